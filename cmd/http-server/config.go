@@ -0,0 +1,90 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+)
+
+type config struct {
+	storage         string
+	postgresURL     string
+	sqlitePath      string
+	migrateOnStart  bool
+	cursorSecret    string
+	addr            string
+	readTimeout     time.Duration
+	writeTimeout    time.Duration
+	idleTimeout     time.Duration
+	shutdownDelay   time.Duration
+	shutdownTimeout time.Duration
+	// tombstoneRetention is how long deleted supplements are kept before
+	// the purge command removes them.
+	tombstoneRetention time.Duration
+}
+
+// loadConfig reads the server configuration from the environment. Durations
+// use time.ParseDuration syntax, e.g. SHUTDOWN_TIMEOUT=25s.
+func loadConfig(getenv func(string) string) (config, error) {
+	c := config{
+		storage:      getenv("STORAGE"),
+		postgresURL:  getenv("POSTGRES_URL"),
+		sqlitePath:   getenv("SQLITE_PATH"),
+		cursorSecret: getenv("CURSOR_SECRET"),
+		addr:         getenv("HTTP_ADDR"),
+	}
+
+	switch c.storage {
+	case "":
+		c.storage = "postgres"
+	case "postgres", "sqlite", "memory":
+	default:
+		return config{}, fmt.Errorf("STORAGE %q is invalid, it must be postgres, sqlite or memory", c.storage)
+	}
+
+	if v := getenv("MIGRATE_ON_START"); v != "" {
+		migrateOnStart, err := strconv.ParseBool(v)
+		if err != nil {
+			return config{}, fmt.Errorf("MIGRATE_ON_START %q is invalid, it must be true or false", v)
+		}
+		c.migrateOnStart = migrateOnStart
+	}
+
+	if c.sqlitePath == "" {
+		c.sqlitePath = "supplementapp.db"
+	}
+
+	if c.addr == "" {
+		c.addr = ":8080"
+	}
+
+	durations := []struct {
+		key          string
+		target       *time.Duration
+		defaultValue time.Duration
+		allowZero    bool
+	}{
+		{"HTTP_READ_TIMEOUT", &c.readTimeout, 5 * time.Second, false},
+		{"HTTP_WRITE_TIMEOUT", &c.writeTimeout, 10 * time.Second, false},
+		{"HTTP_IDLE_TIMEOUT", &c.idleTimeout, 120 * time.Second, false},
+		{"SHUTDOWN_DELAY", &c.shutdownDelay, 5 * time.Second, true},
+		{"SHUTDOWN_TIMEOUT", &c.shutdownTimeout, 20 * time.Second, false},
+		{"TOMBSTONE_RETENTION", &c.tombstoneRetention, 30 * 24 * time.Hour, true},
+	}
+
+	for _, d := range durations {
+		v := getenv(d.key)
+		if v == "" {
+			*d.target = d.defaultValue
+			continue
+		}
+
+		parsed, err := time.ParseDuration(v)
+		if err != nil || parsed < 0 || parsed == 0 && !d.allowZero {
+			return config{}, fmt.Errorf("%s %q is invalid, it must be a positive duration", d.key, v)
+		}
+		*d.target = parsed
+	}
+
+	return c, nil
+}
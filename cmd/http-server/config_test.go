@@ -0,0 +1,111 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestLoadConfig(t *testing.T) {
+	t.Parallel()
+	defaults := config{
+		storage:            "postgres",
+		sqlitePath:         "supplementapp.db",
+		addr:               ":8080",
+		readTimeout:        5 * time.Second,
+		writeTimeout:       10 * time.Second,
+		idleTimeout:        120 * time.Second,
+		shutdownDelay:      5 * time.Second,
+		shutdownTimeout:    20 * time.Second,
+		tombstoneRetention: 30 * 24 * time.Hour,
+	}
+	tests := []struct {
+		name    string
+		env     map[string]string
+		want    func(c *config)
+		wantErr string
+	}{
+		{name: "defaults", env: map[string]string{}, want: func(c *config) {}},
+		{
+			name: "set",
+			env: map[string]string{
+				"STORAGE":            "sqlite",
+				"SQLITE_PATH":        "/data/supplements.db",
+				"MIGRATE_ON_START":   "true",
+				"CURSOR_SECRET":      "secret",
+				"HTTP_ADDR":          ":9090",
+				"HTTP_WRITE_TIMEOUT": "1m30s",
+				"SHUTDOWN_TIMEOUT":   "25s",
+			},
+			want: func(c *config) {
+				c.storage = "sqlite"
+				c.sqlitePath = "/data/supplements.db"
+				c.migrateOnStart = true
+				c.cursorSecret = "secret"
+				c.addr = ":9090"
+				c.writeTimeout = 90 * time.Second
+				c.shutdownTimeout = 25 * time.Second
+			},
+		},
+		{
+			name: "zero where allowed",
+			env:  map[string]string{"SHUTDOWN_DELAY": "0s", "TOMBSTONE_RETENTION": "0"},
+			want: func(c *config) {
+				c.shutdownDelay = 0
+				c.tombstoneRetention = 0
+			},
+		},
+		{
+			name:    "zero timeout",
+			env:     map[string]string{"HTTP_READ_TIMEOUT": "0s"},
+			wantErr: `HTTP_READ_TIMEOUT "0s" is invalid, it must be a positive duration`,
+		},
+		{
+			name:    "negative duration",
+			env:     map[string]string{"SHUTDOWN_DELAY": "-1s"},
+			wantErr: `SHUTDOWN_DELAY "-1s" is invalid, it must be a positive duration`,
+		},
+		{
+			name:    "invalid duration",
+			env:     map[string]string{"HTTP_IDLE_TIMEOUT": "ten seconds"},
+			wantErr: `HTTP_IDLE_TIMEOUT "ten seconds" is invalid, it must be a positive duration`,
+		},
+		{
+			name:    "duration without unit",
+			env:     map[string]string{"SHUTDOWN_TIMEOUT": "20"},
+			wantErr: `SHUTDOWN_TIMEOUT "20" is invalid, it must be a positive duration`,
+		},
+		{
+			name:    "invalid storage",
+			env:     map[string]string{"STORAGE": "mysql"},
+			wantErr: `STORAGE "mysql" is invalid, it must be postgres, sqlite or memory`,
+		},
+		{
+			name:    "invalid migrate on start",
+			env:     map[string]string{"MIGRATE_ON_START": "yes"},
+			wantErr: `MIGRATE_ON_START "yes" is invalid, it must be true or false`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			got, err := loadConfig(func(key string) string { return tt.env[key] })
+
+			if tt.wantErr != "" {
+				if err == nil || err.Error() != tt.wantErr {
+					t.Fatalf("loadConfig() error = %v, wantErr %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("loadConfig() error = %v, want nil", err)
+			}
+			want := defaults
+			tt.want(&want)
+			if diff := cmp.Diff(got, want, cmp.AllowUnexported(config{})); diff != "" {
+				t.Errorf("loadConfig() (-got +want):\n%s", diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"context"
+	"io"
+)
+
+// Storage lets the tests of package main_test open the storage an
+// environment selects and prepare its schema as the server does on start.
+type Storage struct {
+	store  storage
+	config config
+}
+
+func OpenStorage(ctx context.Context, env map[string]string) (Storage, error) {
+	config, err := loadConfig(func(key string) string { return env[key] })
+	if err != nil {
+		return Storage{}, err
+	}
+
+	store, err := openStorage(ctx, config)
+	if err != nil {
+		return Storage{}, err
+	}
+	return Storage{store: store, config: config}, nil
+}
+
+func (s Storage) PrepareSchema(ctx context.Context) error {
+	return prepareSchema(ctx, s.store, s.config.migrateOnStart)
+}
+
+func (s Storage) Migrate(ctx context.Context, w io.Writer, args ...string) error {
+	return migrate(ctx, s.store, args, w)
+}
+
+func (s Storage) Readiness() *Readiness {
+	return NewReadiness(s.store.checks()...)
+}
+
+func (s Storage) Close() {
+	s.store.close()
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const checkTimeout = 2 * time.Second
+
+type Check struct {
+	Name string
+	Run  func(ctx context.Context) error
+}
+
+type CheckStatus struct {
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+type ReadinessReport struct {
+	Status string                 `json:"status"`
+	Checks map[string]CheckStatus `json:"checks"`
+}
+
+// Readiness runs the dependency checks behind /readyz. Once ShutDown is called
+// it reports not ready without running them, so load balancers stop routing
+// new traffic while in-flight requests drain.
+type Readiness struct {
+	checks       []Check
+	shuttingDown atomic.Bool
+}
+
+func NewReadiness(checks ...Check) *Readiness {
+	return &Readiness{checks: checks}
+}
+
+func (r *Readiness) ShutDown() {
+	r.shuttingDown.Store(true)
+}
+
+func (r *Readiness) Report(ctx context.Context) ReadinessReport {
+	report := ReadinessReport{Status: "ready", Checks: make(map[string]CheckStatus, len(r.checks))}
+
+	if r.shuttingDown.Load() {
+		report.Status = "shutting down"
+		return report
+	}
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for _, check := range r.checks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			ctx, cancel := context.WithTimeout(ctx, checkTimeout)
+			defer cancel()
+
+			status := CheckStatus{Status: "up"}
+			if err := check.Run(ctx); err != nil {
+				status = CheckStatus{Status: "down", Error: err.Error()}
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			report.Checks[check.Name] = status
+			if status.Status != "up" {
+				report.Status = "not ready"
+			}
+		}()
+	}
+	wg.Wait()
+
+	return report
+}
+
+func (r ReadinessReport) Ready() bool {
+	return r.Status == "ready"
+}
+
+func livenessHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		_ = json.NewEncoder(w).Encode(map[string]string{"status": "alive"})
+	}
+}
+
+func readinessHandler(readiness *Readiness) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		report := readiness.Report(r.Context())
+
+		code := http.StatusOK
+		if !report.Ready() {
+			code = http.StatusServiceUnavailable
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-store")
+		w.WriteHeader(code)
+		_ = json.NewEncoder(w).Encode(report)
+	}
+}
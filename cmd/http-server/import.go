@@ -0,0 +1,94 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"text/tabwriter"
+
+	"github.com/marioromandono/supplementapp/internal/supplement"
+)
+
+const importUsage = "usage: supplementapp import [-format csv|ndjson] [-map EAN=gtin,...] [-policy all-or-nothing|best-effort] [-skip-existing] [-dry-run] file"
+
+// importSupplements runs the import command, which imports the supplements
+// of a CSV or NDJSON file, or of stdin when the file is "-", and prints what
+// was done with each record.
+func importSupplements(ctx context.Context, service *supplement.SupplementService, args []string, w io.Writer) error {
+	flags := flag.NewFlagSet("import", flag.ContinueOnError)
+	flags.SetOutput(io.Discard)
+	format := flags.String("format", "", "csv or ndjson, by default taken from the file extension")
+	mapping := flags.String("map", "", "CSV columns to rename, such as EAN=gtin,Product=name")
+	policy := flags.String("policy", string(supplement.AllOrNothing), "all-or-nothing or best-effort")
+	var options supplement.ImportOptions
+	flags.BoolVar(&options.SkipExisting, "skip-existing", false, "leave stored supplements alone")
+	flags.BoolVar(&options.DryRun, "dry-run", false, "report what the import would do without storing anything")
+
+	if err := flags.Parse(args); err != nil || flags.NArg() != 1 {
+		return errors.New(importUsage)
+	}
+
+	options.Policy = supplement.ImportPolicy(*policy)
+	if *mapping != "" {
+		parsed, err := supplement.ParseMapping(*mapping)
+		if err != nil {
+			return err
+		}
+		options.Mapping = parsed
+	}
+
+	path := flags.Arg(0)
+	if *format == "" {
+		switch filepath.Ext(path) {
+		case ".csv":
+			*format = string(supplement.ImportCSV)
+		case ".ndjson", ".jsonl":
+			*format = string(supplement.ImportNDJSON)
+		default:
+			return fmt.Errorf("format of %q is unknown, pass -format, %s", path, importUsage)
+		}
+	}
+
+	var r io.Reader = os.Stdin
+	if path != "-" {
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		r = f
+	}
+
+	records, err := supplement.ReadImport(r, supplement.ImportFormat(*format), options.Mapping)
+	if err != nil {
+		return err
+	}
+
+	report, err := service.Import(ctx, records, options)
+	if err != nil {
+		return err
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "LINE\tGTIN\tSTATUS\tREASON")
+	for _, result := range report.Results {
+		fmt.Fprintf(tw, "%d\t%s\t%s\t%s\n", result.Line, result.Gtin, result.Status, result.Reason)
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(w, "%d created, %d updated, %d skipped, %d invalid\n", report.Created, report.Updated, report.Skipped, report.Invalid)
+
+	switch {
+	case report.DryRun:
+		fmt.Fprintln(w, "dry run, nothing was stored")
+	case !report.Committed:
+		return fmt.Errorf("%w: nothing was stored, as %d records are invalid", supplement.ErrInvalidImport, report.Invalid)
+	}
+	return nil
+}
@@ -2,45 +2,140 @@ package main
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"log"
+	"net"
 	"net/http"
 	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
 	"github.com/marioromandono/supplementapp/internal/supplement"
-	"github.com/marioromandono/supplementapp/internal/supplement/persistence/postgres"
-
-	"github.com/jackc/pgx/v5/pgxpool"
 )
 
 func main() {
-	// TODO: This code is not ready for production as it misses graceful shutdown, closing database connections...
-	service := createSupplementService()
-	server := NewServer(service)
-	log.Fatal(http.ListenAndServe(":8080", server))
+	if err := run(context.Background(), os.Args[1:]); err != nil {
+		log.Fatal(err)
+	}
 }
 
-func createSupplementService() *supplement.SupplementService {
-	repo := createPostgresSupplementRepository()
-	service := supplement.NewSupplementService(repo)
+// run starts the server or, when args are "migrate <command>", "purge" or
+// "import", migrates the database, purges deleted supplements or imports a
+// file and exits.
+func run(ctx context.Context, args []string) error {
+	ctx, stop := signal.NotifyContext(ctx, syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
 
-	return service
-}
+	config, err := loadConfig(os.Getenv)
+	if err != nil {
+		return err
+	}
+
+	store, err := openStorage(ctx, config)
+	if err != nil {
+		return err
+	}
+	defer store.close()
+
+	if len(args) > 0 && args[0] == "migrate" {
+		return migrate(ctx, store, args[1:], os.Stdout)
+	}
+
+	if len(args) > 0 && args[0] == "purge" {
+		return purge(ctx, createSupplementService(store.repository, config), config.tombstoneRetention, args[1:], os.Stdout)
+	}
+
+	if len(args) > 0 && args[0] == "import" {
+		return importSupplements(ctx, createSupplementService(store.repository, config), args[1:], os.Stdout)
+	}
+
+	if len(args) > 0 {
+		return fmt.Errorf("unknown command %q, %s, %s or %s", args[0], migrateUsage, purgeUsage, importUsage)
+	}
+
+	// Instances must sign cursors with the same key to accept each other's,
+	// so only the memory storage, which no two instances share, can do
+	// without one.
+	if config.cursorSecret == "" && config.storage != "memory" {
+		return fmt.Errorf("CURSOR_SECRET must be set when STORAGE is %s", config.storage)
+	}
 
-func createPostgresSupplementRepository() *postgres.PostgresSupplementRepository {
-	db, err := pgxpool.New(context.Background(), os.Getenv("POSTGRES_URL"))
+	if err := prepareSchema(ctx, store, config.migrateOnStart); err != nil {
+		return err
+	}
+
+	readiness := NewReadiness(store.checks()...)
+
+	server := &http.Server{
+		Addr:         config.addr,
+		Handler:      NewServer(createSupplementService(store.repository, config), readiness),
+		ReadTimeout:  config.readTimeout,
+		WriteTimeout: config.writeTimeout,
+		IdleTimeout:  config.idleTimeout,
+	}
+
+	listener, err := net.Listen("tcp", server.Addr)
 	if err != nil {
-		log.Fatalf("could not create postgres pool: %v", err)
+		return err
+	}
+
+	// Once the first signal is received, a second one terminates the process
+	// right away.
+	context.AfterFunc(ctx, stop)
+
+	return serve(ctx, server, listener, readiness, config)
+}
+
+// serve serves on listener until ctx is done, then fails readiness, waits
+// the shutdown delay and shuts the server down, letting in-flight requests
+// finish within the shutdown timeout.
+func serve(ctx context.Context, server *http.Server, listener net.Listener, readiness *Readiness, config config) error {
+	serverErr := make(chan error, 1)
+	go func() {
+		log.Printf("listening on %s", listener.Addr())
+		if err := server.Serve(listener); !errors.Is(err, http.ErrServerClosed) {
+			serverErr <- err
+		}
+		close(serverErr)
+	}()
+
+	select {
+	case err := <-serverErr:
+		return err
+	case <-ctx.Done():
 	}
 
-	if err = db.Ping(context.Background()); err != nil {
-		log.Fatalf("could not connect to postgres: %v", err)
+	// Keep serving while load balancers notice /readyz failing, so no new
+	// request hits a closed listener.
+	readiness.ShutDown()
+	log.Printf("shutting down in %s", config.shutdownDelay)
+	time.Sleep(config.shutdownDelay)
+
+	log.Printf("shutting down, waiting up to %s for in-flight requests", config.shutdownTimeout)
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), config.shutdownTimeout)
+	defer cancel()
+
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		return fmt.Errorf("could not shut down gracefully: %w", err)
+	}
+
+	return nil
+}
+
+func createSupplementService(repo supplement.SupplementRepository, config config) *supplement.SupplementService {
+	var options []supplement.Option
+	if config.cursorSecret != "" {
+		options = append(options, supplement.WithCursorKey([]byte(config.cursorSecret)))
 	}
 
-	return postgres.NewSupplementRepository(db)
+	return supplement.NewSupplementService(repo, options...)
 }
 
-func NewServer(service *supplement.SupplementService) http.Handler {
+func NewServer(service *supplement.SupplementService, readiness *Readiness) http.Handler {
 	mux := http.NewServeMux()
-	addRoutes(mux, service)
-	return mux
+	addRoutes(mux, service, readiness)
+	return withActor(mux)
 }
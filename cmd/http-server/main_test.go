@@ -9,13 +9,20 @@ import (
 	"log"
 	"net/http"
 	"net/http/httptest"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
 	"github.com/marioromandono/supplementapp/cmd/http-server"
+	"github.com/marioromandono/supplementapp/internal/problem"
 	"github.com/marioromandono/supplementapp/internal/supplement"
+	"github.com/marioromandono/supplementapp/internal/supplement/persistence/memory"
 	"github.com/marioromandono/supplementapp/internal/supplement/persistence/postgres"
+	"github.com/marioromandono/supplementapp/internal/supplement/persistence/repotest"
+	"github.com/marioromandono/supplementapp/migrations"
 
+	"github.com/google/go-cmp/cmp"
 	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/testcontainers/testcontainers-go"
 	tcpostgres "github.com/testcontainers/testcontainers-go/modules/postgres"
@@ -57,33 +64,17 @@ func TestMain(m *testing.M) {
 		log.Panic(err)
 	}
 
-	_, _, err = container.Exec(ctx, []string{
-		"psql", "-U", dbUser, "-d", dbName, "-c",
-		"CREATE TABLE " + tableName + " ( " +
-			"id INT GENERATED ALWAYS AS IDENTITY PRIMARY KEY, " +
-			"gtin VARCHAR UNIQUE, " +
-			"name VARCHAR, " +
-			"brand VARCHAR, " +
-			"flavor VARCHAR, " +
-			"carbohydrates REAL, " +
-			"electrolytes REAL, " +
-			"maltodextrose REAL, " +
-			"fructose REAL, " +
-			"caffeine REAL, " +
-			"sodium REAL, " +
-			"protein REAL " +
-			")",
-	})
+	dbUrl, err = container.ConnectionString(ctx)
 	if err != nil {
 		log.Panic(err)
 	}
 
-	err = container.Snapshot(ctx, tcpostgres.WithSnapshotName("test-snapshot"))
+	err = repotest.MigratePostgres(ctx, dbUrl)
 	if err != nil {
 		log.Panic(err)
 	}
 
-	dbUrl, err = container.ConnectionString(ctx)
+	err = container.Snapshot(ctx, tcpostgres.WithSnapshotName("test-snapshot"))
 	if err != nil {
 		log.Panic(err)
 	}
@@ -106,15 +97,19 @@ func TestGetSupplement(t *testing.T) {
 		})
 
 		dbPool := getPool(t, ctx)
-		server := main.NewServer(supplement.NewSupplementService(postgres.NewSupplementRepository(dbPool)))
+		server := main.NewServer(supplement.NewSupplementService(postgres.NewSupplementRepository(dbPool)), main.NewReadiness())
 
 		gtin := "123"
 		request := httptest.NewRequest("GET", "/supplement/"+gtin, nil)
 		response := httptest.NewRecorder()
 		wantCode := http.StatusNotFound
-		wantBodyJSON, _ := json.Marshal(&main.ErrorResponseBody{
-			Code:    wantCode,
-			Message: fmt.Sprintf("%s: %s", gtin, supplement.ErrNotFound),
+		wantBodyJSON, _ := json.Marshal(&problem.Details{
+			Type:     problem.TypeNotFound,
+			Title:    "Supplement not found",
+			Status:   wantCode,
+			Detail:   fmt.Sprintf("%s: %s", gtin, supplement.ErrNotFound),
+			Instance: request.URL.Path,
+			Gtin:     gtin,
 		})
 		wantBody := string(wantBodyJSON) + "\n"
 
@@ -122,6 +117,7 @@ func TestGetSupplement(t *testing.T) {
 
 		assertStatus(t, response.Code, wantCode)
 		assertResponseBody(t, response.Body.String(), wantBody)
+		assertHeader(t, response.Header(), "Content-Type", problem.ContentType)
 	})
 
 	t.Run("existing", func(t *testing.T) {
@@ -133,27 +129,60 @@ func TestGetSupplement(t *testing.T) {
 			}
 		})
 		dbPool := getPool(t, ctx)
-		server := main.NewServer(supplement.NewSupplementService(postgres.NewSupplementRepository(dbPool)))
+		server := main.NewServer(supplement.NewSupplementService(postgres.NewSupplementRepository(dbPool)), main.NewReadiness())
 
 		want := supplement.Supplement{
-			Gtin:          "1234567890123",
+			Gtin:          "01234567890128",
 			Name:          "Test",
 			Brand:         "Test",
 			Flavor:        "Test",
-			Carbohydrates: 1.0,
-			Electrolytes:  1.0,
-			Maltodextrose: 1.0,
-			Fructose:      1.0,
-			Caffeine:      1.0,
-			Sodium:        1.0,
-			Protein:       1.0,
+			Carbohydrates: supplement.Grams(1.0),
+			Electrolytes:  supplement.Milligrams(1.0),
+			Maltodextrose: supplement.Grams(1.0),
+			Fructose:      supplement.Grams(1.0),
+			Caffeine:      supplement.Milligrams(1.0),
+			Sodium:        supplement.Milligrams(1.0),
+			Protein:       supplement.Grams(1.0),
+			Version:       3,
 		}
 		insertSupplement(t, ctx, dbPool, want)
 
 		request := httptest.NewRequest("GET", "/supplement/"+want.Gtin, nil)
 		response := httptest.NewRecorder()
 		wantCode := http.StatusOK
-		wantBodyJSON, _ := json.Marshal(want)
+		wantBodyJSON, _ := json.Marshal(repotest.InUnits(want).Per(supplement.PerServing))
+		wantBody := string(wantBodyJSON) + "\n"
+
+		server.ServeHTTP(response, request)
+
+		assertStatus(t, response.Code, wantCode)
+		assertResponseBody(t, response.Body.String(), wantBody)
+		assertHeader(t, response.Header(), "ETag", `"3"`)
+	})
+
+	t.Run("existing by ean-13", func(t *testing.T) {
+		ctx := context.Background()
+		t.Cleanup(func() {
+			err := container.Restore(ctx)
+			if err != nil {
+				t.Fatal(err)
+			}
+		})
+		dbPool := getPool(t, ctx)
+		server := main.NewServer(supplement.NewSupplementService(postgres.NewSupplementRepository(dbPool)), main.NewReadiness())
+
+		want := supplement.Supplement{
+			Gtin:   "04006381333931",
+			Name:   "Test",
+			Brand:  "Test",
+			Flavor: "Test",
+		}
+		insertSupplement(t, ctx, dbPool, want)
+
+		request := httptest.NewRequest("GET", "/supplement/4006381333931", nil)
+		response := httptest.NewRecorder()
+		wantCode := http.StatusOK
+		wantBodyJSON, _ := json.Marshal(repotest.InUnits(want).Per(supplement.PerServing))
 		wantBody := string(wantBodyJSON) + "\n"
 
 		server.ServeHTTP(response, request)
@@ -161,6 +190,47 @@ func TestGetSupplement(t *testing.T) {
 		assertStatus(t, response.Code, wantCode)
 		assertResponseBody(t, response.Body.String(), wantBody)
 	})
+
+	t.Run("per 100 g", func(t *testing.T) {
+		ctx := context.Background()
+		t.Cleanup(func() {
+			err := container.Restore(ctx)
+			if err != nil {
+				t.Fatal(err)
+			}
+		})
+		dbPool := getPool(t, ctx)
+		server := main.NewServer(supplement.NewSupplementService(postgres.NewSupplementRepository(dbPool)), main.NewReadiness())
+
+		s := supplement.Supplement{
+			Gtin:          "01234567890128",
+			Name:          "Test",
+			Brand:         "Test",
+			Flavor:        "Test",
+			Serving:       &supplement.Serving{Size: supplement.Grams(40), ServingsPerPackage: 24},
+			Carbohydrates: supplement.Grams(22),
+			Sodium:        supplement.Grams(0.05),
+		}
+		body, _ := json.Marshal(s)
+		request := httptest.NewRequest("POST", "/supplement", bytes.NewBuffer(body))
+		response := httptest.NewRecorder()
+
+		server.ServeHTTP(response, request)
+
+		assertStatus(t, response.Code, http.StatusCreated)
+
+		request = httptest.NewRequest("GET", "/supplement/"+s.Gtin+"?basis=100g", nil)
+		response = httptest.NewRecorder()
+		s.Carbohydrates = supplement.Grams(55)
+		s.Sodium = supplement.Milligrams(125)
+		wantBodyJSON, _ := json.Marshal(supplement.View{Supplement: repotest.InUnits(s), Basis: supplement.Per100g})
+		wantBody := string(wantBodyJSON) + "\n"
+
+		server.ServeHTTP(response, request)
+
+		assertStatus(t, response.Code, http.StatusOK)
+		assertResponseBody(t, response.Body.String(), wantBody)
+	})
 }
 
 func TestCreateSupplement(t *testing.T) {
@@ -177,14 +247,17 @@ func TestCreateSupplement(t *testing.T) {
 			}
 		})
 		dbPool := getPool(t, ctx)
-		server := main.NewServer(supplement.NewSupplementService(postgres.NewSupplementRepository(dbPool)))
+		server := main.NewServer(supplement.NewSupplementService(postgres.NewSupplementRepository(dbPool)), main.NewReadiness())
 
 		request := httptest.NewRequest("POST", "/supplement", nil)
 		response := httptest.NewRecorder()
 		wantCode := http.StatusBadRequest
-		wantBodyJSON, _ := json.Marshal(&main.ErrorResponseBody{
-			Code:    wantCode,
-			Message: io.EOF.Error(),
+		wantBodyJSON, _ := json.Marshal(&problem.Details{
+			Type:     problem.TypeMalformedBody,
+			Title:    "Malformed request body",
+			Status:   wantCode,
+			Detail:   io.EOF.Error(),
+			Instance: request.URL.Path,
 		})
 		wantBody := string(wantBodyJSON) + "\n"
 
@@ -203,17 +276,20 @@ func TestCreateSupplement(t *testing.T) {
 			}
 		})
 		dbPool := getPool(t, ctx)
-		server := main.NewServer(supplement.NewSupplementService(postgres.NewSupplementRepository(dbPool)))
+		server := main.NewServer(supplement.NewSupplementService(postgres.NewSupplementRepository(dbPool)), main.NewReadiness())
 
-		body := []byte(`{"gtin": "1234567890123"]`)
+		body := []byte(`{"gtin": "01234567890128"]`)
 		request := httptest.NewRequest("POST", "/supplement", bytes.NewBuffer(body))
 		response := httptest.NewRecorder()
 
 		err := json.Unmarshal(body, &supplement.Supplement{})
 		wantCode := http.StatusBadRequest
-		wantBodyJSON, _ := json.Marshal(&main.ErrorResponseBody{
-			Code:    wantCode,
-			Message: err.Error(),
+		wantBodyJSON, _ := json.Marshal(&problem.Details{
+			Type:     problem.TypeMalformedBody,
+			Title:    "Malformed request body",
+			Status:   wantCode,
+			Detail:   err.Error(),
+			Instance: request.URL.Path,
 		})
 		wantBody := string(wantBodyJSON) + "\n"
 
@@ -232,22 +308,31 @@ func TestCreateSupplement(t *testing.T) {
 			}
 		})
 		dbPool := getPool(t, ctx)
-		server := main.NewServer(supplement.NewSupplementService(postgres.NewSupplementRepository(dbPool)))
+		server := main.NewServer(supplement.NewSupplementService(postgres.NewSupplementRepository(dbPool)), main.NewReadiness())
 
 		s := &supplement.Supplement{
-			Gtin:          "1234567890123",
+			Gtin:          "01234567890128",
 			Name:          "name",
 			Brand:         "brand",
 			Flavor:        "flavor",
-			Carbohydrates: -1.0,
+			Carbohydrates: supplement.Grams(-1.0),
 		}
 		body, _ := json.Marshal(s)
 		request := httptest.NewRequest("POST", "/supplement", bytes.NewBuffer(body))
 		response := httptest.NewRecorder()
 		wantCode := http.StatusBadRequest
-		wantBodyJSON, _ := json.Marshal(&main.ErrorResponseBody{
-			Code:    wantCode,
-			Message: fmt.Sprintf("%s: carbohydrates %f is invalid, it must be greater or equal to zero", supplement.ErrInvalidSupplement, s.Carbohydrates),
+		wantBodyJSON, _ := json.Marshal(&problem.Details{
+			Type:     problem.TypeInvalidSupplement,
+			Title:    "Invalid supplement",
+			Status:   wantCode,
+			Detail:   fmt.Sprintf("%s: carbohydrates %f is invalid, it must be greater or equal to zero", supplement.ErrInvalidSupplement, s.Carbohydrates.Amount),
+			Instance: request.URL.Path,
+			Errors: []supplement.Violation{{
+				Field:   "carbohydrates",
+				Rule:    supplement.RuleMin,
+				Value:   s.Carbohydrates.Amount,
+				Message: fmt.Sprintf("carbohydrates %f is invalid, it must be greater or equal to zero", s.Carbohydrates.Amount),
+			}},
 		})
 		wantBody := string(wantBodyJSON) + "\n"
 
@@ -266,20 +351,20 @@ func TestCreateSupplement(t *testing.T) {
 			}
 		})
 		dbPool := getPool(t, ctx)
-		server := main.NewServer(supplement.NewSupplementService(postgres.NewSupplementRepository(dbPool)))
+		server := main.NewServer(supplement.NewSupplementService(postgres.NewSupplementRepository(dbPool)), main.NewReadiness())
 
 		s := supplement.Supplement{
-			Gtin:          "1234567890123",
+			Gtin:          "01234567890128",
 			Name:          "Test",
 			Brand:         "Test",
 			Flavor:        "Test",
-			Carbohydrates: 1.0,
-			Electrolytes:  1.0,
-			Maltodextrose: 1.0,
-			Fructose:      1.0,
-			Caffeine:      1.0,
-			Sodium:        1.0,
-			Protein:       1.0,
+			Carbohydrates: supplement.Grams(1.0),
+			Electrolytes:  supplement.Milligrams(1.0),
+			Maltodextrose: supplement.Grams(1.0),
+			Fructose:      supplement.Grams(1.0),
+			Caffeine:      supplement.Milligrams(1.0),
+			Sodium:        supplement.Milligrams(1.0),
+			Protein:       supplement.Grams(1.0),
 		}
 		insertSupplement(t, ctx, dbPool, s)
 
@@ -287,9 +372,13 @@ func TestCreateSupplement(t *testing.T) {
 		request := httptest.NewRequest("POST", "/supplement", bytes.NewBuffer(body))
 		response := httptest.NewRecorder()
 		wantCode := http.StatusConflict
-		wantBodyJSON, _ := json.Marshal(&main.ErrorResponseBody{
-			Code:    wantCode,
-			Message: fmt.Sprintf("%s: %s", s.Gtin, supplement.ErrAlreadyExists),
+		wantBodyJSON, _ := json.Marshal(&problem.Details{
+			Type:     problem.TypeAlreadyExists,
+			Title:    "Supplement already exists",
+			Status:   wantCode,
+			Detail:   fmt.Sprintf("%s: %s", s.Gtin, supplement.ErrAlreadyExists),
+			Instance: request.URL.Path,
+			Gtin:     s.Gtin,
 		})
 		wantBody := string(wantBodyJSON) + "\n"
 
@@ -308,20 +397,20 @@ func TestCreateSupplement(t *testing.T) {
 			}
 		})
 		dbPool := getPool(t, ctx)
-		server := main.NewServer(supplement.NewSupplementService(postgres.NewSupplementRepository(dbPool)))
+		server := main.NewServer(supplement.NewSupplementService(postgres.NewSupplementRepository(dbPool)), main.NewReadiness())
 
 		s := &supplement.Supplement{
-			Gtin:          "1234567890123",
+			Gtin:          "01234567890128",
 			Name:          "Test",
 			Brand:         "Test",
 			Flavor:        "Test",
-			Carbohydrates: 1.0,
-			Electrolytes:  1.0,
-			Maltodextrose: 1.0,
-			Fructose:      1.0,
-			Caffeine:      1.0,
-			Sodium:        1.0,
-			Protein:       1.0,
+			Carbohydrates: supplement.Grams(1.0),
+			Electrolytes:  supplement.Milligrams(1.0),
+			Maltodextrose: supplement.Grams(1.0),
+			Fructose:      supplement.Grams(1.0),
+			Caffeine:      supplement.Milligrams(1.0),
+			Sodium:        supplement.Milligrams(1.0),
+			Protein:       supplement.Grams(1.0),
 		}
 		body, _ := json.Marshal(s)
 		request := httptest.NewRequest("POST", "/supplement", bytes.NewBuffer(body))
@@ -334,6 +423,49 @@ func TestCreateSupplement(t *testing.T) {
 		assertResponseBody(t, response.Body.String(), "")
 		assertHeader(t, response.Header(), "Location", "/supplement/"+s.Gtin)
 	})
+
+	t.Run("created concurrently", func(t *testing.T) {
+		ctx := context.Background()
+		t.Cleanup(func() {
+			err := container.Restore(ctx)
+			if err != nil {
+				t.Fatal(err)
+			}
+		})
+		dbPool := getPool(t, ctx)
+		server := main.NewServer(supplement.NewSupplementService(postgres.NewSupplementRepository(dbPool)), main.NewReadiness())
+
+		const clients = 8
+		codes := make(chan int, clients)
+		var wg sync.WaitGroup
+		for range clients {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				body := `{"gtin": "01234567890128", "name": "Test", "brand": "Test", "flavor": "Test"}`
+				request := httptest.NewRequest("POST", "/supplement", bytes.NewBufferString(body))
+				response := httptest.NewRecorder()
+				server.ServeHTTP(response, request)
+				codes <- response.Code
+			}()
+		}
+		wg.Wait()
+		close(codes)
+
+		created := 0
+		for code := range codes {
+			switch code {
+			case http.StatusCreated:
+				created++
+			case http.StatusConflict:
+			default:
+				t.Errorf("incorrect status, got %d, want %d or %d", code, http.StatusCreated, http.StatusConflict)
+			}
+		}
+		if created != 1 {
+			t.Errorf("%d concurrent creates of the same GTIN succeeded, want 1", created)
+		}
+	})
 }
 
 func TestUpdateSupplement(t *testing.T) {
@@ -350,15 +482,18 @@ func TestUpdateSupplement(t *testing.T) {
 			}
 		})
 		dbPool := getPool(t, ctx)
-		server := main.NewServer(supplement.NewSupplementService(postgres.NewSupplementRepository(dbPool)))
+		server := main.NewServer(supplement.NewSupplementService(postgres.NewSupplementRepository(dbPool)), main.NewReadiness())
 
 		gtin := "123"
-		request := httptest.NewRequest("PUT", "/supplement/"+gtin, nil)
+		request := httptest.NewRequest("PATCH", "/supplement/"+gtin, nil)
 		response := httptest.NewRecorder()
 		wantCode := http.StatusBadRequest
-		wantBodyJSON, _ := json.Marshal(&main.ErrorResponseBody{
-			Code:    wantCode,
-			Message: io.EOF.Error(),
+		wantBodyJSON, _ := json.Marshal(&problem.Details{
+			Type:     problem.TypeMalformedBody,
+			Title:    "Malformed request body",
+			Status:   wantCode,
+			Detail:   io.EOF.Error(),
+			Instance: request.URL.Path,
 		})
 		wantBody := string(wantBodyJSON) + "\n"
 
@@ -377,17 +512,20 @@ func TestUpdateSupplement(t *testing.T) {
 			}
 		})
 		dbPool := getPool(t, ctx)
-		server := main.NewServer(supplement.NewSupplementService(postgres.NewSupplementRepository(dbPool)))
+		server := main.NewServer(supplement.NewSupplementService(postgres.NewSupplementRepository(dbPool)), main.NewReadiness())
 
-		body := []byte(`{"gtin": "1234567890123"]`)
-		request := httptest.NewRequest("PUT", "/supplement/1234567890123", bytes.NewBuffer(body))
+		body := []byte(`{"gtin": "01234567890128"]`)
+		request := httptest.NewRequest("PATCH", "/supplement/01234567890128", bytes.NewBuffer(body))
 		response := httptest.NewRecorder()
 
 		err := json.Unmarshal(body, &supplement.Supplement{})
 		wantCode := http.StatusBadRequest
-		wantBodyJSON, _ := json.Marshal(&main.ErrorResponseBody{
-			Code:    wantCode,
-			Message: err.Error(),
+		wantBodyJSON, _ := json.Marshal(&problem.Details{
+			Type:     problem.TypeMalformedBody,
+			Title:    "Malformed request body",
+			Status:   wantCode,
+			Detail:   err.Error(),
+			Instance: request.URL.Path,
 		})
 		wantBody := string(wantBodyJSON) + "\n"
 
@@ -406,19 +544,23 @@ func TestUpdateSupplement(t *testing.T) {
 			}
 		})
 		dbPool := getPool(t, ctx)
-		server := main.NewServer(supplement.NewSupplementService(postgres.NewSupplementRepository(dbPool)))
+		server := main.NewServer(supplement.NewSupplementService(postgres.NewSupplementRepository(dbPool)), main.NewReadiness())
 
 		gtin := "123"
 		body, _ := json.Marshal(&supplement.Supplement{
 			Gtin: gtin,
 			Name: "Test",
 		})
-		request := httptest.NewRequest("PUT", "/supplement/"+gtin, bytes.NewBuffer(body))
+		request := httptest.NewRequest("PATCH", "/supplement/"+gtin, bytes.NewBuffer(body))
 		response := httptest.NewRecorder()
 		wantCode := http.StatusNotFound
-		wantBodyJSON, _ := json.Marshal(&main.ErrorResponseBody{
-			Code:    wantCode,
-			Message: fmt.Sprintf("%s: %s", gtin, supplement.ErrNotFound),
+		wantBodyJSON, _ := json.Marshal(&problem.Details{
+			Type:     problem.TypeNotFound,
+			Title:    "Supplement not found",
+			Status:   wantCode,
+			Detail:   fmt.Sprintf("%s: %s", gtin, supplement.ErrNotFound),
+			Instance: request.URL.Path,
+			Gtin:     gtin,
 		})
 		wantBody := string(wantBodyJSON) + "\n"
 
@@ -437,31 +579,40 @@ func TestUpdateSupplement(t *testing.T) {
 			}
 		})
 		dbPool := getPool(t, ctx)
-		server := main.NewServer(supplement.NewSupplementService(postgres.NewSupplementRepository(dbPool)))
+		server := main.NewServer(supplement.NewSupplementService(postgres.NewSupplementRepository(dbPool)), main.NewReadiness())
 
 		s := supplement.Supplement{
-			Gtin:          "1234567890123",
+			Gtin:          "01234567890128",
 			Name:          "Test",
 			Brand:         "Test",
 			Flavor:        "Test",
-			Carbohydrates: 1.0,
-			Electrolytes:  1.0,
-			Maltodextrose: 1.0,
-			Fructose:      1.0,
-			Caffeine:      1.0,
-			Sodium:        1.0,
-			Protein:       1.0,
+			Carbohydrates: supplement.Grams(1.0),
+			Electrolytes:  supplement.Milligrams(1.0),
+			Maltodextrose: supplement.Grams(1.0),
+			Fructose:      supplement.Grams(1.0),
+			Caffeine:      supplement.Milligrams(1.0),
+			Sodium:        supplement.Milligrams(1.0),
+			Protein:       supplement.Grams(1.0),
 		}
 		insertSupplement(t, ctx, dbPool, s)
 
-		s.Carbohydrates = -1.0
+		s.Carbohydrates = supplement.Grams(-1.0)
 		body, _ := json.Marshal(s)
-		request := httptest.NewRequest("PUT", "/supplement/"+s.Gtin, bytes.NewBuffer(body))
+		request := httptest.NewRequest("PATCH", "/supplement/"+s.Gtin, bytes.NewBuffer(body))
 		response := httptest.NewRecorder()
 		wantCode := http.StatusBadRequest
-		wantBodyJSON, _ := json.Marshal(&main.ErrorResponseBody{
-			Code:    wantCode,
-			Message: fmt.Sprintf("%s: carbohydrates %f is invalid, it must be greater or equal to zero", supplement.ErrInvalidSupplement, s.Carbohydrates),
+		wantBodyJSON, _ := json.Marshal(&problem.Details{
+			Type:     problem.TypeInvalidSupplement,
+			Title:    "Invalid supplement",
+			Status:   wantCode,
+			Detail:   fmt.Sprintf("%s: carbohydrates %f is invalid, it must be greater or equal to zero", supplement.ErrInvalidSupplement, s.Carbohydrates.Amount),
+			Instance: request.URL.Path,
+			Errors: []supplement.Violation{{
+				Field:   "carbohydrates",
+				Rule:    supplement.RuleMin,
+				Value:   s.Carbohydrates.Amount,
+				Message: fmt.Sprintf("carbohydrates %f is invalid, it must be greater or equal to zero", s.Carbohydrates.Amount),
+			}},
 		})
 		wantBody := string(wantBodyJSON) + "\n"
 
@@ -480,26 +631,26 @@ func TestUpdateSupplement(t *testing.T) {
 			}
 		})
 		dbPool := getPool(t, ctx)
-		server := main.NewServer(supplement.NewSupplementService(postgres.NewSupplementRepository(dbPool)))
+		server := main.NewServer(supplement.NewSupplementService(postgres.NewSupplementRepository(dbPool)), main.NewReadiness())
 
 		s := supplement.Supplement{
-			Gtin:          "1234567890123",
+			Gtin:          "01234567890128",
 			Name:          "Test",
 			Brand:         "Test",
 			Flavor:        "Test",
-			Carbohydrates: 1.0,
-			Electrolytes:  1.0,
-			Maltodextrose: 1.0,
-			Fructose:      1.0,
-			Caffeine:      1.0,
-			Sodium:        1.0,
-			Protein:       1.0,
+			Carbohydrates: supplement.Grams(1.0),
+			Electrolytes:  supplement.Milligrams(1.0),
+			Maltodextrose: supplement.Grams(1.0),
+			Fructose:      supplement.Grams(1.0),
+			Caffeine:      supplement.Milligrams(1.0),
+			Sodium:        supplement.Milligrams(1.0),
+			Protein:       supplement.Grams(1.0),
 		}
 		insertSupplement(t, ctx, dbPool, s)
 
 		s.Name = "Updated"
 		body, _ := json.Marshal(s)
-		request := httptest.NewRequest("PUT", "/supplement/"+s.Gtin, bytes.NewBuffer(body))
+		request := httptest.NewRequest("PATCH", "/supplement/"+s.Gtin, bytes.NewBuffer(body))
 		response := httptest.NewRecorder()
 		wantCode := http.StatusOK
 
@@ -508,14 +659,8 @@ func TestUpdateSupplement(t *testing.T) {
 		assertStatus(t, response.Code, wantCode)
 		assertResponseBody(t, response.Body.String(), "")
 	})
-}
-
-func TestDeleteSupplement(t *testing.T) {
-	if testing.Short() {
-		t.Skip("skipping integration test")
-	}
 
-	t.Run("not found", func(t *testing.T) {
+	t.Run("stale etag", func(t *testing.T) {
 		ctx := context.Background()
 		t.Cleanup(func() {
 			err := container.Restore(ctx)
@@ -524,15 +669,28 @@ func TestDeleteSupplement(t *testing.T) {
 			}
 		})
 		dbPool := getPool(t, ctx)
-		server := main.NewServer(supplement.NewSupplementService(postgres.NewSupplementRepository(dbPool)))
+		server := main.NewServer(supplement.NewSupplementService(postgres.NewSupplementRepository(dbPool)), main.NewReadiness())
 
-		gtin := "123"
-		request := httptest.NewRequest("DELETE", "/supplement/"+gtin, nil)
+		s := supplement.Supplement{
+			Gtin:    "01234567890128",
+			Name:    "Test",
+			Brand:   "Test",
+			Flavor:  "Test",
+			Version: 2,
+		}
+		insertSupplement(t, ctx, dbPool, s)
+
+		request := httptest.NewRequest("PATCH", "/supplement/"+s.Gtin, bytes.NewBufferString(`{"name": "Updated"}`))
+		request.Header.Set("If-Match", `"1"`)
 		response := httptest.NewRecorder()
-		wantCode := http.StatusNotFound
-		wantBodyJSON, _ := json.Marshal(&main.ErrorResponseBody{
-			Code:    wantCode,
-			Message: fmt.Sprintf("%s: %s", gtin, supplement.ErrNotFound),
+		wantCode := http.StatusPreconditionFailed
+		wantBodyJSON, _ := json.Marshal(&problem.Details{
+			Type:     problem.TypePreconditionFailed,
+			Title:    "Precondition failed",
+			Status:   wantCode,
+			Detail:   fmt.Sprintf("%s: %s", s.Gtin, supplement.ErrPreconditionFailed),
+			Instance: request.URL.Path,
+			Gtin:     s.Gtin,
 		})
 		wantBody := string(wantBodyJSON) + "\n"
 
@@ -542,7 +700,7 @@ func TestDeleteSupplement(t *testing.T) {
 		assertResponseBody(t, response.Body.String(), wantBody)
 	})
 
-	t.Run("deleted", func(t *testing.T) {
+	t.Run("matching etag", func(t *testing.T) {
 		ctx := context.Background()
 		t.Cleanup(func() {
 			err := container.Restore(ctx)
@@ -551,40 +709,122 @@ func TestDeleteSupplement(t *testing.T) {
 			}
 		})
 		dbPool := getPool(t, ctx)
-		server := main.NewServer(supplement.NewSupplementService(postgres.NewSupplementRepository(dbPool)))
+		server := main.NewServer(supplement.NewSupplementService(postgres.NewSupplementRepository(dbPool)), main.NewReadiness())
 
 		s := supplement.Supplement{
-			Gtin:          "1234567890123",
-			Name:          "Test",
-			Brand:         "Test",
-			Flavor:        "Test",
-			Carbohydrates: 1.0,
-			Electrolytes:  1.0,
-			Maltodextrose: 1.0,
-			Fructose:      1.0,
-			Caffeine:      1.0,
-			Sodium:        1.0,
-			Protein:       1.0,
+			Gtin:    "01234567890128",
+			Name:    "Test",
+			Brand:   "Test",
+			Flavor:  "Test",
+			Version: 2,
 		}
 		insertSupplement(t, ctx, dbPool, s)
 
-		request := httptest.NewRequest("DELETE", "/supplement/"+s.Gtin, nil)
+		request := httptest.NewRequest("PATCH", "/supplement/"+s.Gtin, bytes.NewBufferString(`{"name": "Updated"}`))
+		request.Header.Set("If-Match", `"2"`)
 		response := httptest.NewRecorder()
-		wantCode := http.StatusNoContent
 
 		server.ServeHTTP(response, request)
 
-		assertStatus(t, response.Code, wantCode)
-		assertResponseBody(t, response.Body.String(), "")
+		assertStatus(t, response.Code, http.StatusOK)
+	})
+	t.Run("merge patch", func(t *testing.T) {
+		ctx := context.Background()
+		t.Cleanup(func() {
+			err := container.Restore(ctx)
+			if err != nil {
+				t.Fatal(err)
+			}
+		})
+		dbPool := getPool(t, ctx)
+		server := main.NewServer(supplement.NewSupplementService(postgres.NewSupplementRepository(dbPool)), main.NewReadiness())
+
+		s := supplement.Supplement{
+			Gtin:     "01234567890128",
+			Name:     "Test",
+			Brand:    "Test",
+			Flavor:   "Test",
+			Caffeine: supplement.Milligrams(1.0),
+		}
+		insertSupplement(t, ctx, dbPool, s)
+
+		request := httptest.NewRequest("PATCH", "/supplement/"+s.Gtin, bytes.NewBufferString(`{"name": "Updated", "caffeine": null}`))
+		request.Header.Set("Content-Type", supplement.MergePatchContentType)
+		response := httptest.NewRecorder()
+
+		server.ServeHTTP(response, request)
+
+		assertStatus(t, response.Code, http.StatusOK)
+
+		request = httptest.NewRequest("GET", "/supplement/"+s.Gtin, nil)
+		response = httptest.NewRecorder()
+		wantBodyJSON, _ := json.Marshal(repotest.InUnits(supplement.Supplement{Gtin: s.Gtin, Name: "Updated", Brand: "Test", Flavor: "Test"}).Per(supplement.PerServing))
+		wantBody := string(wantBodyJSON) + "\n"
+
+		server.ServeHTTP(response, request)
+
+		assertResponseBody(t, response.Body.String(), wantBody)
+	})
+
+	t.Run("json patch with failing test", func(t *testing.T) {
+		ctx := context.Background()
+		t.Cleanup(func() {
+			err := container.Restore(ctx)
+			if err != nil {
+				t.Fatal(err)
+			}
+		})
+		dbPool := getPool(t, ctx)
+		server := main.NewServer(supplement.NewSupplementService(postgres.NewSupplementRepository(dbPool)), main.NewReadiness())
+
+		s := supplement.Supplement{
+			Gtin:     "01234567890128",
+			Name:     "Test",
+			Brand:    "Test",
+			Flavor:   "Test",
+			Caffeine: supplement.Milligrams(1.0),
+		}
+		insertSupplement(t, ctx, dbPool, s)
+
+		body := `[{"op": "test", "path": "/caffeine", "value": 2}, {"op": "replace", "path": "/caffeine", "value": 3}]`
+		request := httptest.NewRequest("PATCH", "/supplement/"+s.Gtin, bytes.NewBufferString(body))
+		request.Header.Set("Content-Type", supplement.JSONPatchContentType)
+		response := httptest.NewRecorder()
+
+		server.ServeHTTP(response, request)
+
+		assertStatus(t, response.Code, http.StatusConflict)
+		assertHeader(t, response.Header(), "Content-Type", problem.ContentType)
+	})
+
+	t.Run("unsupported media type", func(t *testing.T) {
+		ctx := context.Background()
+		t.Cleanup(func() {
+			err := container.Restore(ctx)
+			if err != nil {
+				t.Fatal(err)
+			}
+		})
+		dbPool := getPool(t, ctx)
+		server := main.NewServer(supplement.NewSupplementService(postgres.NewSupplementRepository(dbPool)), main.NewReadiness())
+
+		request := httptest.NewRequest("PATCH", "/supplement/01234567890128", bytes.NewBufferString(`name=Updated`))
+		request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		response := httptest.NewRecorder()
+
+		server.ServeHTTP(response, request)
+
+		assertStatus(t, response.Code, http.StatusUnsupportedMediaType)
+		assertHeader(t, response.Header(), "Accept-Patch", "application/json, application/merge-patch+json, application/json-patch+json")
 	})
 }
 
-func TestListAllSupplements(t *testing.T) {
+func TestReplaceSupplement(t *testing.T) {
 	if testing.Short() {
 		t.Skip("skipping integration test")
 	}
 
-	t.Run("empty", func(t *testing.T) {
+	t.Run("created", func(t *testing.T) {
 		ctx := context.Background()
 		t.Cleanup(func() {
 			err := container.Restore(ctx)
@@ -593,21 +833,20 @@ func TestListAllSupplements(t *testing.T) {
 			}
 		})
 		dbPool := getPool(t, ctx)
-		server := main.NewServer(supplement.NewSupplementService(postgres.NewSupplementRepository(dbPool)))
+		server := main.NewServer(supplement.NewSupplementService(postgres.NewSupplementRepository(dbPool)), main.NewReadiness())
 
-		request := httptest.NewRequest("GET", "/supplement", nil)
+		body, _ := json.Marshal(&supplement.Supplement{Name: "Test", Brand: "Test", Flavor: "Test"})
+		request := httptest.NewRequest("PUT", "/supplement/4006381333931", bytes.NewBuffer(body))
 		response := httptest.NewRecorder()
-		wantCode := http.StatusOK
-		wantBodyJSON, _ := json.Marshal([]supplement.Supplement{})
-		wantBody := string(wantBodyJSON) + "\n"
+		wantCode := http.StatusCreated
 
 		server.ServeHTTP(response, request)
 
 		assertStatus(t, response.Code, wantCode)
-		assertResponseBody(t, response.Body.String(), wantBody)
+		assertHeader(t, response.Header(), "Location", "/supplement/04006381333931")
 	})
 
-	t.Run("not empty", func(t *testing.T) {
+	t.Run("replaced", func(t *testing.T) {
 		ctx := context.Background()
 		t.Cleanup(func() {
 			err := container.Restore(ctx)
@@ -616,44 +855,109 @@ func TestListAllSupplements(t *testing.T) {
 			}
 		})
 		dbPool := getPool(t, ctx)
-		server := main.NewServer(supplement.NewSupplementService(postgres.NewSupplementRepository(dbPool)))
+		server := main.NewServer(supplement.NewSupplementService(postgres.NewSupplementRepository(dbPool)), main.NewReadiness())
 
-		want := []supplement.Supplement{
-			{
-				Gtin:          "1234567890123",
-				Name:          "Test",
-				Brand:         "Test",
-				Flavor:        "Test",
-				Carbohydrates: 1.0,
-				Electrolytes:  1.0,
-				Maltodextrose: 1.0,
-				Fructose:      1.0,
-				Caffeine:      1.0,
-				Sodium:        1.0,
-				Protein:       1.0,
-			},
-			{
-				Gtin:          "1234567890124",
-				Name:          "Test",
-				Brand:         "Test",
-				Flavor:        "Test",
-				Carbohydrates: 1.0,
-				Electrolytes:  1.0,
-				Maltodextrose: 1.0,
-				Fructose:      1.0,
-				Caffeine:      1.0,
-				Sodium:        1.0,
-				Protein:       1.0,
-			},
+		s := supplement.Supplement{
+			Gtin:     "01234567890128",
+			Name:     "Test",
+			Brand:    "Test",
+			Flavor:   "Test",
+			Caffeine: supplement.Milligrams(1.0),
+			Sodium:   supplement.Milligrams(1.0),
 		}
-		for _, s := range want {
-			insertSupplement(t, ctx, dbPool, s)
+		insertSupplement(t, ctx, dbPool, s)
+
+		want := supplement.Supplement{
+			Gtin:   s.Gtin,
+			Name:   "Updated",
+			Brand:  "Test",
+			Flavor: "Test",
+			Sodium: supplement.Milligrams(2.0),
 		}
+		body, _ := json.Marshal(want)
+		request := httptest.NewRequest("PUT", "/supplement/"+s.Gtin, bytes.NewBuffer(body))
+		response := httptest.NewRecorder()
 
-		request := httptest.NewRequest("GET", "/supplement", nil)
+		server.ServeHTTP(response, request)
+
+		assertStatus(t, response.Code, http.StatusOK)
+
+		request = httptest.NewRequest("GET", "/supplement/"+s.Gtin, nil)
+		response = httptest.NewRecorder()
+		wantBodyJSON, _ := json.Marshal(repotest.InUnits(want).Per(supplement.PerServing))
+		wantBody := string(wantBodyJSON) + "\n"
+
+		server.ServeHTTP(response, request)
+
+		assertStatus(t, response.Code, http.StatusOK)
+		assertResponseBody(t, response.Body.String(), wantBody)
+	})
+
+	t.Run("gtin mismatch", func(t *testing.T) {
+		ctx := context.Background()
+		t.Cleanup(func() {
+			err := container.Restore(ctx)
+			if err != nil {
+				t.Fatal(err)
+			}
+		})
+		dbPool := getPool(t, ctx)
+		server := main.NewServer(supplement.NewSupplementService(postgres.NewSupplementRepository(dbPool)), main.NewReadiness())
+
+		body, _ := json.Marshal(&supplement.Supplement{Gtin: "04006381333931", Name: "Test", Brand: "Test", Flavor: "Test"})
+		request := httptest.NewRequest("PUT", "/supplement/01234567890128", bytes.NewBuffer(body))
 		response := httptest.NewRecorder()
-		wantCode := http.StatusOK
-		wantBodyJSON, _ := json.Marshal(want)
+		wantCode := http.StatusBadRequest
+		message := `gtin "04006381333931" is invalid, it must match "01234567890128" in the path`
+		wantBodyJSON, _ := json.Marshal(&problem.Details{
+			Type:     problem.TypeInvalidSupplement,
+			Title:    "Invalid supplement",
+			Status:   wantCode,
+			Detail:   fmt.Sprintf("%s: %s", supplement.ErrInvalidSupplement, message),
+			Instance: request.URL.Path,
+			Errors: []supplement.Violation{{
+				Field:   "gtin",
+				Rule:    supplement.RuleGtin,
+				Value:   "04006381333931",
+				Message: message,
+			}},
+		})
+		wantBody := string(wantBodyJSON) + "\n"
+
+		server.ServeHTTP(response, request)
+
+		assertStatus(t, response.Code, wantCode)
+		assertResponseBody(t, response.Body.String(), wantBody)
+	})
+
+	t.Run("deleted supplement", func(t *testing.T) {
+		ctx := context.Background()
+		t.Cleanup(func() {
+			err := container.Restore(ctx)
+			if err != nil {
+				t.Fatal(err)
+			}
+		})
+		dbPool := getPool(t, ctx)
+		server := main.NewServer(supplement.NewSupplementService(postgres.NewSupplementRepository(dbPool)), main.NewReadiness())
+		gtin := "01234567890128"
+		insertSupplement(t, ctx, dbPool, supplement.Supplement{Gtin: gtin, Name: "Test", Brand: "Test", Flavor: "Test", Version: 1})
+		deleteResponse := httptest.NewRecorder()
+		server.ServeHTTP(deleteResponse, httptest.NewRequest("DELETE", "/supplement/"+gtin, nil))
+		assertStatus(t, deleteResponse.Code, http.StatusNoContent)
+
+		body, _ := json.Marshal(&supplement.Supplement{Gtin: gtin, Name: "Test", Brand: "Test", Flavor: "Test"})
+		request := httptest.NewRequest("PUT", "/supplement/"+gtin, bytes.NewBuffer(body))
+		response := httptest.NewRecorder()
+		wantCode := http.StatusConflict
+		wantBodyJSON, _ := json.Marshal(&problem.Details{
+			Type:     problem.TypeAlreadyExists,
+			Title:    "Supplement already exists",
+			Status:   wantCode,
+			Detail:   fmt.Sprintf("%s: %s", gtin, supplement.ErrAlreadyExists),
+			Instance: request.URL.Path,
+			Gtin:     gtin,
+		})
 		wantBody := string(wantBodyJSON) + "\n"
 
 		server.ServeHTTP(response, request)
@@ -663,6 +967,1032 @@ func TestListAllSupplements(t *testing.T) {
 	})
 }
 
+func TestDeleteSupplement(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping integration test")
+	}
+
+	t.Run("not found", func(t *testing.T) {
+		ctx := context.Background()
+		t.Cleanup(func() {
+			err := container.Restore(ctx)
+			if err != nil {
+				t.Fatal(err)
+			}
+		})
+		dbPool := getPool(t, ctx)
+		server := main.NewServer(supplement.NewSupplementService(postgres.NewSupplementRepository(dbPool)), main.NewReadiness())
+
+		gtin := "123"
+		request := httptest.NewRequest("DELETE", "/supplement/"+gtin, nil)
+		response := httptest.NewRecorder()
+		wantCode := http.StatusNotFound
+		wantBodyJSON, _ := json.Marshal(&problem.Details{
+			Type:     problem.TypeNotFound,
+			Title:    "Supplement not found",
+			Status:   wantCode,
+			Detail:   fmt.Sprintf("%s: %s", gtin, supplement.ErrNotFound),
+			Instance: request.URL.Path,
+			Gtin:     gtin,
+		})
+		wantBody := string(wantBodyJSON) + "\n"
+
+		server.ServeHTTP(response, request)
+
+		assertStatus(t, response.Code, wantCode)
+		assertResponseBody(t, response.Body.String(), wantBody)
+	})
+
+	t.Run("deleted", func(t *testing.T) {
+		ctx := context.Background()
+		t.Cleanup(func() {
+			err := container.Restore(ctx)
+			if err != nil {
+				t.Fatal(err)
+			}
+		})
+		dbPool := getPool(t, ctx)
+		server := main.NewServer(supplement.NewSupplementService(postgres.NewSupplementRepository(dbPool)), main.NewReadiness())
+
+		s := supplement.Supplement{
+			Gtin:          "01234567890128",
+			Name:          "Test",
+			Brand:         "Test",
+			Flavor:        "Test",
+			Carbohydrates: supplement.Grams(1.0),
+			Electrolytes:  supplement.Milligrams(1.0),
+			Maltodextrose: supplement.Grams(1.0),
+			Fructose:      supplement.Grams(1.0),
+			Caffeine:      supplement.Milligrams(1.0),
+			Sodium:        supplement.Milligrams(1.0),
+			Protein:       supplement.Grams(1.0),
+		}
+		insertSupplement(t, ctx, dbPool, s)
+
+		request := httptest.NewRequest("DELETE", "/supplement/"+s.Gtin, nil)
+		response := httptest.NewRecorder()
+		wantCode := http.StatusNoContent
+
+		server.ServeHTTP(response, request)
+
+		assertStatus(t, response.Code, wantCode)
+		assertResponseBody(t, response.Body.String(), "")
+	})
+	t.Run("stale etag", func(t *testing.T) {
+		ctx := context.Background()
+		t.Cleanup(func() {
+			err := container.Restore(ctx)
+			if err != nil {
+				t.Fatal(err)
+			}
+		})
+		dbPool := getPool(t, ctx)
+		server := main.NewServer(supplement.NewSupplementService(postgres.NewSupplementRepository(dbPool)), main.NewReadiness())
+
+		s := supplement.Supplement{
+			Gtin:    "01234567890128",
+			Name:    "Test",
+			Brand:   "Test",
+			Flavor:  "Test",
+			Version: 2,
+		}
+		insertSupplement(t, ctx, dbPool, s)
+
+		request := httptest.NewRequest("DELETE", "/supplement/"+s.Gtin, nil)
+		request.Header.Set("If-Match", `"1"`)
+		response := httptest.NewRecorder()
+		wantCode := http.StatusPreconditionFailed
+		wantBodyJSON, _ := json.Marshal(&problem.Details{
+			Type:     problem.TypePreconditionFailed,
+			Title:    "Precondition failed",
+			Status:   wantCode,
+			Detail:   fmt.Sprintf("%s: %s", s.Gtin, supplement.ErrPreconditionFailed),
+			Instance: request.URL.Path,
+			Gtin:     s.Gtin,
+		})
+		wantBody := string(wantBodyJSON) + "\n"
+
+		server.ServeHTTP(response, request)
+
+		assertStatus(t, response.Code, wantCode)
+		assertResponseBody(t, response.Body.String(), wantBody)
+	})
+
+	t.Run("matching etag", func(t *testing.T) {
+		ctx := context.Background()
+		t.Cleanup(func() {
+			err := container.Restore(ctx)
+			if err != nil {
+				t.Fatal(err)
+			}
+		})
+		dbPool := getPool(t, ctx)
+		server := main.NewServer(supplement.NewSupplementService(postgres.NewSupplementRepository(dbPool)), main.NewReadiness())
+
+		s := supplement.Supplement{
+			Gtin:    "01234567890128",
+			Name:    "Test",
+			Brand:   "Test",
+			Flavor:  "Test",
+			Version: 2,
+		}
+		insertSupplement(t, ctx, dbPool, s)
+
+		request := httptest.NewRequest("DELETE", "/supplement/"+s.Gtin, nil)
+		request.Header.Set("If-Match", `"2"`)
+		response := httptest.NewRecorder()
+
+		server.ServeHTTP(response, request)
+
+		assertStatus(t, response.Code, http.StatusNoContent)
+	})
+}
+
+func TestListAllSupplements(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping integration test")
+	}
+
+	t.Run("empty", func(t *testing.T) {
+		ctx := context.Background()
+		t.Cleanup(func() {
+			err := container.Restore(ctx)
+			if err != nil {
+				t.Fatal(err)
+			}
+		})
+		dbPool := getPool(t, ctx)
+		server := main.NewServer(supplement.NewSupplementService(postgres.NewSupplementRepository(dbPool)), main.NewReadiness())
+
+		request := httptest.NewRequest("GET", "/supplement", nil)
+		response := httptest.NewRecorder()
+		wantCode := http.StatusOK
+		wantBodyJSON, _ := json.Marshal(supplement.Page{Supplements: []supplement.Supplement{}}.Per(supplement.PerServing))
+		wantBody := string(wantBodyJSON) + "\n"
+
+		server.ServeHTTP(response, request)
+
+		assertStatus(t, response.Code, wantCode)
+		assertResponseBody(t, response.Body.String(), wantBody)
+	})
+
+	t.Run("not empty", func(t *testing.T) {
+		ctx := context.Background()
+		t.Cleanup(func() {
+			err := container.Restore(ctx)
+			if err != nil {
+				t.Fatal(err)
+			}
+		})
+		dbPool := getPool(t, ctx)
+		server := main.NewServer(supplement.NewSupplementService(postgres.NewSupplementRepository(dbPool)), main.NewReadiness())
+
+		want := []supplement.Supplement{
+			{
+				Gtin:          "01234567890128",
+				Name:          "Test",
+				Brand:         "Test",
+				Flavor:        "Test",
+				Carbohydrates: supplement.Grams(1.0),
+				Electrolytes:  supplement.Milligrams(1.0),
+				Maltodextrose: supplement.Grams(1.0),
+				Fructose:      supplement.Grams(1.0),
+				Caffeine:      supplement.Milligrams(1.0),
+				Sodium:        supplement.Milligrams(1.0),
+				Protein:       supplement.Grams(1.0),
+			},
+			{
+				Gtin:          "04006381333931",
+				Name:          "Test",
+				Brand:         "Test",
+				Flavor:        "Test",
+				Carbohydrates: supplement.Grams(1.0),
+				Electrolytes:  supplement.Milligrams(1.0),
+				Maltodextrose: supplement.Grams(1.0),
+				Fructose:      supplement.Grams(1.0),
+				Caffeine:      supplement.Milligrams(1.0),
+				Sodium:        supplement.Milligrams(1.0),
+				Protein:       supplement.Grams(1.0),
+			},
+		}
+		for _, s := range want {
+			insertSupplement(t, ctx, dbPool, s)
+		}
+
+		request := httptest.NewRequest("GET", "/supplement", nil)
+		response := httptest.NewRecorder()
+		wantCode := http.StatusOK
+		wantBodyJSON, _ := json.Marshal(supplement.Page{Supplements: want}.Per(supplement.PerServing))
+		wantBody := string(wantBodyJSON) + "\n"
+
+		server.ServeHTTP(response, request)
+
+		assertStatus(t, response.Code, wantCode)
+		assertResponseBody(t, response.Body.String(), wantBody)
+	})
+
+	t.Run("paginated", func(t *testing.T) {
+		ctx := context.Background()
+		t.Cleanup(func() {
+			err := container.Restore(ctx)
+			if err != nil {
+				t.Fatal(err)
+			}
+		})
+		dbPool := getPool(t, ctx)
+		server := main.NewServer(supplement.NewSupplementService(postgres.NewSupplementRepository(dbPool)), main.NewReadiness())
+
+		ss := []supplement.Supplement{
+			{Gtin: "01234567890128", Name: "Test", Brand: "Test", Flavor: "Test", Carbohydrates: supplement.Grams(10.0)},
+			{Gtin: "04006381333931", Name: "Test", Brand: "Test", Flavor: "Test", Carbohydrates: supplement.Grams(30.0)},
+			{Gtin: "05901234123457", Name: "Test", Brand: "Test", Flavor: "Test", Carbohydrates: supplement.Grams(20.0)},
+		}
+		for _, s := range ss {
+			insertSupplement(t, ctx, dbPool, s)
+		}
+
+		request := httptest.NewRequest("GET", "/supplement?sort=carbohydrates&order=desc&limit=1", nil)
+		response := httptest.NewRecorder()
+
+		server.ServeHTTP(response, request)
+
+		assertStatus(t, response.Code, http.StatusOK)
+		var first supplement.Page
+		if err := json.NewDecoder(response.Body).Decode(&first); err != nil {
+			t.Fatal(err)
+		}
+		if first.Next == "" {
+			t.Fatal("expected a next cursor")
+		}
+
+		request = httptest.NewRequest("GET", "/supplement?sort=carbohydrates&order=desc&limit=1&cursor="+first.Next, nil)
+		response = httptest.NewRecorder()
+		wantCode := http.StatusOK
+		second := supplement.Page{Supplements: []supplement.Supplement{repotest.InUnits(ss[2])}}
+
+		server.ServeHTTP(response, request)
+
+		var got supplement.Page
+		if err := json.NewDecoder(response.Body).Decode(&got); err != nil {
+			t.Fatal(err)
+		}
+		got.Next = ""
+
+		assertStatus(t, response.Code, wantCode)
+		if diff := cmp.Diff(got, second); diff != "" {
+			t.Errorf("incorrect page (-got +want):\n%s", diff)
+		}
+	})
+
+	t.Run("invalid cursor", func(t *testing.T) {
+		ctx := context.Background()
+		dbPool := getPool(t, ctx)
+		server := main.NewServer(supplement.NewSupplementService(postgres.NewSupplementRepository(dbPool)), main.NewReadiness())
+
+		request := httptest.NewRequest("GET", "/supplement?cursor=tampered.cursor", nil)
+		response := httptest.NewRecorder()
+		wantCode := http.StatusBadRequest
+
+		server.ServeHTTP(response, request)
+
+		assertStatus(t, response.Code, wantCode)
+	})
+
+	t.Run("invalid query", func(t *testing.T) {
+		ctx := context.Background()
+		t.Cleanup(func() {
+			err := container.Restore(ctx)
+			if err != nil {
+				t.Fatal(err)
+			}
+		})
+		dbPool := getPool(t, ctx)
+		server := main.NewServer(supplement.NewSupplementService(postgres.NewSupplementRepository(dbPool)), main.NewReadiness())
+
+		request := httptest.NewRequest("GET", "/supplement?limit=ten", nil)
+		response := httptest.NewRecorder()
+		wantCode := http.StatusBadRequest
+		wantBodyJSON, _ := json.Marshal(&problem.Details{
+			Type:     problem.TypeInvalidQuery,
+			Title:    "Invalid query",
+			Status:   wantCode,
+			Detail:   fmt.Sprintf("%s: limit %q is not an integer", supplement.ErrInvalidQuery, "ten"),
+			Instance: request.URL.Path,
+			Errors: []supplement.Violation{{
+				Field:   "limit",
+				Rule:    supplement.RuleType,
+				Value:   "ten",
+				Message: fmt.Sprintf("limit %q is not an integer", "ten"),
+			}},
+		})
+		wantBody := string(wantBodyJSON) + "\n"
+
+		server.ServeHTTP(response, request)
+
+		assertStatus(t, response.Code, wantCode)
+		assertResponseBody(t, response.Body.String(), wantBody)
+	})
+}
+
+func TestSupplementHistory(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping integration test")
+	}
+
+	t.Run("not found", func(t *testing.T) {
+		ctx := context.Background()
+		t.Cleanup(func() {
+			err := container.Restore(ctx)
+			if err != nil {
+				t.Fatal(err)
+			}
+		})
+		dbPool := getPool(t, ctx)
+		server := main.NewServer(supplement.NewSupplementService(postgres.NewSupplementRepository(dbPool)), main.NewReadiness())
+
+		gtin := "01234567890128"
+		request := httptest.NewRequest("GET", "/supplement/"+gtin+"/history", nil)
+		response := httptest.NewRecorder()
+		wantCode := http.StatusNotFound
+		wantBodyJSON, _ := json.Marshal(&problem.Details{
+			Type:     problem.TypeNotFound,
+			Title:    "Supplement not found",
+			Status:   wantCode,
+			Detail:   fmt.Sprintf("%s: %s", gtin, supplement.ErrNotFound),
+			Instance: request.URL.Path,
+			Gtin:     gtin,
+		})
+		wantBody := string(wantBodyJSON) + "\n"
+
+		server.ServeHTTP(response, request)
+
+		assertStatus(t, response.Code, wantCode)
+		assertResponseBody(t, response.Body.String(), wantBody)
+	})
+
+	t.Run("stored before the audit log", func(t *testing.T) {
+		ctx := context.Background()
+		t.Cleanup(func() {
+			err := container.Restore(ctx)
+			if err != nil {
+				t.Fatal(err)
+			}
+		})
+		dbPool := getPool(t, ctx)
+		server := main.NewServer(supplement.NewSupplementService(postgres.NewSupplementRepository(dbPool)), main.NewReadiness())
+		insertSupplement(t, ctx, dbPool, supplement.Supplement{Gtin: "01234567890128", Name: "Test", Brand: "Test", Flavor: "Test", Version: 1})
+
+		request := httptest.NewRequest("GET", "/supplement/01234567890128/history", nil)
+		response := httptest.NewRecorder()
+
+		server.ServeHTTP(response, request)
+
+		assertStatus(t, response.Code, http.StatusOK)
+		assertResponseBody(t, response.Body.String(), `{"entries":[]}`+"\n")
+	})
+
+	t.Run("changes by actor", func(t *testing.T) {
+		ctx := context.Background()
+		t.Cleanup(func() {
+			err := container.Restore(ctx)
+			if err != nil {
+				t.Fatal(err)
+			}
+		})
+		dbPool := getPool(t, ctx)
+		server := main.NewServer(supplement.NewSupplementService(postgres.NewSupplementRepository(dbPool)), main.NewReadiness())
+
+		requests := []*http.Request{
+			httptest.NewRequest("POST", "/supplement", bytes.NewBufferString(`{"gtin": "01234567890128", "name": "Test", "brand": "Test", "flavor": "Test", "caffeine": 75}`)),
+			httptest.NewRequest("PATCH", "/supplement/01234567890128", bytes.NewBufferString(`{"caffeine": 100}`)),
+			httptest.NewRequest("DELETE", "/supplement/01234567890128", nil),
+		}
+		requests[1].Header.Set("X-Actor", "qa@example.com")
+		for _, request := range requests {
+			response := httptest.NewRecorder()
+			server.ServeHTTP(response, request)
+			if response.Code >= 300 {
+				t.Fatalf("%s %s status = %d, body = %s", request.Method, request.URL, response.Code, response.Body)
+			}
+		}
+
+		request := httptest.NewRequest("GET", "/supplement/01234567890128/history", nil)
+		response := httptest.NewRecorder()
+
+		server.ServeHTTP(response, request)
+
+		assertStatus(t, response.Code, http.StatusOK)
+		var history supplement.History
+		if err := json.Unmarshal(response.Body.Bytes(), &history); err != nil {
+			t.Fatal(err)
+		}
+		if len(history.Entries) != 3 {
+			t.Fatalf("history has %d entries, want 3", len(history.Entries))
+		}
+		update := history.Entries[1]
+		want := supplement.AuditEntry{
+			Gtin:      "01234567890128",
+			Version:   2,
+			Operation: supplement.OperationUpdate,
+			Actor:     "qa@example.com",
+			At:        update.At,
+			Changes:   []supplement.Change{{Path: "/caffeine/amount", Before: float64(75), After: float64(100)}},
+		}
+		if diff := cmp.Diff(update, want); diff != "" {
+			t.Errorf("update entry mismatch (-got +want):\n%s", diff)
+		}
+		if history.Entries[0].Actor != supplement.AnonymousActor || history.Entries[2].Operation != supplement.OperationDelete {
+			t.Errorf("history entries = %+v, want an anonymous create first and a delete last", history.Entries)
+		}
+	})
+}
+
+func TestRestoreSupplement(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping integration test")
+	}
+
+	t.Run("not deleted", func(t *testing.T) {
+		ctx := context.Background()
+		t.Cleanup(func() {
+			err := container.Restore(ctx)
+			if err != nil {
+				t.Fatal(err)
+			}
+		})
+		dbPool := getPool(t, ctx)
+		server := main.NewServer(supplement.NewSupplementService(postgres.NewSupplementRepository(dbPool)), main.NewReadiness())
+
+		s := supplement.Supplement{Gtin: "01234567890128", Name: "Test", Brand: "Test", Flavor: "Test", Version: 1}
+		insertSupplement(t, ctx, dbPool, s)
+
+		request := httptest.NewRequest("POST", "/supplement/"+s.Gtin+"/restore", nil)
+		response := httptest.NewRecorder()
+		wantCode := http.StatusNotFound
+		wantBodyJSON, _ := json.Marshal(&problem.Details{
+			Type:     problem.TypeNotFound,
+			Title:    "Supplement not found",
+			Status:   wantCode,
+			Detail:   fmt.Sprintf("%s: %s", s.Gtin, supplement.ErrNotFound),
+			Instance: request.URL.Path,
+			Gtin:     s.Gtin,
+		})
+		wantBody := string(wantBodyJSON) + "\n"
+
+		server.ServeHTTP(response, request)
+
+		assertStatus(t, response.Code, wantCode)
+		assertResponseBody(t, response.Body.String(), wantBody)
+	})
+
+	t.Run("deleted", func(t *testing.T) {
+		ctx := context.Background()
+		t.Cleanup(func() {
+			err := container.Restore(ctx)
+			if err != nil {
+				t.Fatal(err)
+			}
+		})
+		dbPool := getPool(t, ctx)
+		server := main.NewServer(supplement.NewSupplementService(postgres.NewSupplementRepository(dbPool)), main.NewReadiness())
+
+		s := supplement.Supplement{Gtin: "01234567890128", Name: "Test", Brand: "Test", Flavor: "Test", Version: 1}
+		insertSupplement(t, ctx, dbPool, s)
+
+		request := httptest.NewRequest("DELETE", "/supplement/"+s.Gtin, nil)
+		response := httptest.NewRecorder()
+		server.ServeHTTP(response, request)
+		assertStatus(t, response.Code, http.StatusNoContent)
+
+		request = httptest.NewRequest("POST", "/supplement/"+s.Gtin+"/restore", nil)
+		response = httptest.NewRecorder()
+
+		server.ServeHTTP(response, request)
+
+		assertStatus(t, response.Code, http.StatusOK)
+		if got := response.Header().Get("ETag"); got != `"3"` {
+			t.Errorf("ETag = %s, want \"3\"", got)
+		}
+		var restored supplement.Supplement
+		if err := json.Unmarshal(response.Body.Bytes(), &restored); err != nil {
+			t.Fatal(err)
+		}
+		if restored.Gtin != s.Gtin || restored.DeletedAt != nil {
+			t.Errorf("restored supplement = %+v, want %s without deletedAt", restored, s.Gtin)
+		}
+	})
+}
+
+func TestExportSupplements(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping integration test")
+	}
+
+	ctx := context.Background()
+	dbPool := getPool(t, ctx)
+	server := main.NewServer(supplement.NewSupplementService(postgres.NewSupplementRepository(dbPool)), main.NewReadiness())
+	t.Cleanup(func() {
+		err := container.Restore(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+	})
+	insertSupplement(t, ctx, dbPool, supplement.Supplement{Gtin: "01234567890128", Name: "Gel", Brand: "Brand", Flavor: "Lemon", Version: 1})
+	insertSupplement(t, ctx, dbPool, supplement.Supplement{Gtin: "04006381333931", Name: "Bar", Brand: "Other", Flavor: "Cocoa", Version: 1})
+
+	tests := []struct {
+		name            string
+		query           string
+		wantCode        int
+		wantContentType string
+		wantDisposition string
+		wantLines       int
+	}{
+		{
+			name:            "csv",
+			query:           "?brand=brand&limit=1",
+			wantCode:        http.StatusOK,
+			wantContentType: "text/csv; charset=utf-8",
+			wantDisposition: "attachment; filename=supplements.csv",
+			wantLines:       2,
+		},
+		{
+			name:            "ndjson",
+			query:           "?format=ndjson",
+			wantCode:        http.StatusOK,
+			wantContentType: "application/x-ndjson",
+			wantDisposition: "attachment; filename=supplements.ndjson",
+			wantLines:       2,
+		},
+		{
+			name:            "invalid format",
+			query:           "?format=json",
+			wantCode:        http.StatusBadRequest,
+			wantContentType: problem.ContentType,
+			wantLines:       1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			request := httptest.NewRequest("GET", "/supplement/export"+tt.query, nil)
+			response := httptest.NewRecorder()
+
+			server.ServeHTTP(response, request)
+
+			assertStatus(t, response.Code, tt.wantCode)
+			assertHeader(t, response.Header(), "Content-Type", tt.wantContentType)
+			assertHeader(t, response.Header(), "Content-Disposition", tt.wantDisposition)
+			if got := bytes.Count(response.Body.Bytes(), []byte("\n")); got != tt.wantLines {
+				t.Errorf("body has %d lines, want %d:\n%s", got, tt.wantLines, response.Body)
+			}
+		})
+	}
+}
+
+func TestSearchSupplements(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping integration test")
+	}
+
+	ctx := context.Background()
+	dbPool := getPool(t, ctx)
+	server := main.NewServer(supplement.NewSupplementService(postgres.NewSupplementRepository(dbPool)), main.NewReadiness())
+	t.Cleanup(func() {
+		err := container.Restore(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+	})
+	insertSupplement(t, ctx, dbPool, supplement.Supplement{Gtin: "01234567890128", Name: "Gel 160", Brand: "Maurten", Flavor: "Café", Version: 1})
+	insertSupplement(t, ctx, dbPool, supplement.Supplement{Gtin: "04006381333931", Name: "Beta Fuel", Brand: "SiS", Flavor: "Naranja", Version: 1})
+
+	tests := []struct {
+		name      string
+		query     string
+		wantCode  int
+		wantGtins []string
+	}{
+		{name: "words", query: "?q=maurten+160", wantCode: http.StatusOK, wantGtins: []string{"01234567890128"}},
+		{name: "typos", query: "?q=sis+beta+fuell+naranja", wantCode: http.StatusOK, wantGtins: []string{"04006381333931"}},
+		{name: "accent folding", query: "?q=cafe", wantCode: http.StatusOK, wantGtins: []string{"01234567890128"}},
+		{name: "no match", query: "?q=isostar", wantCode: http.StatusOK, wantGtins: []string{}},
+		{name: "no words", query: "?q=", wantCode: http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			request := httptest.NewRequest("GET", "/supplement/search"+tt.query, nil)
+			response := httptest.NewRecorder()
+
+			server.ServeHTTP(response, request)
+
+			assertStatus(t, response.Code, tt.wantCode)
+			if tt.wantCode != http.StatusOK {
+				assertHeader(t, response.Header(), "Content-Type", problem.ContentType)
+				return
+			}
+			var got struct {
+				Supplements []struct {
+					Gtin string `json:"gtin"`
+				} `json:"supplements"`
+			}
+			if err := json.Unmarshal(response.Body.Bytes(), &got); err != nil {
+				t.Fatal(err)
+			}
+			gtins := []string{}
+			for _, s := range got.Supplements {
+				gtins = append(gtins, s.Gtin)
+			}
+			if diff := cmp.Diff(gtins, tt.wantGtins); diff != "" {
+				t.Errorf("gtins (-got +want):\n%s", diff)
+			}
+		})
+	}
+}
+
+// slowExportRepository pauses before each supplement it exports.
+type slowExportRepository struct {
+	supplement.SupplementRepository
+	pause time.Duration
+}
+
+func (r slowExportRepository) Export(ctx context.Context, query supplement.ListQuery, fn func(supplement.Supplement) error) error {
+	return r.SupplementRepository.Export(ctx, query, func(s supplement.Supplement) error {
+		time.Sleep(r.pause)
+		return fn(s)
+	})
+}
+
+func TestExportSupplementsPastWriteTimeout(t *testing.T) {
+	ctx := context.Background()
+	repository := memory.NewSupplementRepository()
+	const n = 10
+	for i := range n {
+		if err := repository.Create(ctx, supplement.Supplement{Gtin: fmt.Sprintf("%014d", i), Name: "Gel", Brand: "Brand", Flavor: "Lemon"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	service := supplement.NewSupplementService(slowExportRepository{repository, 50 * time.Millisecond})
+	server := httptest.NewUnstartedServer(main.NewServer(service, main.NewReadiness()))
+	server.Config.WriteTimeout = 200 * time.Millisecond
+	server.Start()
+	defer server.Close()
+
+	response, err := http.Get(server.URL + "/supplement/export?format=ndjson")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer response.Body.Close()
+	body, err := io.ReadAll(response.Body)
+
+	if err != nil {
+		t.Fatalf("reading the export error = %v, want nil", err)
+	}
+	if got := bytes.Count(body, []byte("\n")); got != n {
+		t.Errorf("export has %d lines, want %d", got, n)
+	}
+}
+
+func TestImportSupplements(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping integration test")
+	}
+
+	csv := "EAN,name,brand,flavor,sodium\n" +
+		"01234567890128,Test,Test,Test,300 mg\n" +
+		"4006381333930,Test,Test,Test,\n"
+
+	t.Run("unsupported media type", func(t *testing.T) {
+		ctx := context.Background()
+		dbPool := getPool(t, ctx)
+		server := main.NewServer(supplement.NewSupplementService(postgres.NewSupplementRepository(dbPool)), main.NewReadiness())
+
+		request := httptest.NewRequest("POST", "/supplement/import", bytes.NewBufferString(csv))
+		request.Header.Set("Content-Type", "application/json")
+		response := httptest.NewRecorder()
+
+		server.ServeHTTP(response, request)
+
+		assertStatus(t, response.Code, http.StatusUnsupportedMediaType)
+		assertHeader(t, response.Header(), "Accept-Post", "text/csv, application/x-ndjson, application/ndjson")
+	})
+
+	t.Run("too large", func(t *testing.T) {
+		server := main.NewServer(supplement.NewSupplementService(memory.NewSupplementRepository()), main.NewReadiness())
+
+		body := "gtin,name\n" + strings.Repeat("01234567890128,"+strings.Repeat("a", 1<<10)+"\n", 33<<10)
+		request := httptest.NewRequest("POST", "/supplement/import", strings.NewReader(body))
+		request.Header.Set("Content-Type", "text/csv")
+		response := httptest.NewRecorder()
+
+		server.ServeHTTP(response, request)
+
+		assertStatus(t, response.Code, http.StatusRequestEntityTooLarge)
+	})
+
+	tests := []struct {
+		name        string
+		query       string
+		wantCode    int
+		wantReport  supplement.ImportReport
+		wantCreated bool
+	}{
+		{
+			name:     "all or nothing",
+			query:    "?map=EAN=gtin",
+			wantCode: http.StatusUnprocessableEntity,
+			wantReport: supplement.ImportReport{
+				Created: 1,
+				Invalid: 1,
+			},
+		},
+		{
+			name:     "dry run",
+			query:    "?map=EAN=gtin&policy=best-effort&dryRun=true",
+			wantCode: http.StatusOK,
+			wantReport: supplement.ImportReport{
+				DryRun:  true,
+				Created: 1,
+				Invalid: 1,
+			},
+		},
+		{
+			name:     "best effort",
+			query:    "?map=EAN=gtin&policy=best-effort",
+			wantCode: http.StatusOK,
+			wantReport: supplement.ImportReport{
+				Committed: true,
+				Created:   1,
+				Invalid:   1,
+			},
+			wantCreated: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			t.Cleanup(func() {
+				err := container.Restore(ctx)
+				if err != nil {
+					t.Fatal(err)
+				}
+			})
+			dbPool := getPool(t, ctx)
+			server := main.NewServer(supplement.NewSupplementService(postgres.NewSupplementRepository(dbPool)), main.NewReadiness())
+
+			request := httptest.NewRequest("POST", "/supplement/import"+tt.query, bytes.NewBufferString(csv))
+			request.Header.Set("Content-Type", "text/csv; charset=utf-8")
+			response := httptest.NewRecorder()
+
+			server.ServeHTTP(response, request)
+
+			assertStatus(t, response.Code, tt.wantCode)
+			var report supplement.ImportReport
+			if err := json.Unmarshal(response.Body.Bytes(), &report); err != nil {
+				t.Fatal(err)
+			}
+			if len(report.Results) != 2 || report.Results[1].Line != 3 || len(report.Results[1].Errors) == 0 {
+				t.Errorf("report results = %+v, want line 3 invalid with violations", report.Results)
+			}
+			report.Results = nil
+			if diff := cmp.Diff(report, tt.wantReport); diff != "" {
+				t.Errorf("report (-got +want):\n%s", diff)
+			}
+
+			request = httptest.NewRequest("GET", "/supplement/01234567890128", nil)
+			response = httptest.NewRecorder()
+			server.ServeHTTP(response, request)
+
+			wantCode := http.StatusNotFound
+			if tt.wantCreated {
+				wantCode = http.StatusOK
+			}
+			assertStatus(t, response.Code, wantCode)
+		})
+	}
+}
+
+func TestImportSupplementsPastReadTimeout(t *testing.T) {
+	server := httptest.NewUnstartedServer(main.NewServer(supplement.NewSupplementService(memory.NewSupplementRepository()), main.NewReadiness()))
+	server.Config.ReadTimeout = 150 * time.Millisecond
+	server.Start()
+	defer server.Close()
+
+	gtins := []string{"01234567890128", "04006381333931", "05901234123457", "10012345678902"}
+	body, upload := io.Pipe()
+	go func() {
+		fmt.Fprintln(upload, "gtin,name,brand,flavor")
+		for _, gtin := range gtins {
+			time.Sleep(100 * time.Millisecond)
+			fmt.Fprintf(upload, "%s,Gel,Brand,Lemon\n", gtin)
+		}
+		upload.Close()
+	}()
+
+	response, err := http.Post(server.URL+"/supplement/import", "text/csv", body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer response.Body.Close()
+
+	assertStatus(t, response.StatusCode, http.StatusOK)
+	var report supplement.ImportReport
+	if err := json.NewDecoder(response.Body).Decode(&report); err != nil {
+		t.Fatal(err)
+	}
+	if report.Created != len(gtins) {
+		t.Errorf("import created %d supplements, want %d: %+v", report.Created, len(gtins), report)
+	}
+}
+
+func TestBatchSupplements(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping integration test")
+	}
+
+	body := `{"atomic": %t, "operations": [
+		{"op": "create", "supplement": {"gtin": "01234567890128", "name": "Test", "brand": "Test", "flavor": "Test"}},
+		{"op": "delete", "gtin": "04006381333931"}
+	]}`
+	tests := []struct {
+		name          string
+		atomic        bool
+		wantStatuses  []int
+		wantCommitted bool
+		wantCreated   bool
+	}{
+		{
+			name:          "independent",
+			wantStatuses:  []int{http.StatusCreated, http.StatusNotFound},
+			wantCommitted: true,
+			wantCreated:   true,
+		},
+		{
+			name:         "atomic",
+			atomic:       true,
+			wantStatuses: []int{http.StatusFailedDependency, http.StatusNotFound},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			t.Cleanup(func() {
+				err := container.Restore(ctx)
+				if err != nil {
+					t.Fatal(err)
+				}
+			})
+			dbPool := getPool(t, ctx)
+			server := main.NewServer(supplement.NewSupplementService(postgres.NewSupplementRepository(dbPool)), main.NewReadiness())
+
+			request := httptest.NewRequest("POST", "/supplement:batch", bytes.NewBufferString(fmt.Sprintf(body, tt.atomic)))
+			response := httptest.NewRecorder()
+
+			server.ServeHTTP(response, request)
+
+			assertStatus(t, response.Code, http.StatusOK)
+			var got struct {
+				Committed bool `json:"committed"`
+				Results   []struct {
+					Status  int              `json:"status"`
+					Problem *problem.Details `json:"problem"`
+				} `json:"results"`
+			}
+			if err := json.Unmarshal(response.Body.Bytes(), &got); err != nil {
+				t.Fatal(err)
+			}
+			if got.Committed != tt.wantCommitted {
+				t.Errorf("committed = %t, want %t", got.Committed, tt.wantCommitted)
+			}
+			var statuses []int
+			for _, result := range got.Results {
+				statuses = append(statuses, result.Status)
+				if (result.Problem == nil) != (result.Status < 400) {
+					t.Errorf("result with status %d has problem %v", result.Status, result.Problem)
+				}
+			}
+			if diff := cmp.Diff(statuses, tt.wantStatuses); diff != "" {
+				t.Errorf("statuses (-got +want):\n%s", diff)
+			}
+
+			request = httptest.NewRequest("GET", "/supplement/01234567890128", nil)
+			response = httptest.NewRecorder()
+			server.ServeHTTP(response, request)
+
+			wantCode := http.StatusNotFound
+			if tt.wantCreated {
+				wantCode = http.StatusOK
+			}
+			assertStatus(t, response.Code, wantCode)
+		})
+	}
+}
+
+func TestHealth(t *testing.T) {
+	t.Run("alive", func(t *testing.T) {
+		server := main.NewServer(nil, main.NewReadiness())
+
+		request := httptest.NewRequest("GET", "/healthz", nil)
+		response := httptest.NewRecorder()
+
+		server.ServeHTTP(response, request)
+
+		assertStatus(t, response.Code, http.StatusOK)
+		assertResponseBody(t, response.Body.String(), `{"status":"alive"}`+"\n")
+	})
+
+	t.Run("ready", func(t *testing.T) {
+		ctx := context.Background()
+		dbPool := getPool(t, ctx)
+		server := main.NewServer(nil, main.NewReadiness(main.Check{Name: "postgres", Run: dbPool.Ping}))
+
+		request := httptest.NewRequest("GET", "/readyz", nil)
+		response := httptest.NewRecorder()
+
+		server.ServeHTTP(response, request)
+
+		assertStatus(t, response.Code, http.StatusOK)
+		assertResponseBody(t, response.Body.String(), `{"status":"ready","checks":{"postgres":{"status":"up"}}}`+"\n")
+	})
+
+	t.Run("dependency down", func(t *testing.T) {
+		server := main.NewServer(nil, main.NewReadiness(
+			main.Check{Name: "postgres", Run: func(ctx context.Context) error { return nil }},
+			main.Check{Name: "migrations", Run: func(ctx context.Context) error {
+				return fmt.Errorf("schema version is 1, expected 2")
+			}},
+		))
+
+		request := httptest.NewRequest("GET", "/readyz", nil)
+		response := httptest.NewRecorder()
+
+		server.ServeHTTP(response, request)
+
+		assertStatus(t, response.Code, http.StatusServiceUnavailable)
+		assertResponseBody(t, response.Body.String(),
+			`{"status":"not ready","checks":{"migrations":{"status":"down","error":"schema version is 1, expected 2"},"postgres":{"status":"up"}}}`+"\n")
+	})
+
+	t.Run("pending migrations", func(t *testing.T) {
+		ctx := context.Background()
+		store, err := main.OpenStorage(ctx, sqliteEnv(t, ctx))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer store.Close()
+		if err := store.Migrate(ctx, io.Discard, "down"); err != nil {
+			t.Fatal(err)
+		}
+		server := main.NewServer(nil, store.Readiness())
+
+		ready := func() (int, main.ReadinessReport) {
+			t.Helper()
+			request := httptest.NewRequest("GET", "/readyz", nil)
+			response := httptest.NewRecorder()
+
+			server.ServeHTTP(response, request)
+
+			var report main.ReadinessReport
+			if err := json.NewDecoder(response.Body).Decode(&report); err != nil {
+				t.Fatal(err)
+			}
+			return response.Code, report
+		}
+
+		code, report := ready()
+		assertStatus(t, code, http.StatusServiceUnavailable)
+		if check := report.Checks["migrations"]; check.Status != "down" || !strings.HasPrefix(check.Error, migrations.ErrSchemaBehind.Error()) {
+			t.Errorf("migrations check = %+v, want it down with pending migrations", check)
+		}
+
+		if err := store.Migrate(ctx, io.Discard, "up"); err != nil {
+			t.Fatal(err)
+		}
+
+		code, report = ready()
+		assertStatus(t, code, http.StatusOK)
+		if diff := cmp.Diff(report, main.ReadinessReport{Status: "ready", Checks: map[string]main.CheckStatus{
+			"sqlite":     {Status: "up"},
+			"migrations": {Status: "up"},
+		}}); diff != "" {
+			t.Errorf("/readyz (-got +want):\n%s", diff)
+		}
+	})
+
+	t.Run("shutting down", func(t *testing.T) {
+		readiness := main.NewReadiness(main.Check{Name: "postgres", Run: func(ctx context.Context) error { return nil }})
+		server := main.NewServer(nil, readiness)
+		readiness.ShutDown()
+
+		request := httptest.NewRequest("GET", "/readyz", nil)
+		response := httptest.NewRecorder()
+
+		server.ServeHTTP(response, request)
+
+		assertStatus(t, response.Code, http.StatusServiceUnavailable)
+		assertResponseBody(t, response.Body.String(), `{"status":"shutting down","checks":{}}`+"\n")
+	})
+}
+
 func getPool(t *testing.T, ctx context.Context) *pgxpool.Pool {
 	t.Helper()
 	dbPool, err := pgxpool.New(ctx, dbUrl)
@@ -682,9 +2012,11 @@ func insertSupplement(t *testing.T, ctx context.Context, dbPool *pgxpool.Pool, s
 	_, err := dbPool.Exec(
 		ctx,
 		"INSERT INTO "+tableName+
-			" (gtin, name, brand, flavor, carbohydrates, electrolytes, maltodextrose, fructose, caffeine, sodium, protein) "+
-			"VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)",
-		s.Gtin, s.Name, s.Brand, s.Flavor, s.Carbohydrates, s.Electrolytes, s.Maltodextrose, s.Fructose, s.Caffeine, s.Sodium, s.Protein,
+			" (gtin, name, brand, flavor, carbohydrates, electrolytes, maltodextrose, fructose, caffeine, sodium, protein, version) "+
+			"VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)",
+		s.Gtin, s.Name, s.Brand, s.Flavor,
+		s.Carbohydrates.Amount, s.Electrolytes.Amount, s.Maltodextrose.Amount, s.Fructose.Amount, s.Caffeine.Amount, s.Sodium.Amount, s.Protein.Amount,
+		s.Version,
 	)
 
 	if err != nil {
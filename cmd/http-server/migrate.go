@@ -0,0 +1,60 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"text/tabwriter"
+	"time"
+)
+
+const migrateUsage = "usage: supplementapp migrate up|down|status"
+
+// migrate runs the migrate command: up applies every pending migration, down
+// rolls back the most recent one and status lists them all.
+func migrate(ctx context.Context, store storage, args []string, w io.Writer) error {
+	if store.migrations == nil {
+		return errors.New("the memory storage has no migrations")
+	}
+
+	if len(args) != 1 {
+		return errors.New(migrateUsage)
+	}
+
+	switch args[0] {
+	case "up":
+		results, err := store.migrations.Up(ctx)
+		for _, result := range results {
+			fmt.Fprintf(w, "applied %s in %s\n", result.Source.Path, result.Duration.Round(time.Millisecond))
+		}
+		if err == nil && len(results) == 0 {
+			fmt.Fprintln(w, "no pending migrations")
+		}
+		return err
+	case "down":
+		result, err := store.migrations.Down(ctx)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(w, "rolled back %s in %s\n", result.Source.Path, result.Duration.Round(time.Millisecond))
+		return nil
+	case "status":
+		statuses, err := store.migrations.Status(ctx)
+		if err != nil {
+			return err
+		}
+		tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, "MIGRATION\tSTATE\tAPPLIED AT")
+		for _, status := range statuses {
+			appliedAt := "-"
+			if !status.AppliedAt.IsZero() {
+				appliedAt = status.AppliedAt.Format(time.RFC3339)
+			}
+			fmt.Fprintf(tw, "%s\t%s\t%s\n", status.Source.Path, status.State, appliedAt)
+		}
+		return tw.Flush()
+	default:
+		return errors.New(migrateUsage)
+	}
+}
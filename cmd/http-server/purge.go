@@ -0,0 +1,38 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/marioromandono/supplementapp/internal/supplement"
+)
+
+const purgeUsage = "usage: supplementapp purge [retention]"
+
+// purge runs the purge command, which removes for good the supplements
+// deleted longer ago than the retention argument, TOMBSTONE_RETENTION by
+// default.
+func purge(ctx context.Context, service *supplement.SupplementService, retention time.Duration, args []string, w io.Writer) error {
+	switch len(args) {
+	case 0:
+	case 1:
+		parsed, err := time.ParseDuration(args[0])
+		if err != nil || parsed < 0 {
+			return fmt.Errorf("retention %q is invalid, it must be a duration such as 720h, %s", args[0], purgeUsage)
+		}
+		retention = parsed
+	default:
+		return errors.New(purgeUsage)
+	}
+
+	purged, err := service.Purge(ctx, retention)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(w, "purged %d supplements deleted more than %s ago\n", purged, retention)
+	return nil
+}
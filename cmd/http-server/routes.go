@@ -3,40 +3,71 @@ package main
 import (
 	"encoding/json"
 	"errors"
+	"fmt"
 	"io"
+	"log"
+	"mime"
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
 
+	"github.com/marioromandono/supplementapp/internal/problem"
 	"github.com/marioromandono/supplementapp/internal/supplement"
 )
 
-type ErrorResponseBody struct {
-	Code    int    `json:"code"`
-	Message string `json:"message"`
-}
-
-func addRoutes(mux *http.ServeMux, service *supplement.SupplementService) {
+func addRoutes(mux *http.ServeMux, service *supplement.SupplementService, readiness *Readiness) {
+	mux.HandleFunc("GET /healthz", livenessHandler())
+	mux.HandleFunc("GET /readyz", readinessHandler(readiness))
 	mux.HandleFunc("GET /supplement/{gtin}", getSupplementHandler(service))
 	mux.HandleFunc("GET /supplement", listAllSupplementsHandler(service))
+	mux.HandleFunc("GET /supplement/export", exportSupplementsHandler(service))
+	mux.HandleFunc("GET /supplement/search", searchSupplementsHandler(service))
 	mux.HandleFunc("POST /supplement", createSupplementHandler(service))
-	mux.HandleFunc("PUT /supplement/{gtin}", updateSupplementHandler(service))
+	mux.HandleFunc("POST /supplement/import", importSupplementsHandler(service))
+	mux.HandleFunc("POST /supplement:batch", batchSupplementsHandler(service))
+	mux.HandleFunc("PUT /supplement/{gtin}", replaceSupplementHandler(service))
 	mux.HandleFunc("PATCH /supplement/{gtin}", updateSupplementHandler(service))
 	mux.HandleFunc("DELETE /supplement/{gtin}", deleteSupplementHandler(service))
+	mux.HandleFunc("GET /supplement/{gtin}/history", supplementHistoryHandler(service))
+	mux.HandleFunc("POST /supplement/{gtin}/restore", restoreSupplementHandler(service))
+}
+
+// actorHeader names who makes a request, as set by the gateway or client in
+// front of the server. Changes made without it are recorded as anonymous.
+const actorHeader = "X-Actor"
+
+func withActor(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if actor := strings.TrimSpace(r.Header.Get(actorHeader)); actor != "" {
+			r = r.WithContext(supplement.WithActor(r.Context(), actor))
+		}
+		next.ServeHTTP(w, r)
+	})
 }
 
 func getSupplementHandler(service *supplement.SupplementService) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		gtin := r.PathValue("gtin")
 
+		basis, err := supplement.ParseBasis(r.URL.Query())
+
+		if err != nil {
+			handleError(err, w, r)
+			return
+		}
+
 		supplement, err := service.FindByGtin(r.Context(), gtin)
 
 		if err != nil {
-			handleError(err, w)
+			handleError(err, w, r)
 			return
 		}
 
-		w.WriteHeader(http.StatusOK)
 		w.Header().Set("Content-Type", "application/json")
-		err = json.NewEncoder(w).Encode(supplement)
+		w.Header().Set("ETag", etag(supplement.Version))
+		w.WriteHeader(http.StatusOK)
+		err = json.NewEncoder(w).Encode(supplement.Per(basis))
 		if err != nil {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
@@ -46,16 +77,63 @@ func getSupplementHandler(service *supplement.SupplementService) http.HandlerFun
 
 func listAllSupplementsHandler(service *supplement.SupplementService) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		supplements, err := service.ListAll(r.Context())
+		query, err := supplement.ParseListQuery(r.URL.Query())
+
+		if err != nil {
+			handleError(err, w, r)
+			return
+		}
+
+		basis, err := supplement.ParseBasis(r.URL.Query())
+
+		if err != nil {
+			handleError(err, w, r)
+			return
+		}
+
+		page, err := service.ListAll(r.Context(), query)
 
 		if err != nil {
-			handleError(err, w)
+			handleError(err, w, r)
 			return
 		}
 
+		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(http.StatusOK)
+		err = json.NewEncoder(w).Encode(page.Per(basis))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+}
+
+func searchSupplementsHandler(service *supplement.SupplementService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		query, err := supplement.ParseSearchQuery(r.URL.Query())
+
+		if err != nil {
+			handleError(err, w, r)
+			return
+		}
+
+		basis, err := supplement.ParseBasis(r.URL.Query())
+
+		if err != nil {
+			handleError(err, w, r)
+			return
+		}
+
+		supplements, err := service.Search(r.Context(), query)
+
+		if err != nil {
+			handleError(err, w, r)
+			return
+		}
+
 		w.Header().Set("Content-Type", "application/json")
-		err = json.NewEncoder(w).Encode(supplements)
+		w.WriteHeader(http.StatusOK)
+		err = json.NewEncoder(w).Encode(supplement.Page{Supplements: supplements}.Per(basis))
 		if err != nil {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
@@ -63,46 +141,286 @@ func listAllSupplementsHandler(service *supplement.SupplementService) http.Handl
 	}
 }
 
+// exportSupplementsHandler streams the export as it is read. An error after
+// the first supplement can no longer be answered with a problem, so the
+// response is aborted instead and the client sees a truncated download. The
+// write deadline moves with every supplement, so that the server's write
+// timeout bounds a stalled client rather than the whole download.
+func exportSupplementsHandler(service *supplement.SupplementService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		query, err := supplement.ParseListQuery(r.URL.Query())
+
+		if err != nil {
+			handleError(err, w, r)
+			return
+		}
+
+		format, err := supplement.ParseExportFormat(r.URL.Query())
+
+		if err != nil {
+			handleError(err, w, r)
+			return
+		}
+
+		w.Header().Set("Content-Type", format.ContentType())
+		w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": format.Filename()}))
+		export := supplement.NewExportWriter(w, format)
+		started := false
+
+		err = service.Export(r.Context(), query, func(s supplement.Supplement) error {
+			started = true
+			extendWriteDeadline(w, r)
+			return export.Write(s)
+		})
+
+		if err != nil && !started {
+			w.Header().Del("Content-Disposition")
+			handleError(err, w, r)
+			return
+		}
+
+		if err == nil {
+			err = export.Close()
+		}
+
+		if err != nil {
+			log.Printf("%s %s: %v", r.Method, r.URL.Path, err)
+			panic(http.ErrAbortHandler)
+		}
+	}
+}
+
+// extendWriteDeadline gives the response another write timeout of the
+// server from now. Without a server or a timeout, as in tests, it does
+// nothing.
+func extendWriteDeadline(w http.ResponseWriter, r *http.Request) {
+	server, ok := r.Context().Value(http.ServerContextKey).(*http.Server)
+	if !ok || server.WriteTimeout <= 0 {
+		return
+	}
+
+	err := http.NewResponseController(w).SetWriteDeadline(time.Now().Add(server.WriteTimeout))
+	if err != nil && !errors.Is(err, http.ErrNotSupported) {
+		log.Printf("%s %s: could not extend write deadline: %v", r.Method, r.URL.Path, err)
+	}
+}
+
+// extendReadDeadline gives the request body another read timeout of the
+// server from now. Without a server or a timeout, as in tests, it does
+// nothing.
+func extendReadDeadline(w http.ResponseWriter, r *http.Request) {
+	server, ok := r.Context().Value(http.ServerContextKey).(*http.Server)
+	if !ok || server.ReadTimeout <= 0 {
+		return
+	}
+
+	err := http.NewResponseController(w).SetReadDeadline(time.Now().Add(server.ReadTimeout))
+	if err != nil && !errors.Is(err, http.ErrNotSupported) {
+		log.Printf("%s %s: could not extend read deadline: %v", r.Method, r.URL.Path, err)
+	}
+}
+
+// deadlineBody extends the read deadline before every read of the body of
+// r, so that the read timeout bounds how long a client stalls rather than how
+// long its whole upload takes.
+type deadlineBody struct {
+	io.ReadCloser
+	w http.ResponseWriter
+	r *http.Request
+}
+
+func (b deadlineBody) Read(p []byte) (int, error) {
+	extendReadDeadline(b.w, b.r)
+	return b.ReadCloser.Read(p)
+}
+
 func createSupplementHandler(service *supplement.SupplementService) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		var supplement supplement.Supplement
-		err := json.NewDecoder(r.Body).Decode(&supplement)
+		var s supplement.Supplement
+		err := json.NewDecoder(r.Body).Decode(&s)
 		defer r.Body.Close()
 
 		if err != nil {
-			handleError(err, w)
+			handleError(err, w, r)
 			return
 		}
 
-		err = service.Create(r.Context(), supplement)
+		err = service.Create(r.Context(), s)
 
 		if err != nil {
-			handleError(err, w)
+			handleError(err, w, r)
 			return
 		}
 
+		gtin, _ := supplement.NormalizeGtin(s.Gtin)
+		w.Header().Add("Location", "/supplement/"+gtin)
 		w.WriteHeader(http.StatusCreated)
-		w.Header().Add("Location", "/supplement/"+supplement.Gtin)
 	}
 }
 
-func updateSupplementHandler(service *supplement.SupplementService) http.HandlerFunc {
+// importFormats maps the media types an import can be sent as to its format.
+var importFormats = map[string]supplement.ImportFormat{
+	"text/csv":             supplement.ImportCSV,
+	"application/x-ndjson": supplement.ImportNDJSON,
+	"application/ndjson":   supplement.ImportNDJSON,
+}
+
+const acceptImport = "text/csv, application/x-ndjson, application/ndjson"
+
+// maxImportBytes is the largest import file accepted.
+const maxImportBytes = 32 << 20
+
+// importSupplementsHandler answers 422 Unprocessable Entity, with the report,
+// when invalid records stopped an all-or-nothing import from being committed,
+// and 413 Content Too Large for files over maxImportBytes. As uploading and
+// importing may outlast the server timeouts, the read timeout applies to each
+// read of the file, and the report gets a whole write timeout once it is
+// ready.
+func importSupplementsHandler(service *supplement.SupplementService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		r.Body = deadlineBody{ReadCloser: http.MaxBytesReader(w, r.Body, maxImportBytes), w: w, r: r}
+		defer r.Body.Close()
+
+		options, err := supplement.ParseImportOptions(r.URL.Query())
+
+		if err != nil {
+			handleError(err, w, r)
+			return
+		}
+
+		mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+		format, ok := importFormats[mediaType]
+
+		if !ok {
+			w.Header().Set("Accept-Post", acceptImport)
+			handleError(fmt.Errorf("%w: %q, expected one of %s", problem.ErrUnsupportedMediaType, mediaType, acceptImport), w, r)
+			return
+		}
+
+		records, err := supplement.ReadImport(r.Body, format, options.Mapping)
+
+		if err != nil {
+			handleError(err, w, r)
+			return
+		}
+
+		report, err := service.Import(r.Context(), records, options)
+		extendWriteDeadline(w, r)
+
+		if err != nil {
+			handleError(err, w, r)
+			return
+		}
+
+		status := http.StatusOK
+		if !report.Committed && !report.DryRun {
+			status = http.StatusUnprocessableEntity
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		err = json.NewEncoder(w).Encode(report)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+}
+
+type batchRequest struct {
+	Atomic     bool                        `json:"atomic"`
+	Operations []supplement.BatchOperation `json:"operations"`
+}
+
+type batchResponse struct {
+	Atomic    bool          `json:"atomic"`
+	Committed bool          `json:"committed"`
+	Results   []batchResult `json:"results"`
+}
+
+// batchResult has the status the operation would have been answered with
+// on its own and, if it failed, the problem.
+type batchResult struct {
+	Op      supplement.BatchOp `json:"op"`
+	Gtin    string             `json:"gtin,omitempty"`
+	Status  int                `json:"status"`
+	Problem *problem.Details   `json:"problem,omitempty"`
+}
+
+var batchStatuses = map[supplement.BatchOp]int{
+	supplement.BatchCreate: http.StatusCreated,
+	supplement.BatchUpdate: http.StatusOK,
+	supplement.BatchDelete: http.StatusNoContent,
+}
+
+func batchSupplementsHandler(service *supplement.SupplementService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var batch batchRequest
+		err := json.NewDecoder(r.Body).Decode(&batch)
+		defer r.Body.Close()
+
+		if err != nil {
+			handleError(err, w, r)
+			return
+		}
+
+		results, committed, err := service.Batch(r.Context(), batch.Operations, batch.Atomic)
+
+		if err != nil {
+			handleError(err, w, r)
+			return
+		}
+
+		response := batchResponse{Atomic: batch.Atomic, Committed: committed, Results: make([]batchResult, len(results))}
+		for i, result := range results {
+			response.Results[i] = batchResult{Op: result.Op, Gtin: result.Gtin, Status: batchStatuses[result.Op]}
+			if result.Err != nil {
+				details := problemDetails(result.Err, r)
+				response.Results[i].Status, response.Results[i].Problem = details.Status, &details
+			}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		err = json.NewEncoder(w).Encode(response)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+}
+
+func replaceSupplementHandler(service *supplement.SupplementService) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		gtin := r.PathValue("gtin")
 
-		var supplement supplement.UpdatableSupplement
-		err := json.NewDecoder(r.Body).Decode(&supplement)
+		var s supplement.Supplement
+		err := json.NewDecoder(r.Body).Decode(&s)
 		defer r.Body.Close()
 
 		if err != nil {
-			handleError(err, w)
+			handleError(err, w, r)
 			return
 		}
 
-		err = service.Update(r.Context(), gtin, supplement)
+		version, err := ifMatchVersion(r, gtin)
 
 		if err != nil {
-			handleError(err, w)
+			handleError(err, w, r)
+			return
+		}
+
+		created, err := service.Replace(r.Context(), gtin, s, version)
+
+		if err != nil {
+			handleError(err, w, r)
+			return
+		}
+
+		if created {
+			normalized, _ := supplement.NormalizeGtin(gtin)
+			w.Header().Add("Location", "/supplement/"+normalized)
+			w.WriteHeader(http.StatusCreated)
 			return
 		}
 
@@ -110,14 +428,84 @@ func updateSupplementHandler(service *supplement.SupplementService) http.Handler
 	}
 }
 
+// acceptPatch lists the media types PATCH understands. Plain JSON, also
+// assumed when no Content-Type is sent, is a partial UpdatableSupplement.
+const acceptPatch = "application/json, " + supplement.MergePatchContentType + ", " + supplement.JSONPatchContentType
+
+func updateSupplementHandler(service *supplement.SupplementService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		gtin := r.PathValue("gtin")
+		defer r.Body.Close()
+
+		version, err := ifMatchVersion(r, gtin)
+
+		if err != nil {
+			handleError(err, w, r)
+			return
+		}
+
+		mediaType := "application/json"
+		if contentType := r.Header.Get("Content-Type"); contentType != "" {
+			mediaType, _, _ = mime.ParseMediaType(contentType)
+		}
+
+		switch mediaType {
+		case "application/json":
+			var updatable supplement.UpdatableSupplement
+			err = json.NewDecoder(r.Body).Decode(&updatable)
+			if err == nil {
+				err = service.Update(r.Context(), gtin, updatable, version)
+			}
+		case supplement.MergePatchContentType, supplement.JSONPatchContentType:
+			err = patchSupplement(r, service, gtin, mediaType, version)
+		default:
+			w.Header().Set("Accept-Patch", acceptPatch)
+			err = fmt.Errorf("%w: %q, expected one of %s", problem.ErrUnsupportedMediaType, mediaType, acceptPatch)
+		}
+
+		if err != nil {
+			handleError(err, w, r)
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+	}
+}
+
+func patchSupplement(r *http.Request, service *supplement.SupplementService, gtin, mediaType string, version int64) error {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		return err
+	}
+
+	var patch supplement.Patch
+	if mediaType == supplement.MergePatchContentType {
+		patch, err = supplement.NewMergePatch(body)
+	} else {
+		patch, err = supplement.NewJSONPatch(body)
+	}
+	if err != nil {
+		return err
+	}
+
+	return service.Patch(r.Context(), gtin, patch, version)
+}
+
 func deleteSupplementHandler(service *supplement.SupplementService) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		gtin := r.PathValue("gtin")
 
-		err := service.Delete(r.Context(), gtin)
+		version, err := ifMatchVersion(r, gtin)
+
+		if err != nil {
+			handleError(err, w, r)
+			return
+		}
+
+		err = service.Delete(r.Context(), gtin, version)
 
 		if err != nil {
-			handleError(err, w)
+			handleError(err, w, r)
 			return
 		}
 
@@ -125,39 +513,96 @@ func deleteSupplementHandler(service *supplement.SupplementService) http.Handler
 	}
 }
 
-func handleError(err error, w http.ResponseWriter) {
-	message := err.Error()
-	var code int
-
-	var syntaxErr *json.SyntaxError
-	var unmarshalTypeErr *json.UnmarshalTypeError
-	var invalidUnmarshalErr *json.InvalidUnmarshalError
-	var unsupportedTypeError *json.UnsupportedTypeError
-	var unsupportedValueErr *json.UnsupportedValueError
-
-	switch {
-	case errors.Is(err, supplement.ErrNotFound):
-		code = http.StatusNotFound
-	case errors.Is(err, supplement.ErrAlreadyExists):
-		code = http.StatusConflict
-	case
-		errors.Is(err, io.EOF),
-		errors.As(err, &syntaxErr),
-		errors.As(err, &unmarshalTypeErr),
-		errors.As(err, &invalidUnmarshalErr),
-		errors.As(err, &unsupportedTypeError),
-		errors.As(err, &unsupportedValueErr),
-		errors.Is(err, supplement.ErrInvalidSupplement):
-		code = http.StatusBadRequest
-	default:
-		code = http.StatusInternalServerError
-	}
-
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(code)
-	encodeErr := json.NewEncoder(w).Encode(ErrorResponseBody{Code: code, Message: message})
+func restoreSupplementHandler(service *supplement.SupplementService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		gtin := r.PathValue("gtin")
+
+		supplement, err := service.Restore(r.Context(), gtin)
+
+		if err != nil {
+			handleError(err, w, r)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("ETag", etag(supplement.Version))
+		w.WriteHeader(http.StatusOK)
+		err = json.NewEncoder(w).Encode(supplement)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+}
+
+func supplementHistoryHandler(service *supplement.SupplementService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		gtin := r.PathValue("gtin")
+
+		history, err := service.History(r.Context(), gtin)
+
+		if err != nil {
+			handleError(err, w, r)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		err = json.NewEncoder(w).Encode(history)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+}
+
+func etag(version int64) string {
+	return `"` + strconv.FormatInt(version, 10) + `"`
+}
+
+// ifMatchVersion returns the version required by the If-Match header, or 0
+// when there is no header or it is "*". Anything other than a single strong
+// ETag issued by this server can never match.
+func ifMatchVersion(r *http.Request, gtin string) (int64, error) {
+	ifMatch := strings.TrimSpace(r.Header.Get("If-Match"))
+	if ifMatch == "" || ifMatch == "*" {
+		return 0, nil
+	}
+
+	mismatch := &supplement.GtinError{Gtin: gtin, Err: supplement.ErrPreconditionFailed}
+	if len(ifMatch) < 3 || ifMatch[0] != '"' || ifMatch[len(ifMatch)-1] != '"' {
+		return 0, mismatch
+	}
+
+	version, err := strconv.ParseInt(ifMatch[1:len(ifMatch)-1], 10, 64)
+	if err != nil || version < 1 {
+		return 0, mismatch
+	}
+
+	return version, nil
+}
+
+func handleError(err error, w http.ResponseWriter, r *http.Request) {
+	details := problemDetails(err, r)
+
+	w.Header().Set("Content-Type", problem.ContentType)
+	w.WriteHeader(details.Status)
+	encodeErr := json.NewEncoder(w).Encode(details)
 	if encodeErr != nil {
 		http.Error(w, encodeErr.Error(), http.StatusInternalServerError)
 		return
 	}
 }
+
+// problemDetails maps err, the failure of r, to its problem details, logging
+// unknown errors.
+func problemDetails(err error, r *http.Request) problem.Details {
+	details := problem.FromError(err)
+	details.Instance = r.URL.Path
+
+	if details.Status == http.StatusInternalServerError {
+		log.Printf("%s %s: %v", r.Method, r.URL.Path, err)
+	}
+
+	return details
+}
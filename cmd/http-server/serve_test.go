@@ -0,0 +1,65 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestServe(t *testing.T) {
+	t.Parallel()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	started := make(chan struct{})
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		// Outlive the start of the shutdown.
+		<-ctx.Done()
+		time.Sleep(100 * time.Millisecond)
+		io.WriteString(w, "done")
+	}))
+	url := "http://" + server.Listener.Addr().String()
+	readiness := NewReadiness()
+
+	served := make(chan error, 1)
+	go func() {
+		served <- serve(ctx, server.Config, server.Listener, readiness, config{shutdownTimeout: 5 * time.Second})
+	}()
+
+	type result struct {
+		body string
+		err  error
+	}
+	inFlight := make(chan result, 1)
+	go func() {
+		response, err := http.Get(url)
+		if err != nil {
+			inFlight <- result{err: err}
+			return
+		}
+		defer response.Body.Close()
+		body, err := io.ReadAll(response.Body)
+		inFlight <- result{body: string(body), err: err}
+	}()
+
+	<-started
+	cancel()
+
+	got := <-inFlight
+	if got.err != nil || got.body != "done" {
+		t.Errorf("in-flight request = %q, %v, want it to finish", got.body, got.err)
+	}
+	if err := <-served; err != nil {
+		t.Errorf("serve() error = %v, want nil", err)
+	}
+	if status := readiness.Report(context.Background()).Status; status != "shutting down" {
+		t.Errorf("readiness status = %q, want %q", status, "shutting down")
+	}
+	if _, err := http.Get(url); err == nil {
+		t.Error("request after shutdown succeeded, want the listener closed")
+	}
+}
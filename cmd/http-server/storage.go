@@ -0,0 +1,143 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+
+	"github.com/marioromandono/supplementapp/internal/supplement"
+	"github.com/marioromandono/supplementapp/internal/supplement/persistence/memory"
+	"github.com/marioromandono/supplementapp/internal/supplement/persistence/postgres"
+	"github.com/marioromandono/supplementapp/internal/supplement/persistence/sqlite"
+	"github.com/marioromandono/supplementapp/migrations"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/pressly/goose/v3"
+)
+
+// storage is the repository selected by the STORAGE setting, together with
+// what is needed to migrate and health check whatever backs it. The memory
+// storage has no schema, so its migration fields are nil.
+type storage struct {
+	repository    supplement.SupplementRepository
+	ping          Check
+	migrations    *goose.Provider
+	embedded      fs.FS
+	schemaVersion func(ctx context.Context) (int64, error)
+	close         func()
+}
+
+func openStorage(ctx context.Context, config config) (storage, error) {
+	switch config.storage {
+	case "sqlite":
+		return openSQLite(ctx, config.sqlitePath)
+	case "memory":
+		return storage{repository: memory.NewSupplementRepository(), close: func() {}}, nil
+	default:
+		return openPostgres(ctx, config.postgresURL)
+	}
+}
+
+func openPostgres(ctx context.Context, url string) (storage, error) {
+	db, err := pgxpool.New(ctx, url)
+	if err != nil {
+		return storage{}, fmt.Errorf("could not create postgres pool: %w", err)
+	}
+
+	if err = db.Ping(ctx); err != nil {
+		db.Close()
+		return storage{}, fmt.Errorf("could not connect to postgres: %w", err)
+	}
+
+	provider, err := postgres.NewMigrationProvider(db)
+	if err != nil {
+		db.Close()
+		return storage{}, fmt.Errorf("could not load postgres migrations: %w", err)
+	}
+
+	return storage{
+		repository: postgres.NewSupplementRepository(db),
+		ping:       Check{Name: "postgres", Run: db.Ping},
+		migrations: provider,
+		embedded:   migrations.Postgres,
+		schemaVersion: func(ctx context.Context) (int64, error) {
+			return postgres.SchemaVersion(ctx, db)
+		},
+		close: db.Close,
+	}, nil
+}
+
+// openSQLite brings the file up to date on open, so there is nothing left
+// for MIGRATE_ON_START to do, but the migrate command still works on it.
+func openSQLite(ctx context.Context, path string) (storage, error) {
+	db, err := sqlite.Open(ctx, path)
+	if err != nil {
+		return storage{}, err
+	}
+
+	provider, err := sqlite.NewMigrationProvider(db)
+	if err != nil {
+		db.Close()
+		return storage{}, fmt.Errorf("could not load sqlite migrations: %w", err)
+	}
+
+	return storage{
+		repository: sqlite.NewSupplementRepository(db),
+		ping:       Check{Name: "sqlite", Run: db.PingContext},
+		migrations: provider,
+		embedded:   migrations.SQLite,
+		schemaVersion: func(ctx context.Context) (int64, error) {
+			return sqlite.SchemaVersion(ctx, db)
+		},
+		close: func() { db.Close() },
+	}, nil
+}
+
+// prepareSchema applies the pending migrations when migrateOnStart is set,
+// then checks the schema the server is about to serve.
+func prepareSchema(ctx context.Context, store storage, migrateOnStart bool) error {
+	if migrateOnStart && store.migrations != nil {
+		if err := migrate(ctx, store, []string{"up"}, log.Writer()); err != nil {
+			return err
+		}
+	}
+
+	return store.checkSchema(ctx)
+}
+
+// checkSchema refuses to serve a database migrated by a newer build, whose
+// schema this binary may misread or corrupt. Pending migrations only make
+// the server not ready.
+func (s storage) checkSchema(ctx context.Context) error {
+	if s.schemaVersion == nil {
+		return nil
+	}
+
+	version, err := s.schemaVersion(ctx)
+	if err != nil {
+		return fmt.Errorf("could not read schema version: %w", err)
+	}
+
+	err = migrations.Compare(version, s.embedded)
+	if errors.Is(err, migrations.ErrSchemaBehind) {
+		log.Printf("%v, run \"migrate up\" or set MIGRATE_ON_START=true", err)
+		return nil
+	}
+	return err
+}
+
+func (s storage) checks() []Check {
+	if s.schemaVersion == nil {
+		return nil
+	}
+
+	return []Check{s.ping, {Name: "migrations", Run: func(ctx context.Context) error {
+		version, err := s.schemaVersion(ctx)
+		if err != nil {
+			return err
+		}
+		return migrations.Compare(version, s.embedded)
+	}}}
+}
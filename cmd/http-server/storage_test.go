@@ -0,0 +1,204 @@
+package main_test
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"errors"
+	"io/fs"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/marioromandono/supplementapp/cmd/http-server"
+	"github.com/marioromandono/supplementapp/internal/supplement/persistence/postgres"
+	"github.com/marioromandono/supplementapp/internal/supplement/persistence/repotest"
+	"github.com/marioromandono/supplementapp/migrations"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// schemaDatabase is a database for the schema tests. setUp, run before the
+// storage is opened, and change, run after, put it in the state under test.
+type schemaDatabase struct {
+	env    func(t *testing.T, ctx context.Context) map[string]string
+	setUp  func(t *testing.T, ctx context.Context, env map[string]string)
+	change func(t *testing.T, ctx context.Context, env map[string]string, store main.Storage)
+}
+
+var nonWord = regexp.MustCompile(`\W+`)
+
+func sqliteEnv(t *testing.T, ctx context.Context) map[string]string {
+	return map[string]string{"STORAGE": "sqlite", "SQLITE_PATH": filepath.Join(t.TempDir(), "supplementapp.db")}
+}
+
+func postgresEnv(t *testing.T, ctx context.Context) map[string]string {
+	if testing.Short() {
+		t.Skip("skipping integration test")
+	}
+	name := "schema_" + nonWord.ReplaceAllString(strings.ToLower(t.Name()), "_")
+	return map[string]string{"STORAGE": "postgres", "POSTGRES_URL": repotest.NewPostgresDatabase(t, ctx, dbUrl, name)}
+}
+
+// migratePostgresTo applies the Postgres migrations up to version.
+func migratePostgresTo(version int64) func(t *testing.T, ctx context.Context, env map[string]string) {
+	return func(t *testing.T, ctx context.Context, env map[string]string) {
+		db, err := pgxpool.New(ctx, env["POSTGRES_URL"])
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer db.Close()
+		provider, err := postgres.NewMigrationProvider(db)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := provider.UpTo(ctx, version); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// recordNewerMigration marks a migration newer than any embedded one as
+// applied, as a newer build would have.
+func recordNewerMigration(t *testing.T, ctx context.Context, env map[string]string, store main.Storage) {
+	var embedded fs.FS = migrations.Postgres
+	if env["STORAGE"] == "sqlite" {
+		embedded = migrations.SQLite
+	}
+	latest, err := migrations.Latest(embedded)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if env["STORAGE"] == "sqlite" {
+		db, err := sql.Open("sqlite", env["SQLITE_PATH"])
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer db.Close()
+		if _, err := db.ExecContext(ctx, "INSERT INTO goose_db_version (version_id, is_applied) VALUES (?1, 1)", latest+1); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+
+	db, err := pgxpool.New(ctx, env["POSTGRES_URL"])
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if _, err := db.Exec(ctx, "INSERT INTO goose_db_version (version_id, is_applied) VALUES ($1, true)", latest+1); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func migrateStore(args ...string) func(t *testing.T, ctx context.Context, env map[string]string, store main.Storage) {
+	return func(t *testing.T, ctx context.Context, env map[string]string, store main.Storage) {
+		if err := store.Migrate(ctx, &bytes.Buffer{}, args...); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestPrepareSchema(t *testing.T) {
+	tests := []struct {
+		name           string
+		database       schemaDatabase
+		migrateOnStart bool
+		wantErr        error
+		wantReady      bool
+	}{
+		// SQLite files are migrated when opened, so they are never fresh.
+		{name: "sqlite migrated", database: schemaDatabase{env: sqliteEnv}, wantReady: true},
+		{name: "sqlite behind", database: schemaDatabase{env: sqliteEnv, change: migrateStore("down")}},
+		{name: "sqlite behind, migrate on start", database: schemaDatabase{env: sqliteEnv, change: migrateStore("down")}, migrateOnStart: true, wantReady: true},
+		{name: "sqlite ahead", database: schemaDatabase{env: sqliteEnv, change: recordNewerMigration}, wantErr: migrations.ErrSchemaAhead},
+		{name: "postgres fresh", database: schemaDatabase{env: postgresEnv}},
+		{name: "postgres fresh, migrate on start", database: schemaDatabase{env: postgresEnv}, migrateOnStart: true, wantReady: true},
+		{name: "postgres partly migrated", database: schemaDatabase{env: postgresEnv, setUp: migratePostgresTo(20261016100000)}},
+		{name: "postgres migrated", database: schemaDatabase{env: postgresEnv, change: migrateStore("up")}, wantReady: true},
+		{name: "postgres ahead", database: schemaDatabase{env: postgresEnv, change: func(t *testing.T, ctx context.Context, env map[string]string, store main.Storage) {
+			migrateStore("up")(t, ctx, env, store)
+			recordNewerMigration(t, ctx, env, store)
+		}}, wantErr: migrations.ErrSchemaAhead},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			env := tt.database.env(t, ctx)
+			if tt.migrateOnStart {
+				env["MIGRATE_ON_START"] = "true"
+			}
+			if tt.database.setUp != nil {
+				tt.database.setUp(t, ctx, env)
+			}
+			store, err := main.OpenStorage(ctx, env)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer store.Close()
+			if tt.database.change != nil {
+				tt.database.change(t, ctx, env, store)
+			}
+
+			err = store.PrepareSchema(ctx)
+
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("PrepareSchema() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			report := store.Readiness().Report(ctx)
+			if got := report.Status == "ready"; got != tt.wantReady {
+				t.Errorf("readiness = %+v, want ready %v", report, tt.wantReady)
+			}
+			if migrationsCheck := report.Checks["migrations"]; !tt.wantReady && !strings.Contains(migrationsCheck.Error, migrations.ErrSchemaBehind.Error()) {
+				t.Errorf("migrations check = %+v, want it behind", migrationsCheck)
+			}
+		})
+	}
+}
+
+func TestMigrateCommand(t *testing.T) {
+	ctx := context.Background()
+	store, err := main.OpenStorage(ctx, sqliteEnv(t, ctx))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+
+	steps := []struct {
+		args    []string
+		want    string
+		wantErr bool
+	}{
+		{args: []string{"up"}, want: "no pending migrations"},
+		{args: []string{"down"}, want: "rolled back 20261016180000_add_supplement_deleted_at.sql"},
+		{args: []string{"status"}, want: `20261016170000_create_supplement_audit_log.sql +applied .*\n20261016180000_add_supplement_deleted_at.sql +pending +-\n`},
+		{args: []string{"up"}, want: "applied 20261016180000_add_supplement_deleted_at.sql"},
+		{args: []string{"sideways"}, wantErr: true},
+		{args: []string{}, wantErr: true},
+	}
+	for _, step := range steps {
+		var out bytes.Buffer
+
+		err := store.Migrate(ctx, &out, step.args...)
+
+		if (err != nil) != step.wantErr {
+			t.Fatalf("migrate %v error = %v, wantErr %v", step.args, err, step.wantErr)
+		}
+		if !regexp.MustCompile(step.want).MatchString(out.String()) {
+			t.Errorf("migrate %v printed %q, want it to contain %q", step.args, out.String(), step.want)
+		}
+	}
+
+	memory, err := main.OpenStorage(ctx, map[string]string{"STORAGE": "memory"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := memory.Migrate(ctx, &bytes.Buffer{}, "up"); err == nil {
+		t.Error("migrate up on the memory storage succeeded, want an error")
+	}
+}
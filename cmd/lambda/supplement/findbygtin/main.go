@@ -3,12 +3,14 @@ package main
 import (
 	"context"
 	"encoding/json"
-	"errors"
 	"log"
+	"net/url"
 	"os"
 
+	"github.com/marioromandono/supplementapp/internal/problem"
 	"github.com/marioromandono/supplementapp/internal/supplement"
 	"github.com/marioromandono/supplementapp/internal/supplement/persistence/postgres"
+	"github.com/marioromandono/supplementapp/internal/supplement/persistence/sqlite"
 
 	"github.com/aws/aws-lambda-go/events"
 	"github.com/aws/aws-lambda-go/lambda"
@@ -29,24 +31,26 @@ func (ls *LambdaHandler) Handle(ctx context.Context, r events.APIGatewayV2HTTPRe
 
 	log.Printf("REQUEST: %s", gtin)
 
-	s, err := ls.service.FindByGtin(ctx, gtin)
+	values := url.Values{}
+	for k, v := range r.QueryStringParameters {
+		values.Set(k, v)
+	}
+
+	basis, err := supplement.ParseBasis(values)
 
 	if err != nil {
-		var statusCode int
+		return errorResponse(err, r), nil
+	}
 
-		switch {
-		case errors.Is(err, supplement.ErrNotFound):
-			statusCode = 404
-		default:
-			statusCode = 500
-		}
+	s, err := ls.service.FindByGtin(ctx, gtin)
 
-		return events.APIGatewayV2HTTPResponse{Body: err.Error(), StatusCode: statusCode}, nil
+	if err != nil {
+		return errorResponse(err, r), nil
 	}
 
-	sJson, err := json.Marshal(s)
+	sJson, err := json.Marshal(s.Per(basis))
 	if err != nil {
-		return events.APIGatewayV2HTTPResponse{Body: err.Error(), StatusCode: 500}, nil
+		return errorResponse(err, r), nil
 	}
 	response := events.APIGatewayV2HTTPResponse{Body: string(sJson), StatusCode: 200}
 
@@ -55,15 +59,49 @@ func (ls *LambdaHandler) Handle(ctx context.Context, r events.APIGatewayV2HTTPRe
 	return response, nil
 }
 
+func errorResponse(err error, r events.APIGatewayV2HTTPRequest) events.APIGatewayV2HTTPResponse {
+	details := problem.FromError(err)
+	details.Instance = r.RawPath
+
+	if details.Status == 500 {
+		log.Printf("ERROR: %v", err)
+	}
+
+	detailsJson, marshalErr := json.Marshal(details)
+	if marshalErr != nil {
+		return events.APIGatewayV2HTTPResponse{Body: marshalErr.Error(), StatusCode: 500}
+	}
+
+	return events.APIGatewayV2HTTPResponse{
+		Body:       string(detailsJson),
+		StatusCode: details.Status,
+		Headers:    map[string]string{"Content-Type": problem.ContentType},
+	}
+}
+
 func NewLambdaHandler(service *supplement.SupplementService) *LambdaHandler {
 	return &LambdaHandler{service: service}
 }
 
 func createSupplementService() *supplement.SupplementService {
-	repo := createPostgresSupplementRepository()
+	repo := createSupplementRepository()
 	return supplement.NewSupplementService(repo)
 }
 
+// createSupplementRepository opens the storage selected by STORAGE:
+// "postgres" (the default) or "sqlite".
+func createSupplementRepository() supplement.SupplementRepository {
+	switch storage := os.Getenv("STORAGE"); storage {
+	case "", "postgres":
+		return createPostgresSupplementRepository()
+	case "sqlite":
+		return createSQLiteSupplementRepository()
+	default:
+		log.Fatalf("STORAGE %q is invalid, it must be postgres or sqlite", storage)
+		return nil
+	}
+}
+
 func createPostgresSupplementRepository() *postgres.PostgresSupplementRepository {
 	db, err := pgxpool.New(context.Background(), os.Getenv("POSTGRES_URL"))
 	if err != nil {
@@ -76,3 +114,17 @@ func createPostgresSupplementRepository() *postgres.PostgresSupplementRepository
 
 	return postgres.NewSupplementRepository(db)
 }
+
+func createSQLiteSupplementRepository() *sqlite.SQLiteSupplementRepository {
+	path := os.Getenv("SQLITE_PATH")
+	if path == "" {
+		path = "supplementapp.db"
+	}
+
+	db, err := sqlite.Open(context.Background(), path)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	return sqlite.NewSupplementRepository(db)
+}
@@ -9,8 +9,10 @@ import (
 
 	"github.com/google/go-cmp/cmp"
 	"github.com/marioromandono/supplementapp/cmd/lambda/supplement/findbygtin"
+	"github.com/marioromandono/supplementapp/internal/problem"
 	"github.com/marioromandono/supplementapp/internal/supplement"
 	"github.com/marioromandono/supplementapp/internal/supplement/persistence/postgres"
+	"github.com/marioromandono/supplementapp/internal/supplement/persistence/repotest"
 
 	"github.com/aws/aws-lambda-go/events"
 	"github.com/jackc/pgx/v5/pgxpool"
@@ -54,33 +56,17 @@ func TestMain(m *testing.M) {
 		panic(err)
 	}
 
-	_, _, err = container.Exec(ctx, []string{
-		"psql", "-U", dbUser, "-d", dbName, "-c",
-		"CREATE TABLE " + tableName + " ( " +
-			"id INT GENERATED ALWAYS AS IDENTITY PRIMARY KEY, " +
-			"gtin VARCHAR UNIQUE, " +
-			"name VARCHAR, " +
-			"brand VARCHAR, " +
-			"flavor VARCHAR, " +
-			"carbohydrates REAL, " +
-			"electrolytes REAL, " +
-			"maltodextrose REAL, " +
-			"fructose REAL, " +
-			"caffeine REAL, " +
-			"sodium REAL, " +
-			"protein REAL " +
-			")",
-	})
+	dbUrl, err = container.ConnectionString(ctx)
 	if err != nil {
 		panic(err)
 	}
 
-	err = container.Snapshot(ctx, tcpostgres.WithSnapshotName("test-snapshot"))
+	err = repotest.MigratePostgres(ctx, dbUrl)
 	if err != nil {
 		panic(err)
 	}
 
-	dbUrl, err = container.ConnectionString(ctx)
+	err = container.Snapshot(ctx, tcpostgres.WithSnapshotName("test-snapshot"))
 	if err != nil {
 		panic(err)
 	}
@@ -106,13 +92,23 @@ func TestLambdaHandler(t *testing.T) {
 		dbPool := getPool(t, ctx)
 
 		gtin := "123"
+		detailsJson, _ := json.Marshal(problem.Details{
+			Type:     problem.TypeNotFound,
+			Title:    "Supplement not found",
+			Status:   404,
+			Detail:   fmt.Sprintf("%s: %v", gtin, supplement.ErrNotFound),
+			Instance: "/supplement/" + gtin,
+			Gtin:     gtin,
+		})
 		want := events.APIGatewayV2HTTPResponse{
-			Body:       fmt.Sprintf("%s: %v", gtin, supplement.ErrNotFound),
+			Body:       string(detailsJson),
 			StatusCode: 404,
+			Headers:    map[string]string{"Content-Type": problem.ContentType},
 		}
 
 		handler := main.NewLambdaHandler(supplement.NewSupplementService(postgres.NewSupplementRepository(dbPool)))
 		got, err := handler.Handle(ctx, events.APIGatewayV2HTTPRequest{
+			RawPath: "/supplement/" + gtin,
 			PathParameters: map[string]string{
 				"gtin": gtin,
 			},
@@ -131,21 +127,21 @@ func TestLambdaHandler(t *testing.T) {
 		dbPool := getPool(t, ctx)
 
 		s := supplement.Supplement{
-			Gtin:          "1234567890123",
+			Gtin:          "01234567890128",
 			Name:          "Test",
 			Brand:         "Test",
 			Flavor:        "Test",
-			Carbohydrates: 1.0,
-			Electrolytes:  1.0,
-			Maltodextrose: 1.0,
-			Fructose:      1.0,
-			Caffeine:      1.0,
-			Sodium:        1.0,
-			Protein:       1.0,
+			Carbohydrates: supplement.Grams(1.0),
+			Electrolytes:  supplement.Milligrams(1.0),
+			Maltodextrose: supplement.Grams(1.0),
+			Fructose:      supplement.Grams(1.0),
+			Caffeine:      supplement.Milligrams(1.0),
+			Sodium:        supplement.Milligrams(1.0),
+			Protein:       supplement.Grams(1.0),
 		}
 		insertSupplement(t, ctx, dbPool, s)
 
-		sJson, _ := json.Marshal(s)
+		sJson, _ := json.Marshal(repotest.InUnits(s).Per(supplement.PerServing))
 		want := events.APIGatewayV2HTTPResponse{
 			Body:       string(sJson),
 			StatusCode: 200,
@@ -165,6 +161,45 @@ func TestLambdaHandler(t *testing.T) {
 			t.Errorf("LambdaHandler() error (-got +want):\n%s", diff)
 		}
 	})
+
+	t.Run("existing by gtin-8", func(t *testing.T) {
+		ctx := context.Background()
+		t.Cleanup(func() {
+			err := container.Restore(ctx)
+			if err != nil {
+				t.Fatal(err)
+			}
+		})
+		dbPool := getPool(t, ctx)
+
+		s := supplement.Supplement{
+			Gtin:   "00000096385074",
+			Name:   "Test",
+			Brand:  "Test",
+			Flavor: "Test",
+		}
+		insertSupplement(t, ctx, dbPool, s)
+
+		sJson, _ := json.Marshal(repotest.InUnits(s).Per(supplement.PerServing))
+		want := events.APIGatewayV2HTTPResponse{
+			Body:       string(sJson),
+			StatusCode: 200,
+		}
+
+		handler := main.NewLambdaHandler(supplement.NewSupplementService(postgres.NewSupplementRepository(dbPool)))
+		got, err := handler.Handle(ctx, events.APIGatewayV2HTTPRequest{
+			PathParameters: map[string]string{
+				"gtin": "96385074",
+			},
+		})
+
+		if err != nil {
+			t.Errorf("LambdaHandler() error = %v, want nil", err)
+		}
+		if diff := cmp.Diff(got, want); diff != "" {
+			t.Errorf("LambdaHandler() error (-got +want):\n%s", diff)
+		}
+	})
 }
 
 func getPool(t *testing.T, ctx context.Context) *pgxpool.Pool {
@@ -186,9 +221,11 @@ func insertSupplement(t *testing.T, ctx context.Context, dbPool *pgxpool.Pool, s
 	_, err := dbPool.Exec(
 		ctx,
 		"INSERT INTO "+tableName+
-			" (gtin, name, brand, flavor, carbohydrates, electrolytes, maltodextrose, fructose, caffeine, sodium, protein) "+
-			"VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)",
-		s.Gtin, s.Name, s.Brand, s.Flavor, s.Carbohydrates, s.Electrolytes, s.Maltodextrose, s.Fructose, s.Caffeine, s.Sodium, s.Protein,
+			" (gtin, name, brand, flavor, carbohydrates, electrolytes, maltodextrose, fructose, caffeine, sodium, protein, version) "+
+			"VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)",
+		s.Gtin, s.Name, s.Brand, s.Flavor,
+		s.Carbohydrates.Amount, s.Electrolytes.Amount, s.Maltodextrose.Amount, s.Fructose.Amount, s.Caffeine.Amount, s.Sodium.Amount, s.Protein.Amount,
+		s.Version,
 	)
 
 	if err != nil {
@@ -4,10 +4,13 @@ import (
 	"context"
 	"encoding/json"
 	"log"
+	"net/url"
 	"os"
 
+	"github.com/marioromandono/supplementapp/internal/problem"
 	"github.com/marioromandono/supplementapp/internal/supplement"
 	"github.com/marioromandono/supplementapp/internal/supplement/persistence/postgres"
+	"github.com/marioromandono/supplementapp/internal/supplement/persistence/sqlite"
 
 	"github.com/aws/aws-lambda-go/events"
 	"github.com/aws/aws-lambda-go/lambda"
@@ -24,32 +27,89 @@ func main() {
 }
 
 func (ls *LambdaHandler) Handle(ctx context.Context, r events.APIGatewayV2HTTPRequest) (events.APIGatewayV2HTTPResponse, error) {
-	log.Printf("REQUEST: ListAll")
+	log.Printf("REQUEST: ListAll %v", r.QueryStringParameters)
 
-	ss, err := ls.service.ListAll(ctx)
+	values := url.Values{}
+	for k, v := range r.QueryStringParameters {
+		values.Set(k, v)
+	}
+
+	query, err := supplement.ParseListQuery(values)
+
+	if err != nil {
+		return errorResponse(err, r), nil
+	}
+
+	basis, err := supplement.ParseBasis(values)
 
 	if err != nil {
-		return events.APIGatewayV2HTTPResponse{Body: err.Error(), StatusCode: 500}, nil
+		return errorResponse(err, r), nil
 	}
 
-	ssJson, err := json.Marshal(ss)
+	page, err := ls.service.ListAll(ctx, query)
+
 	if err != nil {
-		return events.APIGatewayV2HTTPResponse{Body: err.Error(), StatusCode: 500}, nil
+		return errorResponse(err, r), nil
 	}
-	response := events.APIGatewayV2HTTPResponse{Body: string(ssJson), StatusCode: 200}
+
+	pageJson, err := json.Marshal(page.Per(basis))
+	if err != nil {
+		return errorResponse(err, r), nil
+	}
+	response := events.APIGatewayV2HTTPResponse{Body: string(pageJson), StatusCode: 200}
 
 	log.Printf("RESPONSE: %v", response)
 
 	return response, nil
 }
 
+func errorResponse(err error, r events.APIGatewayV2HTTPRequest) events.APIGatewayV2HTTPResponse {
+	details := problem.FromError(err)
+	details.Instance = r.RawPath
+
+	if details.Status == 500 {
+		log.Printf("ERROR: %v", err)
+	}
+
+	detailsJson, marshalErr := json.Marshal(details)
+	if marshalErr != nil {
+		return events.APIGatewayV2HTTPResponse{Body: marshalErr.Error(), StatusCode: 500}
+	}
+
+	return events.APIGatewayV2HTTPResponse{
+		Body:       string(detailsJson),
+		StatusCode: details.Status,
+		Headers:    map[string]string{"Content-Type": problem.ContentType},
+	}
+}
+
 func NewLambdaHandler(service *supplement.SupplementService) *LambdaHandler {
 	return &LambdaHandler{service: service}
 }
 
+// createSupplementService fails without CURSOR_SECRET, as every instance of
+// the function must sign cursors with the same key to accept each other's.
 func createSupplementService() *supplement.SupplementService {
-	repo := createPostgresSupplementRepository()
-	return supplement.NewSupplementService(repo)
+	key := os.Getenv("CURSOR_SECRET")
+	if key == "" {
+		log.Fatal("CURSOR_SECRET must be set, so that every instance accepts the cursors of the others")
+	}
+
+	return supplement.NewSupplementService(createSupplementRepository(), supplement.WithCursorKey([]byte(key)))
+}
+
+// createSupplementRepository opens the storage selected by STORAGE:
+// "postgres" (the default) or "sqlite".
+func createSupplementRepository() supplement.SupplementRepository {
+	switch storage := os.Getenv("STORAGE"); storage {
+	case "", "postgres":
+		return createPostgresSupplementRepository()
+	case "sqlite":
+		return createSQLiteSupplementRepository()
+	default:
+		log.Fatalf("STORAGE %q is invalid, it must be postgres or sqlite", storage)
+		return nil
+	}
 }
 
 func createPostgresSupplementRepository() *postgres.PostgresSupplementRepository {
@@ -64,3 +124,17 @@ func createPostgresSupplementRepository() *postgres.PostgresSupplementRepository
 
 	return postgres.NewSupplementRepository(db)
 }
+
+func createSQLiteSupplementRepository() *sqlite.SQLiteSupplementRepository {
+	path := os.Getenv("SQLITE_PATH")
+	if path == "" {
+		path = "supplementapp.db"
+	}
+
+	db, err := sqlite.Open(context.Background(), path)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	return sqlite.NewSupplementRepository(db)
+}
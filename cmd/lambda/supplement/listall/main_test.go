@@ -8,8 +8,10 @@ import (
 
 	"github.com/google/go-cmp/cmp"
 	"github.com/marioromandono/supplementapp/cmd/lambda/supplement/listall"
+	"github.com/marioromandono/supplementapp/internal/problem"
 	"github.com/marioromandono/supplementapp/internal/supplement"
 	"github.com/marioromandono/supplementapp/internal/supplement/persistence/postgres"
+	"github.com/marioromandono/supplementapp/internal/supplement/persistence/repotest"
 
 	"github.com/aws/aws-lambda-go/events"
 	"github.com/jackc/pgx/v5/pgxpool"
@@ -53,33 +55,17 @@ func TestMain(m *testing.M) {
 		panic(err)
 	}
 
-	_, _, err = container.Exec(ctx, []string{
-		"psql", "-U", dbUser, "-d", dbName, "-c",
-		"CREATE TABLE " + tableName + " ( " +
-			"id INT GENERATED ALWAYS AS IDENTITY PRIMARY KEY, " +
-			"gtin VARCHAR UNIQUE, " +
-			"name VARCHAR, " +
-			"brand VARCHAR, " +
-			"flavor VARCHAR, " +
-			"carbohydrates REAL, " +
-			"electrolytes REAL, " +
-			"maltodextrose REAL, " +
-			"fructose REAL, " +
-			"caffeine REAL, " +
-			"sodium REAL, " +
-			"protein REAL " +
-			")",
-	})
+	dbUrl, err = container.ConnectionString(ctx)
 	if err != nil {
 		panic(err)
 	}
 
-	err = container.Snapshot(ctx, tcpostgres.WithSnapshotName("test-snapshot"))
+	err = repotest.MigratePostgres(ctx, dbUrl)
 	if err != nil {
 		panic(err)
 	}
 
-	dbUrl, err = container.ConnectionString(ctx)
+	err = container.Snapshot(ctx, tcpostgres.WithSnapshotName("test-snapshot"))
 	if err != nil {
 		panic(err)
 	}
@@ -105,7 +91,7 @@ func TestLambdaHandler(t *testing.T) {
 		dbPool := getPool(t, ctx)
 
 		want := events.APIGatewayV2HTTPResponse{
-			Body:       "[]",
+			Body:       `{"supplements":[]}`,
 			StatusCode: 200,
 		}
 
@@ -132,37 +118,37 @@ func TestLambdaHandler(t *testing.T) {
 
 		ss := []supplement.Supplement{
 			{
-				Gtin:          "1234567890123",
+				Gtin:          "01234567890128",
 				Name:          "Test",
 				Brand:         "Test",
 				Flavor:        "Test",
-				Carbohydrates: 1.0,
-				Electrolytes:  1.0,
-				Maltodextrose: 1.0,
-				Fructose:      1.0,
-				Caffeine:      1.0,
-				Sodium:        1.0,
-				Protein:       1.0,
+				Carbohydrates: supplement.Grams(1.0),
+				Electrolytes:  supplement.Milligrams(1.0),
+				Maltodextrose: supplement.Grams(1.0),
+				Fructose:      supplement.Grams(1.0),
+				Caffeine:      supplement.Milligrams(1.0),
+				Sodium:        supplement.Milligrams(1.0),
+				Protein:       supplement.Grams(1.0),
 			},
 			{
-				Gtin:          "1234567890124",
+				Gtin:          "04006381333931",
 				Name:          "Test",
 				Brand:         "Test",
 				Flavor:        "Test",
-				Carbohydrates: 1.0,
-				Electrolytes:  1.0,
-				Maltodextrose: 1.0,
-				Fructose:      1.0,
-				Caffeine:      1.0,
-				Sodium:        1.0,
-				Protein:       1.0,
+				Carbohydrates: supplement.Grams(1.0),
+				Electrolytes:  supplement.Milligrams(1.0),
+				Maltodextrose: supplement.Grams(1.0),
+				Fructose:      supplement.Grams(1.0),
+				Caffeine:      supplement.Milligrams(1.0),
+				Sodium:        supplement.Milligrams(1.0),
+				Protein:       supplement.Grams(1.0),
 			},
 		}
 		for _, s := range ss {
 			insertSupplement(t, ctx, dbPool, s)
 		}
 
-		ssJson, _ := json.Marshal(ss)
+		ssJson, _ := json.Marshal(supplement.Page{Supplements: ss}.Per(supplement.PerServing))
 		want := events.APIGatewayV2HTTPResponse{
 			Body:       string(ssJson),
 			StatusCode: 200,
@@ -178,6 +164,105 @@ func TestLambdaHandler(t *testing.T) {
 			t.Errorf("LambdaHandler() error (-got +want):\n%s", diff)
 		}
 	})
+
+	t.Run("paginated", func(t *testing.T) {
+		ctx := context.Background()
+		t.Cleanup(func() {
+			err := container.Restore(ctx)
+			if err != nil {
+				t.Fatal(err)
+			}
+		})
+		dbPool := getPool(t, ctx)
+
+		ss := []supplement.Supplement{
+			{Gtin: "01234567890128", Name: "Test", Brand: "Test", Flavor: "Test"},
+			{Gtin: "04006381333931", Name: "Test", Brand: "Other", Flavor: "Test"},
+			{Gtin: "05901234123457", Name: "Test", Brand: "Test", Flavor: "Test"},
+		}
+		for _, s := range ss {
+			insertSupplement(t, ctx, dbPool, s)
+		}
+
+		handler := main.NewLambdaHandler(supplement.NewSupplementService(postgres.NewSupplementRepository(dbPool)))
+		got, err := handler.Handle(ctx, events.APIGatewayV2HTTPRequest{
+			QueryStringParameters: map[string]string{"brand": "test", "limit": "1"},
+		})
+
+		if err != nil {
+			t.Errorf("LambdaHandler() error = %v, want nil", err)
+		}
+
+		var page supplement.Page
+		if err := json.Unmarshal([]byte(got.Body), &page); err != nil {
+			t.Fatal(err)
+		}
+		if diff := cmp.Diff(page.Supplements, []supplement.Supplement{repotest.InUnits(ss[0])}); diff != "" {
+			t.Errorf("LambdaHandler() first page (-got +want):\n%s", diff)
+		}
+
+		got, err = handler.Handle(ctx, events.APIGatewayV2HTTPRequest{
+			QueryStringParameters: map[string]string{"brand": "test", "limit": "1", "cursor": page.Next},
+		})
+
+		if err != nil {
+			t.Errorf("LambdaHandler() error = %v, want nil", err)
+		}
+
+		ssJson, _ := json.Marshal(supplement.Page{Supplements: []supplement.Supplement{repotest.InUnits(ss[2])}}.Per(supplement.PerServing))
+		want := events.APIGatewayV2HTTPResponse{
+			Body:       string(ssJson),
+			StatusCode: 200,
+		}
+		if diff := cmp.Diff(got, want); diff != "" {
+			t.Errorf("LambdaHandler() error (-got +want):\n%s", diff)
+		}
+	})
+
+	t.Run("invalid query", func(t *testing.T) {
+		ctx := context.Background()
+		dbPool := getPool(t, ctx)
+
+		handler := main.NewLambdaHandler(supplement.NewSupplementService(postgres.NewSupplementRepository(dbPool)))
+		got, err := handler.Handle(ctx, events.APIGatewayV2HTTPRequest{
+			QueryStringParameters: map[string]string{"limit": "1000"},
+		})
+
+		if err != nil {
+			t.Errorf("LambdaHandler() error = %v, want nil", err)
+		}
+		if got.StatusCode != 400 {
+			t.Errorf("LambdaHandler() status code = %d, want 400", got.StatusCode)
+		}
+
+		var body problem.Details
+		if err := json.Unmarshal([]byte(got.Body), &body); err != nil {
+			t.Fatal(err)
+		}
+		if body.Type != problem.TypeInvalidQuery {
+			t.Errorf("LambdaHandler() problem type = %q, want %q", body.Type, problem.TypeInvalidQuery)
+		}
+		if len(body.Errors) != 1 || body.Errors[0].Field != "limit" || body.Errors[0].Rule != supplement.RuleRange {
+			t.Errorf("LambdaHandler() errors = %+v, want a single limit range violation", body.Errors)
+		}
+	})
+
+	t.Run("invalid cursor", func(t *testing.T) {
+		ctx := context.Background()
+		dbPool := getPool(t, ctx)
+
+		handler := main.NewLambdaHandler(supplement.NewSupplementService(postgres.NewSupplementRepository(dbPool)))
+		got, err := handler.Handle(ctx, events.APIGatewayV2HTTPRequest{
+			QueryStringParameters: map[string]string{"cursor": "tampered.cursor"},
+		})
+
+		if err != nil {
+			t.Errorf("LambdaHandler() error = %v, want nil", err)
+		}
+		if got.StatusCode != 400 {
+			t.Errorf("LambdaHandler() status code = %d, want 400", got.StatusCode)
+		}
+	})
 }
 
 func getPool(t *testing.T, ctx context.Context) *pgxpool.Pool {
@@ -199,9 +284,11 @@ func insertSupplement(t *testing.T, ctx context.Context, dbPool *pgxpool.Pool, s
 	_, err := dbPool.Exec(
 		ctx,
 		"INSERT INTO "+tableName+
-			" (gtin, name, brand, flavor, carbohydrates, electrolytes, maltodextrose, fructose, caffeine, sodium, protein) "+
-			"VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)",
-		s.Gtin, s.Name, s.Brand, s.Flavor, s.Carbohydrates, s.Electrolytes, s.Maltodextrose, s.Fructose, s.Caffeine, s.Sodium, s.Protein,
+			" (gtin, name, brand, flavor, carbohydrates, electrolytes, maltodextrose, fructose, caffeine, sodium, protein, version) "+
+			"VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)",
+		s.Gtin, s.Name, s.Brand, s.Flavor,
+		s.Carbohydrates.Amount, s.Electrolytes.Amount, s.Maltodextrose.Amount, s.Fructose.Amount, s.Caffeine.Amount, s.Sodium.Amount, s.Protein.Amount,
+		s.Version,
 	)
 
 	if err != nil {
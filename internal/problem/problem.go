@@ -0,0 +1,114 @@
+package problem
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+
+	"github.com/marioromandono/supplementapp/internal/supplement"
+)
+
+const ContentType = "application/problem+json"
+
+// ErrUnsupportedMediaType is returned by handlers for request bodies whose
+// Content-Type they cannot process.
+var ErrUnsupportedMediaType = errors.New("unsupported media type")
+
+// Problem type URIs. They are relative references, so they resolve against
+// the API host, and must never change once published.
+const (
+	TypeNotFound           = "/problems/supplement-not-found"
+	TypeAlreadyExists      = "/problems/supplement-already-exists"
+	TypeInvalidSupplement  = "/problems/invalid-supplement"
+	TypeInvalidQuery       = "/problems/invalid-query"
+	TypeInvalidCursor      = "/problems/invalid-cursor"
+	TypeInvalidImport      = "/problems/invalid-import"
+	TypeInvalidBatch       = "/problems/invalid-batch"
+	TypeBatchAborted       = "/problems/batch-aborted"
+	TypePreconditionFailed = "/problems/precondition-failed"
+	TypeInvalidPatch       = "/problems/invalid-patch"
+	TypePatchTestFailed    = "/problems/patch-test-failed"
+	TypeUnsupportedMedia   = "/problems/unsupported-media-type"
+	TypeMalformedBody      = "/problems/malformed-body"
+	TypeBodyTooLarge       = "/problems/body-too-large"
+	TypeBlank              = "about:blank"
+)
+
+// Details is an RFC 9457 problem details object. Gtin and Errors are
+// extension members.
+type Details struct {
+	Type     string                 `json:"type"`
+	Title    string                 `json:"title"`
+	Status   int                    `json:"status"`
+	Detail   string                 `json:"detail,omitempty"`
+	Instance string                 `json:"instance,omitempty"`
+	Gtin     string                 `json:"gtin,omitempty"`
+	Errors   []supplement.Violation `json:"errors,omitempty"`
+}
+
+// FromError maps err to its problem details. Unknown errors become a 500
+// without detail, so that internal messages never reach clients.
+func FromError(err error) Details {
+	var details Details
+
+	var syntaxErr *json.SyntaxError
+	var unmarshalTypeErr *json.UnmarshalTypeError
+	var invalidUnmarshalErr *json.InvalidUnmarshalError
+	var unsupportedTypeError *json.UnsupportedTypeError
+	var unsupportedValueErr *json.UnsupportedValueError
+	var maxBytesErr *http.MaxBytesError
+
+	switch {
+	case errors.As(err, &maxBytesErr):
+		details = Details{Type: TypeBodyTooLarge, Title: "Request body too large", Status: http.StatusRequestEntityTooLarge}
+	case errors.Is(err, supplement.ErrNotFound):
+		details = Details{Type: TypeNotFound, Title: "Supplement not found", Status: http.StatusNotFound}
+	case errors.Is(err, supplement.ErrAlreadyExists):
+		details = Details{Type: TypeAlreadyExists, Title: "Supplement already exists", Status: http.StatusConflict}
+	case errors.Is(err, supplement.ErrInvalidSupplement):
+		details = Details{Type: TypeInvalidSupplement, Title: "Invalid supplement", Status: http.StatusBadRequest}
+	case errors.Is(err, supplement.ErrInvalidQuery):
+		details = Details{Type: TypeInvalidQuery, Title: "Invalid query", Status: http.StatusBadRequest}
+	case errors.Is(err, supplement.ErrInvalidCursor):
+		details = Details{Type: TypeInvalidCursor, Title: "Invalid cursor", Status: http.StatusBadRequest}
+	case errors.Is(err, supplement.ErrInvalidImport):
+		details = Details{Type: TypeInvalidImport, Title: "Invalid import", Status: http.StatusBadRequest}
+	case errors.Is(err, supplement.ErrInvalidBatch):
+		details = Details{Type: TypeInvalidBatch, Title: "Invalid batch", Status: http.StatusBadRequest}
+	case errors.Is(err, supplement.ErrBatchAborted):
+		details = Details{Type: TypeBatchAborted, Title: "Batch aborted", Status: http.StatusFailedDependency}
+	case errors.Is(err, supplement.ErrPreconditionFailed):
+		details = Details{Type: TypePreconditionFailed, Title: "Precondition failed", Status: http.StatusPreconditionFailed}
+	case errors.Is(err, supplement.ErrInvalidPatch):
+		details = Details{Type: TypeInvalidPatch, Title: "Invalid patch", Status: http.StatusUnprocessableEntity}
+	case errors.Is(err, supplement.ErrPatchTestFailed):
+		details = Details{Type: TypePatchTestFailed, Title: "Patch test failed", Status: http.StatusConflict}
+	case errors.Is(err, ErrUnsupportedMediaType):
+		details = Details{Type: TypeUnsupportedMedia, Title: "Unsupported media type", Status: http.StatusUnsupportedMediaType}
+	case
+		errors.Is(err, io.EOF),
+		errors.As(err, &syntaxErr),
+		errors.As(err, &unmarshalTypeErr),
+		errors.As(err, &invalidUnmarshalErr),
+		errors.As(err, &unsupportedTypeError),
+		errors.As(err, &unsupportedValueErr):
+		details = Details{Type: TypeMalformedBody, Title: "Malformed request body", Status: http.StatusBadRequest}
+	default:
+		return Details{Type: TypeBlank, Title: http.StatusText(http.StatusInternalServerError), Status: http.StatusInternalServerError}
+	}
+
+	details.Detail = err.Error()
+
+	var gtinErr *supplement.GtinError
+	if errors.As(err, &gtinErr) {
+		details.Gtin = gtinErr.Gtin
+	}
+
+	var validationErr *supplement.ValidationError
+	if errors.As(err, &validationErr) {
+		details.Errors = validationErr.Violations
+	}
+
+	return details
+}
@@ -0,0 +1,169 @@
+package problem_test
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"testing"
+
+	"github.com/marioromandono/supplementapp/internal/problem"
+	"github.com/marioromandono/supplementapp/internal/supplement"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestFromError(t *testing.T) {
+	t.Parallel()
+	violations := []supplement.Violation{{Field: "name", Rule: supplement.RuleRequired, Value: "", Message: `name "" is invalid, it must not be empty`}}
+	tests := []struct {
+		name string
+		err  error
+		want problem.Details
+	}{
+		{
+			name: "not found",
+			err:  &supplement.GtinError{Gtin: "01234567890128", Err: supplement.ErrNotFound},
+			want: problem.Details{
+				Type:   problem.TypeNotFound,
+				Title:  "Supplement not found",
+				Status: http.StatusNotFound,
+				Detail: "01234567890128: supplement not found",
+				Gtin:   "01234567890128",
+			},
+		},
+		{
+			name: "already exists",
+			err:  &supplement.GtinError{Gtin: "01234567890128", Err: supplement.ErrAlreadyExists},
+			want: problem.Details{
+				Type:   problem.TypeAlreadyExists,
+				Title:  "Supplement already exists",
+				Status: http.StatusConflict,
+				Detail: "01234567890128: supplement already exists",
+				Gtin:   "01234567890128",
+			},
+		},
+		{
+			name: "precondition failed",
+			err:  &supplement.GtinError{Gtin: "01234567890128", Err: supplement.ErrPreconditionFailed},
+			want: problem.Details{
+				Type:   problem.TypePreconditionFailed,
+				Title:  "Precondition failed",
+				Status: http.StatusPreconditionFailed,
+				Detail: "01234567890128: supplement version does not match",
+				Gtin:   "01234567890128",
+			},
+		},
+		{
+			name: "patch test failed",
+			err:  &supplement.GtinError{Gtin: "01234567890128", Err: fmt.Errorf("%w: testing value /caffeine failed", supplement.ErrPatchTestFailed)},
+			want: problem.Details{
+				Type:   problem.TypePatchTestFailed,
+				Title:  "Patch test failed",
+				Status: http.StatusConflict,
+				Detail: "01234567890128: patch test failed: testing value /caffeine failed",
+				Gtin:   "01234567890128",
+			},
+		},
+		{
+			name: "unsupported media type",
+			err:  problem.ErrUnsupportedMediaType,
+			want: problem.Details{
+				Type:   problem.TypeUnsupportedMedia,
+				Title:  "Unsupported media type",
+				Status: http.StatusUnsupportedMediaType,
+				Detail: "unsupported media type",
+			},
+		},
+		{
+			name: "invalid supplement",
+			err:  &supplement.ValidationError{Err: supplement.ErrInvalidSupplement, Violations: violations},
+			want: problem.Details{
+				Type:   problem.TypeInvalidSupplement,
+				Title:  "Invalid supplement",
+				Status: http.StatusBadRequest,
+				Detail: `invalid supplement: name "" is invalid, it must not be empty`,
+				Errors: violations,
+			},
+		},
+		{
+			name: "invalid cursor",
+			err:  fmt.Errorf("%w: cursor expired", supplement.ErrInvalidCursor),
+			want: problem.Details{
+				Type:   problem.TypeInvalidCursor,
+				Title:  "Invalid cursor",
+				Status: http.StatusBadRequest,
+				Detail: "invalid cursor: cursor expired",
+			},
+		},
+		{
+			name: "invalid import",
+			err:  fmt.Errorf("%w: format %q, expected csv or ndjson", supplement.ErrInvalidImport, "xml"),
+			want: problem.Details{
+				Type:   problem.TypeInvalidImport,
+				Title:  "Invalid import",
+				Status: http.StatusBadRequest,
+				Detail: `invalid import: format "xml", expected csv or ndjson`,
+			},
+		},
+		{
+			name: "batch aborted",
+			err:  supplement.ErrBatchAborted,
+			want: problem.Details{
+				Type:   problem.TypeBatchAborted,
+				Title:  "Batch aborted",
+				Status: http.StatusFailedDependency,
+				Detail: "batch aborted",
+			},
+		},
+		{
+			name: "malformed body",
+			err:  io.EOF,
+			want: problem.Details{
+				Type:   problem.TypeMalformedBody,
+				Title:  "Malformed request body",
+				Status: http.StatusBadRequest,
+				Detail: "EOF",
+			},
+		},
+		{
+			name: "invalid json",
+			err:  json.Unmarshal([]byte(`{`), &supplement.Supplement{}),
+			want: problem.Details{
+				Type:   problem.TypeMalformedBody,
+				Title:  "Malformed request body",
+				Status: http.StatusBadRequest,
+				Detail: "unexpected end of JSON input",
+			},
+		},
+		{
+			name: "body too large",
+			err:  fmt.Errorf("%w: %w", supplement.ErrInvalidImport, &http.MaxBytesError{Limit: 1024}),
+			want: problem.Details{
+				Type:   problem.TypeBodyTooLarge,
+				Title:  "Request body too large",
+				Status: http.StatusRequestEntityTooLarge,
+				Detail: "invalid import: http: request body too large",
+			},
+		},
+		{
+			name: "internal error",
+			err:  errors.New("connection refused"),
+			want: problem.Details{
+				Type:   problem.TypeBlank,
+				Title:  "Internal Server Error",
+				Status: http.StatusInternalServerError,
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			got := problem.FromError(tt.err)
+			if diff := cmp.Diff(got, tt.want); diff != "" {
+				t.Errorf("FromError() (-got +want):\n%s", diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,124 @@
+package supplement
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// Allergen is one of the major allergens that must be declared in the EU
+// (Regulation 1169/2011, Annex II) or the US (FALCPA and the FASTER Act).
+type Allergen string
+
+const (
+	AllergenGluten      Allergen = "gluten"
+	AllergenWheat       Allergen = "wheat"
+	AllergenCrustaceans Allergen = "crustaceans"
+	AllergenEggs        Allergen = "eggs"
+	AllergenFish        Allergen = "fish"
+	AllergenPeanuts     Allergen = "peanuts"
+	AllergenSoy         Allergen = "soy"
+	AllergenMilk        Allergen = "milk"
+	AllergenTreeNuts    Allergen = "tree-nuts"
+	AllergenCelery      Allergen = "celery"
+	AllergenMustard     Allergen = "mustard"
+	AllergenSesame      Allergen = "sesame"
+	AllergenSulphites   Allergen = "sulphites"
+	AllergenLupin       Allergen = "lupin"
+	AllergenMolluscs    Allergen = "molluscs"
+)
+
+var Allergens = []Allergen{
+	AllergenGluten, AllergenWheat, AllergenCrustaceans, AllergenEggs, AllergenFish,
+	AllergenPeanuts, AllergenSoy, AllergenMilk, AllergenTreeNuts, AllergenCelery,
+	AllergenMustard, AllergenSesame, AllergenSulphites, AllergenLupin, AllergenMolluscs,
+}
+
+// AllergenDeclaration lists the allergens a supplement contains as an
+// ingredient and those it may contain through cross-contamination. Once
+// stored, both lists are sorted.
+type AllergenDeclaration struct {
+	Contains   []Allergen `json:"contains,omitempty"`
+	MayContain []Allergen `json:"mayContain,omitempty"`
+}
+
+// Declares reports whether d lists allergen as contained or maybe contained.
+func (d AllergenDeclaration) Declares(allergen Allergen) bool {
+	return slices.Contains(d.Contains, allergen) || slices.Contains(d.MayContain, allergen)
+}
+
+func (a Allergen) valid() bool {
+	return slices.Contains(Allergens, a)
+}
+
+func allergenNames() string {
+	names := make([]string, len(Allergens))
+	for i, a := range Allergens {
+		names[i] = string(a)
+	}
+	return strings.Join(names, ", ")
+}
+
+func appendIfInvalidIngredients(violations []Violation, ingredients []string) []Violation {
+	for i, ingredient := range ingredients {
+		if strings.TrimSpace(ingredient) == "" {
+			violations = append(violations, Violation{
+				Field:   fmt.Sprintf("ingredients[%d]", i),
+				Rule:    RuleRequired,
+				Value:   ingredient,
+				Message: fmt.Sprintf("ingredient %d %q is invalid, it must not be empty", i+1, ingredient),
+			})
+		}
+	}
+	return violations
+}
+
+func appendIfInvalidAllergens(violations []Violation, d AllergenDeclaration) []Violation {
+	seen := map[Allergen]bool{}
+	check := func(field string, allergens []Allergen) {
+		for i, a := range allergens {
+			field := fmt.Sprintf("allergens.%s[%d]", field, i)
+			switch {
+			case !a.valid():
+				violations = append(violations, Violation{
+					Field:   field,
+					Rule:    RuleOneOf,
+					Value:   a,
+					Message: fmt.Sprintf("allergen %q is invalid, it must be one of %s", a, allergenNames()),
+				})
+			case seen[a]:
+				violations = append(violations, Violation{
+					Field:   field,
+					Rule:    RuleUnique,
+					Value:   a,
+					Message: fmt.Sprintf("allergen %q is invalid, it is declared more than once", a),
+				})
+			}
+			seen[a] = true
+		}
+	}
+
+	check("contains", d.Contains)
+	check("mayContain", d.MayContain)
+	return violations
+}
+
+// normalizeComposition trims ingredient names, sorts declared allergens and
+// drops empty lists, so that every storage returns them the same way. It
+// copies the lists rather than sharing them with the caller.
+func (s *Supplement) normalizeComposition() {
+	var ingredients []string
+	for _, ingredient := range s.Ingredients {
+		ingredients = append(ingredients, strings.TrimSpace(ingredient))
+	}
+	s.Ingredients = ingredients
+
+	for _, allergens := range []*[]Allergen{&s.Allergens.Contains, &s.Allergens.MayContain} {
+		if len(*allergens) == 0 {
+			*allergens = nil
+			continue
+		}
+		*allergens = slices.Clone(*allergens)
+		slices.Sort(*allergens)
+	}
+}
@@ -0,0 +1,145 @@
+package supplement
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"slices"
+	"strings"
+	"time"
+)
+
+// AnonymousActor is recorded for changes made without an actor in their
+// context.
+const AnonymousActor = "anonymous"
+
+type Operation string
+
+const (
+	OperationCreate  Operation = "create"
+	OperationUpdate  Operation = "update"
+	OperationDelete  Operation = "delete"
+	OperationRestore Operation = "restore"
+	OperationPurge   Operation = "purge"
+)
+
+// Change is a value that differs between two versions of a supplement,
+// identified by its JSON Pointer. Before is nil for added values and After
+// for removed ones.
+type Change struct {
+	Path   string `json:"path"`
+	Before any    `json:"before,omitempty"`
+	After  any    `json:"after,omitempty"`
+}
+
+// AuditEntry records a mutation of a supplement: who made it, when, and what
+// it changed. Version is the version the supplement was left at, or the
+// purged one.
+type AuditEntry struct {
+	Gtin      string    `json:"gtin"`
+	Version   int64     `json:"version"`
+	Operation Operation `json:"operation"`
+	Actor     string    `json:"actor"`
+	At        time.Time `json:"at"`
+	Changes   []Change  `json:"changes"`
+}
+
+type History struct {
+	Entries []AuditEntry `json:"entries"`
+}
+
+type actorKey struct{}
+
+// WithActor returns a context whose changes are attributed to actor.
+func WithActor(ctx context.Context, actor string) context.Context {
+	return context.WithValue(ctx, actorKey{}, actor)
+}
+
+// ActorFrom returns the actor changes made with ctx are attributed to.
+func ActorFrom(ctx context.Context) string {
+	if actor, ok := ctx.Value(actorKey{}).(string); ok && actor != "" {
+		return actor
+	}
+	return AnonymousActor
+}
+
+// NewAuditEntry describes the change from before to after, either of which is
+// nil when the supplement is created or purged. Repositories call it while
+// writing, so that the entry is stored along with the change.
+func NewAuditEntry(ctx context.Context, operation Operation, before, after *Supplement) AuditEntry {
+	entry := AuditEntry{
+		Operation: operation,
+		Actor:     ActorFrom(ctx),
+		At:        time.Now().UTC().Truncate(time.Microsecond),
+		Changes:   diff(before, after),
+	}
+
+	if after != nil {
+		entry.Gtin, entry.Version = after.Gtin, after.Version
+	} else if before != nil {
+		entry.Gtin, entry.Version = before.Gtin, before.Version
+	}
+
+	return entry
+}
+
+// diff compares the JSON representations of before and after leaf by leaf.
+// Arrays are leaves, so a reordered ingredient list is a single change.
+func diff(before, after *Supplement) []Change {
+	previous, current := flatten(before), flatten(after)
+
+	paths := make([]string, 0, len(previous)+len(current))
+	for path := range previous {
+		paths = append(paths, path)
+	}
+	for path := range current {
+		if _, ok := previous[path]; !ok {
+			paths = append(paths, path)
+		}
+	}
+	slices.Sort(paths)
+
+	changes := []Change{}
+	for _, path := range paths {
+		if !reflect.DeepEqual(previous[path], current[path]) {
+			changes = append(changes, Change{Path: path, Before: previous[path], After: current[path]})
+		}
+	}
+	return changes
+}
+
+func flatten(s *Supplement) map[string]any {
+	leaves := map[string]any{}
+	if s == nil {
+		return leaves
+	}
+
+	document, err := json.Marshal(s)
+	if err != nil {
+		return leaves
+	}
+
+	var value any
+	if err := json.Unmarshal(document, &value); err != nil {
+		return leaves
+	}
+
+	var walk func(path string, value any)
+	walk = func(path string, value any) {
+		object, ok := value.(map[string]any)
+		if !ok {
+			leaves[path] = value
+			return
+		}
+		for key, member := range object {
+			walk(path+"/"+escapePointer(key), member)
+		}
+	}
+	walk("", value)
+
+	return leaves
+}
+
+func escapePointer(token string) string {
+	return strings.NewReplacer("~", "~0", "/", "~1").Replace(token)
+}
@@ -0,0 +1,171 @@
+package supplement
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+var (
+	ErrInvalidBatch = errors.New("invalid batch")
+	// ErrBatchAborted is the error of the operations of an atomic batch
+	// other than the one that failed, as none of them was applied.
+	ErrBatchAborted = errors.New("batch aborted")
+)
+
+// MaxBatchSize is the most operations a batch can have.
+const MaxBatchSize = 100
+
+type BatchOp string
+
+const (
+	BatchCreate BatchOp = "create"
+	BatchUpdate BatchOp = "update"
+	BatchDelete BatchOp = "delete"
+)
+
+// BatchOperation is one change of a batch: creating Supplement, applying
+// Update to the supplement with Gtin like SupplementService.Update, or
+// deleting it. A non-zero Version makes an update or delete conditional.
+type BatchOperation struct {
+	Op         BatchOp
+	Gtin       string
+	Version    int64
+	Supplement Supplement
+	Update     UpdatableSupplement
+}
+
+// UnmarshalJSON reads an operation such as {"op": "update", "gtin": "...",
+// "version": 2, "supplement": {"name": "..."}}, whose supplement is complete
+// for creates and partial for updates.
+func (o *BatchOperation) UnmarshalJSON(data []byte) error {
+	var raw struct {
+		Op         BatchOp         `json:"op"`
+		Gtin       string          `json:"gtin"`
+		Version    int64           `json:"version"`
+		Supplement json.RawMessage `json:"supplement"`
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+
+	*o = BatchOperation{Op: raw.Op, Gtin: raw.Gtin, Version: raw.Version}
+	if len(raw.Supplement) == 0 {
+		return nil
+	}
+
+	switch raw.Op {
+	case BatchCreate:
+		return json.Unmarshal(raw.Supplement, &o.Supplement)
+	case BatchUpdate:
+		return json.Unmarshal(raw.Supplement, &o.Update)
+	}
+	return nil
+}
+
+func (o BatchOperation) validate() error {
+	var violations []Violation
+
+	switch o.Op {
+	case BatchCreate:
+	case BatchUpdate, BatchDelete:
+		violations = appendIfEmpty(violations, "gtin", o.Gtin)
+	default:
+		violations = append(violations, Violation{
+			Field:   "op",
+			Rule:    RuleOneOf,
+			Value:   o.Op,
+			Message: fmt.Sprintf("op %q is invalid, it must be one of %s, %s, %s", o.Op, BatchCreate, BatchUpdate, BatchDelete),
+		})
+	}
+
+	return newValidationError(ErrInvalidBatch, violations)
+}
+
+// BatchResult is what a batch did with the operation at the same index: its
+// Gtin, normalized when valid, and the error it failed with, if any.
+type BatchResult struct {
+	Op   BatchOp
+	Gtin string
+	Err  error
+}
+
+// Batch applies operations in order, and returns what it did with each one
+// and whether any of them was committed. Each operation is applied on its
+// own, and a failure does not stop the rest, unless atomic is set: then they
+// are all applied in one transaction, which the first failure rolls back.
+func (service *SupplementService) Batch(ctx context.Context, operations []BatchOperation, atomic bool) (results []BatchResult, committed bool, err error) {
+	if len(operations) > MaxBatchSize {
+		return nil, false, newValidationError(ErrInvalidBatch, []Violation{{
+			Field:   "operations",
+			Rule:    RuleMax,
+			Value:   len(operations),
+			Message: fmt.Sprintf("operations are invalid, a batch can have at most %d, not %d", MaxBatchSize, len(operations)),
+		}})
+	}
+
+	results = make([]BatchResult, len(operations))
+	for i, o := range operations {
+		results[i] = BatchResult{Op: o.Op, Gtin: o.gtin()}
+		if gtin, err := NormalizeGtin(o.gtin()); err == nil {
+			results[i].Gtin = gtin
+		}
+	}
+
+	if !atomic {
+		for i, o := range operations {
+			results[i].Err = service.inTransaction(ctx, func(tx *SupplementService) error {
+				return tx.apply(ctx, o)
+			})
+			committed = committed || results[i].Err == nil
+		}
+		return results, committed, nil
+	}
+
+	failed := -1
+	err = service.inTransaction(ctx, func(tx *SupplementService) error {
+		for i, o := range operations {
+			if err := tx.apply(ctx, o); err != nil {
+				failed = i
+				return err
+			}
+		}
+		return nil
+	})
+
+	if err == nil {
+		return results, true, nil
+	}
+	if failed < 0 {
+		return nil, false, err
+	}
+
+	for i := range results {
+		results[i].Err = ErrBatchAborted
+	}
+	results[failed].Err = err
+	return results, false, nil
+}
+
+func (o BatchOperation) gtin() string {
+	if o.Op == BatchCreate {
+		return o.Supplement.Gtin
+	}
+	return o.Gtin
+}
+
+func (service *SupplementService) apply(ctx context.Context, o BatchOperation) error {
+	if err := o.validate(); err != nil {
+		return err
+	}
+
+	switch o.Op {
+	case BatchCreate:
+		return service.create(ctx, o.Supplement)
+	case BatchUpdate:
+		return service.update(ctx, o.Gtin, o.Update, o.Version)
+	default:
+		return service.delete(ctx, o.Gtin, o.Version)
+	}
+}
@@ -0,0 +1,152 @@
+package supplement_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/marioromandono/supplementapp/internal/supplement"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+)
+
+func TestBatchOperation_UnmarshalJSON(t *testing.T) {
+	t.Parallel()
+	data := `[
+		{"op": "create", "supplement": {"gtin": "01234567890128", "name": "Gel"}},
+		{"op": "update", "gtin": "04006381333931", "version": 2, "supplement": {"name": "Bar"}},
+		{"op": "delete", "gtin": "04006381333931"}
+	]`
+
+	var got []supplement.BatchOperation
+	err := json.Unmarshal([]byte(data), &got)
+
+	if err != nil {
+		t.Fatalf("json.Unmarshal() error = %v, want nil", err)
+	}
+	want := []supplement.BatchOperation{
+		{Op: supplement.BatchCreate, Supplement: supplement.Supplement{Gtin: "01234567890128", Name: "Gel"}},
+		{Op: supplement.BatchUpdate, Gtin: "04006381333931", Version: 2, Update: supplement.UpdatableSupplement{Name: Ptr("Bar")}},
+		{Op: supplement.BatchDelete, Gtin: "04006381333931"},
+	}
+	if diff := cmp.Diff(got, want); diff != "" {
+		t.Errorf("json.Unmarshal() (-got +want):\n%s", diff)
+	}
+}
+
+func TestSupplementService_Batch(t *testing.T) {
+	t.Parallel()
+	stored := supplement.Supplement{
+		Gtin:          "04006381333931",
+		Name:          "Gel",
+		Brand:         "Brand",
+		Flavor:        "Lemon",
+		Carbohydrates: supplement.Grams(0),
+		Electrolytes:  supplement.Milligrams(0),
+		Maltodextrose: supplement.Grams(0),
+		Fructose:      supplement.Grams(0),
+		Caffeine:      supplement.Milligrams(0),
+		Sodium:        supplement.Milligrams(0),
+		Protein:       supplement.Grams(0),
+		Version:       1,
+	}
+	create := supplement.BatchOperation{Op: supplement.BatchCreate, Supplement: supplement.Supplement{Gtin: "1234567890128", Name: "Bar", Brand: "Brand", Flavor: "Cocoa"}}
+	update := supplement.BatchOperation{Op: supplement.BatchUpdate, Gtin: stored.Gtin, Version: 1, Update: supplement.UpdatableSupplement{Flavor: Ptr("Orange")}}
+	deleteMissing := supplement.BatchOperation{Op: supplement.BatchDelete, Gtin: "05901234123457"}
+	unknown := supplement.BatchOperation{Op: "upsert", Gtin: stored.Gtin}
+	tests := []struct {
+		name          string
+		operations    []supplement.BatchOperation
+		atomic        bool
+		want          []supplement.BatchResult
+		wantCommitted bool
+		wantErr       error
+		wantStored    []string
+		wantFlavor    string
+	}{
+		{
+			name:       "independent operations",
+			operations: []supplement.BatchOperation{create, update, deleteMissing, unknown, create},
+			want: []supplement.BatchResult{
+				{Op: supplement.BatchCreate, Gtin: "01234567890128"},
+				{Op: supplement.BatchUpdate, Gtin: stored.Gtin},
+				{Op: supplement.BatchDelete, Gtin: "05901234123457", Err: supplement.ErrNotFound},
+				{Op: "upsert", Gtin: stored.Gtin, Err: supplement.ErrInvalidBatch},
+				{Op: supplement.BatchCreate, Gtin: "01234567890128", Err: supplement.ErrAlreadyExists},
+			},
+			wantCommitted: true,
+			wantStored:    []string{"01234567890128", stored.Gtin},
+			wantFlavor:    "Orange",
+		},
+		{
+			name:       "independent operations that all fail",
+			operations: []supplement.BatchOperation{deleteMissing, unknown},
+			want: []supplement.BatchResult{
+				{Op: supplement.BatchDelete, Gtin: "05901234123457", Err: supplement.ErrNotFound},
+				{Op: "upsert", Gtin: stored.Gtin, Err: supplement.ErrInvalidBatch},
+			},
+			wantStored: []string{stored.Gtin},
+			wantFlavor: "Lemon",
+		},
+		{
+			name:          "atomic",
+			operations:    []supplement.BatchOperation{create, update},
+			atomic:        true,
+			want:          []supplement.BatchResult{{Op: supplement.BatchCreate, Gtin: "01234567890128"}, {Op: supplement.BatchUpdate, Gtin: stored.Gtin}},
+			wantCommitted: true,
+			wantStored:    []string{"01234567890128", stored.Gtin},
+			wantFlavor:    "Orange",
+		},
+		{
+			name:       "atomic with a failure",
+			operations: []supplement.BatchOperation{create, update, deleteMissing, create},
+			atomic:     true,
+			want: []supplement.BatchResult{
+				{Op: supplement.BatchCreate, Gtin: "01234567890128", Err: supplement.ErrBatchAborted},
+				{Op: supplement.BatchUpdate, Gtin: stored.Gtin, Err: supplement.ErrBatchAborted},
+				{Op: supplement.BatchDelete, Gtin: "05901234123457", Err: supplement.ErrNotFound},
+				{Op: supplement.BatchCreate, Gtin: "01234567890128", Err: supplement.ErrBatchAborted},
+			},
+			wantStored: []string{stored.Gtin},
+			wantFlavor: "Lemon",
+		},
+		{
+			name:       "too many operations",
+			operations: make([]supplement.BatchOperation, supplement.MaxBatchSize+1),
+			wantErr:    supplement.ErrInvalidBatch,
+			wantStored: []string{stored.Gtin},
+			wantFlavor: "Lemon",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			repository := &stubSupplementRepository{store: map[string]supplement.Supplement{stored.Gtin: stored}}
+			service := supplement.NewSupplementService(repository)
+
+			got, committed, err := service.Batch(context.TODO(), tt.operations, tt.atomic)
+
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("SupplementService.Batch() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if committed != tt.wantCommitted {
+				t.Errorf("SupplementService.Batch() committed = %t, want %t", committed, tt.wantCommitted)
+			}
+			if diff := cmp.Diff(got, tt.want, cmpopts.EquateErrors()); diff != "" {
+				t.Errorf("SupplementService.Batch() (-got +want):\n%s", diff)
+			}
+			var gtins []string
+			for gtin := range repository.store {
+				gtins = append(gtins, gtin)
+			}
+			if diff := cmp.Diff(gtins, tt.wantStored, cmpopts.SortSlices(func(a, b string) bool { return a < b })); diff != "" {
+				t.Errorf("SupplementService.Batch() stored (-got +want):\n%s", diff)
+			}
+			if flavor := repository.store[stored.Gtin].Flavor; flavor != tt.wantFlavor {
+				t.Errorf("SupplementService.Batch() stored flavor = %q, want %q", flavor, tt.wantFlavor)
+			}
+		})
+	}
+}
@@ -0,0 +1,73 @@
+package supplement
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Category is the format a supplement comes in. The zero value means the
+// category is unknown.
+type Category string
+
+const (
+	CategoryGel      Category = "gel"
+	CategoryDrinkMix Category = "drink-mix"
+	CategoryBar      Category = "bar"
+	CategoryChew     Category = "chew"
+	CategoryCapsule  Category = "capsule"
+	CategoryTablet   Category = "tablet"
+	CategoryPowder   Category = "powder"
+)
+
+var Categories = []Category{CategoryGel, CategoryDrinkMix, CategoryBar, CategoryChew, CategoryCapsule, CategoryTablet, CategoryPowder}
+
+// unclaimableNutrients lists, per category, the nutrients a supplement of that
+// category cannot contain.
+var unclaimableNutrients = map[Category][]Nutrient{
+	CategoryCapsule: {Carbohydrates, Maltodextrose, Fructose},
+}
+
+func (c Category) valid() bool {
+	for _, other := range Categories {
+		if c == other {
+			return true
+		}
+	}
+	return false
+}
+
+func categoryNames() string {
+	names := make([]string, len(Categories))
+	for i, c := range Categories {
+		names[i] = string(c)
+	}
+	return strings.Join(names, ", ")
+}
+
+func appendIfInvalidCategory(violations []Violation, s *Supplement) []Violation {
+	if s.Category == "" {
+		return violations
+	}
+
+	if !s.Category.valid() {
+		return append(violations, Violation{
+			Field:   "category",
+			Rule:    RuleOneOf,
+			Value:   s.Category,
+			Message: fmt.Sprintf("category %q is invalid, it must be one of %s", s.Category, categoryNames()),
+		})
+	}
+
+	for _, n := range unclaimableNutrients[s.Category] {
+		if q := s.nutrient(n); q.Amount != 0 {
+			violations = append(violations, Violation{
+				Field:   string(n),
+				Rule:    RuleCategory,
+				Value:   q.Amount,
+				Message: fmt.Sprintf("%s %f is invalid, a %s cannot claim %s", n, q.Amount, s.Category, n),
+			})
+		}
+	}
+
+	return violations
+}
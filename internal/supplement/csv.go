@@ -0,0 +1,239 @@
+package supplement
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// CSV column names, shared with the fields of violations.
+const (
+	columnGtin               = "gtin"
+	columnName               = "name"
+	columnBrand              = "brand"
+	columnFlavor             = "flavor"
+	columnCategory           = "category"
+	columnServingSize        = "serving.size"
+	columnServingsPerPackage = "serving.servingsPerPackage"
+	columnIngredients        = "ingredients"
+	columnContains           = "allergens.contains"
+	columnMayContain         = "allergens.mayContain"
+)
+
+// listSeparator separates the items of list cells, as commas already
+// separate cells.
+const listSeparator = ";"
+
+// CSVColumns are the columns a supplement has in CSV, in order: its text
+// fields, its serving, each nutrient, its ingredients and allergens, and each
+// micronutrient as micronutrients.<code>. Quantity cells hold an amount and
+// a unit, "300 mg", or a bare amount in the unit the value is stored in, and
+// list cells separate their items with semicolons. An empty cell leaves its
+// value out.
+var CSVColumns = csvColumns()
+
+func csvColumns() []string {
+	columns := []string{columnGtin, columnName, columnBrand, columnFlavor, columnCategory, columnServingSize, columnServingsPerPackage}
+	for _, n := range Nutrients {
+		columns = append(columns, string(n))
+	}
+	columns = append(columns, columnIngredients, columnContains, columnMayContain)
+	for _, m := range Micronutrients {
+		columns = append(columns, micronutrientColumn(m))
+	}
+	return columns
+}
+
+func micronutrientColumn(m Micronutrient) string {
+	return "micronutrients." + string(m)
+}
+
+// fromCSV reads a supplement from the cells of a record, keyed by column.
+// Every cell that cannot be read is reported as a violation.
+func fromCSV(cells map[string]string) (Supplement, error) {
+	var s Supplement
+	var violations []Violation
+
+	s.Gtin = cells[columnGtin]
+	s.Name = unescapeFormula(cells[columnName])
+	s.Brand = unescapeFormula(cells[columnBrand])
+	s.Flavor = unescapeFormula(cells[columnFlavor])
+	s.Category = Category(cells[columnCategory])
+
+	size, perPackage := cells[columnServingSize], cells[columnServingsPerPackage]
+	if size != "" || perPackage != "" {
+		s.Serving = &Serving{}
+		if size != "" {
+			q, err := parseQuantity(size)
+			if err != nil {
+				violations = append(violations, cellViolation(columnServingSize, size, err))
+			}
+			s.Serving.Size = q
+		}
+		if perPackage != "" {
+			n, err := strconv.Atoi(perPackage)
+			if err != nil {
+				violations = append(violations, cellViolation(columnServingsPerPackage, perPackage, errors.New("it is not a whole number")))
+			}
+			s.Serving.ServingsPerPackage = n
+		}
+	}
+
+	for _, n := range Nutrients {
+		if cell := cells[string(n)]; cell != "" {
+			q, err := parseQuantity(cell)
+			if err != nil {
+				violations = append(violations, cellViolation(string(n), cell, err))
+			}
+			*s.nutrient(n) = q
+		}
+	}
+
+	s.Ingredients = splitList(unescapeFormula(cells[columnIngredients]))
+	for _, a := range splitList(cells[columnContains]) {
+		s.Allergens.Contains = append(s.Allergens.Contains, Allergen(a))
+	}
+	for _, a := range splitList(cells[columnMayContain]) {
+		s.Allergens.MayContain = append(s.Allergens.MayContain, Allergen(a))
+	}
+
+	for _, m := range Micronutrients {
+		column := micronutrientColumn(m)
+		if cell := cells[column]; cell != "" {
+			q, err := parseQuantity(cell)
+			if err != nil {
+				violations = append(violations, cellViolation(column, cell, err))
+			}
+			if s.Micronutrients == nil {
+				s.Micronutrients = Panel{}
+			}
+			s.Micronutrients[m] = q
+		}
+	}
+
+	return s, newValidationError(ErrInvalidSupplement, violations)
+}
+
+// csvCells returns the cells of s in the order of CSVColumns: the amounts of
+// nutrients and micronutrients as quantities, the servings per package as an
+// int and everything else as a string, empty when the value is missing. Free
+// text is escaped with escapeFormula.
+func csvCells(s Supplement) []any {
+	cells := []any{s.Gtin, escapeFormula(s.Name), escapeFormula(s.Brand), escapeFormula(s.Flavor), string(s.Category), "", ""}
+	if s.Serving != nil {
+		cells[5], cells[6] = formatQuantity(s.Serving.Size), s.Serving.ServingsPerPackage
+	}
+
+	for _, n := range Nutrients {
+		cells = append(cells, *s.nutrient(n))
+	}
+
+	cells = append(cells,
+		escapeFormula(strings.Join(s.Ingredients, listSeparator+" ")),
+		joinAllergens(s.Allergens.Contains),
+		joinAllergens(s.Allergens.MayContain),
+	)
+
+	for _, m := range Micronutrients {
+		if q, ok := s.Micronutrients[m]; ok {
+			cells = append(cells, q)
+		} else {
+			cells = append(cells, "")
+		}
+	}
+	return cells
+}
+
+// csvRecord returns the cells of s as text, such that fromCSV reads s back.
+func csvRecord(s Supplement) []string {
+	cells := csvCells(s)
+	record := make([]string, len(cells))
+	for i, cell := range cells {
+		switch cell := cell.(type) {
+		case Quantity:
+			record[i] = formatQuantity(cell)
+		case int:
+			record[i] = strconv.Itoa(cell)
+		case string:
+			record[i] = cell
+		}
+	}
+	return record
+}
+
+// formulaPrefixes are what text a spreadsheet evaluates as a formula starts
+// with.
+const formulaPrefixes = "=+-@\t\r"
+
+// escapeFormula prefixes text that would run as a formula when the export is
+// opened in a spreadsheet with an apostrophe, which spreadsheets read as
+// "this is text". Text that only starts with apostrophes before such a
+// prefix gets one more, so that unescapeFormula restores every text.
+func escapeFormula(text string) string {
+	if startsFormula(text) {
+		return "'" + text
+	}
+	return text
+}
+
+func unescapeFormula(cell string) string {
+	if strings.HasPrefix(cell, "'") && startsFormula(cell[1:]) {
+		return cell[1:]
+	}
+	return cell
+}
+
+func startsFormula(text string) bool {
+	text = strings.TrimLeft(text, "'")
+	return text != "" && strings.ContainsRune(formulaPrefixes, rune(text[0]))
+}
+
+func formatQuantity(q Quantity) string {
+	return strings.TrimSpace(strconv.FormatFloat(q.Amount, 'f', -1, 64) + " " + string(q.Unit))
+}
+
+func joinAllergens(allergens []Allergen) string {
+	names := make([]string, len(allergens))
+	for i, a := range allergens {
+		names[i] = string(a)
+	}
+	return strings.Join(names, listSeparator+" ")
+}
+
+// parseQuantity reads "300 mg", "300mg" or a bare "300".
+func parseQuantity(cell string) (Quantity, error) {
+	number, unit := cell, ""
+	if i := strings.IndexFunc(cell, unicode.IsLetter); i >= 0 {
+		number, unit = cell[:i], cell[i:]
+	}
+
+	amount, err := strconv.ParseFloat(strings.TrimSpace(number), 64)
+	if err != nil {
+		return Quantity{}, errors.New(`it is not a quantity such as "300 mg"`)
+	}
+
+	return Quantity{Amount: amount, Unit: Unit(strings.TrimSpace(unit))}, nil
+}
+
+func splitList(cell string) []string {
+	if strings.TrimSpace(cell) == "" {
+		return nil
+	}
+
+	items := strings.Split(cell, listSeparator)
+	for i, item := range items {
+		items[i] = strings.TrimSpace(item)
+	}
+	return items
+}
+
+func cellViolation(column, cell string, err error) Violation {
+	return Violation{
+		Field:   column,
+		Rule:    RuleType,
+		Value:   cell,
+		Message: fmt.Sprintf("%s %q is invalid, %s", column, cell, err),
+	}
+}
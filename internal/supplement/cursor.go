@@ -0,0 +1,142 @@
+package supplement
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+const DefaultCursorTTL = 24 * time.Hour
+
+// Keyset identifies the last row of a page: the value of the sort field
+// (a string for text fields, a float64 for nutrients) and its GTIN.
+type Keyset struct {
+	Value any
+	Gtin  string
+}
+
+type Page struct {
+	Supplements []Supplement `json:"supplements"`
+	Next        string       `json:"next,omitempty"`
+}
+
+type cursorPayload struct {
+	SortBy        SortField       `json:"s"`
+	SortDirection SortDirection   `json:"o"`
+	Value         json.RawMessage `json:"v"`
+	Gtin          string          `json:"g"`
+	ExpiresAt     int64           `json:"x"`
+}
+
+type cursorCodec struct {
+	key []byte
+	ttl time.Duration
+}
+
+func newCursorCodec() cursorCodec {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		panic(fmt.Sprintf("could not generate cursor key: %v", err))
+	}
+	return cursorCodec{key: key, ttl: DefaultCursorTTL}
+}
+
+func (c cursorCodec) encode(query ListQuery, last Supplement) (string, error) {
+	value, err := json.Marshal(last.SortValue(query.SortBy))
+	if err != nil {
+		return "", err
+	}
+
+	payload, err := json.Marshal(cursorPayload{
+		SortBy:        query.SortBy,
+		SortDirection: query.SortDirection,
+		Value:         value,
+		Gtin:          last.Gtin,
+		ExpiresAt:     time.Now().Add(c.ttl).UnixMilli(),
+	})
+	if err != nil {
+		return "", err
+	}
+
+	encoding := base64.RawURLEncoding
+	return encoding.EncodeToString(payload) + "." + encoding.EncodeToString(c.sign(payload)), nil
+}
+
+func (c cursorCodec) decode(cursor string, query ListQuery) (*Keyset, error) {
+	encoding := base64.RawURLEncoding
+
+	encodedPayload, encodedSignature, ok := strings.Cut(cursor, ".")
+	if !ok {
+		return nil, fmt.Errorf("%w: malformed cursor", ErrInvalidCursor)
+	}
+
+	payload, err := encoding.DecodeString(encodedPayload)
+	if err != nil {
+		return nil, fmt.Errorf("%w: malformed cursor", ErrInvalidCursor)
+	}
+
+	signature, err := encoding.DecodeString(encodedSignature)
+	if err != nil || !hmac.Equal(signature, c.sign(payload)) {
+		return nil, fmt.Errorf("%w: signature mismatch", ErrInvalidCursor)
+	}
+
+	var p cursorPayload
+	if err := json.Unmarshal(payload, &p); err != nil {
+		return nil, fmt.Errorf("%w: malformed cursor", ErrInvalidCursor)
+	}
+
+	if time.Now().UnixMilli() > p.ExpiresAt {
+		return nil, fmt.Errorf("%w: cursor expired", ErrInvalidCursor)
+	}
+
+	if p.SortBy != query.SortBy || p.SortDirection != query.SortDirection {
+		return nil, fmt.Errorf("%w: cursor was issued for sort %s %s", ErrInvalidCursor, p.SortBy, p.SortDirection)
+	}
+
+	keyset := &Keyset{Gtin: p.Gtin}
+
+	if Nutrient(p.SortBy).valid() {
+		var value float64
+		if err := json.Unmarshal(p.Value, &value); err != nil {
+			return nil, fmt.Errorf("%w: malformed cursor", ErrInvalidCursor)
+		}
+		keyset.Value = value
+	} else {
+		var value string
+		if err := json.Unmarshal(p.Value, &value); err != nil {
+			return nil, fmt.Errorf("%w: malformed cursor", ErrInvalidCursor)
+		}
+		keyset.Value = value
+	}
+
+	return keyset, nil
+}
+
+func (c cursorCodec) sign(payload []byte) []byte {
+	mac := hmac.New(sha256.New, c.key)
+	mac.Write(payload)
+	return mac.Sum(nil)
+}
+
+// SortValue returns the value of field for s, with the same types as
+// Keyset.Value.
+func (s Supplement) SortValue(field SortField) any {
+	switch field {
+	case SortByName:
+		return s.Name
+	case SortByBrand:
+		return s.Brand
+	case SortByFlavor:
+		return s.Flavor
+	default:
+		if n := Nutrient(field); n.valid() {
+			return s.nutrient(n).Amount
+		}
+		return s.Gtin
+	}
+}
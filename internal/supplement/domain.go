@@ -3,97 +3,193 @@ package supplement
 import (
 	"context"
 	"fmt"
-	"regexp"
-	"strings"
+	"math"
+	"time"
 )
 
+// Nutrient amounts are stored with a fixed precision of NUMERIC(10, 3), so
+// they cannot exceed MaxNutrientAmount nor have more than NutrientScale
+// decimal places.
+const (
+	MaxNutrientAmount = 9_999_999.999
+	NutrientScale     = 3
+)
+
+// Supplement describes a product. Nutrient amounts are per serving and, once
+// stored, in the unit of their Nutrient. Serving is nil when unknown.
+// Ingredients are listed in the order they appear on the label.
+// Micronutrients holds minerals and vitamins beyond the fixed nutrients.
 type Supplement struct {
-	Gtin          string  `json:"gtin"`
-	Name          string  `json:"name"`
-	Brand         string  `json:"brand"`
-	Flavor        string  `json:"flavor"`
-	Carbohydrates float32 `json:"carbohydrates"`
-	Electrolytes  float32 `json:"electrolytes"`
-	Maltodextrose float32 `json:"maltodextrose"`
-	Fructose      float32 `json:"fructose"`
-	Caffeine      float32 `json:"caffeine"`
-	Sodium        float32 `json:"sodium"`
-	Protein       float32 `json:"protein"`
+	Gtin           string              `json:"gtin"`
+	Name           string              `json:"name"`
+	Brand          string              `json:"brand"`
+	Flavor         string              `json:"flavor"`
+	Category       Category            `json:"category,omitempty"`
+	Serving        *Serving            `json:"serving,omitempty"`
+	Ingredients    []string            `json:"ingredients,omitempty"`
+	Allergens      AllergenDeclaration `json:"allergens"`
+	Carbohydrates  Quantity            `json:"carbohydrates"`
+	Electrolytes   Quantity            `json:"electrolytes"`
+	Maltodextrose  Quantity            `json:"maltodextrose"`
+	Fructose       Quantity            `json:"fructose"`
+	Caffeine       Quantity            `json:"caffeine"`
+	Sodium         Quantity            `json:"sodium"`
+	Protein        Quantity            `json:"protein"`
+	Micronutrients Panel               `json:"micronutrients,omitempty"`
+	// DeletedAt is set once the supplement is deleted, until it is restored or
+	// purged. Repositories ignore it on writes.
+	DeletedAt *time.Time `json:"deletedAt,omitempty"`
+	// Version is incremented on every update and exposed to HTTP clients as
+	// the ETag, never in the body.
+	Version int64 `json:"-"`
 }
 
 type UpdatableSupplement struct {
-	Name          *string  `json:"name,omitempty"`
-	Brand         *string  `json:"brand,omitempty"`
-	Flavor        *string  `json:"flavor,omitempty"`
-	Carbohydrates *float32 `json:"carbohydrates,omitempty"`
-	Electrolytes  *float32 `json:"electrolytes,omitempty"`
-	Maltodextrose *float32 `json:"maltodextrose,omitempty"`
-	Fructose      *float32 `json:"fructose,omitempty"`
-	Caffeine      *float32 `json:"caffeine,omitempty"`
-	Sodium        *float32 `json:"sodium,omitempty"`
-	Protein       *float32 `json:"protein,omitempty"`
+	Name           *string              `json:"name,omitempty"`
+	Brand          *string              `json:"brand,omitempty"`
+	Flavor         *string              `json:"flavor,omitempty"`
+	Category       *Category            `json:"category,omitempty"`
+	Serving        *Serving             `json:"serving,omitempty"`
+	Ingredients    *[]string            `json:"ingredients,omitempty"`
+	Allergens      *AllergenDeclaration `json:"allergens,omitempty"`
+	Carbohydrates  *Quantity            `json:"carbohydrates,omitempty"`
+	Electrolytes   *Quantity            `json:"electrolytes,omitempty"`
+	Maltodextrose  *Quantity            `json:"maltodextrose,omitempty"`
+	Fructose       *Quantity            `json:"fructose,omitempty"`
+	Caffeine       *Quantity            `json:"caffeine,omitempty"`
+	Sodium         *Quantity            `json:"sodium,omitempty"`
+	Protein        *Quantity            `json:"protein,omitempty"`
+	Micronutrients PanelUpdate          `json:"micronutrients,omitempty"`
 }
 
+// SupplementRepository persists supplements, whose nutrients are always in the
+// unit of their Nutrient. Update and Delete only succeed if the stored version
+// still equals supplement.Version, and report ErrPreconditionFailed otherwise.
+// Update increments the stored version.
+//
+// Delete leaves a tombstone: it sets DeletedAt and increments the version.
+// FindByGtin, Update and ListAll ignore tombstones, unless the query includes
+// deleted supplements, but Create reports ErrAlreadyExists for their GTIN.
+// Restore brings a tombstone back, or reports ErrNotFound, and Purge removes
+// those deleted before a time for good.
+//
+// Create, Update, Delete, Restore and Purge append an entry made with
+// NewAuditEntry in the same transaction as the change, which History returns
+// oldest first. Create reports ErrAlreadyExists for a GTIN stored
+// concurrently, rather than the storage's own unique key error.
+//
+// Export calls fn with every supplement ListAll would list for query, in the
+// same order but regardless of its Limit, and stops at the first error fn
+// returns.
+//
+// Search returns up to query.Limit supplements that are not deleted and
+// whose SearchText matches every one of the SearchTerms of query.Text, most
+// relevant first and then by GTIN, ranked as SearchRank does or close to it.
+//
+// InTransaction calls fn with a repository whose operations all belong to one
+// transaction, committed if fn returns nil and rolled back otherwise. Until
+// it returns, fn must use that repository rather than the one it was called
+// on.
 type SupplementRepository interface {
+	InTransaction(ctx context.Context, fn func(repository SupplementRepository) error) error
 	FindByGtin(ctx context.Context, gtin string) (*Supplement, error)
 	Create(ctx context.Context, supplement Supplement) error
 	Update(ctx context.Context, supplement Supplement) error
 	Delete(ctx context.Context, supplement Supplement) error
-	ListAll(ctx context.Context) ([]Supplement, error)
+	Restore(ctx context.Context, gtin string) error
+	Purge(ctx context.Context, deletedBefore time.Time) (int, error)
+	ListAll(ctx context.Context, query ListQuery) ([]Supplement, error)
+	Export(ctx context.Context, query ListQuery, fn func(Supplement) error) error
+	Search(ctx context.Context, query SearchQuery) ([]Supplement, error)
+	History(ctx context.Context, gtin string) ([]AuditEntry, error)
 }
 
 func (s *Supplement) validate() error {
-	var errors []string
+	var violations []Violation
 
-	if !regexp.MustCompile(`^\d{13}$`).MatchString(s.Gtin) {
-		errors = append(errors, fmt.Sprintf("gtin %q is invalid, it must be a 13-digit number", s.Gtin))
+	if _, err := NormalizeGtin(s.Gtin); err != nil {
+		violations = append(violations, Violation{Field: "gtin", Rule: RuleGtin, Value: s.Gtin, Message: err.Error()})
 	}
 
-	if s.Name == "" {
-		errors = append(errors, fmt.Sprintf("name %q is invalid, it must not be empty", s.Name))
-	}
+	violations = appendIfEmpty(violations, "name", s.Name)
+	violations = appendIfEmpty(violations, "brand", s.Brand)
+	violations = appendIfEmpty(violations, "flavor", s.Flavor)
 
-	if s.Brand == "" {
-		errors = append(errors, fmt.Sprintf("brand %q is invalid, it must not be empty", s.Brand))
+	for _, n := range Nutrients {
+		violations = appendIfInvalidAmount(violations, string(n), n.Unit(), *s.nutrient(n))
 	}
 
-	if s.Flavor == "" {
-		errors = append(errors, fmt.Sprintf("flavor %q is invalid, it must not be empty", s.Flavor))
-	}
+	violations = appendIfInvalidServing(violations, s.Serving)
+	violations = appendIfInvalidCategory(violations, s)
+	violations = appendIfInvalidIngredients(violations, s.Ingredients)
+	violations = appendIfInvalidAllergens(violations, s.Allergens)
+	violations = appendIfInvalidPanel(violations, s.Micronutrients)
 
-	if s.Carbohydrates < 0 {
-		errors = append(errors, fmt.Sprintf("carbohydrates %f is invalid, it must be greater or equal to zero", s.Carbohydrates))
-	}
+	return newValidationError(ErrInvalidSupplement, violations)
+}
 
-	if s.Electrolytes < 0 {
-		errors = append(errors, fmt.Sprintf("electrolytes %f is invalid, it must be greater or equal to zero", s.Electrolytes))
-	}
+// normalize brings a valid supplement into the form it is stored in.
+func (s *Supplement) normalize() {
+	s.normalizeUnits()
+	s.normalizeComposition()
+	s.normalizePanel()
+}
 
-	if s.Maltodextrose < 0 {
-		errors = append(errors, fmt.Sprintf("maltodextrose %f is invalid, it must be greater or equal to zero", s.Maltodextrose))
+func appendIfEmpty(violations []Violation, field, value string) []Violation {
+	if value != "" {
+		return violations
 	}
 
-	if s.Fructose < 0 {
-		errors = append(errors, fmt.Sprintf("fructose %f is invalid, it must be greater or equal to zero", s.Fructose))
-	}
+	return append(violations, Violation{
+		Field:   field,
+		Rule:    RuleRequired,
+		Value:   value,
+		Message: fmt.Sprintf("%s %q is invalid, it must not be empty", field, value),
+	})
+}
 
-	if s.Caffeine < 0 {
-		errors = append(errors, fmt.Sprintf("caffeine %f is invalid, it must be greater or equal to zero", s.Caffeine))
+// appendIfInvalidAmount checks the amount of q, reported as field, in unit. A
+// quantity without unit is already in it.
+func appendIfInvalidAmount(violations []Violation, field string, unit Unit, q Quantity) []Violation {
+	if q.Unit == "" {
+		q.Unit = unit
 	}
 
-	if s.Sodium < 0 {
-		errors = append(errors, fmt.Sprintf("sodium %f is invalid, it must be greater or equal to zero", s.Sodium))
+	if !isMassUnit(q.Unit) {
+		return append(violations, Violation{
+			Field:   field + ".unit",
+			Rule:    RuleOneOf,
+			Value:   q.Unit,
+			Message: fmt.Sprintf("%s unit %q is invalid, it must be one of %s", field, q.Unit, joinUnits(MassUnits)),
+		})
 	}
 
-	if s.Protein < 0 {
-		errors = append(errors, fmt.Sprintf("protein %f is invalid, it must be greater or equal to zero", s.Protein))
-	}
+	q, _ = q.In(unit)
+	value := q.Amount
+	violation := Violation{Field: field, Value: value}
 
-	if len(errors) == 0 {
-		return nil
+	switch {
+	case value < 0:
+		violation.Rule = RuleMin
+		violation.Message = fmt.Sprintf("%s %f is invalid, it must be greater or equal to zero", field, value)
+	case value > MaxNutrientAmount:
+		violation.Rule = RuleMax
+		violation.Message = fmt.Sprintf("%s %f is invalid, it must be less or equal to %.3f %s", field, value, MaxNutrientAmount, q.Unit)
+	case !hasScale(value, NutrientScale):
+		violation.Rule = RuleScale
+		violation.Message = fmt.Sprintf("%s %g is invalid, it must have at most %d decimal places in %s", field, value, NutrientScale, q.Unit)
+	default:
+		return violations
 	}
 
-	return fmt.Errorf(strings.Join(errors, "; "))
+	return append(violations, violation)
+}
+
+// hasScale reports whether value has at most scale decimal places, allowing
+// for the error of its binary representation.
+func hasScale(value float64, scale int) bool {
+	scaled := value * math.Pow10(scale)
+	return math.Abs(scaled-math.Round(scaled)) < 1e-6
 }
 
 func (s *Supplement) update(other UpdatableSupplement) Supplement {
@@ -109,6 +205,22 @@ func (s *Supplement) update(other UpdatableSupplement) Supplement {
 		s.Flavor = *other.Flavor
 	}
 
+	if other.Category != nil {
+		s.Category = *other.Category
+	}
+
+	if other.Serving != nil {
+		s.Serving = other.Serving
+	}
+
+	if other.Ingredients != nil {
+		s.Ingredients = *other.Ingredients
+	}
+
+	if other.Allergens != nil {
+		s.Allergens = *other.Allergens
+	}
+
 	if other.Carbohydrates != nil {
 		s.Carbohydrates = *other.Carbohydrates
 	}
@@ -137,5 +249,9 @@ func (s *Supplement) update(other UpdatableSupplement) Supplement {
 		s.Protein = *other.Protein
 	}
 
+	if other.Micronutrients != nil {
+		s.Micronutrients = s.Micronutrients.update(other.Micronutrients)
+	}
+
 	return *s
 }
@@ -0,0 +1,114 @@
+package supplement
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	"slices"
+)
+
+type ExportFormat string
+
+const (
+	ExportCSV    ExportFormat = "csv"
+	ExportNDJSON ExportFormat = "ndjson"
+	ExportXLSX   ExportFormat = "xlsx"
+)
+
+var ExportFormats = []ExportFormat{ExportCSV, ExportNDJSON, ExportXLSX}
+
+// ParseExportFormat reads the format URL query parameter, csv by default.
+func ParseExportFormat(values url.Values) (ExportFormat, error) {
+	format := ExportFormat(values.Get("format"))
+	if format == "" {
+		return ExportCSV, nil
+	}
+
+	if !slices.Contains(ExportFormats, format) {
+		return "", newValidationError(ErrInvalidQuery, []Violation{{
+			Field:   "format",
+			Rule:    RuleOneOf,
+			Value:   format,
+			Message: fmt.Sprintf("format %q is invalid, it must be one of %s, %s, %s", format, ExportCSV, ExportNDJSON, ExportXLSX),
+		}})
+	}
+	return format, nil
+}
+
+func (f ExportFormat) ContentType() string {
+	switch f {
+	case ExportNDJSON:
+		return "application/x-ndjson"
+	case ExportXLSX:
+		return "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"
+	default:
+		return "text/csv; charset=utf-8"
+	}
+}
+
+// Filename is the name an export in the format is downloaded as.
+func (f ExportFormat) Filename() string {
+	return "supplements." + string(f)
+}
+
+// ExportWriter writes supplements to a file in an export format, and Close
+// completes the file. Nothing is written before the first call to either.
+type ExportWriter interface {
+	Write(s Supplement) error
+	Close() error
+}
+
+// NewExportWriter returns a writer of format. CSV and XLSX files have the
+// columns of CSVColumns, and NDJSON files a supplement per line as JSON.
+func NewExportWriter(w io.Writer, format ExportFormat) ExportWriter {
+	switch format {
+	case ExportNDJSON:
+		return &ndjsonWriter{encoder: json.NewEncoder(w)}
+	case ExportXLSX:
+		return newXLSXWriter(w)
+	default:
+		return &csvWriter{writer: csv.NewWriter(w)}
+	}
+}
+
+type csvWriter struct {
+	writer  *csv.Writer
+	started bool
+}
+
+func (w *csvWriter) start() error {
+	if w.started {
+		return nil
+	}
+	w.started = true
+	return w.writer.Write(CSVColumns)
+}
+
+func (w *csvWriter) Write(s Supplement) error {
+	if err := w.start(); err != nil {
+		return err
+	}
+	return w.writer.Write(csvRecord(s))
+}
+
+func (w *csvWriter) Close() error {
+	if err := w.start(); err != nil {
+		return err
+	}
+	w.writer.Flush()
+	return w.writer.Error()
+}
+
+type ndjsonWriter struct {
+	encoder *json.Encoder
+}
+
+func (w *ndjsonWriter) Write(s Supplement) error {
+	return w.encoder.Encode(s)
+}
+
+func (w *ndjsonWriter) Close() error {
+	return nil
+}
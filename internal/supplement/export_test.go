@@ -0,0 +1,301 @@
+package supplement_test
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/xml"
+	"errors"
+	"io"
+	"net/url"
+	"testing"
+
+	"github.com/marioromandono/supplementapp/internal/supplement"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestParseExportFormat(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name    string
+		values  url.Values
+		want    supplement.ExportFormat
+		wantErr error
+	}{
+		{name: "default", values: url.Values{}, want: supplement.ExportCSV},
+		{name: "xlsx", values: url.Values{"format": {"xlsx"}}, want: supplement.ExportXLSX},
+		{name: "unknown", values: url.Values{"format": {"json"}}, wantErr: supplement.ErrInvalidQuery},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			got, err := supplement.ParseExportFormat(tt.values)
+
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("ParseExportFormat() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("ParseExportFormat() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func exportedSupplements() []supplement.Supplement {
+	return []supplement.Supplement{
+		{
+			Gtin:          "01234567890128",
+			Name:          "Gel, \"Lemon\" & <Lime>",
+			Brand:         "Brand",
+			Flavor:        "Lemon",
+			Category:      supplement.CategoryGel,
+			Serving:       &supplement.Serving{Size: supplement.Grams(60), ServingsPerPackage: 10},
+			Carbohydrates: supplement.Grams(22.5),
+			Electrolytes:  supplement.Milligrams(0),
+			Maltodextrose: supplement.Grams(0),
+			Fructose:      supplement.Grams(0),
+			Caffeine:      supplement.Milligrams(75),
+			Sodium:        supplement.Milligrams(300),
+			Protein:       supplement.Grams(0),
+			Ingredients:   []string{"water", "maltodextrin"},
+			Allergens: supplement.AllergenDeclaration{
+				Contains:   []supplement.Allergen{supplement.AllergenMilk},
+				MayContain: []supplement.Allergen{supplement.AllergenPeanuts, supplement.AllergenSoy},
+			},
+			Micronutrients: supplement.Panel{
+				supplement.Potassium:  supplement.Milligrams(150),
+				supplement.VitaminB12: supplement.Quantity{Amount: 2.5, Unit: supplement.Microgram},
+			},
+		},
+		{
+			Gtin:          "04006381333931",
+			Name:          "Bar",
+			Brand:         "Brand",
+			Flavor:        "Cocoa",
+			Carbohydrates: supplement.Grams(40),
+			Electrolytes:  supplement.Milligrams(0),
+			Maltodextrose: supplement.Grams(0),
+			Fructose:      supplement.Grams(0),
+			Caffeine:      supplement.Milligrams(0),
+			Sodium:        supplement.Milligrams(0),
+			Protein:       supplement.Grams(10),
+		},
+	}
+}
+
+func TestNewExportWriter(t *testing.T) {
+	t.Parallel()
+	for _, format := range []supplement.ExportFormat{supplement.ExportCSV, supplement.ExportNDJSON} {
+		t.Run(string(format)+" is read back by ReadImport", func(t *testing.T) {
+			t.Parallel()
+			want := exportedSupplements()
+			var buf bytes.Buffer
+			w := supplement.NewExportWriter(&buf, format)
+			for _, s := range want {
+				if err := w.Write(s); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := w.Close(); err != nil {
+				t.Fatal(err)
+			}
+
+			records, err := supplement.ReadImport(&buf, supplement.ImportFormat(format), nil)
+
+			if err != nil {
+				t.Fatalf("ReadImport() error = %v, want nil", err)
+			}
+			var got []supplement.Supplement
+			for _, record := range records {
+				if record.Err != nil {
+					t.Errorf("ReadImport() line %d error = %v, want nil", record.Line, record.Err)
+				}
+				got = append(got, record.Supplement)
+			}
+			if diff := cmp.Diff(got, want); diff != "" {
+				t.Errorf("ReadImport() (-got +want):\n%s", diff)
+			}
+		})
+	}
+
+	t.Run("formulas are escaped", func(t *testing.T) {
+		t.Parallel()
+		s := exportedSupplements()[1]
+		s.Name, s.Brand, s.Flavor = `=HYPERLINK("http://example.com")`, "+Brand", "'=Lemon"
+		s.Ingredients = []string{"-water", "@cocoa"}
+
+		var csvBuf, xlsxBuf bytes.Buffer
+		for _, export := range []struct {
+			w      io.Writer
+			format supplement.ExportFormat
+		}{{&csvBuf, supplement.ExportCSV}, {&xlsxBuf, supplement.ExportXLSX}} {
+			w := supplement.NewExportWriter(export.w, export.format)
+			if err := w.Write(s); err != nil {
+				t.Fatal(err)
+			}
+			if err := w.Close(); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		sheet := readSheet(t, xlsxBuf.Bytes())
+		want := []string{`'=HYPERLINK("http://example.com")`, "'+Brand", "''=Lemon"}
+		if diff := cmp.Diff(sheet[1][1:4], want); diff != "" {
+			t.Errorf("xlsx cells (-got +want):\n%s", diff)
+		}
+		if !bytes.Contains(csvBuf.Bytes(), []byte(",'-water; @cocoa,")) {
+			t.Errorf("csv = %s, want the ingredients escaped", csvBuf.String())
+		}
+
+		records, err := supplement.ReadImport(&csvBuf, supplement.ImportCSV, nil)
+
+		if err != nil || len(records) != 1 {
+			t.Fatalf("ReadImport() = %v, %v, want a record", records, err)
+		}
+		if diff := cmp.Diff(records[0].Supplement, s); diff != "" {
+			t.Errorf("ReadImport() (-got +want):\n%s", diff)
+		}
+	})
+
+	t.Run("empty csv", func(t *testing.T) {
+		t.Parallel()
+		var buf bytes.Buffer
+		w := supplement.NewExportWriter(&buf, supplement.ExportCSV)
+
+		if err := w.Close(); err != nil {
+			t.Fatal(err)
+		}
+
+		records, err := supplement.ReadImport(&buf, supplement.ImportCSV, nil)
+		if err != nil || len(records) != 0 {
+			t.Errorf("ReadImport() = %v, %v, want a header only", records, err)
+		}
+	})
+
+	t.Run("xlsx", func(t *testing.T) {
+		t.Parallel()
+		var buf bytes.Buffer
+		w := supplement.NewExportWriter(&buf, supplement.ExportXLSX)
+		for _, s := range exportedSupplements() {
+			if err := w.Write(s); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := w.Close(); err != nil {
+			t.Fatal(err)
+		}
+
+		sheet := readSheet(t, buf.Bytes())
+
+		if len(sheet) != 3 {
+			t.Fatalf("sheet has %d rows, want 3", len(sheet))
+		}
+		for i, row := range sheet {
+			if len(row) != len(supplement.CSVColumns) {
+				t.Errorf("row %d has %d cells, want %d", i+1, len(row), len(supplement.CSVColumns))
+			}
+		}
+		want := map[string]string{
+			"gtin":                       "01234567890128",
+			"name":                       "Gel, \"Lemon\" & <Lime>",
+			"serving.size":               "60 g",
+			"serving.servingsPerPackage": "10",
+			"sodium":                     "300",
+			"allergens.mayContain":       "peanuts; soy",
+			"micronutrients.vitamin-b12": "2.5",
+			"micronutrients.calcium":     "",
+		}
+		for i, column := range sheet[0] {
+			if value, ok := want[column]; ok && sheet[1][i] != value {
+				t.Errorf("%s = %q, want %q", column, sheet[1][i], value)
+			}
+		}
+	})
+}
+
+// readSheet returns the cells of the only sheet of an XLSX file as text.
+func readSheet(t *testing.T, data []byte) [][]string {
+	t.Helper()
+
+	archive, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := archive.Open("xl/worksheets/sheet1.xml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	content, err := io.ReadAll(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var worksheet struct {
+		Rows []struct {
+			Cells []struct {
+				Value  string `xml:"v"`
+				Inline string `xml:"is>t"`
+			} `xml:"c"`
+		} `xml:"sheetData>row"`
+	}
+	if err := xml.Unmarshal(content, &worksheet); err != nil {
+		t.Fatal(err)
+	}
+
+	var rows [][]string
+	for _, r := range worksheet.Rows {
+		var row []string
+		for _, c := range r.Cells {
+			row = append(row, c.Value+c.Inline)
+		}
+		rows = append(rows, row)
+	}
+	return rows
+}
+
+func TestSupplementService_Export(t *testing.T) {
+	t.Parallel()
+	store := map[string]supplement.Supplement{
+		"01234567890128": {Gtin: "01234567890128"},
+		"04006381333931": {Gtin: "04006381333931"},
+		"05901234123457": {Gtin: "05901234123457"},
+	}
+	tests := []struct {
+		name    string
+		query   supplement.ListQuery
+		want    []string
+		wantErr error
+	}{
+		{
+			name:  "ignores limit and cursor",
+			query: supplement.ListQuery{Limit: 1, Cursor: "not a cursor"},
+			want:  []string{"01234567890128", "04006381333931", "05901234123457"},
+		},
+		{
+			name:    "invalid query",
+			query:   supplement.ListQuery{SortBy: "unknown"},
+			wantErr: supplement.ErrInvalidQuery,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			service := supplement.NewSupplementService(&stubSupplementRepository{store: store})
+
+			var got []string
+			err := service.Export(context.TODO(), tt.query, func(s supplement.Supplement) error {
+				got = append(got, s.Gtin)
+				return nil
+			})
+
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("SupplementService.Export() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if diff := cmp.Diff(got, tt.want); diff != "" {
+				t.Errorf("SupplementService.Export() (-got +want):\n%s", diff)
+			}
+		})
+	}
+}
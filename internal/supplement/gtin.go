@@ -0,0 +1,45 @@
+package supplement
+
+import (
+	"fmt"
+	"strings"
+)
+
+const gtinLength = 14
+
+// NormalizeGtin accepts any GTIN family member (GTIN-8, GTIN-12/UPC-A,
+// GTIN-13/EAN-13 or GTIN-14), verifies its GS1 mod-10 check digit and returns
+// it left-padded with zeros to 14 digits, which is the form used as key.
+func NormalizeGtin(gtin string) (string, error) {
+	gtin = strings.TrimSpace(gtin)
+
+	switch len(gtin) {
+	case 8, 12, 13, 14:
+	default:
+		return "", fmt.Errorf("gtin %q is invalid, it must be an 8, 12, 13 or 14-digit number", gtin)
+	}
+
+	for _, r := range gtin {
+		if r < '0' || r > '9' {
+			return "", fmt.Errorf("gtin %q is invalid, it must be an 8, 12, 13 or 14-digit number", gtin)
+		}
+	}
+
+	if want := gtinCheckDigit(gtin[:len(gtin)-1]); gtin[len(gtin)-1] != want {
+		return "", fmt.Errorf("gtin %q is invalid, its check digit must be %c", gtin, want)
+	}
+
+	return strings.Repeat("0", gtinLength-len(gtin)) + gtin, nil
+}
+
+// gtinCheckDigit computes the GS1 check digit: starting from the rightmost
+// digit of the payload, digits are alternately weighted 3 and 1.
+func gtinCheckDigit(payload string) byte {
+	sum := 0
+	weight := 3
+	for i := len(payload) - 1; i >= 0; i-- {
+		sum += int(payload[i]-'0') * weight
+		weight = 4 - weight
+	}
+	return byte('0' + (10-sum%10)%10)
+}
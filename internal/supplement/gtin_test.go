@@ -0,0 +1,39 @@
+package supplement_test
+
+import (
+	"testing"
+
+	"github.com/marioromandono/supplementapp/internal/supplement"
+)
+
+func TestNormalizeGtin(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name    string
+		gtin    string
+		want    string
+		wantErr bool
+	}{
+		{name: "gtin-8", gtin: "96385074", want: "00000096385074"},
+		{name: "gtin-12", gtin: "012345678905", want: "00012345678905"},
+		{name: "gtin-13", gtin: "4006381333931", want: "04006381333931"},
+		{name: "gtin-14", gtin: "10012345678902", want: "10012345678902"},
+		{name: "surrounding spaces", gtin: " 4006381333931\n", want: "04006381333931"},
+		{name: "empty", gtin: "", wantErr: true},
+		{name: "wrong length", gtin: "123456789", wantErr: true},
+		{name: "not a number", gtin: "400638133393A", wantErr: true},
+		{name: "wrong check digit", gtin: "4006381333932", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			got, err := supplement.NormalizeGtin(tt.gtin)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("NormalizeGtin() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("NormalizeGtin() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,430 @@
+package supplement
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+var ErrInvalidImport = errors.New("invalid import")
+
+type ImportFormat string
+
+const (
+	ImportCSV    ImportFormat = "csv"
+	ImportNDJSON ImportFormat = "ndjson"
+)
+
+// ImportPolicy decides what happens to the valid records of an import when
+// some are invalid.
+type ImportPolicy string
+
+const (
+	// AllOrNothing stores every record or, if any is invalid, none of them.
+	AllOrNothing ImportPolicy = "all-or-nothing"
+	// BestEffort stores every valid record, each in its own transaction.
+	BestEffort ImportPolicy = "best-effort"
+)
+
+type ImportOptions struct {
+	Policy ImportPolicy
+	// DryRun imports the records in a transaction that is always rolled
+	// back, so that the report tells what an import would do.
+	DryRun bool
+	// SkipExisting leaves stored supplements alone instead of replacing them.
+	SkipExisting bool
+	// Mapping renames CSV columns, from the header of the file to one of
+	// CSVColumns.
+	Mapping map[string]string
+}
+
+// ParseImportOptions builds ImportOptions from URL query parameters such as
+// ?policy=best-effort&dryRun=true&skipExisting=true&map=EAN=gtin,Product=name.
+func ParseImportOptions(values url.Values) (ImportOptions, error) {
+	options := ImportOptions{Policy: ImportPolicy(values.Get("policy"))}
+	var violations []Violation
+
+	for _, flag := range []struct {
+		name   string
+		target *bool
+	}{
+		{"dryRun", &options.DryRun},
+		{"skipExisting", &options.SkipExisting},
+	} {
+		if v := values.Get(flag.name); v != "" {
+			parsed, err := strconv.ParseBool(v)
+			if err != nil {
+				violations = append(violations, Violation{
+					Field:   flag.name,
+					Rule:    RuleType,
+					Value:   v,
+					Message: fmt.Sprintf("%s %q is not a boolean", flag.name, v),
+				})
+			}
+			*flag.target = parsed
+		}
+	}
+
+	if v := values.Get("map"); v != "" {
+		mapping, err := ParseMapping(v)
+		if err != nil {
+			return ImportOptions{}, err
+		}
+		options.Mapping = mapping
+	}
+
+	if err := newValidationError(ErrInvalidQuery, violations); err != nil {
+		return ImportOptions{}, err
+	}
+
+	if err := options.validate(); err != nil {
+		return ImportOptions{}, err
+	}
+
+	return options, nil
+}
+
+// ParseMapping reads a column mapping such as "EAN=gtin,Product=name".
+func ParseMapping(v string) (map[string]string, error) {
+	mapping := map[string]string{}
+	for _, pair := range strings.Split(v, ",") {
+		from, to, ok := strings.Cut(pair, "=")
+		from, to = strings.TrimSpace(from), strings.TrimSpace(to)
+		if !ok || from == "" || !slices.Contains(CSVColumns, to) {
+			return nil, newValidationError(ErrInvalidQuery, []Violation{{
+				Field:   "map",
+				Rule:    RuleOneOf,
+				Value:   pair,
+				Message: fmt.Sprintf("map %q is invalid, it must rename a column to one of %s", pair, strings.Join(CSVColumns, ", ")),
+			}})
+		}
+		mapping[from] = to
+	}
+	return mapping, nil
+}
+
+func (options *ImportOptions) validate() error {
+	switch options.Policy {
+	case "":
+		options.Policy = AllOrNothing
+	case AllOrNothing, BestEffort:
+	default:
+		return newValidationError(ErrInvalidQuery, []Violation{{
+			Field:   "policy",
+			Rule:    RuleOneOf,
+			Value:   options.Policy,
+			Message: fmt.Sprintf("policy %q is invalid, it must be one of %s, %s", options.Policy, AllOrNothing, BestEffort),
+		}})
+	}
+	return nil
+}
+
+// ImportRecord is a supplement read from line Line of an import file, or
+// the reason it could not be read.
+type ImportRecord struct {
+	Line       int
+	Supplement Supplement
+	Err        error
+}
+
+// ReadImport reads every record of an import file. Records that cannot be
+// read are returned with their error, to be reported as invalid, but a CSV
+// header with unknown columns fails the whole file with ErrInvalidImport.
+func ReadImport(r io.Reader, format ImportFormat, mapping map[string]string) ([]ImportRecord, error) {
+	switch format {
+	case ImportCSV:
+		return readCSV(r, mapping)
+	case ImportNDJSON:
+		return readNDJSON(r)
+	default:
+		return nil, fmt.Errorf("%w: format %q, expected %s or %s", ErrInvalidImport, format, ImportCSV, ImportNDJSON)
+	}
+}
+
+func readCSV(r io.Reader, mapping map[string]string) ([]ImportRecord, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if errors.Is(err, io.EOF) {
+		return []ImportRecord{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidImport, err)
+	}
+
+	columns, err := mapColumns(header, mapping)
+	if err != nil {
+		return nil, err
+	}
+
+	records := []ImportRecord{}
+	for {
+		cells, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			return records, nil
+		}
+
+		var parseErr *csv.ParseError
+		if errors.As(err, &parseErr) {
+			records = append(records, ImportRecord{Line: parseErr.StartLine, Err: fmt.Errorf("%w: %w", ErrInvalidImport, err)})
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		line, _ := reader.FieldPos(0)
+		if len(cells) != len(columns) {
+			records = append(records, ImportRecord{
+				Line: line,
+				Err:  fmt.Errorf("%w: line %d has %d cells, the header %d", ErrInvalidImport, line, len(cells), len(columns)),
+			})
+			continue
+		}
+
+		byColumn := make(map[string]string, len(columns))
+		for i, column := range columns {
+			byColumn[column] = strings.TrimSpace(cells[i])
+		}
+		s, err := fromCSV(byColumn)
+		records = append(records, ImportRecord{Line: line, Supplement: s, Err: err})
+	}
+}
+
+// mapColumns returns the column each header cell holds, once mapped.
+func mapColumns(header []string, mapping map[string]string) ([]string, error) {
+	var violations []Violation
+	columns := make([]string, len(header))
+	for i, name := range header {
+		name = strings.TrimSpace(name)
+		if i == 0 {
+			name = strings.TrimPrefix(name, "\ufeff")
+		}
+
+		column := name
+		if mapped, ok := mapping[name]; ok {
+			column = mapped
+		}
+
+		switch {
+		case !slices.Contains(CSVColumns, column):
+			violations = append(violations, Violation{
+				Field:   "header",
+				Rule:    RuleOneOf,
+				Value:   name,
+				Message: fmt.Sprintf("column %q is invalid, it must be one of %s or be mapped to one", name, strings.Join(CSVColumns, ", ")),
+			})
+		case slices.Contains(columns[:i], column):
+			violations = append(violations, Violation{
+				Field:   "header",
+				Rule:    RuleUnique,
+				Value:   name,
+				Message: fmt.Sprintf("column %q is invalid, %s is already read from another column", name, column),
+			})
+		}
+		columns[i] = column
+	}
+
+	if !slices.Contains(columns, columnGtin) {
+		violations = append(violations, Violation{
+			Field:   "header",
+			Rule:    RuleRequired,
+			Value:   strings.Join(header, ","),
+			Message: "header is invalid, it has no gtin column",
+		})
+	}
+
+	if err := newValidationError(ErrInvalidImport, violations); err != nil {
+		return nil, err
+	}
+	return columns, nil
+}
+
+func readNDJSON(r io.Reader) ([]ImportRecord, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, 1<<20)
+
+	records := []ImportRecord{}
+	for line := 1; scanner.Scan(); line++ {
+		data := bytes.TrimSpace(scanner.Bytes())
+		if len(data) == 0 {
+			continue
+		}
+
+		var s Supplement
+		if err := json.Unmarshal(data, &s); err != nil {
+			records = append(records, ImportRecord{Line: line, Err: fmt.Errorf("%w: %w", ErrInvalidImport, err)})
+			continue
+		}
+		records = append(records, ImportRecord{Line: line, Supplement: s})
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidImport, err)
+	}
+	return records, nil
+}
+
+type ImportStatus string
+
+const (
+	ImportCreated ImportStatus = "created"
+	ImportUpdated ImportStatus = "updated"
+	ImportSkipped ImportStatus = "skipped"
+	ImportInvalid ImportStatus = "invalid"
+)
+
+// ImportResult is what an import did with the record on Line. Skipped and
+// invalid records have a Reason, and invalid ones the violations, if any.
+type ImportResult struct {
+	Line   int          `json:"line"`
+	Gtin   string       `json:"gtin,omitempty"`
+	Status ImportStatus `json:"status"`
+	Reason string       `json:"reason,omitempty"`
+	Errors []Violation  `json:"errors,omitempty"`
+}
+
+// ImportReport tells what an import did with each record. Committed is
+// false for dry runs and for all-or-nothing imports with invalid records.
+type ImportReport struct {
+	DryRun    bool           `json:"dryRun"`
+	Committed bool           `json:"committed"`
+	Created   int            `json:"created"`
+	Updated   int            `json:"updated"`
+	Skipped   int            `json:"skipped"`
+	Invalid   int            `json:"invalid"`
+	Results   []ImportResult `json:"results"`
+}
+
+func (report *ImportReport) add(result ImportResult) {
+	switch result.Status {
+	case ImportCreated:
+		report.Created++
+	case ImportUpdated:
+		report.Updated++
+	case ImportSkipped:
+		report.Skipped++
+	case ImportInvalid:
+		report.Invalid++
+	}
+	report.Results = append(report.Results, result)
+}
+
+// errRollback rolls back the transaction of an import that must not be
+// committed.
+var errRollback = errors.New("import rolled back")
+
+// Import creates the supplements of records, or replaces those already
+// stored, validating each like Create. Errors other than invalid records
+// abort the import, leaving best-effort imports partly done.
+func (service *SupplementService) Import(ctx context.Context, records []ImportRecord, options ImportOptions) (ImportReport, error) {
+	if err := options.validate(); err != nil {
+		return ImportReport{}, err
+	}
+
+	report := ImportReport{DryRun: options.DryRun, Results: []ImportResult{}}
+
+	if options.Policy == BestEffort && !options.DryRun {
+		for _, record := range records {
+			var result ImportResult
+			err := service.inTransaction(ctx, func(tx *SupplementService) error {
+				var err error
+				result, err = tx.importRecord(ctx, record, options)
+				return err
+			})
+			if err != nil {
+				return ImportReport{}, err
+			}
+			report.add(result)
+		}
+		report.Committed = true
+		return report, nil
+	}
+
+	err := service.inTransaction(ctx, func(tx *SupplementService) error {
+		for _, record := range records {
+			result, err := tx.importRecord(ctx, record, options)
+			if err != nil {
+				return err
+			}
+			report.add(result)
+		}
+
+		if options.DryRun || options.Policy == AllOrNothing && report.Invalid > 0 {
+			return errRollback
+		}
+		return nil
+	})
+
+	if err != nil && !errors.Is(err, errRollback) {
+		return ImportReport{}, err
+	}
+
+	report.Committed = err == nil
+	return report, nil
+}
+
+// importRecord stores the supplement of record. Only errors that are not
+// about the record itself are returned.
+func (service *SupplementService) importRecord(ctx context.Context, record ImportRecord, options ImportOptions) (ImportResult, error) {
+	result := ImportResult{Line: record.Line, Gtin: record.Supplement.Gtin}
+
+	s := record.Supplement
+	err := record.Err
+	if err == nil {
+		err = s.validate()
+	}
+	if err != nil {
+		result.Status, result.Reason = ImportInvalid, err.Error()
+		var validationErr *ValidationError
+		if errors.As(err, &validationErr) {
+			result.Errors = validationErr.Violations
+		}
+		return result, nil
+	}
+
+	s.Gtin, _ = NormalizeGtin(s.Gtin)
+	s.normalize()
+	result.Gtin = s.Gtin
+
+	existing, err := service.repository.FindByGtin(ctx, s.Gtin)
+	if err != nil {
+		return ImportResult{}, err
+	}
+
+	switch {
+	case existing == nil:
+		result.Status = ImportCreated
+		err = service.repository.Create(ctx, s)
+	case options.SkipExisting:
+		result.Status, result.Reason = ImportSkipped, "it already exists"
+	case len(diff(existing, &s)) == 0:
+		result.Status, result.Reason = ImportSkipped, "it is unchanged"
+	default:
+		result.Status = ImportUpdated
+		s.Version = existing.Version
+		err = service.repository.Update(ctx, s)
+	}
+
+	// The GTIN was deleted, or the supplement changed, since it was read.
+	if errors.Is(err, ErrAlreadyExists) || errors.Is(err, ErrPreconditionFailed) {
+		result.Status, result.Reason = ImportSkipped, err.Error()
+		return result, nil
+	}
+	if err != nil {
+		return ImportResult{}, err
+	}
+
+	return result, nil
+}
@@ -0,0 +1,295 @@
+package supplement_test
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/marioromandono/supplementapp/internal/supplement"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+)
+
+func TestReadImport(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name    string
+		input   string
+		format  supplement.ImportFormat
+		mapping map[string]string
+		want    []supplement.ImportRecord
+		wantErr error
+	}{
+		{
+			name: "csv with mapping",
+			input: "\ufeffEAN,name,brand,flavor,serving.size,serving.servingsPerPackage,caffeine,sodium,ingredients,allergens.mayContain,micronutrients.potassium\n" +
+				"4006381333931,Gel,Brand,Lemon,60 g,10,75,0.2g,water; maltodextrin,soy,150 mg\n" +
+				"\"01234567890128\",Bar,Brand,Cocoa,,,,,,,\n",
+			format:  supplement.ImportCSV,
+			mapping: map[string]string{"EAN": "gtin"},
+			want: []supplement.ImportRecord{
+				{
+					Line: 2,
+					Supplement: supplement.Supplement{
+						Gtin:           "4006381333931",
+						Name:           "Gel",
+						Brand:          "Brand",
+						Flavor:         "Lemon",
+						Serving:        &supplement.Serving{Size: supplement.Grams(60), ServingsPerPackage: 10},
+						Caffeine:       supplement.Quantity{Amount: 75},
+						Sodium:         supplement.Grams(0.2),
+						Ingredients:    []string{"water", "maltodextrin"},
+						Allergens:      supplement.AllergenDeclaration{MayContain: []supplement.Allergen{supplement.AllergenSoy}},
+						Micronutrients: supplement.Panel{supplement.Potassium: supplement.Milligrams(150)},
+					},
+				},
+				{Line: 3, Supplement: supplement.Supplement{Gtin: "01234567890128", Name: "Bar", Brand: "Brand", Flavor: "Cocoa"}},
+			},
+		},
+		{
+			name:   "csv with unreadable cells",
+			input:  "gtin,name,protein,serving.servingsPerPackage\n01234567890128,Bar,lots,ten\n01234567890128,Bar\n",
+			format: supplement.ImportCSV,
+			want: []supplement.ImportRecord{
+				{
+					Line:       2,
+					Supplement: supplement.Supplement{Gtin: "01234567890128", Name: "Bar", Serving: &supplement.Serving{}},
+					Err:        supplement.ErrInvalidSupplement,
+				},
+				{Line: 3, Err: supplement.ErrInvalidImport},
+			},
+		},
+		{
+			name:    "csv with unknown column",
+			input:   "gtin,EAN\n",
+			format:  supplement.ImportCSV,
+			wantErr: supplement.ErrInvalidImport,
+		},
+		{
+			name:    "csv without gtin",
+			input:   "name,brand\n",
+			format:  supplement.ImportCSV,
+			wantErr: supplement.ErrInvalidImport,
+		},
+		{
+			name:    "csv with a column twice",
+			input:   "gtin,EAN\n",
+			format:  supplement.ImportCSV,
+			mapping: map[string]string{"EAN": "gtin"},
+			wantErr: supplement.ErrInvalidImport,
+		},
+		{
+			name:   "ndjson",
+			input:  `{"gtin": "01234567890128", "name": "Bar", "caffeine": {"amount": 75, "unit": "mg"}}` + "\n\n{\"gtin\": 1}\n",
+			format: supplement.ImportNDJSON,
+			want: []supplement.ImportRecord{
+				{Line: 1, Supplement: supplement.Supplement{Gtin: "01234567890128", Name: "Bar", Caffeine: supplement.Milligrams(75)}},
+				{Line: 3, Err: supplement.ErrInvalidImport},
+			},
+		},
+		{
+			name:    "unknown format",
+			format:  "xml",
+			wantErr: supplement.ErrInvalidImport,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			got, err := supplement.ReadImport(strings.NewReader(tt.input), tt.format, tt.mapping)
+
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("ReadImport() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if diff := cmp.Diff(got, tt.want, cmpopts.EquateErrors()); diff != "" {
+				t.Errorf("ReadImport() (-got +want):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestParseImportOptions(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name    string
+		values  url.Values
+		want    supplement.ImportOptions
+		wantErr error
+	}{
+		{
+			name:   "defaults",
+			values: url.Values{},
+			want:   supplement.ImportOptions{Policy: supplement.AllOrNothing},
+		},
+		{
+			name: "every option",
+			values: url.Values{
+				"policy":       {"best-effort"},
+				"dryRun":       {"true"},
+				"skipExisting": {"1"},
+				"map":          {"EAN=gtin, Product = name"},
+			},
+			want: supplement.ImportOptions{
+				Policy:       supplement.BestEffort,
+				DryRun:       true,
+				SkipExisting: true,
+				Mapping:      map[string]string{"EAN": "gtin", "Product": "name"},
+			},
+		},
+		{name: "unknown policy", values: url.Values{"policy": {"some"}}, wantErr: supplement.ErrInvalidQuery},
+		{name: "invalid dry run", values: url.Values{"dryRun": {"maybe"}}, wantErr: supplement.ErrInvalidQuery},
+		{name: "mapping to unknown column", values: url.Values{"map": {"EAN=ean"}}, wantErr: supplement.ErrInvalidQuery},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			got, err := supplement.ParseImportOptions(tt.values)
+
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("ParseImportOptions() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if diff := cmp.Diff(got, tt.want); diff != "" {
+				t.Errorf("ParseImportOptions() (-got +want):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestSupplementService_Import(t *testing.T) {
+	t.Parallel()
+	stored := supplement.Supplement{
+		Gtin:          "04006381333931",
+		Name:          "Gel",
+		Brand:         "Brand",
+		Flavor:        "Lemon",
+		Carbohydrates: supplement.Grams(0),
+		Electrolytes:  supplement.Milligrams(0),
+		Maltodextrose: supplement.Grams(0),
+		Fructose:      supplement.Grams(0),
+		Caffeine:      supplement.Milligrams(0),
+		Sodium:        supplement.Milligrams(0),
+		Protein:       supplement.Grams(0),
+		Version:       1,
+	}
+	records := []supplement.ImportRecord{
+		{Line: 2, Supplement: supplement.Supplement{Gtin: "1234567890128", Name: "Bar", Brand: "Brand", Flavor: "Cocoa"}},
+		{Line: 3, Supplement: supplement.Supplement{Gtin: "04006381333931", Name: "Gel", Brand: "Brand", Flavor: "Lemon"}},
+		{Line: 4, Supplement: supplement.Supplement{Gtin: "04006381333931", Name: "Gel", Brand: "Brand", Flavor: "Orange"}},
+		{Line: 5, Supplement: supplement.Supplement{Gtin: "05901234123457", Name: "Chew"}},
+		{Line: 6, Err: supplement.ErrInvalidImport},
+	}
+	created := supplement.ImportResult{Line: 2, Gtin: "01234567890128", Status: supplement.ImportCreated}
+	unchanged := supplement.ImportResult{Line: 3, Gtin: "04006381333931", Status: supplement.ImportSkipped, Reason: "it is unchanged"}
+	updated := supplement.ImportResult{Line: 4, Gtin: "04006381333931", Status: supplement.ImportUpdated}
+	invalid := []supplement.ImportResult{
+		{Line: 5, Gtin: "05901234123457", Status: supplement.ImportInvalid},
+		{Line: 6, Status: supplement.ImportInvalid},
+	}
+	tests := []struct {
+		name       string
+		records    []supplement.ImportRecord
+		options    supplement.ImportOptions
+		want       supplement.ImportReport
+		wantStored []string
+	}{
+		{
+			name:    "all or nothing",
+			records: records[:3],
+			options: supplement.ImportOptions{Policy: supplement.AllOrNothing},
+			want: supplement.ImportReport{
+				Committed: true,
+				Created:   1,
+				Updated:   1,
+				Skipped:   1,
+				Results:   []supplement.ImportResult{created, unchanged, updated},
+			},
+			wantStored: []string{"01234567890128", "04006381333931"},
+		},
+		{
+			name:    "all or nothing with invalid records",
+			records: records,
+			options: supplement.ImportOptions{Policy: supplement.AllOrNothing},
+			want: supplement.ImportReport{
+				Created: 1,
+				Updated: 1,
+				Skipped: 1,
+				Invalid: 2,
+				Results: append([]supplement.ImportResult{created, unchanged, updated}, invalid...),
+			},
+			wantStored: []string{"04006381333931"},
+		},
+		{
+			name:    "best effort with invalid records",
+			records: records,
+			options: supplement.ImportOptions{Policy: supplement.BestEffort},
+			want: supplement.ImportReport{
+				Committed: true,
+				Created:   1,
+				Updated:   1,
+				Skipped:   1,
+				Invalid:   2,
+				Results:   append([]supplement.ImportResult{created, unchanged, updated}, invalid...),
+			},
+			wantStored: []string{"01234567890128", "04006381333931"},
+		},
+		{
+			name:    "dry run",
+			records: records[:1],
+			options: supplement.ImportOptions{Policy: supplement.BestEffort, DryRun: true},
+			want: supplement.ImportReport{
+				DryRun:  true,
+				Created: 1,
+				Results: []supplement.ImportResult{created},
+			},
+			wantStored: []string{"04006381333931"},
+		},
+		{
+			name:    "skip existing",
+			records: records[2:3],
+			options: supplement.ImportOptions{SkipExisting: true},
+			want: supplement.ImportReport{
+				Committed: true,
+				Skipped:   1,
+				Results:   []supplement.ImportResult{{Line: 4, Gtin: "04006381333931", Status: supplement.ImportSkipped, Reason: "it already exists"}},
+			},
+			wantStored: []string{"04006381333931"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			repository := &stubSupplementRepository{store: map[string]supplement.Supplement{stored.Gtin: stored}}
+			service := supplement.NewSupplementService(repository)
+
+			got, err := service.Import(context.TODO(), tt.records, tt.options)
+
+			if err != nil {
+				t.Fatalf("SupplementService.Import() error = %v, want nil", err)
+			}
+			if diff := cmp.Diff(got, tt.want, ignoreInvalidReasons()); diff != "" {
+				t.Errorf("SupplementService.Import() (-got +want):\n%s", diff)
+			}
+			var gtins []string
+			for gtin := range repository.store {
+				gtins = append(gtins, gtin)
+			}
+			if diff := cmp.Diff(gtins, tt.wantStored, cmpopts.SortSlices(func(a, b string) bool { return a < b })); diff != "" {
+				t.Errorf("SupplementService.Import() stored (-got +want):\n%s", diff)
+			}
+		})
+	}
+}
+
+// ignoreInvalidReasons leaves the reasons and violations of invalid results,
+// which repeat the validation messages, out of comparisons.
+func ignoreInvalidReasons() cmp.Option {
+	return cmp.Transformer("invalidReason", func(r supplement.ImportResult) supplement.ImportResult {
+		if r.Status == supplement.ImportInvalid {
+			r.Reason, r.Errors = "", nil
+		}
+		return r
+	})
+}
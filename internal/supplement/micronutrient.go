@@ -0,0 +1,157 @@
+package supplement
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+)
+
+// Micronutrient is the code of a mineral or vitamin a supplement may declare
+// in its Panel.
+type Micronutrient string
+
+const (
+	Potassium  Micronutrient = "potassium"
+	Magnesium  Micronutrient = "magnesium"
+	Calcium    Micronutrient = "calcium"
+	Chloride   Micronutrient = "chloride"
+	Iron       Micronutrient = "iron"
+	Zinc       Micronutrient = "zinc"
+	VitaminB1  Micronutrient = "vitamin-b1"
+	VitaminB6  Micronutrient = "vitamin-b6"
+	VitaminB12 Micronutrient = "vitamin-b12"
+	VitaminC   Micronutrient = "vitamin-c"
+	VitaminD   Micronutrient = "vitamin-d"
+	VitaminE   Micronutrient = "vitamin-e"
+)
+
+// micronutrients is the registry of known micronutrient codes, in the order
+// they are listed in, with the unit the amount of each is stored in.
+// Supporting a new micronutrient takes an entry here and a row in the
+// micronutrients table, which the tests check the migrations for.
+var micronutrients = []struct {
+	code Micronutrient
+	unit Unit
+}{
+	{Potassium, Milligram},
+	{Magnesium, Milligram},
+	{Calcium, Milligram},
+	{Chloride, Milligram},
+	{Iron, Milligram},
+	{Zinc, Milligram},
+	{VitaminB1, Milligram},
+	{VitaminB6, Milligram},
+	{VitaminB12, Microgram},
+	{VitaminC, Milligram},
+	{VitaminD, Microgram},
+	{VitaminE, Milligram},
+}
+
+var micronutrientUnits = registeredUnits()
+
+// Micronutrients lists the known micronutrient codes in registry order, which
+// is the order of their CSV columns.
+var Micronutrients = registeredMicronutrients()
+
+func registeredUnits() map[Micronutrient]Unit {
+	units := make(map[Micronutrient]Unit, len(micronutrients))
+	for _, m := range micronutrients {
+		units[m.code] = m.unit
+	}
+	return units
+}
+
+func registeredMicronutrients() []Micronutrient {
+	codes := make([]Micronutrient, len(micronutrients))
+	for i, m := range micronutrients {
+		codes[i] = m.code
+	}
+	return codes
+}
+
+// Unit is the unit amounts of m are stored in, empty if m is not registered.
+func (m Micronutrient) Unit() Unit {
+	return micronutrientUnits[m]
+}
+
+func (m Micronutrient) valid() bool {
+	_, ok := micronutrientUnits[m]
+	return ok
+}
+
+// Panel holds the amount per serving of each micronutrient a supplement
+// declares. Once stored, amounts are in the unit of their Micronutrient.
+type Panel map[Micronutrient]Quantity
+
+// PanelUpdate changes a Panel: a micronutrient set to a quantity is added or
+// replaced, one set to nil, null in JSON, is removed, and the rest are kept.
+type PanelUpdate map[Micronutrient]*Quantity
+
+func (p Panel) update(other PanelUpdate) Panel {
+	updated := maps.Clone(p)
+	if updated == nil {
+		updated = Panel{}
+	}
+
+	for m, q := range other {
+		if q == nil {
+			delete(updated, m)
+		} else {
+			updated[m] = *q
+		}
+	}
+
+	return updated
+}
+
+func micronutrientNames() string {
+	names := make([]string, len(Micronutrients))
+	for i, m := range Micronutrients {
+		names[i] = string(m)
+	}
+	return strings.Join(names, ", ")
+}
+
+func appendIfInvalidPanel(violations []Violation, panel Panel) []Violation {
+	codes := make([]Micronutrient, 0, len(panel))
+	for m := range panel {
+		codes = append(codes, m)
+	}
+	slices.Sort(codes)
+
+	for _, m := range codes {
+		field := "micronutrients." + string(m)
+		if !m.valid() {
+			violations = append(violations, Violation{
+				Field:   field,
+				Rule:    RuleOneOf,
+				Value:   m,
+				Message: fmt.Sprintf("micronutrient %q is invalid, it must be one of %s", m, micronutrientNames()),
+			})
+			continue
+		}
+		violations = appendIfInvalidAmount(violations, field, m.Unit(), panel[m])
+	}
+	return violations
+}
+
+// normalizePanel converts every micronutrient of a valid supplement to the
+// unit it is stored in, into a copy of the panel.
+func (s *Supplement) normalizePanel() {
+	if len(s.Micronutrients) == 0 {
+		s.Micronutrients = nil
+		return
+	}
+
+	panel := make(Panel, len(s.Micronutrients))
+	for m, q := range s.Micronutrients {
+		if q.Unit == "" {
+			q.Unit = m.Unit()
+		}
+		q, _ = q.In(m.Unit())
+		q.Amount = round(q.Amount, NutrientScale)
+		panel[m] = q
+	}
+	s.Micronutrients = panel
+}
@@ -0,0 +1,63 @@
+package supplement_test
+
+import (
+	"io/fs"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/marioromandono/supplementapp/internal/supplement"
+	"github.com/marioromandono/supplementapp/migrations"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+var (
+	micronutrientsInsert = regexp.MustCompile(`(?is)INSERT INTO micronutrients \(code, unit\) VALUES(.*?);`)
+	micronutrientRow     = regexp.MustCompile(`\('([^']*)', '([^']*)'\)`)
+)
+
+// TestMicronutrientsTable checks that the migrations seed the micronutrients
+// table with exactly the registry, so neither accepts codes the other rejects.
+func TestMicronutrientsTable(t *testing.T) {
+	t.Parallel()
+	want := make(map[supplement.Micronutrient]supplement.Unit, len(supplement.Micronutrients))
+	for _, m := range supplement.Micronutrients {
+		want[m] = m.Unit()
+	}
+
+	tests := []struct {
+		name       string
+		migrations fs.FS
+	}{
+		{name: "postgres", migrations: migrations.Postgres},
+		{name: "sqlite", migrations: migrations.SQLite},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			files, err := fs.Glob(tt.migrations, "*.sql")
+			if err != nil {
+				t.Fatalf("fs.Glob() error = %v", err)
+			}
+
+			got := make(map[supplement.Micronutrient]supplement.Unit)
+			for _, file := range files {
+				data, err := fs.ReadFile(tt.migrations, file)
+				if err != nil {
+					t.Fatalf("fs.ReadFile(%q) error = %v", file, err)
+				}
+				up, _, _ := strings.Cut(string(data), "-- +goose Down")
+				for _, insert := range micronutrientsInsert.FindAllStringSubmatch(up, -1) {
+					for _, row := range micronutrientRow.FindAllStringSubmatch(insert[1], -1) {
+						got[supplement.Micronutrient(row[1])] = supplement.Unit(row[2])
+					}
+				}
+			}
+
+			if diff := cmp.Diff(got, want); diff != "" {
+				t.Errorf("micronutrients table (-got +want):\n%s", diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,89 @@
+package supplement
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	jsonpatch "github.com/evanphx/json-patch/v5"
+)
+
+const (
+	MergePatchContentType = "application/merge-patch+json"
+	JSONPatchContentType  = "application/json-patch+json"
+)
+
+// Patch changes the JSON representation of a supplement, as returned by
+// FindByGtin, into its new representation.
+type Patch interface {
+	apply(document []byte) ([]byte, error)
+}
+
+type mergePatch []byte
+
+// NewMergePatch parses an RFC 7396 JSON Merge Patch. Members set to null are
+// reset to their zero value.
+func NewMergePatch(patch []byte) (Patch, error) {
+	if !json.Valid(patch) {
+		return nil, fmt.Errorf("%w: merge patch is not valid JSON", ErrInvalidPatch)
+	}
+	return mergePatch(patch), nil
+}
+
+func (p mergePatch) apply(document []byte) ([]byte, error) {
+	patched, err := jsonpatch.MergePatch(document, p)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidPatch, err)
+	}
+	return patched, nil
+}
+
+type jsonPatch struct {
+	operations jsonpatch.Patch
+}
+
+// NewJSONPatch parses an RFC 6902 JSON Patch. If any of its test operations
+// fails, applying it reports ErrPatchTestFailed and nothing is changed.
+func NewJSONPatch(patch []byte) (Patch, error) {
+	operations, err := jsonpatch.DecodePatch(patch)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidPatch, err)
+	}
+	return jsonPatch{operations: operations}, nil
+}
+
+func (p jsonPatch) apply(document []byte) ([]byte, error) {
+	patched, err := p.operations.Apply(document)
+	if errors.Is(err, jsonpatch.ErrTestFailed) {
+		return nil, fmt.Errorf("%w: %v", ErrPatchTestFailed, err)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidPatch, err)
+	}
+	return patched, nil
+}
+
+// patch applies p to the JSON representation of s. Unknown members in the
+// result are rejected rather than silently dropped.
+func (s *Supplement) patch(p Patch) (Supplement, error) {
+	document, err := json.Marshal(s)
+	if err != nil {
+		return Supplement{}, err
+	}
+
+	patched, err := p.apply(document)
+	if err != nil {
+		return Supplement{}, err
+	}
+
+	var updated Supplement
+	decoder := json.NewDecoder(bytes.NewReader(patched))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&updated); err != nil {
+		return Supplement{}, fmt.Errorf("%w: %v", ErrInvalidPatch, err)
+	}
+
+	updated.Version = s.Version
+	return updated, nil
+}
@@ -0,0 +1,310 @@
+package memory
+
+import (
+	"cmp"
+	"context"
+	"maps"
+	"math"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/marioromandono/supplementapp/internal/supplement"
+)
+
+// MemorySupplementRepository keeps supplements, and the audit entries of
+// their changes, in maps guarded by a mutex. It is meant for tests and demos
+// and honors the same contract as the Postgres repository, including ListAll
+// ordering.
+type MemorySupplementRepository struct {
+	mu          sync.RWMutex
+	supplements map[string]supplement.Supplement
+	history     map[string][]supplement.AuditEntry
+}
+
+func NewSupplementRepository() *MemorySupplementRepository {
+	return &MemorySupplementRepository{
+		supplements: make(map[string]supplement.Supplement),
+		history:     make(map[string][]supplement.AuditEntry),
+	}
+}
+
+// InTransaction locks the repository for as long as fn runs, on a copy of
+// its maps that replaces them if fn succeeds.
+func (r *MemorySupplementRepository) InTransaction(ctx context.Context, fn func(repository supplement.SupplementRepository) error) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	tx := &MemorySupplementRepository{
+		supplements: maps.Clone(r.supplements),
+		history:     make(map[string][]supplement.AuditEntry, len(r.history)),
+	}
+	for gtin, entries := range r.history {
+		tx.history[gtin] = slices.Clip(entries)
+	}
+
+	if err := fn(tx); err != nil {
+		return err
+	}
+
+	r.supplements, r.history = tx.supplements, tx.history
+	return nil
+}
+
+func (r *MemorySupplementRepository) FindByGtin(ctx context.Context, gtin string) (*supplement.Supplement, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	s, ok := r.supplements[gtin]
+	if !ok || s.DeletedAt != nil {
+		return nil, nil
+	}
+	s = clone(s)
+	return &s, nil
+}
+
+func (r *MemorySupplementRepository) Create(ctx context.Context, s supplement.Supplement) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.supplements[s.Gtin]; ok {
+		return supplement.ErrAlreadyExists
+	}
+
+	s.Version = 1
+	s.DeletedAt = nil
+	r.supplements[s.Gtin] = clone(s)
+	r.record(supplement.NewAuditEntry(ctx, supplement.OperationCreate, nil, &s))
+	return nil
+}
+
+func (r *MemorySupplementRepository) Update(ctx context.Context, s supplement.Supplement) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	stored, ok := r.supplements[s.Gtin]
+	if !ok || stored.DeletedAt != nil || stored.Version != s.Version {
+		return supplement.ErrPreconditionFailed
+	}
+
+	s.Version++
+	s.DeletedAt = nil
+	r.supplements[s.Gtin] = clone(s)
+	r.record(supplement.NewAuditEntry(ctx, supplement.OperationUpdate, &stored, &s))
+	return nil
+}
+
+func (r *MemorySupplementRepository) Delete(ctx context.Context, s supplement.Supplement) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	stored, ok := r.supplements[s.Gtin]
+	if !ok || stored.DeletedAt != nil || stored.Version != s.Version {
+		return supplement.ErrPreconditionFailed
+	}
+
+	deleted := clone(stored)
+	deletedAt := time.Now().UTC().Truncate(time.Microsecond)
+	deleted.DeletedAt = &deletedAt
+	deleted.Version++
+	r.supplements[s.Gtin] = deleted
+	r.record(supplement.NewAuditEntry(ctx, supplement.OperationDelete, &stored, &deleted))
+	return nil
+}
+
+func (r *MemorySupplementRepository) Restore(ctx context.Context, gtin string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	stored, ok := r.supplements[gtin]
+	if !ok || stored.DeletedAt == nil {
+		return supplement.ErrNotFound
+	}
+
+	restored := clone(stored)
+	restored.DeletedAt = nil
+	restored.Version++
+	r.supplements[gtin] = restored
+	r.record(supplement.NewAuditEntry(ctx, supplement.OperationRestore, &stored, &restored))
+	return nil
+}
+
+func (r *MemorySupplementRepository) Purge(ctx context.Context, deletedBefore time.Time) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	purged := 0
+	for gtin, stored := range r.supplements {
+		if stored.DeletedAt == nil || !stored.DeletedAt.Before(deletedBefore) {
+			continue
+		}
+		delete(r.supplements, gtin)
+		r.record(supplement.NewAuditEntry(ctx, supplement.OperationPurge, &stored, nil))
+		purged++
+	}
+	return purged, nil
+}
+
+func (r *MemorySupplementRepository) History(ctx context.Context, gtin string) ([]supplement.AuditEntry, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return slices.Clone(r.history[gtin]), nil
+}
+
+// record appends entry to the history of its supplement. The caller must
+// hold the write lock.
+func (r *MemorySupplementRepository) record(entry supplement.AuditEntry) {
+	r.history[entry.Gtin] = append(r.history[entry.Gtin], entry)
+}
+
+func (r *MemorySupplementRepository) ListAll(ctx context.Context, query supplement.ListQuery) ([]supplement.Supplement, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	direction := 1
+	if query.SortDirection == supplement.Descending {
+		direction = -1
+	}
+
+	supplements := []supplement.Supplement{}
+	for _, s := range r.supplements {
+		if s.DeletedAt != nil && !query.IncludeDeleted || !matches(s, query) {
+			continue
+		}
+		if query.After != nil && direction*compareKeyset(s, query.SortBy, *query.After) <= 0 {
+			continue
+		}
+		supplements = append(supplements, clone(s))
+	}
+
+	slices.SortFunc(supplements, func(a, b supplement.Supplement) int {
+		return direction * compareKeyset(a, query.SortBy, supplement.Keyset{Value: b.SortValue(query.SortBy), Gtin: b.Gtin})
+	})
+
+	if len(supplements) > query.Limit {
+		supplements = supplements[:query.Limit]
+	}
+
+	return supplements, nil
+}
+
+// Export lists the supplements under the lock, but calls fn after releasing
+// it.
+func (r *MemorySupplementRepository) Export(ctx context.Context, query supplement.ListQuery, fn func(supplement.Supplement) error) error {
+	query.Limit = math.MaxInt
+	supplements, err := r.ListAll(ctx, query)
+	if err != nil {
+		return err
+	}
+
+	for _, s := range supplements {
+		if err := fn(s); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *MemorySupplementRepository) Search(ctx context.Context, query supplement.SearchQuery) ([]supplement.Supplement, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	terms := supplement.SearchTerms(query.Text)
+	ranks := make(map[string]float64)
+	supplements := []supplement.Supplement{}
+	for _, s := range r.supplements {
+		if s.DeletedAt != nil {
+			continue
+		}
+		if rank := supplement.SearchRank(s.SearchText(), terms); rank > 0 {
+			ranks[s.Gtin] = rank
+			supplements = append(supplements, clone(s))
+		}
+	}
+
+	slices.SortFunc(supplements, func(a, b supplement.Supplement) int {
+		if c := cmp.Compare(ranks[b.Gtin], ranks[a.Gtin]); c != 0 {
+			return c
+		}
+		return strings.Compare(a.Gtin, b.Gtin)
+	})
+
+	if len(supplements) > query.Limit {
+		supplements = supplements[:query.Limit]
+	}
+
+	return supplements, nil
+}
+
+func matches(s supplement.Supplement, query supplement.ListQuery) bool {
+	if query.Brand != "" && strings.ToLower(s.Brand) != strings.ToLower(query.Brand) {
+		return false
+	}
+
+	if query.Flavor != "" && strings.ToLower(s.Flavor) != strings.ToLower(query.Flavor) {
+		return false
+	}
+
+	if query.Category != "" && s.Category != query.Category {
+		return false
+	}
+
+	for _, a := range query.ExcludeAllergens {
+		if s.Allergens.Declares(a) {
+			return false
+		}
+	}
+
+	for _, nr := range query.NutrientRanges {
+		value, _ := s.SortValue(supplement.SortField(nr.Nutrient)).(float64)
+		if nr.Min != nil && value < *nr.Min || nr.Max != nil && value > *nr.Max {
+			return false
+		}
+	}
+
+	return true
+}
+
+// compareKeyset orders s against keyset the way Postgres compares the row
+// (column, gtin): by the sort field first, then by GTIN. Text is compared
+// byte-wise, which matches the C collation.
+func compareKeyset(s supplement.Supplement, field supplement.SortField, keyset supplement.Keyset) int {
+	if field == supplement.SortByGtin {
+		return strings.Compare(s.Gtin, keyset.Gtin)
+	}
+
+	var c int
+	switch value := s.SortValue(field).(type) {
+	case float64:
+		other, _ := keyset.Value.(float64)
+		c = cmp.Compare(value, other)
+	case string:
+		other, _ := keyset.Value.(string)
+		c = strings.Compare(value, other)
+	}
+
+	if c != 0 {
+		return c
+	}
+	return strings.Compare(s.Gtin, keyset.Gtin)
+}
+
+// clone copies what s points to, so that callers never share memory with the
+// stored supplement.
+func clone(s supplement.Supplement) supplement.Supplement {
+	if s.Serving != nil {
+		serving := *s.Serving
+		s.Serving = &serving
+	}
+	s.Ingredients = slices.Clone(s.Ingredients)
+	s.Allergens.Contains = slices.Clone(s.Allergens.Contains)
+	s.Allergens.MayContain = slices.Clone(s.Allergens.MayContain)
+	s.Micronutrients = maps.Clone(s.Micronutrients)
+	if s.DeletedAt != nil {
+		deletedAt := *s.DeletedAt
+		s.DeletedAt = &deletedAt
+	}
+	return s
+}
@@ -0,0 +1,15 @@
+package memory_test
+
+import (
+	"testing"
+
+	"github.com/marioromandono/supplementapp/internal/supplement"
+	"github.com/marioromandono/supplementapp/internal/supplement/persistence/memory"
+	"github.com/marioromandono/supplementapp/internal/supplement/persistence/repotest"
+)
+
+func TestMemorySupplementRepository(t *testing.T) {
+	repotest.Run(t, func(t *testing.T) supplement.SupplementRepository {
+		return memory.NewSupplementRepository()
+	})
+}
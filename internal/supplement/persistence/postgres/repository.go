@@ -2,30 +2,139 @@ package postgres
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
 
 	"github.com/marioromandono/supplementapp/internal/supplement"
 
 	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
+const selectColumns = "id, gtin, name, brand, flavor, category, serving_size, serving_unit, servings_per_package, " +
+	"carbohydrates, electrolytes, maltodextrose, fructose, caffeine, sodium, protein, deleted_at, version"
+
+// row is a Supplements row. Nutrient amounts are stored in the unit of their
+// nutrient, the category is null when unknown, and so are all the serving
+// columns. Ingredients and allergens live in their own tables, keyed by ID.
+// deleted_at is null but for tombstones.
+type row struct {
+	ID                 int64      `db:"id"`
+	Gtin               string     `db:"gtin"`
+	Name               string     `db:"name"`
+	Brand              string     `db:"brand"`
+	Flavor             string     `db:"flavor"`
+	Category           *string    `db:"category"`
+	ServingSize        *float64   `db:"serving_size"`
+	ServingUnit        *string    `db:"serving_unit"`
+	ServingsPerPackage *int       `db:"servings_per_package"`
+	Carbohydrates      float64    `db:"carbohydrates"`
+	Electrolytes       float64    `db:"electrolytes"`
+	Maltodextrose      float64    `db:"maltodextrose"`
+	Fructose           float64    `db:"fructose"`
+	Caffeine           float64    `db:"caffeine"`
+	Sodium             float64    `db:"sodium"`
+	Protein            float64    `db:"protein"`
+	DeletedAt          *time.Time `db:"deleted_at"`
+	Version            int64      `db:"version"`
+}
+
+func (r row) supplement() supplement.Supplement {
+	s := supplement.Supplement{
+		Gtin:          r.Gtin,
+		Name:          r.Name,
+		Brand:         r.Brand,
+		Flavor:        r.Flavor,
+		Carbohydrates: supplement.Carbohydrates.Quantity(r.Carbohydrates),
+		Electrolytes:  supplement.Electrolytes.Quantity(r.Electrolytes),
+		Maltodextrose: supplement.Maltodextrose.Quantity(r.Maltodextrose),
+		Fructose:      supplement.Fructose.Quantity(r.Fructose),
+		Caffeine:      supplement.Caffeine.Quantity(r.Caffeine),
+		Sodium:        supplement.Sodium.Quantity(r.Sodium),
+		Protein:       supplement.Protein.Quantity(r.Protein),
+		Version:       r.Version,
+	}
+
+	if r.DeletedAt != nil {
+		deletedAt := r.DeletedAt.UTC()
+		s.DeletedAt = &deletedAt
+	}
+
+	if r.Category != nil {
+		s.Category = supplement.Category(*r.Category)
+	}
+
+	if r.ServingSize != nil && r.ServingUnit != nil && r.ServingsPerPackage != nil {
+		s.Serving = &supplement.Serving{
+			Size:               supplement.Quantity{Amount: *r.ServingSize, Unit: supplement.Unit(*r.ServingUnit)},
+			ServingsPerPackage: *r.ServingsPerPackage,
+		}
+	}
+
+	return s
+}
+
+// categoryColumn returns the category value of s, nil when unknown.
+func categoryColumn(s supplement.Supplement) any {
+	if s.Category == "" {
+		return nil
+	}
+	return string(s.Category)
+}
+
+// servingColumns returns the serving_size, serving_unit and
+// servings_per_package values of s, all nil when the serving is unknown.
+func servingColumns(s supplement.Supplement) (size, unit, perPackage any) {
+	if s.Serving == nil {
+		return nil, nil, nil
+	}
+	return s.Serving.Size.Amount, string(s.Serving.Size.Unit), s.Serving.ServingsPerPackage
+}
+
 type PostgresSupplementRepository struct {
-	db        *pgxpool.Pool
+	db        database
 	tableName string
 }
 
+// database is what both the pool and a transaction can begin a transaction
+// on. On a transaction, that is a savepoint.
+type database interface {
+	querier
+	Begin(ctx context.Context) (pgx.Tx, error)
+}
+
 func NewSupplementRepository(db *pgxpool.Pool) *PostgresSupplementRepository {
 	return &PostgresSupplementRepository{db: db, tableName: "Supplements"}
 }
 
+func (r *PostgresSupplementRepository) InTransaction(ctx context.Context, fn func(repository supplement.SupplementRepository) error) error {
+	return pgx.BeginFunc(ctx, r.db, func(tx pgx.Tx) error {
+		return fn(&PostgresSupplementRepository{db: tx, tableName: r.tableName})
+	})
+}
+
 func (r *PostgresSupplementRepository) FindByGtin(ctx context.Context, gtin string) (*supplement.Supplement, error) {
-	rows, _ := r.db.Query(
-		ctx,
-		"SELECT gtin, name, brand, flavor, carbohydrates, electrolytes, maltodextrose, fructose, caffeine, sodium, protein "+
-			"FROM "+r.tableName+" WHERE gtin = $1",
-		gtin,
-	)
-	s, err := pgx.CollectExactlyOneRow(rows, pgx.RowToAddrOfStructByName[supplement.Supplement])
+	return r.find(ctx, r.db, gtin, false, false)
+}
+
+// find reads a supplement through db, which may be a transaction, or its
+// tombstone if deleted. With forUpdate, its row stays locked until the
+// transaction ends.
+func (r *PostgresSupplementRepository) find(ctx context.Context, db querier, gtin string, deleted, forUpdate bool) (*supplement.Supplement, error) {
+	sql := "SELECT " + selectColumns + " FROM " + r.tableName + " WHERE gtin = $1 AND deleted_at IS NULL"
+	if deleted {
+		sql = "SELECT " + selectColumns + " FROM " + r.tableName + " WHERE gtin = $1 AND deleted_at IS NOT NULL"
+	}
+	if forUpdate {
+		sql += " FOR UPDATE"
+	}
+
+	rows, _ := db.Query(ctx, sql, gtin)
+	found, err := pgx.CollectExactlyOneRow(rows, pgx.RowToStructByName[row])
 
 	if err != nil {
 		if err == pgx.ErrNoRows {
@@ -34,43 +143,599 @@ func (r *PostgresSupplementRepository) FindByGtin(ctx context.Context, gtin stri
 		return nil, err
 	}
 
-	return s, err
+	supplements, err := withComposition(ctx, db, []row{found})
+	if err != nil {
+		return nil, err
+	}
+
+	return &supplements[0], nil
 }
 
 func (r *PostgresSupplementRepository) Create(ctx context.Context, s supplement.Supplement) error {
-	_, err := r.db.Exec(
+	servingSize, servingUnit, servingsPerPackage := servingColumns(s)
+	return pgx.BeginFunc(ctx, r.db, func(tx pgx.Tx) error {
+		var exists bool
+		err := tx.QueryRow(ctx, "SELECT EXISTS (SELECT 1 FROM "+r.tableName+" WHERE gtin = $1)", s.Gtin).Scan(&exists)
+		if err != nil {
+			return err
+		}
+		if exists {
+			return supplement.ErrAlreadyExists
+		}
+
+		var id int64
+		err = tx.QueryRow(
+			ctx,
+			"INSERT INTO "+r.tableName+
+				" (gtin, name, brand, flavor, category, serving_size, serving_unit, servings_per_package, carbohydrates, electrolytes, maltodextrose, fructose, caffeine, sodium, protein) "+
+				"VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15) RETURNING id",
+			s.Gtin, s.Name, s.Brand, s.Flavor, categoryColumn(s), servingSize, servingUnit, servingsPerPackage,
+			s.Carbohydrates.Amount, s.Electrolytes.Amount, s.Maltodextrose.Amount, s.Fructose.Amount, s.Caffeine.Amount, s.Sodium.Amount, s.Protein.Amount,
+		).Scan(&id)
+
+		if err != nil {
+			return alreadyExists(err)
+		}
+
+		if err := insertComposition(ctx, tx, id, s); err != nil {
+			return err
+		}
+
+		s.Version = 1
+		s.DeletedAt = nil
+		return insertAuditEntry(ctx, tx, supplement.NewAuditEntry(ctx, supplement.OperationCreate, nil, &s))
+	})
+}
+
+func (r *PostgresSupplementRepository) Update(ctx context.Context, s supplement.Supplement) error {
+	servingSize, servingUnit, servingsPerPackage := servingColumns(s)
+	return pgx.BeginFunc(ctx, r.db, func(tx pgx.Tx) error {
+		before, err := r.find(ctx, tx, s.Gtin, false, true)
+		if err != nil {
+			return err
+		}
+		if before == nil || before.Version != s.Version {
+			return supplement.ErrPreconditionFailed
+		}
+
+		var id int64
+		err = tx.QueryRow(
+			ctx,
+			"UPDATE "+r.tableName+
+				" SET name = $1, brand = $2, flavor = $3, category = $4, serving_size = $5, serving_unit = $6, servings_per_package = $7, "+
+				"carbohydrates = $8, electrolytes = $9, maltodextrose = $10, fructose = $11, caffeine = $12, sodium = $13, protein = $14, version = version + 1 "+
+				"WHERE gtin = $15 AND version = $16 AND deleted_at IS NULL RETURNING id",
+			s.Name, s.Brand, s.Flavor, categoryColumn(s), servingSize, servingUnit, servingsPerPackage,
+			s.Carbohydrates.Amount, s.Electrolytes.Amount, s.Maltodextrose.Amount, s.Fructose.Amount, s.Caffeine.Amount, s.Sodium.Amount, s.Protein.Amount,
+			s.Gtin, s.Version,
+		).Scan(&id)
+
+		if errors.Is(err, pgx.ErrNoRows) {
+			return supplement.ErrPreconditionFailed
+		}
+		if err != nil {
+			return err
+		}
+
+		if _, err := tx.Exec(ctx, "DELETE FROM supplement_ingredients WHERE supplement_id = $1", id); err != nil {
+			return err
+		}
+		if _, err := tx.Exec(ctx, "DELETE FROM supplement_allergens WHERE supplement_id = $1", id); err != nil {
+			return err
+		}
+		if _, err := tx.Exec(ctx, "DELETE FROM supplement_micronutrients WHERE supplement_id = $1", id); err != nil {
+			return err
+		}
+
+		if err := insertComposition(ctx, tx, id, s); err != nil {
+			return err
+		}
+
+		s.Version++
+		s.DeletedAt = nil
+		return insertAuditEntry(ctx, tx, supplement.NewAuditEntry(ctx, supplement.OperationUpdate, before, &s))
+	})
+}
+
+func (r *PostgresSupplementRepository) Delete(ctx context.Context, s supplement.Supplement) error {
+	return pgx.BeginFunc(ctx, r.db, func(tx pgx.Tx) error {
+		before, err := r.find(ctx, tx, s.Gtin, false, true)
+		if err != nil {
+			return err
+		}
+		if before == nil || before.Version != s.Version {
+			return supplement.ErrPreconditionFailed
+		}
+
+		deleted := *before
+		deletedAt := time.Now().UTC().Truncate(time.Microsecond)
+		deleted.DeletedAt = &deletedAt
+		deleted.Version++
+
+		tag, err := tx.Exec(
+			ctx,
+			"UPDATE "+r.tableName+" SET deleted_at = $1, version = version + 1 WHERE gtin = $2 AND version = $3 AND deleted_at IS NULL",
+			deletedAt, s.Gtin, s.Version,
+		)
+		if err := checkVersion(tag, err); err != nil {
+			return err
+		}
+
+		return insertAuditEntry(ctx, tx, supplement.NewAuditEntry(ctx, supplement.OperationDelete, before, &deleted))
+	})
+}
+
+func (r *PostgresSupplementRepository) Restore(ctx context.Context, gtin string) error {
+	return pgx.BeginFunc(ctx, r.db, func(tx pgx.Tx) error {
+		before, err := r.find(ctx, tx, gtin, true, true)
+		if err != nil {
+			return err
+		}
+		if before == nil {
+			return supplement.ErrNotFound
+		}
+
+		restored := *before
+		restored.DeletedAt = nil
+		restored.Version++
+
+		_, err = tx.Exec(ctx, "UPDATE "+r.tableName+" SET deleted_at = NULL, version = version + 1 WHERE gtin = $1", gtin)
+		if err != nil {
+			return err
+		}
+
+		return insertAuditEntry(ctx, tx, supplement.NewAuditEntry(ctx, supplement.OperationRestore, before, &restored))
+	})
+}
+
+// Purge deletes the tombstones, whose ingredients, allergens and
+// micronutrients cascade, recording the last state of each.
+func (r *PostgresSupplementRepository) Purge(ctx context.Context, deletedBefore time.Time) (int, error) {
+	purged := 0
+	err := pgx.BeginFunc(ctx, r.db, func(tx pgx.Tx) error {
+		rows, _ := tx.Query(
+			ctx,
+			"SELECT "+selectColumns+" FROM "+r.tableName+" WHERE deleted_at < $1 ORDER BY gtin FOR UPDATE",
+			deletedBefore,
+		)
+		found, err := pgx.CollectRows(rows, pgx.RowToStructByName[row])
+		if err != nil {
+			return err
+		}
+
+		tombstones, err := withComposition(ctx, tx, found)
+		if err != nil {
+			return err
+		}
+
+		for i := range tombstones {
+			if _, err := tx.Exec(ctx, "DELETE FROM "+r.tableName+" WHERE id = $1", found[i].ID); err != nil {
+				return err
+			}
+			if err := insertAuditEntry(ctx, tx, supplement.NewAuditEntry(ctx, supplement.OperationPurge, &tombstones[i], nil)); err != nil {
+				return err
+			}
+		}
+
+		purged = len(tombstones)
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return purged, nil
+}
+
+func (r *PostgresSupplementRepository) History(ctx context.Context, gtin string) ([]supplement.AuditEntry, error) {
+	rows, _ := r.db.Query(
 		ctx,
-		"INSERT INTO "+r.tableName+
-			" (gtin, name, brand, flavor, carbohydrates, electrolytes, maltodextrose, fructose, caffeine, sodium, protein) "+
-			"VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)",
-		s.Gtin, s.Name, s.Brand, s.Flavor, s.Carbohydrates, s.Electrolytes, s.Maltodextrose, s.Fructose, s.Caffeine, s.Sodium, s.Protein,
+		"SELECT gtin, version, operation, actor, at, changes FROM supplement_audit_log WHERE gtin = $1 ORDER BY id",
+		gtin,
 	)
 
-	return err
+	entries := []supplement.AuditEntry{}
+	var entry supplement.AuditEntry
+	var changes []byte
+	_, err := pgx.ForEachRow(rows, []any{&entry.Gtin, &entry.Version, &entry.Operation, &entry.Actor, &entry.At, &changes}, func() error {
+		entry.Changes = nil
+		if err := json.Unmarshal(changes, &entry.Changes); err != nil {
+			return err
+		}
+		entry.At = entry.At.UTC()
+		entries = append(entries, entry)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return entries, nil
 }
 
-func (r *PostgresSupplementRepository) Update(ctx context.Context, s supplement.Supplement) error {
-	_, err := r.db.Exec(
+func insertAuditEntry(ctx context.Context, db querier, entry supplement.AuditEntry) error {
+	changes, err := json.Marshal(entry.Changes)
+	if err != nil {
+		return err
+	}
+
+	_, err = db.Exec(
 		ctx,
-		"UPDATE "+r.tableName+
-			" SET name = $1, brand = $2, flavor = $3, carbohydrates = $4, electrolytes = $5, maltodextrose = $6, fructose = $7, caffeine = $8, sodium = $9, protein = $10 "+
-			"WHERE gtin = $11",
-		s.Name, s.Brand, s.Flavor, s.Carbohydrates, s.Electrolytes, s.Maltodextrose, s.Fructose, s.Caffeine, s.Sodium, s.Protein, s.Gtin,
+		"INSERT INTO supplement_audit_log (gtin, version, operation, actor, at, changes) VALUES ($1, $2, $3, $4, $5, $6::jsonb)",
+		entry.Gtin, entry.Version, string(entry.Operation), entry.Actor, entry.At, string(changes),
 	)
+	return err
+}
+
+// uniqueViolation is the SQLSTATE of a write clashing with a unique key.
+const uniqueViolation = "23505"
 
+// alreadyExists reports an insert clashing with a GTIN stored concurrently,
+// after the check that it was free, as ErrAlreadyExists.
+func alreadyExists(err error) error {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == uniqueViolation {
+		return supplement.ErrAlreadyExists
+	}
 	return err
 }
 
-func (r *PostgresSupplementRepository) Delete(ctx context.Context, s supplement.Supplement) error {
-	_, err := r.db.Exec(ctx, "DELETE FROM "+r.tableName+" WHERE gtin = $1", s.Gtin)
+// checkVersion reports a conditional write that matched no row, because the
+// supplement was modified or deleted since it was read.
+func checkVersion(tag pgconn.CommandTag, err error) error {
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return supplement.ErrPreconditionFailed
+	}
+	return nil
+}
+
+func (r *PostgresSupplementRepository) ListAll(ctx context.Context, query supplement.ListQuery) ([]supplement.Supplement, error) {
+	sql, args, err := r.listSQL(query)
+	if err != nil {
+		return nil, err
+	}
+	args = append(args, query.Limit)
+	sql += fmt.Sprintf(" LIMIT $%d", len(args))
+
+	rows, _ := r.db.Query(ctx, sql, args...)
+	found, err := pgx.CollectRows(rows, pgx.RowToStructByName[row])
+	if err != nil {
+		return nil, err
+	}
+
+	return withComposition(ctx, r.db, found)
+}
+
+// exportBatchSize is how many rows Export fetches from its cursor at a time.
+const exportBatchSize = 500
+
+// Export reads the supplements through a cursor, so that only a batch of
+// them is held at a time however many there are.
+func (r *PostgresSupplementRepository) Export(ctx context.Context, query supplement.ListQuery, fn func(supplement.Supplement) error) error {
+	sql, args, err := r.listSQL(query)
+	if err != nil {
+		return err
+	}
+
+	return pgx.BeginFunc(ctx, r.db, func(tx pgx.Tx) error {
+		if _, err := tx.Exec(ctx, "DECLARE supplement_export NO SCROLL CURSOR FOR "+sql, args...); err != nil {
+			return err
+		}
+
+		for {
+			rows, _ := tx.Query(ctx, fmt.Sprintf("FETCH FORWARD %d FROM supplement_export", exportBatchSize))
+			batch, err := pgx.CollectRows(rows, pgx.RowToStructByName[row])
+			if err != nil {
+				return err
+			}
+
+			supplements, err := withComposition(ctx, tx, batch)
+			if err != nil {
+				return err
+			}
+
+			for _, s := range supplements {
+				if err := fn(s); err != nil {
+					return err
+				}
+			}
+
+			if len(batch) < exportBatchSize {
+				_, err := tx.Exec(ctx, "CLOSE supplement_export")
+				return err
+			}
+		}
+	})
+}
+
+// Search matches each term against search_document, the unaccented words of
+// search_text, by prefix, or failing that against search_text by trigram
+// word similarity, so that typos are tolerated. Its pg_trgm threshold is the
+// default, supplement.SearchThreshold. Supplements rank by the similarity of
+// the whole search, and by how often its terms occur.
+func (r *PostgresSupplementRepository) Search(ctx context.Context, query supplement.SearchQuery) ([]supplement.Supplement, error) {
+	terms := supplement.SearchTerms(query.Text)
+	if len(terms) == 0 {
+		return []supplement.Supplement{}, nil
+	}
+
+	prefixes := make([]string, len(terms))
+	for i, term := range terms {
+		prefixes[i] = term + ":*"
+	}
+
+	args := []any{strings.Join(terms, " "), strings.Join(prefixes, " | ")}
+	conditions := []string{"deleted_at IS NULL"}
+	for _, term := range terms {
+		args = append(args, term)
+		conditions = append(conditions, fmt.Sprintf(
+			"(search_document @@ to_tsquery('simple', $%d::text || ':*') OR $%d <%% search_text)",
+			len(args), len(args),
+		))
+	}
+	args = append(args, query.Limit)
+
+	sql := "SELECT " + selectColumns + " FROM " + r.tableName +
+		" WHERE " + strings.Join(conditions, " AND ") +
+		" ORDER BY word_similarity($1, search_text) + ts_rank(search_document, to_tsquery('simple', $2)) DESC, gtin" +
+		fmt.Sprintf(" LIMIT $%d", len(args))
+
+	rows, _ := r.db.Query(ctx, sql, args...)
+	found, err := pgx.CollectRows(rows, pgx.RowToStructByName[row])
+	if err != nil {
+		return nil, err
+	}
+
+	return withComposition(ctx, r.db, found)
+}
+
+// listSQL returns the statement selecting the rows of query, in order but
+// without a limit, and its arguments.
+func (r *PostgresSupplementRepository) listSQL(query supplement.ListQuery) (string, []any, error) {
+	var conditions []string
+	var args []any
+
+	if !query.IncludeDeleted {
+		conditions = append(conditions, "deleted_at IS NULL")
+	}
+
+	if query.Brand != "" {
+		args = append(args, query.Brand)
+		conditions = append(conditions, fmt.Sprintf("lower(brand) = lower($%d)", len(args)))
+	}
+
+	if query.Flavor != "" {
+		args = append(args, query.Flavor)
+		conditions = append(conditions, fmt.Sprintf("lower(flavor) = lower($%d)", len(args)))
+	}
+
+	if query.Category != "" {
+		args = append(args, string(query.Category))
+		conditions = append(conditions, fmt.Sprintf("category = $%d", len(args)))
+	}
+
+	if len(query.ExcludeAllergens) > 0 {
+		args = append(args, allergenNames(query.ExcludeAllergens))
+		conditions = append(conditions, fmt.Sprintf(
+			"NOT EXISTS (SELECT 1 FROM supplement_allergens a WHERE a.supplement_id = %s.id AND a.allergen = ANY($%d))",
+			r.tableName, len(args),
+		))
+	}
+
+	for _, nr := range query.NutrientRanges {
+		column, ok := sortColumns[supplement.SortField(nr.Nutrient)]
+		if !ok {
+			return "", nil, fmt.Errorf("unknown nutrient %q", nr.Nutrient)
+		}
+
+		if nr.Min != nil {
+			args = append(args, *nr.Min)
+			conditions = append(conditions, fmt.Sprintf("%s >= $%d", column, len(args)))
+		}
+
+		if nr.Max != nil {
+			args = append(args, *nr.Max)
+			conditions = append(conditions, fmt.Sprintf("%s <= $%d", column, len(args)))
+		}
+	}
+
+	column, ok := sortColumns[query.SortBy]
+	if !ok {
+		return "", nil, fmt.Errorf("unknown sort field %q", query.SortBy)
+	}
+
+	direction, comparison := "ASC", ">"
+	if query.SortDirection == supplement.Descending {
+		direction, comparison = "DESC", "<"
+	}
+
+	orderBy := "gtin " + direction
+	if column != "gtin" {
+		orderBy = column + " " + direction + ", " + orderBy
+	}
+
+	if query.After != nil {
+		if column == "gtin" {
+			args = append(args, query.After.Gtin)
+			conditions = append(conditions, fmt.Sprintf("gtin %s $%d", comparison, len(args)))
+		} else {
+			args = append(args, query.After.Value, query.After.Gtin)
+			conditions = append(conditions, fmt.Sprintf("(%s, gtin) %s ($%d, $%d)", column, comparison, len(args)-1, len(args)))
+		}
+	}
+
+	sql := "SELECT " + selectColumns + " FROM " + r.tableName
+	if len(conditions) > 0 {
+		sql += " WHERE " + strings.Join(conditions, " AND ")
+	}
+	sql += " ORDER BY " + orderBy
+
+	return sql, args, nil
+}
+
+const (
+	presenceContains   = "contains"
+	presenceMayContain = "may-contain"
+)
+
+// querier is what both the pool and a transaction can run statements with.
+type querier interface {
+	Exec(ctx context.Context, sql string, arguments ...any) (pgconn.CommandTag, error)
+	Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error)
+}
+
+// insertComposition stores the ingredients, allergens and micronutrients of s
+// for the Supplements row id.
+func insertComposition(ctx context.Context, db querier, id int64, s supplement.Supplement) error {
+	if len(s.Ingredients) > 0 {
+		_, err := db.Exec(
+			ctx,
+			"INSERT INTO supplement_ingredients (supplement_id, position, name) "+
+				"SELECT $1, i.ordinality - 1, i.name FROM unnest($2::varchar[]) WITH ORDINALITY AS i (name, ordinality)",
+			id, s.Ingredients,
+		)
+		if err != nil {
+			return err
+		}
+	}
+
+	var allergens, presences []string
+	for _, a := range s.Allergens.Contains {
+		allergens, presences = append(allergens, string(a)), append(presences, presenceContains)
+	}
+	for _, a := range s.Allergens.MayContain {
+		allergens, presences = append(allergens, string(a)), append(presences, presenceMayContain)
+	}
+
+	if len(allergens) > 0 {
+		_, err := db.Exec(
+			ctx,
+			"INSERT INTO supplement_allergens (supplement_id, allergen, presence) "+
+				"SELECT $1, a.allergen, a.presence FROM unnest($2::varchar[], $3::varchar[]) AS a (allergen, presence)",
+			id, allergens, presences,
+		)
+		if err != nil {
+			return err
+		}
+	}
+
+	if len(s.Micronutrients) == 0 {
+		return nil
+	}
+
+	var codes []string
+	var amounts []float64
+	for m, q := range s.Micronutrients {
+		codes, amounts = append(codes, string(m)), append(amounts, q.Amount)
+	}
+
+	_, err := db.Exec(
+		ctx,
+		"INSERT INTO supplement_micronutrients (supplement_id, code, amount) "+
+			"SELECT $1, m.code, m.amount FROM unnest($2::varchar[], $3::numeric[]) AS m (code, amount)",
+		id, codes, amounts,
+	)
 	return err
 }
 
-func (r *PostgresSupplementRepository) ListAll(ctx context.Context) ([]supplement.Supplement, error) {
-	rows, _ := r.db.Query(
+// withComposition turns rows into supplements, loading the ingredients,
+// allergens and micronutrients of all of them with one query each.
+func withComposition(ctx context.Context, db querier, rows []row) ([]supplement.Supplement, error) {
+	supplements := make([]supplement.Supplement, len(rows))
+	byID := make(map[int64]*supplement.Supplement, len(rows))
+	ids := make([]int64, len(rows))
+	for i, r := range rows {
+		supplements[i] = r.supplement()
+		byID[r.ID] = &supplements[i]
+		ids[i] = r.ID
+	}
+
+	if len(rows) == 0 {
+		return supplements, nil
+	}
+
+	ingredients, _ := db.Query(
+		ctx,
+		"SELECT supplement_id, name FROM supplement_ingredients WHERE supplement_id = ANY($1) ORDER BY supplement_id, position",
+		ids,
+	)
+	var id int64
+	var name string
+	_, err := pgx.ForEachRow(ingredients, []any{&id, &name}, func() error {
+		s := byID[id]
+		s.Ingredients = append(s.Ingredients, name)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	allergens, _ := db.Query(
+		ctx,
+		"SELECT supplement_id, allergen, presence FROM supplement_allergens WHERE supplement_id = ANY($1) ORDER BY supplement_id, allergen",
+		ids,
+	)
+	var allergen, presence string
+	_, err = pgx.ForEachRow(allergens, []any{&id, &allergen, &presence}, func() error {
+		s := byID[id]
+		if presence == presenceContains {
+			s.Allergens.Contains = append(s.Allergens.Contains, supplement.Allergen(allergen))
+		} else {
+			s.Allergens.MayContain = append(s.Allergens.MayContain, supplement.Allergen(allergen))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	micronutrients, _ := db.Query(
 		ctx,
-		"SELECT gtin, name, brand, flavor, carbohydrates, electrolytes, maltodextrose, fructose, caffeine, sodium, protein "+
-			"FROM "+r.tableName,
+		"SELECT supplement_id, code, amount FROM supplement_micronutrients WHERE supplement_id = ANY($1)",
+		ids,
 	)
-	return pgx.CollectRows(rows, pgx.RowToStructByName[supplement.Supplement])
+	var code string
+	var amount float64
+	_, err = pgx.ForEachRow(micronutrients, []any{&id, &code, &amount}, func() error {
+		s := byID[id]
+		if s.Micronutrients == nil {
+			s.Micronutrients = supplement.Panel{}
+		}
+		m := supplement.Micronutrient(code)
+		s.Micronutrients[m] = supplement.Quantity{Amount: amount, Unit: m.Unit()}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return supplements, nil
+}
+
+func allergenNames(allergens []supplement.Allergen) []string {
+	names := make([]string, len(allergens))
+	for i, a := range allergens {
+		names[i] = string(a)
+	}
+	return names
+}
+
+// sortColumns are the expressions supplements are sorted by. Text sorts in
+// the C collation, byte-wise like the other repositories, rather than in the
+// database's, which would depend on its locale.
+var sortColumns = map[supplement.SortField]string{
+	supplement.SortByGtin:                          "gtin",
+	supplement.SortByName:                          `name COLLATE "C"`,
+	supplement.SortByBrand:                         `brand COLLATE "C"`,
+	supplement.SortByFlavor:                        `flavor COLLATE "C"`,
+	supplement.SortField(supplement.Carbohydrates): "carbohydrates",
+	supplement.SortField(supplement.Electrolytes):  "electrolytes",
+	supplement.SortField(supplement.Maltodextrose): "maltodextrose",
+	supplement.SortField(supplement.Fructose):      "fructose",
+	supplement.SortField(supplement.Caffeine):      "caffeine",
+	supplement.SortField(supplement.Sodium):        "sodium",
+	supplement.SortField(supplement.Protein):       "protein",
 }
@@ -2,16 +2,19 @@ package postgres_test
 
 import (
 	"context"
+	"errors"
 	"log"
 	"testing"
 	"time"
 
 	"github.com/marioromandono/supplementapp/internal/supplement"
 	"github.com/marioromandono/supplementapp/internal/supplement/persistence/postgres"
+	"github.com/marioromandono/supplementapp/internal/supplement/persistence/repotest"
 
 	"github.com/google/go-cmp/cmp"
 	"github.com/google/go-cmp/cmp/cmpopts"
 	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/testcontainers/testcontainers-go"
 	tcpostgres "github.com/testcontainers/testcontainers-go/modules/postgres"
@@ -23,6 +26,19 @@ var dbUrl string
 
 const tableName string = "Supplements"
 
+// SQLSTATE codes of the constraint violations the schema enforces.
+const (
+	numericValueOutOfRange = "22003"
+	notNullViolation       = "23502"
+	checkViolation         = "23514"
+)
+
+var defaultQuery = supplement.ListQuery{
+	Limit:         supplement.DefaultPageSize,
+	SortBy:        supplement.SortByGtin,
+	SortDirection: supplement.Ascending,
+}
+
 func TestMain(m *testing.M) {
 	ctx := context.Background()
 
@@ -53,33 +69,17 @@ func TestMain(m *testing.M) {
 		log.Panic(err)
 	}
 
-	_, _, err = container.Exec(ctx, []string{
-		"psql", "-U", dbUser, "-d", dbName, "-c",
-		"CREATE TABLE " + tableName + " ( " +
-			"id INT GENERATED ALWAYS AS IDENTITY PRIMARY KEY, " +
-			"gtin VARCHAR UNIQUE, " +
-			"name VARCHAR, " +
-			"brand VARCHAR, " +
-			"flavor VARCHAR, " +
-			"carbohydrates REAL, " +
-			"electrolytes REAL, " +
-			"maltodextrose REAL, " +
-			"fructose REAL, " +
-			"caffeine REAL, " +
-			"sodium REAL, " +
-			"protein REAL " +
-			")",
-	})
+	dbUrl, err = container.ConnectionString(ctx)
 	if err != nil {
 		log.Panic(err)
 	}
 
-	err = container.Snapshot(ctx, tcpostgres.WithSnapshotName("test-snapshot"))
+	err = repotest.MigratePostgres(ctx, dbUrl)
 	if err != nil {
 		log.Panic(err)
 	}
 
-	dbUrl, err = container.ConnectionString(ctx)
+	err = container.Snapshot(ctx, tcpostgres.WithSnapshotName("test-snapshot"))
 	if err != nil {
 		log.Panic(err)
 	}
@@ -87,6 +87,76 @@ func TestMain(m *testing.M) {
 	m.Run()
 }
 
+func TestPostgresSupplementRepository_Conformance(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping integration test")
+	}
+
+	repotest.Run(t, func(t *testing.T) supplement.SupplementRepository {
+		ctx := context.Background()
+		t.Cleanup(func() {
+			err := container.Restore(ctx)
+			if err != nil {
+				t.Fatal(err)
+			}
+		})
+
+		return postgres.NewSupplementRepository(getPool(t, ctx))
+	})
+}
+
+func TestSchemaConstraints(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping integration test")
+	}
+
+	ctx := context.Background()
+	t.Cleanup(func() {
+		err := container.Restore(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	dbPool := getPool(t, ctx)
+	insert := func(gtin, name, value any) error {
+		_, err := dbPool.Exec(ctx,
+			"INSERT INTO "+tableName+
+				" (gtin, name, brand, flavor, carbohydrates, electrolytes, maltodextrose, fructose, caffeine, sodium, protein) "+
+				"VALUES ($1, $2, 'brand', 'flavor', $3, 0, 0, 0, 0, 0, 0)",
+			gtin, name, value,
+		)
+		return err
+	}
+
+	if err := insert("04006381333931", "name", 1.0); err != nil {
+		t.Fatalf("INSERT of a valid row error = %v, want nil", err)
+	}
+
+	tests := []struct {
+		name     string
+		gtin     any
+		title    any
+		value    any
+		wantCode string
+	}{
+		{name: "null gtin", gtin: nil, title: "name", value: 1.0, wantCode: notNullViolation},
+		{name: "short gtin", gtin: "1234567890128", title: "name", value: 1.0, wantCode: checkViolation},
+		{name: "non-digit gtin", gtin: "0123456789012A", title: "name", value: 1.0, wantCode: checkViolation},
+		{name: "null name", gtin: "01234567890128", title: nil, value: 1.0, wantCode: notNullViolation},
+		{name: "empty name", gtin: "01234567890128", title: "", value: 1.0, wantCode: checkViolation},
+		{name: "null nutrient", gtin: "01234567890128", title: "name", value: nil, wantCode: notNullViolation},
+		{name: "negative nutrient", gtin: "01234567890128", title: "name", value: -1.0, wantCode: checkViolation},
+		{name: "nutrient overflow", gtin: "01234567890128", title: "name", value: 1e7, wantCode: numericValueOutOfRange},
+	}
+	for _, tt := range tests {
+		var pgErr *pgconn.PgError
+		if err := insert(tt.gtin, tt.title, tt.value); !errors.As(err, &pgErr) || pgErr.Code != tt.wantCode {
+			t.Errorf("%s: INSERT error = %v, want SQLSTATE %s", tt.name, err, tt.wantCode)
+		}
+	}
+}
+
 func TestPostgresSupplementRepository_Create(t *testing.T) {
 	if testing.Short() {
 		t.Skip("skipping integration test")
@@ -104,17 +174,17 @@ func TestPostgresSupplementRepository_Create(t *testing.T) {
 		dbPool := getPool(t, ctx)
 		repo := postgres.NewSupplementRepository(dbPool)
 		want := supplement.Supplement{
-			Gtin:          "1234567890123",
+			Gtin:          "01234567890128",
 			Name:          "name",
 			Brand:         "brand",
 			Flavor:        "flavor",
-			Carbohydrates: 1.0,
-			Electrolytes:  1.0,
-			Maltodextrose: 1.0,
-			Fructose:      1.0,
-			Caffeine:      1.0,
-			Sodium:        1.0,
-			Protein:       1.0,
+			Carbohydrates: supplement.Grams(1.0),
+			Electrolytes:  supplement.Milligrams(1.0),
+			Maltodextrose: supplement.Grams(1.0),
+			Fructose:      supplement.Grams(1.0),
+			Caffeine:      supplement.Milligrams(1.0),
+			Sodium:        supplement.Milligrams(1.0),
+			Protein:       supplement.Grams(1.0),
 		}
 		err := repo.Create(ctx, want)
 
@@ -122,6 +192,8 @@ func TestPostgresSupplementRepository_Create(t *testing.T) {
 			t.Errorf("PostgresSupplementRepository.Create() error = %v, want nil", err)
 		}
 
+		want.Version = 1
+
 		got := getSupplement(t, ctx, dbPool, want.Gtin)
 
 		if diff := cmp.Diff(got, want); diff != "" {
@@ -146,7 +218,7 @@ func TestPostgresSupplementRepository_FindByGtin(t *testing.T) {
 
 		dbPool := getPool(t, ctx)
 		repo := postgres.NewSupplementRepository(dbPool)
-		got, err := repo.FindByGtin(ctx, "1234567890123")
+		got, err := repo.FindByGtin(ctx, "01234567890128")
 
 		if err != nil {
 			t.Errorf("PostgresSupplementRepository.FindByGtin() error = %v, want nil", err)
@@ -169,17 +241,17 @@ func TestPostgresSupplementRepository_FindByGtin(t *testing.T) {
 		dbPool := getPool(t, ctx)
 		repo := postgres.NewSupplementRepository(dbPool)
 		want := supplement.Supplement{
-			Gtin:          "1234567890123",
+			Gtin:          "01234567890128",
 			Name:          "name",
 			Brand:         "brand",
 			Flavor:        "flavor",
-			Carbohydrates: 1.0,
-			Electrolytes:  1.0,
-			Maltodextrose: 1.0,
-			Fructose:      1.0,
-			Caffeine:      1.0,
-			Sodium:        1.0,
-			Protein:       1.0,
+			Carbohydrates: supplement.Grams(1.0),
+			Electrolytes:  supplement.Milligrams(1.0),
+			Maltodextrose: supplement.Grams(1.0),
+			Fructose:      supplement.Grams(1.0),
+			Caffeine:      supplement.Milligrams(1.0),
+			Sodium:        supplement.Milligrams(1.0),
+			Protein:       supplement.Grams(1.0),
 		}
 		insertSupplement(t, ctx, dbPool, want)
 
@@ -212,17 +284,17 @@ func TestPostgresSupplementRepository_Update(t *testing.T) {
 		dbPool := getPool(t, ctx)
 		repo := postgres.NewSupplementRepository(dbPool)
 		want := supplement.Supplement{
-			Gtin:          "1234567890123",
+			Gtin:          "01234567890128",
 			Name:          "name",
 			Brand:         "brand",
 			Flavor:        "flavor",
-			Carbohydrates: 1.0,
-			Electrolytes:  1.0,
-			Maltodextrose: 1.0,
-			Fructose:      1.0,
-			Caffeine:      1.0,
-			Sodium:        1.0,
-			Protein:       1.0,
+			Carbohydrates: supplement.Grams(1.0),
+			Electrolytes:  supplement.Milligrams(1.0),
+			Maltodextrose: supplement.Grams(1.0),
+			Fructose:      supplement.Grams(1.0),
+			Caffeine:      supplement.Milligrams(1.0),
+			Sodium:        supplement.Milligrams(1.0),
+			Protein:       supplement.Grams(1.0),
 		}
 		insertSupplement(t, ctx, dbPool, want)
 
@@ -233,6 +305,43 @@ func TestPostgresSupplementRepository_Update(t *testing.T) {
 			t.Errorf("PostgresSupplementRepository.Update() error = %v, want nil", err)
 		}
 
+		want.Version++
+		got := getSupplement(t, ctx, dbPool, want.Gtin)
+
+		if diff := cmp.Diff(got, want); diff != "" {
+			t.Errorf("PostgresSupplementRepository.Update() mismatch (-got +want):\n%s", diff)
+		}
+	})
+
+	t.Run("stale version", func(t *testing.T) {
+		ctx := context.Background()
+		t.Cleanup(func() {
+			err := container.Restore(ctx)
+			if err != nil {
+				t.Fatal(err)
+			}
+		})
+
+		dbPool := getPool(t, ctx)
+		repo := postgres.NewSupplementRepository(dbPool)
+		want := supplement.Supplement{
+			Gtin:    "01234567890128",
+			Name:    "name",
+			Brand:   "brand",
+			Flavor:  "flavor",
+			Version: 2,
+		}
+		insertSupplement(t, ctx, dbPool, want)
+
+		stale := want
+		stale.Name = "new name"
+		stale.Version = 1
+		err := repo.Update(ctx, stale)
+
+		if !errors.Is(err, supplement.ErrPreconditionFailed) {
+			t.Errorf("PostgresSupplementRepository.Update() error = %v, want %v", err, supplement.ErrPreconditionFailed)
+		}
+
 		got := getSupplement(t, ctx, dbPool, want.Gtin)
 
 		if diff := cmp.Diff(got, want); diff != "" {
@@ -258,17 +367,17 @@ func TestPostgresSupplementRepository_Delete(t *testing.T) {
 		dbPool := getPool(t, ctx)
 		repo := postgres.NewSupplementRepository(dbPool)
 		s := supplement.Supplement{
-			Gtin:          "1234567890123",
+			Gtin:          "01234567890128",
 			Name:          "name",
 			Brand:         "brand",
 			Flavor:        "flavor",
-			Carbohydrates: 1.0,
-			Electrolytes:  1.0,
-			Maltodextrose: 1.0,
-			Fructose:      1.0,
-			Caffeine:      1.0,
-			Sodium:        1.0,
-			Protein:       1.0,
+			Carbohydrates: supplement.Grams(1.0),
+			Electrolytes:  supplement.Milligrams(1.0),
+			Maltodextrose: supplement.Grams(1.0),
+			Fructose:      supplement.Grams(1.0),
+			Caffeine:      supplement.Milligrams(1.0),
+			Sodium:        supplement.Milligrams(1.0),
+			Protein:       supplement.Grams(1.0),
 		}
 		insertSupplement(t, ctx, dbPool, s)
 
@@ -284,6 +393,41 @@ func TestPostgresSupplementRepository_Delete(t *testing.T) {
 			t.Errorf("PostgresSupplementRepository.Delete() mismatch (-got +want):\n%s", diff)
 		}
 	})
+
+	t.Run("stale version", func(t *testing.T) {
+		ctx := context.Background()
+		t.Cleanup(func() {
+			err := container.Restore(ctx)
+			if err != nil {
+				t.Fatal(err)
+			}
+		})
+
+		dbPool := getPool(t, ctx)
+		repo := postgres.NewSupplementRepository(dbPool)
+		want := supplement.Supplement{
+			Gtin:    "01234567890128",
+			Name:    "name",
+			Brand:   "brand",
+			Flavor:  "flavor",
+			Version: 2,
+		}
+		insertSupplement(t, ctx, dbPool, want)
+
+		stale := want
+		stale.Version = 1
+		err := repo.Delete(ctx, stale)
+
+		if !errors.Is(err, supplement.ErrPreconditionFailed) {
+			t.Errorf("PostgresSupplementRepository.Delete() error = %v, want %v", err, supplement.ErrPreconditionFailed)
+		}
+
+		got := getSupplement(t, ctx, dbPool, want.Gtin)
+
+		if diff := cmp.Diff(got, want); diff != "" {
+			t.Errorf("PostgresSupplementRepository.Delete() mismatch (-got +want):\n%s", diff)
+		}
+	})
 }
 
 func TestPostgresSupplementRepository_ListAll(t *testing.T) {
@@ -302,7 +446,7 @@ func TestPostgresSupplementRepository_ListAll(t *testing.T) {
 
 		dbPool := getPool(t, ctx)
 		repo := postgres.NewSupplementRepository(dbPool)
-		got, err := repo.ListAll(ctx)
+		got, err := repo.ListAll(ctx, defaultQuery)
 		want := []supplement.Supplement{}
 
 		if err != nil {
@@ -327,37 +471,114 @@ func TestPostgresSupplementRepository_ListAll(t *testing.T) {
 		repo := postgres.NewSupplementRepository(dbPool)
 		want := []supplement.Supplement{
 			{
-				Gtin:          "1234567890123",
+				Gtin:          "01234567890128",
 				Name:          "name",
 				Brand:         "brand",
 				Flavor:        "flavor",
-				Carbohydrates: 1.0,
-				Electrolytes:  1.0,
-				Maltodextrose: 1.0,
-				Fructose:      1.0,
-				Caffeine:      1.0,
-				Sodium:        1.0,
-				Protein:       1.0,
+				Carbohydrates: supplement.Grams(1.0),
+				Electrolytes:  supplement.Milligrams(1.0),
+				Maltodextrose: supplement.Grams(1.0),
+				Fructose:      supplement.Grams(1.0),
+				Caffeine:      supplement.Milligrams(1.0),
+				Sodium:        supplement.Milligrams(1.0),
+				Protein:       supplement.Grams(1.0),
 			},
 			{
-				Gtin:          "1234567890124",
+				Gtin:          "04006381333931",
 				Name:          "name",
 				Brand:         "brand",
 				Flavor:        "flavor",
-				Carbohydrates: 1.0,
-				Electrolytes:  1.0,
-				Maltodextrose: 1.0,
-				Fructose:      1.0,
-				Caffeine:      1.0,
-				Sodium:        1.0,
-				Protein:       1.0,
+				Carbohydrates: supplement.Grams(1.0),
+				Electrolytes:  supplement.Milligrams(1.0),
+				Maltodextrose: supplement.Grams(1.0),
+				Fructose:      supplement.Grams(1.0),
+				Caffeine:      supplement.Milligrams(1.0),
+				Sodium:        supplement.Milligrams(1.0),
+				Protein:       supplement.Grams(1.0),
 			},
 		}
 		for _, s := range want {
 			insertSupplement(t, ctx, dbPool, s)
 		}
 
-		got, err := repo.ListAll(ctx)
+		got, err := repo.ListAll(ctx, defaultQuery)
+
+		if err != nil {
+			t.Errorf("PostgresSupplementRepository.ListAll() error = %v, want nil", err)
+		}
+
+		if diff := cmp.Diff(got, want, cmpopts.EquateEmpty()); diff != "" {
+			t.Errorf("PostgresSupplementRepository.ListAll() mismatch (-got +want):\n%s", diff)
+		}
+	})
+
+	t.Run("sorted after keyset", func(t *testing.T) {
+		ctx := context.Background()
+		t.Cleanup(func() {
+			err := container.Restore(ctx)
+			if err != nil {
+				t.Fatal(err)
+			}
+		})
+
+		dbPool := getPool(t, ctx)
+		repo := postgres.NewSupplementRepository(dbPool)
+		ss := []supplement.Supplement{
+			{Gtin: "01234567890128", Name: "name", Brand: "brand", Flavor: "flavor", Carbohydrates: supplement.Grams(20.0)},
+			{Gtin: "04006381333931", Name: "name", Brand: "brand", Flavor: "flavor", Carbohydrates: supplement.Grams(40.0)},
+			{Gtin: "05901234123457", Name: "name", Brand: "brand", Flavor: "flavor", Carbohydrates: supplement.Grams(30.0)},
+			{Gtin: "10012345678902", Name: "name", Brand: "brand", Flavor: "flavor", Carbohydrates: supplement.Grams(30.0)},
+		}
+		for _, s := range ss {
+			insertSupplement(t, ctx, dbPool, s)
+		}
+
+		got, err := repo.ListAll(ctx, supplement.ListQuery{
+			Limit:         2,
+			After:         &supplement.Keyset{Value: float64(40.0), Gtin: ss[1].Gtin},
+			SortBy:        supplement.SortField(supplement.Carbohydrates),
+			SortDirection: supplement.Descending,
+		})
+		want := []supplement.Supplement{ss[3], ss[2]}
+
+		if err != nil {
+			t.Errorf("PostgresSupplementRepository.ListAll() error = %v, want nil", err)
+		}
+
+		if diff := cmp.Diff(got, want, cmpopts.EquateEmpty()); diff != "" {
+			t.Errorf("PostgresSupplementRepository.ListAll() mismatch (-got +want):\n%s", diff)
+		}
+	})
+
+	t.Run("filtered", func(t *testing.T) {
+		ctx := context.Background()
+		t.Cleanup(func() {
+			err := container.Restore(ctx)
+			if err != nil {
+				t.Fatal(err)
+			}
+		})
+
+		dbPool := getPool(t, ctx)
+		repo := postgres.NewSupplementRepository(dbPool)
+		ss := []supplement.Supplement{
+			{Gtin: "01234567890128", Name: "name", Brand: "Brand", Flavor: "lemon", Caffeine: supplement.Milligrams(100.0)},
+			{Gtin: "04006381333931", Name: "name", Brand: "brand", Flavor: "lemon", Caffeine: supplement.Milligrams(0.0)},
+			{Gtin: "05901234123457", Name: "name", Brand: "brand", Flavor: "orange", Caffeine: supplement.Milligrams(100.0)},
+			{Gtin: "10012345678902", Name: "name", Brand: "other", Flavor: "lemon", Caffeine: supplement.Milligrams(100.0)},
+		}
+		for _, s := range ss {
+			insertSupplement(t, ctx, dbPool, s)
+		}
+
+		query := defaultQuery
+		query.Brand = "BRAND"
+		query.Flavor = "lemon"
+		query.NutrientRanges = []supplement.NutrientRange{
+			{Nutrient: supplement.Caffeine, Min: Ptr[float64](50), Max: Ptr[float64](150)},
+		}
+		got, err := repo.ListAll(ctx, query)
+		want := []supplement.Supplement{ss[0]}
 
 		if err != nil {
 			t.Errorf("PostgresSupplementRepository.ListAll() error = %v, want nil", err)
@@ -369,6 +590,10 @@ func TestPostgresSupplementRepository_ListAll(t *testing.T) {
 	})
 }
 
+func Ptr[T any](v T) *T {
+	return &v
+}
+
 func getPool(t *testing.T, ctx context.Context) *pgxpool.Pool {
 	t.Helper()
 	dbPool, err := pgxpool.New(ctx, dbUrl)
@@ -388,9 +613,11 @@ func insertSupplement(t *testing.T, ctx context.Context, dbPool *pgxpool.Pool, s
 	_, err := dbPool.Exec(
 		ctx,
 		"INSERT INTO "+tableName+
-			" (gtin, name, brand, flavor, carbohydrates, electrolytes, maltodextrose, fructose, caffeine, sodium, protein) "+
-			"VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)",
-		s.Gtin, s.Name, s.Brand, s.Flavor, s.Carbohydrates, s.Electrolytes, s.Maltodextrose, s.Fructose, s.Caffeine, s.Sodium, s.Protein,
+			" (gtin, name, brand, flavor, carbohydrates, electrolytes, maltodextrose, fructose, caffeine, sodium, protein, version) "+
+			"VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)",
+		s.Gtin, s.Name, s.Brand, s.Flavor,
+		s.Carbohydrates.Amount, s.Electrolytes.Amount, s.Maltodextrose.Amount, s.Fructose.Amount, s.Caffeine.Amount, s.Sodium.Amount, s.Protein.Amount,
+		s.Version,
 	)
 
 	if err != nil {
@@ -400,13 +627,18 @@ func insertSupplement(t *testing.T, ctx context.Context, dbPool *pgxpool.Pool, s
 
 func getSupplement(t *testing.T, ctx context.Context, dbPool *pgxpool.Pool, gtin string) supplement.Supplement {
 	t.Helper()
-	rows, _ := dbPool.Query(
+	var s supplement.Supplement
+	var carbohydrates, electrolytes, maltodextrose, fructose, caffeine, sodium, protein float64
+	err := dbPool.QueryRow(
 		ctx,
-		"SELECT gtin, name, brand, flavor, carbohydrates, electrolytes, maltodextrose, fructose, caffeine, sodium, protein "+
+		"SELECT gtin, name, brand, flavor, carbohydrates, electrolytes, maltodextrose, fructose, caffeine, sodium, protein, version "+
 			"FROM "+tableName+" WHERE gtin = $1",
 		gtin,
+	).Scan(
+		&s.Gtin, &s.Name, &s.Brand, &s.Flavor,
+		&carbohydrates, &electrolytes, &maltodextrose, &fructose, &caffeine, &sodium, &protein,
+		&s.Version,
 	)
-	s, err := pgx.CollectExactlyOneRow(rows, pgx.RowToStructByName[supplement.Supplement])
 
 	if err != nil {
 		if err == pgx.ErrNoRows {
@@ -415,5 +647,12 @@ func getSupplement(t *testing.T, ctx context.Context, dbPool *pgxpool.Pool, gtin
 		t.Fatal(err)
 	}
 
+	s.Carbohydrates = supplement.Carbohydrates.Quantity(carbohydrates)
+	s.Electrolytes = supplement.Electrolytes.Quantity(electrolytes)
+	s.Maltodextrose = supplement.Maltodextrose.Quantity(maltodextrose)
+	s.Fructose = supplement.Fructose.Quantity(fructose)
+	s.Caffeine = supplement.Caffeine.Quantity(caffeine)
+	s.Sodium = supplement.Sodium.Quantity(sodium)
+	s.Protein = supplement.Protein.Quantity(protein)
 	return s
 }
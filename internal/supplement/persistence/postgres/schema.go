@@ -0,0 +1,37 @@
+package postgres
+
+import (
+	"context"
+
+	"github.com/marioromandono/supplementapp/migrations"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/jackc/pgx/v5/stdlib"
+	"github.com/pressly/goose/v3"
+)
+
+// NewMigrationProvider returns a goose provider for the Postgres migrations
+// embedded in the binary.
+func NewMigrationProvider(db *pgxpool.Pool) (*goose.Provider, error) {
+	return goose.NewProvider(goose.DialectPostgres, stdlib.OpenDBFromPool(db), migrations.Postgres)
+}
+
+// SchemaVersion returns the latest migration goose has applied to the
+// database, or 0 if none has been applied yet. It never writes, so it is safe
+// to call from health checks.
+func SchemaVersion(ctx context.Context, db *pgxpool.Pool) (int64, error) {
+	// The version table has to be looked up on its own: a query naming it
+	// fails to parse on a database goose has never touched.
+	var exists bool
+	err := db.QueryRow(ctx, "SELECT to_regclass('goose_db_version') IS NOT NULL").Scan(&exists)
+	if err != nil || !exists {
+		return 0, err
+	}
+
+	var version int64
+	err = db.QueryRow(
+		ctx,
+		"SELECT COALESCE(MAX(version_id), 0) FROM goose_db_version WHERE is_applied",
+	).Scan(&version)
+	return version, err
+}
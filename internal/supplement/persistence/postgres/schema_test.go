@@ -0,0 +1,155 @@
+package postgres_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/marioromandono/supplementapp/internal/supplement/persistence/postgres"
+	"github.com/marioromandono/supplementapp/internal/supplement/persistence/repotest"
+	"github.com/marioromandono/supplementapp/migrations"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+func TestSchemaVersion(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping integration test")
+	}
+
+	latest, err := migrations.Latest(migrations.Postgres)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name        string
+		database    string
+		migrate     func(ctx context.Context, db *pgxpool.Pool) error
+		want        int64
+		wantCompare error
+	}{
+		{
+			name:        "fresh",
+			database:    "schema_fresh",
+			migrate:     func(ctx context.Context, db *pgxpool.Pool) error { return nil },
+			want:        0,
+			wantCompare: migrations.ErrSchemaBehind,
+		},
+		{
+			name:     "partly migrated",
+			database: "schema_partly_migrated",
+			migrate: func(ctx context.Context, db *pgxpool.Pool) error {
+				provider, err := postgres.NewMigrationProvider(db)
+				if err != nil {
+					return err
+				}
+				_, err = provider.UpTo(ctx, 20261016100000)
+				return err
+			},
+			want:        20261016100000,
+			wantCompare: migrations.ErrSchemaBehind,
+		},
+		{
+			name:     "migrated",
+			database: "schema_migrated",
+			migrate: func(ctx context.Context, db *pgxpool.Pool) error {
+				provider, err := postgres.NewMigrationProvider(db)
+				if err != nil {
+					return err
+				}
+				_, err = provider.Up(ctx)
+				return err
+			},
+			want: latest,
+		},
+		{
+			name:     "ahead",
+			database: "schema_ahead",
+			migrate: func(ctx context.Context, db *pgxpool.Pool) error {
+				provider, err := postgres.NewMigrationProvider(db)
+				if err != nil {
+					return err
+				}
+				if _, err := provider.Up(ctx); err != nil {
+					return err
+				}
+				_, err = db.Exec(ctx, "INSERT INTO goose_db_version (version_id, is_applied) VALUES ($1, true)", latest+1)
+				return err
+			},
+			want:        latest + 1,
+			wantCompare: migrations.ErrSchemaAhead,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			db, err := pgxpool.New(ctx, repotest.NewPostgresDatabase(t, ctx, dbUrl, tt.database))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer db.Close()
+			if err := tt.migrate(ctx, db); err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := postgres.SchemaVersion(ctx, db)
+
+			if err != nil || got != tt.want {
+				t.Fatalf("SchemaVersion() = %d, %v, want %d, nil", got, err, tt.want)
+			}
+			if err := migrations.Compare(got, migrations.Postgres); !errors.Is(err, tt.wantCompare) {
+				t.Errorf("Compare() error = %v, wantErr %v", err, tt.wantCompare)
+			}
+		})
+	}
+}
+
+func TestNormalizeGtinsMigration(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping integration test")
+	}
+
+	ctx := context.Background()
+	db, err := pgxpool.New(ctx, repotest.NewPostgresDatabase(t, ctx, dbUrl, "normalize_gtins"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	provider, err := postgres.NewMigrationProvider(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := provider.UpTo(ctx, 20240410125348); err != nil {
+		t.Fatal(err)
+	}
+	for _, gtin := range []string{"4006381333931", "96385074", "4006381333932"} {
+		if _, err := db.Exec(ctx, "INSERT INTO Supplements (gtin, name) VALUES ($1, 'Gel')", gtin); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	_, err = provider.UpTo(ctx, 20261016090000)
+
+	if err == nil || !strings.Contains(err.Error(), "4006381333932") || strings.Contains(err.Error(), "4006381333931") {
+		t.Fatalf("migration error = %v, want it to list only the invalid GTIN", err)
+	}
+
+	if _, err := db.Exec(ctx, "DELETE FROM Supplements WHERE gtin = '4006381333932'"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := provider.UpTo(ctx, 20261016090000); err != nil {
+		t.Fatalf("migration error = %v, want nil once the invalid GTIN is gone", err)
+	}
+	rows, _ := db.Query(ctx, "SELECT gtin FROM Supplements ORDER BY gtin")
+	got, err := pgx.CollectRows(rows, pgx.RowTo[string])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(got, []string{"00000096385074", "04006381333931"}); diff != "" {
+		t.Errorf("GTINs (-got +want):\n%s", diff)
+	}
+}
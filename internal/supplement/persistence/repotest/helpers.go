@@ -0,0 +1,81 @@
+package repotest
+
+import (
+	"context"
+	"net/url"
+	"testing"
+
+	"github.com/marioromandono/supplementapp/internal/supplement"
+	"github.com/marioromandono/supplementapp/internal/supplement/persistence/postgres"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// MigratePostgres builds the schema of the database at databaseURL from the
+// embedded migrations, and closes its connections so that the database can
+// be snapshotted.
+func MigratePostgres(ctx context.Context, databaseURL string) error {
+	dbPool, err := pgxpool.New(ctx, databaseURL)
+	if err != nil {
+		return err
+	}
+	defer dbPool.Close()
+
+	provider, err := postgres.NewMigrationProvider(dbPool)
+	if err != nil {
+		return err
+	}
+
+	_, err = provider.Up(ctx)
+	return err
+}
+
+// NewPostgresDatabase creates an empty database named name on the server of
+// the database at serverURL, dropped when t ends, and returns its URL.
+func NewPostgresDatabase(t *testing.T, ctx context.Context, serverURL, name string) string {
+	t.Helper()
+
+	exec := func(sql string) {
+		t.Helper()
+		conn, err := pgx.Connect(ctx, serverURL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer conn.Close(ctx)
+		if _, err := conn.Exec(ctx, sql); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	identifier := pgx.Identifier{name}.Sanitize()
+	exec("CREATE DATABASE " + identifier)
+	t.Cleanup(func() { exec("DROP DATABASE " + identifier + " WITH (FORCE)") })
+
+	u, err := url.Parse(serverURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	u.Path = "/" + name
+	return u.String()
+}
+
+// InUnits returns s as it is read back from a database, where nutrients left
+// out are zero in their unit.
+func InUnits(s supplement.Supplement) supplement.Supplement {
+	quantities := map[supplement.Nutrient]*supplement.Quantity{
+		supplement.Carbohydrates: &s.Carbohydrates,
+		supplement.Electrolytes:  &s.Electrolytes,
+		supplement.Maltodextrose: &s.Maltodextrose,
+		supplement.Fructose:      &s.Fructose,
+		supplement.Caffeine:      &s.Caffeine,
+		supplement.Sodium:        &s.Sodium,
+		supplement.Protein:       &s.Protein,
+	}
+	for n, q := range quantities {
+		if q.Unit == "" {
+			q.Unit = n.Unit()
+		}
+	}
+	return s
+}
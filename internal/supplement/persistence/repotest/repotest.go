@@ -0,0 +1,759 @@
+// Package repotest is the conformance suite every SupplementRepository
+// implementation must pass, so that the service behaves the same whatever
+// storage backs it.
+package repotest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/marioromandono/supplementapp/internal/supplement"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+)
+
+// Run runs the suite. newRepository must return an empty repository and is
+// called once per subtest; subtests do not run in parallel.
+func Run(t *testing.T, newRepository func(t *testing.T) supplement.SupplementRepository) {
+	t.Run("find missing", func(t *testing.T) {
+		repo := newRepository(t)
+
+		got, err := repo.FindByGtin(context.Background(), "01234567890128")
+
+		if err != nil || got != nil {
+			t.Errorf("FindByGtin() = %v, %v, want nil, nil", got, err)
+		}
+	})
+
+	t.Run("create and find", func(t *testing.T) {
+		ctx := context.Background()
+		repo := newRepository(t)
+		want := newSupplement("01234567890128")
+
+		if err := repo.Create(ctx, want); err != nil {
+			t.Fatalf("Create() error = %v, want nil", err)
+		}
+
+		want.Version = 1
+		assertStored(t, repo, want)
+	})
+
+	t.Run("create duplicate", func(t *testing.T) {
+		ctx := context.Background()
+		repo := newRepository(t)
+		s := newSupplement("01234567890128")
+		create(t, repo, s)
+
+		duplicate := s
+		duplicate.Name = "duplicate"
+		if err := repo.Create(ctx, duplicate); err == nil {
+			t.Errorf("Create() error = nil, want an error")
+		}
+
+		s.Version = 1
+		assertStored(t, repo, s)
+	})
+
+	t.Run("update", func(t *testing.T) {
+		ctx := context.Background()
+		repo := newRepository(t)
+		s := create(t, repo, newSupplement("01234567890128"))
+
+		s.Name = "updated"
+		s.Caffeine = supplement.Milligrams(0)
+		s.Serving = &supplement.Serving{Size: supplement.Millilitres(500), ServingsPerPackage: 1}
+		s.Ingredients = []string{"water", "fructose"}
+		s.Allergens = supplement.AllergenDeclaration{MayContain: []supplement.Allergen{supplement.AllergenGluten}}
+		s.Micronutrients = supplement.Panel{supplement.Potassium: supplement.Milligrams(150), supplement.Magnesium: supplement.Milligrams(30)}
+		if err := repo.Update(ctx, s); err != nil {
+			t.Fatalf("Update() error = %v, want nil", err)
+		}
+
+		s.Version++
+		assertStored(t, repo, s)
+	})
+
+	t.Run("update stale version", func(t *testing.T) {
+		ctx := context.Background()
+		repo := newRepository(t)
+		s := create(t, repo, newSupplement("01234567890128"))
+
+		stale := s
+		stale.Name = "updated"
+		stale.Version--
+		if err := repo.Update(ctx, stale); !errors.Is(err, supplement.ErrPreconditionFailed) {
+			t.Errorf("Update() error = %v, want %v", err, supplement.ErrPreconditionFailed)
+		}
+
+		assertStored(t, repo, s)
+	})
+
+	t.Run("update missing", func(t *testing.T) {
+		repo := newRepository(t)
+
+		err := repo.Update(context.Background(), newSupplement("01234567890128"))
+
+		if !errors.Is(err, supplement.ErrPreconditionFailed) {
+			t.Errorf("Update() error = %v, want %v", err, supplement.ErrPreconditionFailed)
+		}
+	})
+
+	t.Run("concurrent updates", func(t *testing.T) {
+		ctx := context.Background()
+		repo := newRepository(t)
+		s := create(t, repo, newSupplement("01234567890128"))
+
+		const writers = 8
+		errs := make(chan error, writers)
+		var wg sync.WaitGroup
+		for i := range writers {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				update := s
+				update.Caffeine = supplement.Milligrams(float64(i))
+				errs <- repo.Update(ctx, update)
+			}()
+		}
+		wg.Wait()
+		close(errs)
+
+		succeeded := 0
+		for err := range errs {
+			switch {
+			case err == nil:
+				succeeded++
+			case !errors.Is(err, supplement.ErrPreconditionFailed):
+				t.Errorf("Update() error = %v, want nil or %v", err, supplement.ErrPreconditionFailed)
+			}
+		}
+		if succeeded != 1 {
+			t.Errorf("%d concurrent updates of the same version succeeded, want 1", succeeded)
+		}
+	})
+
+	t.Run("concurrent creates", func(t *testing.T) {
+		ctx := context.Background()
+		repo := newRepository(t)
+
+		const writers = 8
+		errs := make(chan error, writers)
+		var wg sync.WaitGroup
+		for range writers {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				errs <- repo.Create(ctx, newSupplement("01234567890128"))
+			}()
+		}
+		wg.Wait()
+		close(errs)
+
+		succeeded := 0
+		for err := range errs {
+			switch {
+			case err == nil:
+				succeeded++
+			case !errors.Is(err, supplement.ErrAlreadyExists):
+				t.Errorf("Create() error = %v, want nil or %v", err, supplement.ErrAlreadyExists)
+			}
+		}
+		if succeeded != 1 {
+			t.Errorf("%d concurrent creates of the same GTIN succeeded, want 1", succeeded)
+		}
+	})
+
+	t.Run("transaction", func(t *testing.T) {
+		ctx := context.Background()
+		repo := newRepository(t)
+		s := create(t, repo, newSupplement("01234567890128"))
+
+		err := repo.InTransaction(ctx, func(tx supplement.SupplementRepository) error {
+			if err := tx.Create(ctx, newSupplement("04006381333931")); err != nil {
+				return err
+			}
+			if err := tx.Create(ctx, newSupplement("04006381333931")); !errors.Is(err, supplement.ErrAlreadyExists) {
+				t.Errorf("Create() in transaction error = %v, want %v", err, supplement.ErrAlreadyExists)
+			}
+			found, err := tx.FindByGtin(ctx, "04006381333931")
+			if err != nil || found == nil {
+				t.Errorf("FindByGtin() in transaction = %v, %v, want the created supplement", found, err)
+			}
+			updated := s
+			updated.Name = "updated"
+			return tx.Update(ctx, updated)
+		})
+		if err != nil {
+			t.Fatalf("InTransaction() error = %v, want nil", err)
+		}
+
+		s.Name = "updated"
+		s.Version++
+		assertStored(t, repo, s)
+		if got, err := repo.FindByGtin(ctx, "04006381333931"); err != nil || got == nil {
+			t.Errorf("FindByGtin() after InTransaction() = %v, %v, want the created supplement", got, err)
+		}
+	})
+
+	t.Run("transaction rolled back", func(t *testing.T) {
+		ctx := context.Background()
+		repo := newRepository(t)
+		s := create(t, repo, newSupplement("01234567890128"))
+		failure := errors.New("failure")
+
+		err := repo.InTransaction(ctx, func(tx supplement.SupplementRepository) error {
+			if err := tx.Create(ctx, newSupplement("04006381333931")); err != nil {
+				return err
+			}
+			if err := tx.Delete(ctx, s); err != nil {
+				return err
+			}
+			return failure
+		})
+		if !errors.Is(err, failure) {
+			t.Fatalf("InTransaction() error = %v, want %v", err, failure)
+		}
+
+		assertStored(t, repo, s)
+		if got, err := repo.FindByGtin(ctx, "04006381333931"); err != nil || got != nil {
+			t.Errorf("FindByGtin() after rollback = %v, %v, want nil, nil", got, err)
+		}
+		history, err := repo.History(ctx, s.Gtin)
+		if err != nil || len(history) != 1 {
+			t.Errorf("History() after rollback = %v, %v, want the create entry only", history, err)
+		}
+	})
+
+	t.Run("delete", func(t *testing.T) {
+		ctx := context.Background()
+		repo := newRepository(t)
+		s := create(t, repo, newSupplement("01234567890128"))
+
+		if err := repo.Delete(ctx, s); err != nil {
+			t.Fatalf("Delete() error = %v, want nil", err)
+		}
+
+		got, err := repo.FindByGtin(ctx, s.Gtin)
+		if err != nil || got != nil {
+			t.Errorf("FindByGtin() after Delete() = %v, %v, want nil, nil", got, err)
+		}
+		if err := repo.Update(ctx, s); !errors.Is(err, supplement.ErrPreconditionFailed) {
+			t.Errorf("Update() after Delete() error = %v, want %v", err, supplement.ErrPreconditionFailed)
+		}
+		if err := repo.Create(ctx, s); !errors.Is(err, supplement.ErrAlreadyExists) {
+			t.Errorf("Create() after Delete() error = %v, want %v", err, supplement.ErrAlreadyExists)
+		}
+	})
+
+	t.Run("list deleted", func(t *testing.T) {
+		ctx := context.Background()
+		repo := newRepository(t)
+		ss := seed(t, repo)
+		if err := repo.Delete(ctx, ss[1]); err != nil {
+			t.Fatal(err)
+		}
+
+		got, err := repo.ListAll(ctx, query(supplement.SortByGtin, supplement.Ascending))
+		if err != nil {
+			t.Fatalf("ListAll() error = %v, want nil", err)
+		}
+		if diff := cmp.Diff(got, []supplement.Supplement{ss[0], ss[2], ss[3]}, cmpopts.EquateEmpty()); diff != "" {
+			t.Errorf("ListAll() mismatch (-got +want):\n%s", diff)
+		}
+
+		q := query(supplement.SortByGtin, supplement.Ascending)
+		q.IncludeDeleted = true
+		got, err = repo.ListAll(ctx, q)
+		if err != nil {
+			t.Fatalf("ListAll() including deleted error = %v, want nil", err)
+		}
+		if len(got) != len(ss) || got[1].DeletedAt == nil || got[1].Version != ss[1].Version+1 {
+			t.Errorf("ListAll() including deleted = %v, want every supplement and the tombstone at the next version", got)
+		}
+	})
+
+	t.Run("restore", func(t *testing.T) {
+		ctx := context.Background()
+		repo := newRepository(t)
+		s := create(t, repo, newSupplement("01234567890128"))
+		if err := repo.Delete(ctx, s); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := repo.Restore(ctx, s.Gtin); err != nil {
+			t.Fatalf("Restore() error = %v, want nil", err)
+		}
+
+		s.Version += 2
+		assertStored(t, repo, s)
+	})
+
+	t.Run("restore not deleted", func(t *testing.T) {
+		ctx := context.Background()
+		repo := newRepository(t)
+		s := create(t, repo, newSupplement("01234567890128"))
+
+		for _, gtin := range []string{s.Gtin, "04006381333931"} {
+			if err := repo.Restore(ctx, gtin); !errors.Is(err, supplement.ErrNotFound) {
+				t.Errorf("Restore(%q) error = %v, want %v", gtin, err, supplement.ErrNotFound)
+			}
+		}
+
+		assertStored(t, repo, s)
+	})
+
+	t.Run("purge", func(t *testing.T) {
+		ctx := context.Background()
+		repo := newRepository(t)
+		ss := seed(t, repo)
+		for _, s := range ss[:2] {
+			if err := repo.Delete(ctx, s); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		purged, err := repo.Purge(ctx, time.Now().Add(-time.Hour))
+		if err != nil || purged != 0 {
+			t.Errorf("Purge() of recent tombstones = %d, %v, want 0, nil", purged, err)
+		}
+
+		purged, err = repo.Purge(ctx, time.Now().Add(time.Second))
+		if err != nil || purged != 2 {
+			t.Errorf("Purge() = %d, %v, want 2, nil", purged, err)
+		}
+
+		q := query(supplement.SortByGtin, supplement.Ascending)
+		q.IncludeDeleted = true
+		got, err := repo.ListAll(ctx, q)
+		if err != nil {
+			t.Fatalf("ListAll() error = %v, want nil", err)
+		}
+		if diff := cmp.Diff(got, ss[2:], cmpopts.EquateEmpty()); diff != "" {
+			t.Errorf("ListAll() after Purge() mismatch (-got +want):\n%s", diff)
+		}
+		if err := repo.Restore(ctx, ss[0].Gtin); !errors.Is(err, supplement.ErrNotFound) {
+			t.Errorf("Restore() after Purge() error = %v, want %v", err, supplement.ErrNotFound)
+		}
+
+		history, err := repo.History(ctx, ss[0].Gtin)
+		if err != nil || len(history) != 3 || history[2].Operation != supplement.OperationPurge || history[2].Version != ss[0].Version+1 {
+			t.Errorf("History() after Purge() = %v, %v, want create, delete and purge entries", history, err)
+		}
+	})
+
+	t.Run("delete stale version", func(t *testing.T) {
+		ctx := context.Background()
+		repo := newRepository(t)
+		s := create(t, repo, newSupplement("01234567890128"))
+
+		stale := s
+		stale.Version--
+		if err := repo.Delete(ctx, stale); !errors.Is(err, supplement.ErrPreconditionFailed) {
+			t.Errorf("Delete() error = %v, want %v", err, supplement.ErrPreconditionFailed)
+		}
+
+		assertStored(t, repo, s)
+	})
+
+	t.Run("history", func(t *testing.T) {
+		ctx := supplement.WithActor(context.Background(), "qa@example.com")
+		repo := newRepository(t)
+		if err := repo.Create(ctx, newSupplement("01234567890128")); err != nil {
+			t.Fatal(err)
+		}
+		s := create(t, repo, newSupplement("04006381333931"))
+
+		updated := s
+		updated.Name = "updated"
+		updated.Caffeine = supplement.Milligrams(0)
+		if err := repo.Update(ctx, updated); err != nil {
+			t.Fatal(err)
+		}
+		if err := repo.Update(ctx, updated); !errors.Is(err, supplement.ErrPreconditionFailed) {
+			t.Fatalf("Update() error = %v, want %v", err, supplement.ErrPreconditionFailed)
+		}
+		updated.Version++
+		if err := repo.Delete(ctx, updated); err != nil {
+			t.Fatal(err)
+		}
+
+		got, err := repo.History(context.Background(), s.Gtin)
+
+		if err != nil {
+			t.Fatalf("History() error = %v, want nil", err)
+		}
+		for _, entry := range got {
+			if entry.At.IsZero() {
+				t.Errorf("History() entry %d has no timestamp", entry.Version)
+			}
+		}
+		want := []supplement.AuditEntry{
+			{Gtin: s.Gtin, Version: 1, Operation: supplement.OperationCreate, Actor: supplement.AnonymousActor},
+			{
+				Gtin:      s.Gtin,
+				Version:   2,
+				Operation: supplement.OperationUpdate,
+				Actor:     "qa@example.com",
+				Changes: []supplement.Change{
+					{Path: "/caffeine/amount", Before: float64(1), After: float64(0)},
+					{Path: "/name", Before: "name", After: "updated"},
+				},
+			},
+			{
+				Gtin:      s.Gtin,
+				Version:   3,
+				Operation: supplement.OperationDelete,
+				Actor:     "qa@example.com",
+				Changes:   []supplement.Change{{Path: "/deletedAt"}},
+			},
+		}
+		if diff := cmp.Diff(got, want, cmpopts.IgnoreFields(supplement.AuditEntry{}, "At", "Changes")); diff != "" {
+			t.Fatalf("History() mismatch (-got +want):\n%s", diff)
+		}
+		if diff := cmp.Diff(got[1].Changes, want[1].Changes); diff != "" {
+			t.Errorf("History() update changes (-got +want):\n%s", diff)
+		}
+		if len(got[0].Changes) == 0 {
+			t.Errorf("History() create changes = %v, want every value", got[0].Changes)
+		}
+		if len(got[2].Changes) != 1 || got[2].Changes[0].Path != "/deletedAt" || got[2].Changes[0].After == nil {
+			t.Errorf("History() delete changes = %v, want /deletedAt set", got[2].Changes)
+		}
+	})
+
+	t.Run("list empty", func(t *testing.T) {
+		repo := newRepository(t)
+
+		got, err := repo.ListAll(context.Background(), query(supplement.SortByGtin, supplement.Ascending))
+
+		if err != nil {
+			t.Errorf("ListAll() error = %v, want nil", err)
+		}
+		if len(got) != 0 {
+			t.Errorf("ListAll() = %v, want no supplements", got)
+		}
+	})
+
+	t.Run("list ordering", func(t *testing.T) {
+		ctx := context.Background()
+		repo := newRepository(t)
+		ss := seed(t, repo)
+
+		tests := []struct {
+			name  string
+			query supplement.ListQuery
+			want  []supplement.Supplement
+		}{
+			{
+				name:  "by gtin",
+				query: query(supplement.SortByGtin, supplement.Ascending),
+				want:  []supplement.Supplement{ss[0], ss[1], ss[2], ss[3]},
+			},
+			{
+				name:  "by gtin descending",
+				query: query(supplement.SortByGtin, supplement.Descending),
+				want:  []supplement.Supplement{ss[3], ss[2], ss[1], ss[0]},
+			},
+			{
+				name:  "by name, ties by gtin",
+				query: query(supplement.SortByName, supplement.Ascending),
+				want:  []supplement.Supplement{ss[1], ss[3], ss[0], ss[2]},
+			},
+			{
+				name:  "by brand, byte-wise so uppercase first",
+				query: query(supplement.SortByBrand, supplement.Ascending),
+				want:  []supplement.Supplement{ss[0], ss[1], ss[2], ss[3]},
+			},
+			{
+				name:  "by flavor, byte-wise so uppercase first",
+				query: query(supplement.SortByFlavor, supplement.Ascending),
+				want:  []supplement.Supplement{ss[3], ss[0], ss[1], ss[2]},
+			},
+			{
+				name: "after text keyset",
+				query: func() supplement.ListQuery {
+					q := query(supplement.SortByBrand, supplement.Ascending)
+					q.After = &supplement.Keyset{Value: "Brand", Gtin: ss[0].Gtin}
+					return q
+				}(),
+				want: []supplement.Supplement{ss[1], ss[2], ss[3]},
+			},
+			{
+				name:  "by nutrient descending, ties by gtin",
+				query: query(supplement.SortField(supplement.Carbohydrates), supplement.Descending),
+				want:  []supplement.Supplement{ss[1], ss[3], ss[2], ss[0]},
+			},
+			{
+				name: "after keyset",
+				query: func() supplement.ListQuery {
+					q := query(supplement.SortField(supplement.Carbohydrates), supplement.Descending)
+					q.After = &supplement.Keyset{Value: float64(30.0), Gtin: ss[3].Gtin}
+					return q
+				}(),
+				want: []supplement.Supplement{ss[2], ss[0]},
+			},
+			{
+				name: "limited",
+				query: func() supplement.ListQuery {
+					q := query(supplement.SortByGtin, supplement.Ascending)
+					q.Limit = 2
+					return q
+				}(),
+				want: []supplement.Supplement{ss[0], ss[1]},
+			},
+		}
+		for _, tt := range tests {
+			got, err := repo.ListAll(ctx, tt.query)
+			if err != nil {
+				t.Errorf("%s: ListAll() error = %v, want nil", tt.name, err)
+			}
+			if diff := cmp.Diff(got, tt.want, cmpopts.EquateEmpty()); diff != "" {
+				t.Errorf("%s: ListAll() mismatch (-got +want):\n%s", tt.name, diff)
+			}
+		}
+	})
+
+	t.Run("list filtered", func(t *testing.T) {
+		repo := newRepository(t)
+		ss := seed(t, repo)
+
+		q := query(supplement.SortByGtin, supplement.Ascending)
+		q.Brand = "BRAND"
+		q.Flavor = "lemon"
+		min, max := float64(50), float64(150)
+		q.NutrientRanges = []supplement.NutrientRange{{Nutrient: supplement.Caffeine, Min: &min, Max: &max}}
+		got, err := repo.ListAll(context.Background(), q)
+
+		if err != nil {
+			t.Errorf("ListAll() error = %v, want nil", err)
+		}
+		if diff := cmp.Diff(got, []supplement.Supplement{ss[0], ss[3]}, cmpopts.EquateEmpty()); diff != "" {
+			t.Errorf("ListAll() mismatch (-got +want):\n%s", diff)
+		}
+	})
+
+	t.Run("list by category", func(t *testing.T) {
+		repo := newRepository(t)
+		ss := seed(t, repo)
+
+		q := query(supplement.SortByGtin, supplement.Ascending)
+		q.Category = supplement.CategoryGel
+		got, err := repo.ListAll(context.Background(), q)
+
+		if err != nil {
+			t.Errorf("ListAll() error = %v, want nil", err)
+		}
+		if diff := cmp.Diff(got, []supplement.Supplement{ss[0], ss[3]}, cmpopts.EquateEmpty()); diff != "" {
+			t.Errorf("ListAll() mismatch (-got +want):\n%s", diff)
+		}
+	})
+
+	t.Run("list excluding allergens", func(t *testing.T) {
+		repo := newRepository(t)
+		ss := seed(t, repo)
+
+		q := query(supplement.SortByGtin, supplement.Ascending)
+		q.ExcludeAllergens = []supplement.Allergen{supplement.AllergenMilk, supplement.AllergenSoy}
+		got, err := repo.ListAll(context.Background(), q)
+
+		if err != nil {
+			t.Errorf("ListAll() error = %v, want nil", err)
+		}
+		if diff := cmp.Diff(got, []supplement.Supplement{ss[2], ss[3]}, cmpopts.EquateEmpty()); diff != "" {
+			t.Errorf("ListAll() mismatch (-got +want):\n%s", diff)
+		}
+	})
+
+	t.Run("export", func(t *testing.T) {
+		repo := newRepository(t)
+		ss := seed(t, repo)
+
+		q := query(supplement.SortField(supplement.Carbohydrates), supplement.Descending)
+		q.Limit = 1
+		q.Flavor = "lemon"
+		var got []supplement.Supplement
+		err := repo.Export(context.Background(), q, func(s supplement.Supplement) error {
+			got = append(got, s)
+			return nil
+		})
+
+		if err != nil {
+			t.Errorf("Export() error = %v, want nil", err)
+		}
+		if diff := cmp.Diff(got, []supplement.Supplement{ss[1], ss[3], ss[0]}); diff != "" {
+			t.Errorf("Export() mismatch (-got +want):\n%s", diff)
+		}
+	})
+
+	t.Run("export in batches", func(t *testing.T) {
+		ctx := context.Background()
+		repo := newRepository(t)
+		const n = 1100
+		for i := range n {
+			s := newSupplement(fmt.Sprintf("%014d", i))
+			if err := repo.Create(ctx, s); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		var gtins []string
+		err := repo.Export(ctx, query(supplement.SortByGtin, supplement.Descending), func(s supplement.Supplement) error {
+			gtins = append(gtins, s.Gtin)
+			return nil
+		})
+
+		if err != nil {
+			t.Errorf("Export() error = %v, want nil", err)
+		}
+		if len(gtins) != n || gtins[0] != fmt.Sprintf("%014d", n-1) || gtins[n-1] != fmt.Sprintf("%014d", 0) {
+			t.Errorf("Export() = %d supplements, want %d in descending GTIN order", len(gtins), n)
+		}
+	})
+
+	t.Run("export stopped", func(t *testing.T) {
+		repo := newRepository(t)
+		seed(t, repo)
+		stop := errors.New("stop")
+
+		calls := 0
+		err := repo.Export(context.Background(), query(supplement.SortByGtin, supplement.Ascending), func(supplement.Supplement) error {
+			calls++
+			return stop
+		})
+
+		if !errors.Is(err, stop) || calls != 1 {
+			t.Errorf("Export() error = %v after %d calls, want %v after 1", err, calls, stop)
+		}
+	})
+
+	t.Run("search", func(t *testing.T) {
+		ctx := context.Background()
+		repo := newRepository(t)
+		catalog := []struct{ gtin, name, brand, flavor string }{
+			{"01234567890128", "Gell Bar", "Isostar", "Cocoa"},
+			{"04006381333931", "Gel 160", "Maurten", "Café"},
+			{"05901234123457", "Drink Mix 320", "Maurten", "Neutral"},
+			{"10012345678902", "Gel 100", "Maurten", "Lima"},
+		}
+		ss := make([]supplement.Supplement, len(catalog))
+		for i, c := range catalog {
+			s := newSupplement(c.gtin)
+			s.Name, s.Brand, s.Flavor = c.name, c.brand, c.flavor
+			ss[i] = create(t, repo, s)
+		}
+		if err := repo.Delete(ctx, ss[3]); err != nil {
+			t.Fatal(err)
+		}
+
+		tests := []struct {
+			text  string
+			limit int
+			want  []supplement.Supplement
+		}{
+			{text: "maurten 160", want: []supplement.Supplement{ss[1]}},
+			{text: "MAURTEN", want: []supplement.Supplement{ss[1], ss[2]}},
+			{text: "maur", want: []supplement.Supplement{ss[1], ss[2]}},
+			{text: "cafe", want: []supplement.Supplement{ss[1]}},
+			{text: "isóstar", want: []supplement.Supplement{ss[0]}},
+			{text: "maurtenn 160", want: []supplement.Supplement{ss[1]}},
+			{text: "gel", want: []supplement.Supplement{ss[1], ss[0]}},
+			{text: "gel", limit: 1, want: []supplement.Supplement{ss[1]}},
+			{text: "lima"},
+			{text: "beta fuel"},
+		}
+		for _, tt := range tests {
+			q := supplement.SearchQuery{Text: tt.text, Limit: tt.limit}
+			if q.Limit == 0 {
+				q.Limit = supplement.MaxPageSize
+			}
+
+			got, err := repo.Search(ctx, q)
+
+			if err != nil {
+				t.Errorf("Search(%q) error = %v, want nil", tt.text, err)
+			}
+			if diff := cmp.Diff(got, tt.want, cmpopts.EquateEmpty()); diff != "" {
+				t.Errorf("Search(%q, %d) mismatch (-got +want):\n%s", tt.text, q.Limit, diff)
+			}
+		}
+	})
+}
+
+func newSupplement(gtin string) supplement.Supplement {
+	return supplement.Supplement{
+		Gtin:        gtin,
+		Name:        "name",
+		Brand:       "brand",
+		Flavor:      "flavor",
+		Category:    supplement.CategoryGel,
+		Serving:     &supplement.Serving{Size: supplement.Grams(60), ServingsPerPackage: 10},
+		Ingredients: []string{"maltodextrin", "fructose", "whey protein"},
+		Allergens: supplement.AllergenDeclaration{
+			Contains:   []supplement.Allergen{supplement.AllergenMilk},
+			MayContain: []supplement.Allergen{supplement.AllergenPeanuts, supplement.AllergenSoy},
+		},
+		Carbohydrates: supplement.Grams(1.0),
+		Electrolytes:  supplement.Milligrams(1.0),
+		Maltodextrose: supplement.Grams(1.0),
+		Fructose:      supplement.Grams(1.0),
+		Caffeine:      supplement.Milligrams(1.0),
+		Sodium:        supplement.Milligrams(1.0),
+		Protein:       supplement.Grams(1.0),
+		Micronutrients: supplement.Panel{
+			supplement.Potassium:  supplement.Milligrams(200),
+			supplement.VitaminB12: supplement.Quantity{Amount: 2.5, Unit: supplement.Microgram},
+		},
+	}
+}
+
+// create stores s and returns it as stored, with its initial version.
+func create(t *testing.T, repo supplement.SupplementRepository, s supplement.Supplement) supplement.Supplement {
+	t.Helper()
+	ctx := context.Background()
+
+	if err := repo.Create(ctx, s); err != nil {
+		t.Fatal(err)
+	}
+
+	stored, err := repo.FindByGtin(ctx, s.Gtin)
+	if err != nil || stored == nil {
+		t.Fatalf("FindByGtin() after Create() = %v, %v", stored, err)
+	}
+	return *stored
+}
+
+func seed(t *testing.T, repo supplement.SupplementRepository) []supplement.Supplement {
+	t.Helper()
+	ss := []supplement.Supplement{
+		{Gtin: "01234567890128", Name: "b", Brand: "Brand", Flavor: "lemon", Category: supplement.CategoryGel, Allergens: supplement.AllergenDeclaration{Contains: []supplement.Allergen{supplement.AllergenMilk}}, Carbohydrates: supplement.Grams(20.0), Caffeine: supplement.Milligrams(100.0)},
+		{Gtin: "04006381333931", Name: "a", Brand: "brand", Flavor: "lemon", Category: supplement.CategoryDrinkMix, Allergens: supplement.AllergenDeclaration{MayContain: []supplement.Allergen{supplement.AllergenSoy}}, Carbohydrates: supplement.Grams(40.0), Caffeine: supplement.Milligrams(0.0)},
+		{Gtin: "05901234123457", Name: "b", Brand: "brand", Flavor: "orange", Carbohydrates: supplement.Grams(30.0), Caffeine: supplement.Milligrams(100.0)},
+		{Gtin: "10012345678902", Name: "a", Brand: "brand", Flavor: "Lemon", Category: supplement.CategoryGel, Carbohydrates: supplement.Grams(30.0), Caffeine: supplement.Milligrams(100.0)},
+	}
+	for i, s := range ss {
+		ss[i] = create(t, repo, s)
+	}
+	return ss
+}
+
+func query(sortBy supplement.SortField, direction supplement.SortDirection) supplement.ListQuery {
+	return supplement.ListQuery{Limit: supplement.MaxPageSize, SortBy: sortBy, SortDirection: direction}
+}
+
+func assertStored(t *testing.T, repo supplement.SupplementRepository, want supplement.Supplement) {
+	t.Helper()
+
+	got, err := repo.FindByGtin(context.Background(), want.Gtin)
+
+	if err != nil {
+		t.Fatalf("FindByGtin() error = %v, want nil", err)
+	}
+	if diff := cmp.Diff(got, &want); diff != "" {
+		t.Errorf("FindByGtin() mismatch (-got +want):\n%s", diff)
+	}
+}
@@ -0,0 +1,83 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net/url"
+
+	"github.com/marioromandono/supplementapp/migrations"
+
+	"github.com/pressly/goose/v3"
+	_ "modernc.org/sqlite"
+)
+
+// Open opens the SQLite database file at path, creating it if needed, and
+// applies any pending migration so that a fresh file is ready to use.
+func Open(ctx context.Context, path string) (*sql.DB, error) {
+	// Writers wait for each other instead of failing with SQLITE_BUSY, and WAL
+	// lets readers proceed while a write is in progress. Transactions, which
+	// read before they write, take the write lock up front so that another
+	// writer cannot invalidate what they read.
+	dsn := "file:" + url.PathEscape(path) +
+		"?_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)&_pragma=foreign_keys(1)&_txlock=immediate"
+
+	db, err := sql.Open("sqlite", dsn)
+	if err != nil {
+		return nil, fmt.Errorf("could not open sqlite database: %w", err)
+	}
+
+	if err := Migrate(ctx, db); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return db, nil
+}
+
+// NewMigrationProvider returns a goose provider for the SQLite migrations
+// embedded in the binary.
+func NewMigrationProvider(db *sql.DB) (*goose.Provider, error) {
+	return goose.NewProvider(goose.DialectSQLite3, db, migrations.SQLite)
+}
+
+// Migrate applies the pending SQLite migrations embedded in the binary. It
+// fails if the file was migrated by a newer build.
+func Migrate(ctx context.Context, db *sql.DB) error {
+	provider, err := NewMigrationProvider(db)
+	if err != nil {
+		return fmt.Errorf("could not load sqlite migrations: %w", err)
+	}
+
+	if _, err := provider.Up(ctx); err != nil {
+		return fmt.Errorf("could not migrate sqlite database: %w", err)
+	}
+
+	version, err := SchemaVersion(ctx, db)
+	if err != nil {
+		return err
+	}
+
+	return migrations.Compare(version, migrations.SQLite)
+}
+
+// SchemaVersion returns the latest migration goose has applied to the
+// database, or 0 if none has been applied yet. It never writes, so it is safe
+// to call from health checks.
+func SchemaVersion(ctx context.Context, db *sql.DB) (int64, error) {
+	var tables int
+	err := db.QueryRowContext(
+		ctx,
+		"SELECT count(*) FROM sqlite_master WHERE type = 'table' AND name = 'goose_db_version'",
+	).Scan(&tables)
+	if err != nil || tables == 0 {
+		return 0, err
+	}
+
+	var version int64
+	err = db.QueryRowContext(
+		ctx,
+		"SELECT COALESCE(MAX(version_id), 0) FROM goose_db_version WHERE is_applied",
+	).Scan(&version)
+	return version, err
+}
@@ -0,0 +1,108 @@
+package sqlite_test
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/marioromandono/supplementapp/internal/supplement/persistence/sqlite"
+	"github.com/marioromandono/supplementapp/migrations"
+)
+
+func TestSchemaVersion(t *testing.T) {
+	latest, err := migrations.Latest(migrations.SQLite)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name        string
+		migrate     func(ctx context.Context, db *sql.DB) error
+		want        int64
+		wantCompare error
+	}{
+		{
+			name:        "fresh",
+			migrate:     func(ctx context.Context, db *sql.DB) error { return nil },
+			want:        0,
+			wantCompare: migrations.ErrSchemaBehind,
+		},
+		{
+			name: "partly migrated",
+			migrate: func(ctx context.Context, db *sql.DB) error {
+				provider, err := sqlite.NewMigrationProvider(db)
+				if err != nil {
+					return err
+				}
+				_, err = provider.UpTo(ctx, 20261016130000)
+				return err
+			},
+			want:        20261016130000,
+			wantCompare: migrations.ErrSchemaBehind,
+		},
+		{
+			name:    "migrated",
+			migrate: sqlite.Migrate,
+			want:    latest,
+		},
+		{
+			name: "ahead",
+			migrate: func(ctx context.Context, db *sql.DB) error {
+				if err := sqlite.Migrate(ctx, db); err != nil {
+					return err
+				}
+				_, err := db.ExecContext(ctx, "INSERT INTO goose_db_version (version_id, is_applied) VALUES (?1, 1)", latest+1)
+				return err
+			},
+			want:        latest + 1,
+			wantCompare: migrations.ErrSchemaAhead,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			db, err := sql.Open("sqlite", filepath.Join(t.TempDir(), "supplementapp.db"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer db.Close()
+			if err := tt.migrate(ctx, db); err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := sqlite.SchemaVersion(ctx, db)
+
+			if err != nil || got != tt.want {
+				t.Fatalf("SchemaVersion() = %d, %v, want %d, nil", got, err, tt.want)
+			}
+			if err := migrations.Compare(got, migrations.SQLite); !errors.Is(err, tt.wantCompare) {
+				t.Errorf("Compare() error = %v, wantErr %v", err, tt.wantCompare)
+			}
+		})
+	}
+
+	t.Run("open refuses a newer schema", func(t *testing.T) {
+		ctx := context.Background()
+		path := filepath.Join(t.TempDir(), "supplementapp.db")
+		db, err := sqlite.Open(ctx, path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = db.ExecContext(ctx, "INSERT INTO goose_db_version (version_id, is_applied) VALUES (?1, 1)", latest+1)
+		db.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		db, err = sqlite.Open(ctx, path)
+
+		if !errors.Is(err, migrations.ErrSchemaAhead) {
+			t.Errorf("Open() error = %v, want %v", err, migrations.ErrSchemaAhead)
+		}
+		if db != nil {
+			db.Close()
+		}
+	})
+}
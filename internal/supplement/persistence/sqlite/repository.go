@@ -0,0 +1,769 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/marioromandono/supplementapp/internal/supplement"
+
+	moderncsqlite "modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+const selectColumns = "id, gtin, name, brand, flavor, category, serving_size, serving_unit, servings_per_package, " +
+	"carbohydrates, electrolytes, maltodextrose, fructose, caffeine, sodium, protein, deleted_at, version"
+
+// deletedAtLayout stores deleted_at as fixed-width UTC text, so that SQLite
+// compares it in time order.
+const deletedAtLayout = "2006-01-02T15:04:05.000000Z"
+
+// SQLiteSupplementRepository runs its statements on db, or on tx for the
+// repository InTransaction passes on.
+type SQLiteSupplementRepository struct {
+	db        *sql.DB
+	tx        *sql.Tx
+	tableName string
+}
+
+func NewSupplementRepository(db *sql.DB) *SQLiteSupplementRepository {
+	return &SQLiteSupplementRepository{db: db, tableName: "Supplements"}
+}
+
+func (r *SQLiteSupplementRepository) InTransaction(ctx context.Context, fn func(repository supplement.SupplementRepository) error) error {
+	return r.inTx(ctx, func(tx *sql.Tx) error {
+		return fn(&SQLiteSupplementRepository{db: r.db, tx: tx, tableName: r.tableName})
+	})
+}
+
+func (r *SQLiteSupplementRepository) FindByGtin(ctx context.Context, gtin string) (*supplement.Supplement, error) {
+	return r.find(ctx, r.conn(), gtin, false)
+}
+
+// find reads a supplement through db, which may be a transaction, or its
+// tombstone if deleted.
+func (r *SQLiteSupplementRepository) find(ctx context.Context, db querier, gtin string, deleted bool) (*supplement.Supplement, error) {
+	query := "SELECT " + selectColumns + " FROM " + r.tableName + " WHERE gtin = ?1 AND deleted_at IS NULL"
+	if deleted {
+		query = "SELECT " + selectColumns + " FROM " + r.tableName + " WHERE gtin = ?1 AND deleted_at IS NOT NULL"
+	}
+
+	row := db.QueryRowContext(ctx, query, gtin)
+	id, s, err := scanSupplement(row)
+
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	supplements := []supplement.Supplement{s}
+	if err := loadComposition(ctx, db, []int64{id}, supplements); err != nil {
+		return nil, err
+	}
+
+	return &supplements[0], nil
+}
+
+func (r *SQLiteSupplementRepository) Create(ctx context.Context, s supplement.Supplement) error {
+	servingSize, servingUnit, servingsPerPackage := servingColumns(s)
+	return r.inTx(ctx, func(tx *sql.Tx) error {
+		var exists bool
+		err := tx.QueryRowContext(ctx, "SELECT EXISTS (SELECT 1 FROM "+r.tableName+" WHERE gtin = ?1)", s.Gtin).Scan(&exists)
+		if err != nil {
+			return err
+		}
+		if exists {
+			return supplement.ErrAlreadyExists
+		}
+
+		var id int64
+		err = tx.QueryRowContext(
+			ctx,
+			"INSERT INTO "+r.tableName+
+				" (gtin, name, brand, flavor, category, serving_size, serving_unit, servings_per_package, carbohydrates, electrolytes, maltodextrose, fructose, caffeine, sodium, protein) "+
+				"VALUES (?1, ?2, ?3, ?4, ?5, ?6, ?7, ?8, ?9, ?10, ?11, ?12, ?13, ?14, ?15) RETURNING id",
+			s.Gtin, s.Name, s.Brand, s.Flavor, categoryColumn(s), servingSize, servingUnit, servingsPerPackage,
+			s.Carbohydrates.Amount, s.Electrolytes.Amount, s.Maltodextrose.Amount, s.Fructose.Amount, s.Caffeine.Amount, s.Sodium.Amount, s.Protein.Amount,
+		).Scan(&id)
+
+		if err != nil {
+			return alreadyExists(err)
+		}
+
+		if err := insertComposition(ctx, tx, id, s); err != nil {
+			return err
+		}
+
+		s.Version = 1
+		s.DeletedAt = nil
+		return insertAuditEntry(ctx, tx, supplement.NewAuditEntry(ctx, supplement.OperationCreate, nil, &s))
+	})
+}
+
+func (r *SQLiteSupplementRepository) Update(ctx context.Context, s supplement.Supplement) error {
+	servingSize, servingUnit, servingsPerPackage := servingColumns(s)
+	return r.inTx(ctx, func(tx *sql.Tx) error {
+		before, err := r.find(ctx, tx, s.Gtin, false)
+		if err != nil {
+			return err
+		}
+		if before == nil || before.Version != s.Version {
+			return supplement.ErrPreconditionFailed
+		}
+
+		var id int64
+		err = tx.QueryRowContext(
+			ctx,
+			"UPDATE "+r.tableName+
+				" SET name = ?1, brand = ?2, flavor = ?3, category = ?4, serving_size = ?5, serving_unit = ?6, servings_per_package = ?7, "+
+				"carbohydrates = ?8, electrolytes = ?9, maltodextrose = ?10, fructose = ?11, caffeine = ?12, sodium = ?13, protein = ?14, version = version + 1 "+
+				"WHERE gtin = ?15 AND version = ?16 AND deleted_at IS NULL RETURNING id",
+			s.Name, s.Brand, s.Flavor, categoryColumn(s), servingSize, servingUnit, servingsPerPackage,
+			s.Carbohydrates.Amount, s.Electrolytes.Amount, s.Maltodextrose.Amount, s.Fructose.Amount, s.Caffeine.Amount, s.Sodium.Amount, s.Protein.Amount,
+			s.Gtin, s.Version,
+		).Scan(&id)
+
+		if errors.Is(err, sql.ErrNoRows) {
+			return supplement.ErrPreconditionFailed
+		}
+		if err != nil {
+			return err
+		}
+
+		if _, err := tx.ExecContext(ctx, "DELETE FROM supplement_ingredients WHERE supplement_id = ?1", id); err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, "DELETE FROM supplement_allergens WHERE supplement_id = ?1", id); err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, "DELETE FROM supplement_micronutrients WHERE supplement_id = ?1", id); err != nil {
+			return err
+		}
+
+		if err := insertComposition(ctx, tx, id, s); err != nil {
+			return err
+		}
+
+		s.Version++
+		s.DeletedAt = nil
+		return insertAuditEntry(ctx, tx, supplement.NewAuditEntry(ctx, supplement.OperationUpdate, before, &s))
+	})
+}
+
+func (r *SQLiteSupplementRepository) Delete(ctx context.Context, s supplement.Supplement) error {
+	return r.inTx(ctx, func(tx *sql.Tx) error {
+		before, err := r.find(ctx, tx, s.Gtin, false)
+		if err != nil {
+			return err
+		}
+		if before == nil || before.Version != s.Version {
+			return supplement.ErrPreconditionFailed
+		}
+
+		deleted := *before
+		deletedAt := time.Now().UTC().Truncate(time.Microsecond)
+		deleted.DeletedAt = &deletedAt
+		deleted.Version++
+
+		result, err := tx.ExecContext(
+			ctx,
+			"UPDATE "+r.tableName+" SET deleted_at = ?1, version = version + 1 WHERE gtin = ?2 AND version = ?3 AND deleted_at IS NULL",
+			deletedAt.Format(deletedAtLayout), s.Gtin, s.Version,
+		)
+		if err := checkVersion(result, err); err != nil {
+			return err
+		}
+
+		return insertAuditEntry(ctx, tx, supplement.NewAuditEntry(ctx, supplement.OperationDelete, before, &deleted))
+	})
+}
+
+func (r *SQLiteSupplementRepository) Restore(ctx context.Context, gtin string) error {
+	return r.inTx(ctx, func(tx *sql.Tx) error {
+		before, err := r.find(ctx, tx, gtin, true)
+		if err != nil {
+			return err
+		}
+		if before == nil {
+			return supplement.ErrNotFound
+		}
+
+		restored := *before
+		restored.DeletedAt = nil
+		restored.Version++
+
+		_, err = tx.ExecContext(ctx, "UPDATE "+r.tableName+" SET deleted_at = NULL, version = version + 1 WHERE gtin = ?1", gtin)
+		if err != nil {
+			return err
+		}
+
+		return insertAuditEntry(ctx, tx, supplement.NewAuditEntry(ctx, supplement.OperationRestore, before, &restored))
+	})
+}
+
+// Purge deletes the tombstones, whose ingredients, allergens and
+// micronutrients cascade, recording the last state of each.
+func (r *SQLiteSupplementRepository) Purge(ctx context.Context, deletedBefore time.Time) (int, error) {
+	purged := 0
+	err := r.inTx(ctx, func(tx *sql.Tx) error {
+		rows, err := tx.QueryContext(
+			ctx,
+			"SELECT "+selectColumns+" FROM "+r.tableName+" WHERE deleted_at < ?1 ORDER BY gtin",
+			deletedBefore.UTC().Format(deletedAtLayout),
+		)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		var tombstones []supplement.Supplement
+		var ids []int64
+		for rows.Next() {
+			id, s, err := scanSupplement(rows)
+			if err != nil {
+				return err
+			}
+			ids = append(ids, id)
+			tombstones = append(tombstones, s)
+		}
+		if err := rows.Err(); err != nil {
+			return err
+		}
+		rows.Close()
+
+		if err := loadComposition(ctx, tx, ids, tombstones); err != nil {
+			return err
+		}
+
+		for i := range tombstones {
+			if _, err := tx.ExecContext(ctx, "DELETE FROM "+r.tableName+" WHERE id = ?1", ids[i]); err != nil {
+				return err
+			}
+			if err := insertAuditEntry(ctx, tx, supplement.NewAuditEntry(ctx, supplement.OperationPurge, &tombstones[i], nil)); err != nil {
+				return err
+			}
+		}
+
+		purged = len(tombstones)
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return purged, nil
+}
+
+func (r *SQLiteSupplementRepository) History(ctx context.Context, gtin string) ([]supplement.AuditEntry, error) {
+	rows, err := r.conn().QueryContext(
+		ctx,
+		"SELECT gtin, version, operation, actor, at, changes FROM supplement_audit_log WHERE gtin = ?1 ORDER BY id",
+		gtin,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	entries := []supplement.AuditEntry{}
+	for rows.Next() {
+		var entry supplement.AuditEntry
+		var at, changes string
+		if err := rows.Scan(&entry.Gtin, &entry.Version, &entry.Operation, &entry.Actor, &at, &changes); err != nil {
+			return nil, err
+		}
+		if entry.At, err = time.Parse(time.RFC3339Nano, at); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal([]byte(changes), &entry.Changes); err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry)
+	}
+
+	return entries, rows.Err()
+}
+
+// insertAuditEntry stores entry with its timestamp as RFC 3339 text and its
+// changes as JSON text, the closest SQLite has to timestamptz and jsonb.
+func insertAuditEntry(ctx context.Context, db querier, entry supplement.AuditEntry) error {
+	changes, err := json.Marshal(entry.Changes)
+	if err != nil {
+		return err
+	}
+
+	_, err = db.ExecContext(
+		ctx,
+		"INSERT INTO supplement_audit_log (gtin, version, operation, actor, at, changes) VALUES (?1, ?2, ?3, ?4, ?5, ?6)",
+		entry.Gtin, entry.Version, string(entry.Operation), entry.Actor, entry.At.Format(time.RFC3339Nano), string(changes),
+	)
+	return err
+}
+
+// exportBatchSize is how many supplements Export reads at a time.
+const exportBatchSize = 500
+
+// Export reads the supplements a page at a time, each after the last one of
+// the previous page, rather than keeping a statement open while fn runs.
+func (r *SQLiteSupplementRepository) Export(ctx context.Context, query supplement.ListQuery, fn func(supplement.Supplement) error) error {
+	query.Limit = exportBatchSize
+	for {
+		page, err := r.ListAll(ctx, query)
+		if err != nil {
+			return err
+		}
+
+		for _, s := range page {
+			if err := fn(s); err != nil {
+				return err
+			}
+		}
+
+		if len(page) < exportBatchSize {
+			return nil
+		}
+
+		last := page[len(page)-1]
+		query.After = &supplement.Keyset{Value: last.SortValue(query.SortBy), Gtin: last.Gtin}
+	}
+}
+
+// ListAll mirrors the Postgres query. SQLite compares text with the BINARY
+// collation and its lower() only folds ASCII letters.
+func (r *SQLiteSupplementRepository) ListAll(ctx context.Context, query supplement.ListQuery) ([]supplement.Supplement, error) {
+	var conditions []string
+	var args []any
+
+	if !query.IncludeDeleted {
+		conditions = append(conditions, "deleted_at IS NULL")
+	}
+
+	if query.Brand != "" {
+		args = append(args, query.Brand)
+		conditions = append(conditions, fmt.Sprintf("lower(brand) = lower(?%d)", len(args)))
+	}
+
+	if query.Flavor != "" {
+		args = append(args, query.Flavor)
+		conditions = append(conditions, fmt.Sprintf("lower(flavor) = lower(?%d)", len(args)))
+	}
+
+	if query.Category != "" {
+		args = append(args, string(query.Category))
+		conditions = append(conditions, fmt.Sprintf("category = ?%d", len(args)))
+	}
+
+	if len(query.ExcludeAllergens) > 0 {
+		placeholders := make([]string, len(query.ExcludeAllergens))
+		for i, a := range query.ExcludeAllergens {
+			args = append(args, string(a))
+			placeholders[i] = fmt.Sprintf("?%d", len(args))
+		}
+		conditions = append(conditions, fmt.Sprintf(
+			"NOT EXISTS (SELECT 1 FROM supplement_allergens a WHERE a.supplement_id = %s.id AND a.allergen IN (%s))",
+			r.tableName, strings.Join(placeholders, ", "),
+		))
+	}
+
+	for _, nr := range query.NutrientRanges {
+		column, ok := sortColumns[supplement.SortField(nr.Nutrient)]
+		if !ok {
+			return nil, fmt.Errorf("unknown nutrient %q", nr.Nutrient)
+		}
+
+		if nr.Min != nil {
+			args = append(args, *nr.Min)
+			conditions = append(conditions, fmt.Sprintf("%s >= ?%d", column, len(args)))
+		}
+
+		if nr.Max != nil {
+			args = append(args, *nr.Max)
+			conditions = append(conditions, fmt.Sprintf("%s <= ?%d", column, len(args)))
+		}
+	}
+
+	column, ok := sortColumns[query.SortBy]
+	if !ok {
+		return nil, fmt.Errorf("unknown sort field %q", query.SortBy)
+	}
+
+	direction, comparison := "ASC", ">"
+	if query.SortDirection == supplement.Descending {
+		direction, comparison = "DESC", "<"
+	}
+
+	orderBy := "gtin " + direction
+	if column != "gtin" {
+		orderBy = column + " " + direction + ", " + orderBy
+	}
+
+	if query.After != nil {
+		if column == "gtin" {
+			args = append(args, query.After.Gtin)
+			conditions = append(conditions, fmt.Sprintf("gtin %s ?%d", comparison, len(args)))
+		} else {
+			args = append(args, query.After.Value, query.After.Gtin)
+			conditions = append(conditions, fmt.Sprintf("(%s, gtin) %s (?%d, ?%d)", column, comparison, len(args)-1, len(args)))
+		}
+	}
+
+	sql := "SELECT " + selectColumns + " FROM " + r.tableName
+	if len(conditions) > 0 {
+		sql += " WHERE " + strings.Join(conditions, " AND ")
+	}
+	args = append(args, query.Limit)
+	sql += fmt.Sprintf(" ORDER BY %s LIMIT ?%d", orderBy, len(args))
+
+	return r.list(ctx, sql, args...)
+}
+
+func init() {
+	moderncsqlite.MustRegisterDeterministicScalarFunction("supplement_search_rank", 2, func(_ *moderncsqlite.FunctionContext, args []driver.Value) (driver.Value, error) {
+		text, _ := args[0].(string)
+		search, _ := args[1].(string)
+		return supplement.SearchRank(text, supplement.SearchTerms(search)), nil
+	})
+}
+
+// Search ranks every supplement with supplement.SearchRank, which SQLite
+// knows as supplement_search_rank, as it has neither trigrams nor accent
+// folding of its own.
+func (r *SQLiteSupplementRepository) Search(ctx context.Context, query supplement.SearchQuery) ([]supplement.Supplement, error) {
+	sql := "SELECT " + selectColumns + " FROM (" +
+		"SELECT " + selectColumns + ", supplement_search_rank(name || ' ' || brand || ' ' || flavor, ?1) AS search_rank " +
+		"FROM " + r.tableName + " WHERE deleted_at IS NULL" +
+		") WHERE search_rank > 0 ORDER BY search_rank DESC, gtin LIMIT ?2"
+
+	return r.list(ctx, sql, query.Text, query.Limit)
+}
+
+// list runs a statement selecting selectColumns and reads its supplements,
+// with their composition.
+func (r *SQLiteSupplementRepository) list(ctx context.Context, sql string, args ...any) ([]supplement.Supplement, error) {
+	rows, err := r.conn().QueryContext(ctx, sql, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	supplements := []supplement.Supplement{}
+	var ids []int64
+	for rows.Next() {
+		id, s, err := scanSupplement(rows)
+		if err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+		supplements = append(supplements, s)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	rows.Close()
+
+	if err := loadComposition(ctx, r.conn(), ids, supplements); err != nil {
+		return nil, err
+	}
+
+	return supplements, nil
+}
+
+// scanSupplement scans a row of selectColumns, returning its ID apart.
+func scanSupplement(row interface{ Scan(dest ...any) error }) (int64, supplement.Supplement, error) {
+	var id int64
+	var s supplement.Supplement
+	var category sql.NullString
+	var servingSize sql.NullFloat64
+	var servingUnit sql.NullString
+	var servingsPerPackage sql.NullInt64
+	var deletedAt sql.NullString
+	var carbohydrates, electrolytes, maltodextrose, fructose, caffeine, sodium, protein float64
+
+	err := row.Scan(
+		&id, &s.Gtin, &s.Name, &s.Brand, &s.Flavor, &category,
+		&servingSize, &servingUnit, &servingsPerPackage,
+		&carbohydrates, &electrolytes, &maltodextrose, &fructose, &caffeine, &sodium, &protein,
+		&deletedAt, &s.Version,
+	)
+	if err != nil {
+		return 0, supplement.Supplement{}, err
+	}
+
+	s.Category = supplement.Category(category.String)
+	s.Carbohydrates = supplement.Carbohydrates.Quantity(carbohydrates)
+	s.Electrolytes = supplement.Electrolytes.Quantity(electrolytes)
+	s.Maltodextrose = supplement.Maltodextrose.Quantity(maltodextrose)
+	s.Fructose = supplement.Fructose.Quantity(fructose)
+	s.Caffeine = supplement.Caffeine.Quantity(caffeine)
+	s.Sodium = supplement.Sodium.Quantity(sodium)
+	s.Protein = supplement.Protein.Quantity(protein)
+
+	if servingSize.Valid && servingUnit.Valid && servingsPerPackage.Valid {
+		s.Serving = &supplement.Serving{
+			Size:               supplement.Quantity{Amount: servingSize.Float64, Unit: supplement.Unit(servingUnit.String)},
+			ServingsPerPackage: int(servingsPerPackage.Int64),
+		}
+	}
+
+	if deletedAt.Valid {
+		at, err := time.Parse(deletedAtLayout, deletedAt.String)
+		if err != nil {
+			return 0, supplement.Supplement{}, err
+		}
+		s.DeletedAt = &at
+	}
+
+	return id, s, nil
+}
+
+const (
+	presenceContains   = "contains"
+	presenceMayContain = "may-contain"
+)
+
+// querier is what both the database and a transaction can run statements
+// with.
+type querier interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+// conn returns what the repository runs its statements on.
+func (r *SQLiteSupplementRepository) conn() querier {
+	if r.tx != nil {
+		return r.tx
+	}
+	return r.db
+}
+
+// inTx runs fn in a transaction, committing it if fn succeeds. Within the
+// transaction of InTransaction, it runs fn in a savepoint instead.
+func (r *SQLiteSupplementRepository) inTx(ctx context.Context, fn func(tx *sql.Tx) error) error {
+	if r.tx != nil {
+		if _, err := r.tx.ExecContext(ctx, "SAVEPOINT nested"); err != nil {
+			return err
+		}
+
+		if err := fn(r.tx); err != nil {
+			r.tx.ExecContext(ctx, "ROLLBACK TO nested")
+			r.tx.ExecContext(ctx, "RELEASE nested")
+			return err
+		}
+
+		_, err := r.tx.ExecContext(ctx, "RELEASE nested")
+		return err
+	}
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	if err := fn(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// insertComposition stores the ingredients, allergens and micronutrients of s
+// for the Supplements row id.
+func insertComposition(ctx context.Context, db querier, id int64, s supplement.Supplement) error {
+	for i, name := range s.Ingredients {
+		_, err := db.ExecContext(ctx, "INSERT INTO supplement_ingredients (supplement_id, position, name) VALUES (?1, ?2, ?3)", id, i, name)
+		if err != nil {
+			return err
+		}
+	}
+
+	presences := []struct {
+		allergens []supplement.Allergen
+		presence  string
+	}{
+		{s.Allergens.Contains, presenceContains},
+		{s.Allergens.MayContain, presenceMayContain},
+	}
+	for _, p := range presences {
+		for _, a := range p.allergens {
+			_, err := db.ExecContext(ctx, "INSERT INTO supplement_allergens (supplement_id, allergen, presence) VALUES (?1, ?2, ?3)", id, string(a), p.presence)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	for m, q := range s.Micronutrients {
+		_, err := db.ExecContext(ctx, "INSERT INTO supplement_micronutrients (supplement_id, code, amount) VALUES (?1, ?2, ?3)", id, string(m), q.Amount)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// loadComposition fills in the ingredients, allergens and micronutrients of
+// supplements, whose row IDs are ids, with one query each.
+func loadComposition(ctx context.Context, db querier, ids []int64, supplements []supplement.Supplement) error {
+	if len(ids) == 0 {
+		return nil
+	}
+
+	byID := make(map[int64]*supplement.Supplement, len(ids))
+	placeholders := make([]string, len(ids))
+	args := make([]any, len(ids))
+	for i, id := range ids {
+		byID[id] = &supplements[i]
+		placeholders[i] = fmt.Sprintf("?%d", i+1)
+		args[i] = id
+	}
+	in := strings.Join(placeholders, ", ")
+
+	rows, err := db.QueryContext(
+		ctx,
+		"SELECT supplement_id, name FROM supplement_ingredients WHERE supplement_id IN ("+in+") ORDER BY supplement_id, position",
+		args...,
+	)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id int64
+		var name string
+		if err := rows.Scan(&id, &name); err != nil {
+			return err
+		}
+		s := byID[id]
+		s.Ingredients = append(s.Ingredients, name)
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	rows.Close()
+
+	rows, err = db.QueryContext(
+		ctx,
+		"SELECT supplement_id, allergen, presence FROM supplement_allergens WHERE supplement_id IN ("+in+") ORDER BY supplement_id, allergen",
+		args...,
+	)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id int64
+		var allergen, presence string
+		if err := rows.Scan(&id, &allergen, &presence); err != nil {
+			return err
+		}
+		s := byID[id]
+		if presence == presenceContains {
+			s.Allergens.Contains = append(s.Allergens.Contains, supplement.Allergen(allergen))
+		} else {
+			s.Allergens.MayContain = append(s.Allergens.MayContain, supplement.Allergen(allergen))
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	rows.Close()
+
+	rows, err = db.QueryContext(
+		ctx,
+		"SELECT supplement_id, code, amount FROM supplement_micronutrients WHERE supplement_id IN ("+in+")",
+		args...,
+	)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id int64
+		var code string
+		var amount float64
+		if err := rows.Scan(&id, &code, &amount); err != nil {
+			return err
+		}
+		s := byID[id]
+		if s.Micronutrients == nil {
+			s.Micronutrients = supplement.Panel{}
+		}
+		m := supplement.Micronutrient(code)
+		s.Micronutrients[m] = supplement.Quantity{Amount: amount, Unit: m.Unit()}
+	}
+
+	return rows.Err()
+}
+
+// categoryColumn returns the category value of s, nil when unknown.
+func categoryColumn(s supplement.Supplement) any {
+	if s.Category == "" {
+		return nil
+	}
+	return string(s.Category)
+}
+
+// servingColumns returns the serving_size, serving_unit and
+// servings_per_package values of s, all nil when the serving is unknown.
+func servingColumns(s supplement.Supplement) (size, unit, perPackage any) {
+	if s.Serving == nil {
+		return nil, nil, nil
+	}
+	return s.Serving.Size.Amount, string(s.Serving.Size.Unit), s.Serving.ServingsPerPackage
+}
+
+// alreadyExists reports an insert clashing with a GTIN stored concurrently,
+// after the check that it was free, as ErrAlreadyExists.
+func alreadyExists(err error) error {
+	var sqliteErr *moderncsqlite.Error
+	if errors.As(err, &sqliteErr) && sqliteErr.Code() == sqlite3.SQLITE_CONSTRAINT_UNIQUE {
+		return supplement.ErrAlreadyExists
+	}
+	return err
+}
+
+// checkVersion reports a conditional write that matched no row, because the
+// supplement was modified or deleted since it was read.
+func checkVersion(result sql.Result, err error) error {
+	if err != nil {
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if affected == 0 {
+		return supplement.ErrPreconditionFailed
+	}
+	return nil
+}
+
+var sortColumns = map[supplement.SortField]string{
+	supplement.SortByGtin:                          "gtin",
+	supplement.SortByName:                          "name",
+	supplement.SortByBrand:                         "brand",
+	supplement.SortByFlavor:                        "flavor",
+	supplement.SortField(supplement.Carbohydrates): "carbohydrates",
+	supplement.SortField(supplement.Electrolytes):  "electrolytes",
+	supplement.SortField(supplement.Maltodextrose): "maltodextrose",
+	supplement.SortField(supplement.Fructose):      "fructose",
+	supplement.SortField(supplement.Caffeine):      "caffeine",
+	supplement.SortField(supplement.Sodium):        "sodium",
+	supplement.SortField(supplement.Protein):       "protein",
+}
@@ -0,0 +1,64 @@
+package sqlite_test
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/marioromandono/supplementapp/internal/supplement"
+	"github.com/marioromandono/supplementapp/internal/supplement/persistence/repotest"
+	"github.com/marioromandono/supplementapp/internal/supplement/persistence/sqlite"
+)
+
+func TestSQLiteSupplementRepository(t *testing.T) {
+	repotest.Run(t, func(t *testing.T) supplement.SupplementRepository {
+		db, err := sqlite.Open(context.Background(), filepath.Join(t.TempDir(), "supplementapp.db"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { db.Close() })
+
+		return sqlite.NewSupplementRepository(db)
+	})
+}
+
+func TestSchemaConstraints(t *testing.T) {
+	ctx := context.Background()
+	db, err := sqlite.Open(ctx, filepath.Join(t.TempDir(), "supplementapp.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	tests := []struct {
+		name  string
+		gtin  any
+		title any
+		value any
+	}{
+		{name: "null gtin", gtin: nil, title: "name", value: 1.0},
+		{name: "short gtin", gtin: "1234567890128", title: "name", value: 1.0},
+		{name: "non-digit gtin", gtin: "0123456789012A", title: "name", value: 1.0},
+		{name: "null name", gtin: "01234567890128", title: nil, value: 1.0},
+		{name: "empty name", gtin: "01234567890128", title: "", value: 1.0},
+		{name: "null nutrient", gtin: "01234567890128", title: "name", value: nil},
+		{name: "negative nutrient", gtin: "01234567890128", title: "name", value: -1.0},
+	}
+	insert := func(gtin, name, value any) error {
+		_, err := db.ExecContext(ctx,
+			"INSERT INTO Supplements (gtin, name, brand, flavor, carbohydrates, electrolytes, maltodextrose, fructose, caffeine, sodium, protein) "+
+				"VALUES (?1, ?2, 'brand', 'flavor', ?3, 0, 0, 0, 0, 0, 0)",
+			gtin, name, value,
+		)
+		return err
+	}
+
+	if err := insert("04006381333931", "name", 1.0); err != nil {
+		t.Fatalf("INSERT of a valid row error = %v, want nil", err)
+	}
+	for _, tt := range tests {
+		if err := insert(tt.gtin, tt.title, tt.value); err == nil {
+			t.Errorf("%s: INSERT error = nil, want a constraint violation", tt.name)
+		}
+	}
+}
@@ -0,0 +1,268 @@
+package supplement
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+const (
+	DefaultPageSize = 20
+	MaxPageSize     = 100
+)
+
+type Nutrient string
+
+const (
+	Carbohydrates Nutrient = "carbohydrates"
+	Electrolytes  Nutrient = "electrolytes"
+	Maltodextrose Nutrient = "maltodextrose"
+	Fructose      Nutrient = "fructose"
+	Caffeine      Nutrient = "caffeine"
+	Sodium        Nutrient = "sodium"
+	Protein       Nutrient = "protein"
+)
+
+var Nutrients = []Nutrient{Carbohydrates, Electrolytes, Maltodextrose, Fructose, Caffeine, Sodium, Protein}
+
+type SortField string
+
+const (
+	SortByGtin   SortField = "gtin"
+	SortByName   SortField = "name"
+	SortByBrand  SortField = "brand"
+	SortByFlavor SortField = "flavor"
+)
+
+type SortDirection string
+
+const (
+	Ascending  SortDirection = "asc"
+	Descending SortDirection = "desc"
+)
+
+type NutrientRange struct {
+	Nutrient Nutrient
+	Min      *float64
+	Max      *float64
+}
+
+// ListQuery describes a page of supplements. Nutrients can also be used as
+// sort fields, e.g. SortField(Carbohydrates). Cursor is the opaque token
+// returned as Page.Next; the service decodes it into After before the query
+// reaches the repository.
+type ListQuery struct {
+	Limit          int
+	Cursor         string
+	After          *Keyset
+	SortBy         SortField
+	SortDirection  SortDirection
+	Brand          string
+	Flavor         string
+	Category       Category
+	NutrientRanges []NutrientRange
+	// ExcludeAllergens leaves out supplements that contain or may contain
+	// any of the allergens.
+	ExcludeAllergens []Allergen
+	// IncludeDeleted also lists supplements that are deleted but not purged.
+	IncludeDeleted bool
+}
+
+// ParseListQuery builds a ListQuery from URL query parameters such as
+// ?limit=10&cursor=...&sort=carbohydrates&order=desc&brand=x&category=gel&minCaffeine=50&excludeAllergens=milk,soy&includeDeleted=true.
+func ParseListQuery(values url.Values) (ListQuery, error) {
+	var query ListQuery
+	var err error
+
+	if v := values.Get("limit"); v != "" {
+		if query.Limit, err = strconv.Atoi(v); err != nil {
+			return ListQuery{}, newValidationError(ErrInvalidQuery, []Violation{{
+				Field:   "limit",
+				Rule:    RuleType,
+				Value:   v,
+				Message: fmt.Sprintf("limit %q is not an integer", v),
+			}})
+		}
+	}
+
+	query.Cursor = values.Get("cursor")
+	query.SortBy = SortField(values.Get("sort"))
+	query.SortDirection = SortDirection(values.Get("order"))
+	query.Brand = values.Get("brand")
+	query.Flavor = values.Get("flavor")
+	query.Category = Category(values.Get("category"))
+
+	if v := values.Get("includeDeleted"); v != "" {
+		if query.IncludeDeleted, err = strconv.ParseBool(v); err != nil {
+			return ListQuery{}, newValidationError(ErrInvalidQuery, []Violation{{
+				Field:   "includeDeleted",
+				Rule:    RuleType,
+				Value:   v,
+				Message: fmt.Sprintf("includeDeleted %q is not a boolean", v),
+			}})
+		}
+	}
+
+	if v := values.Get("excludeAllergens"); v != "" {
+		for _, a := range strings.Split(v, ",") {
+			query.ExcludeAllergens = append(query.ExcludeAllergens, Allergen(strings.TrimSpace(a)))
+		}
+	}
+
+	for _, n := range Nutrients {
+		r := NutrientRange{Nutrient: n}
+		if r.Min, err = parseBound(values, "min"+capitalize(string(n))); err != nil {
+			return ListQuery{}, err
+		}
+		if r.Max, err = parseBound(values, "max"+capitalize(string(n))); err != nil {
+			return ListQuery{}, err
+		}
+		if r.Min != nil || r.Max != nil {
+			query.NutrientRanges = append(query.NutrientRanges, r)
+		}
+	}
+
+	return query, nil
+}
+
+func parseBound(values url.Values, key string) (*float64, error) {
+	v := values.Get(key)
+	if v == "" {
+		return nil, nil
+	}
+
+	f, err := strconv.ParseFloat(v, 64)
+	if err != nil {
+		return nil, newValidationError(ErrInvalidQuery, []Violation{{
+			Field:   key,
+			Rule:    RuleType,
+			Value:   v,
+			Message: fmt.Sprintf("%s %q is not a number", key, v),
+		}})
+	}
+
+	return &f, nil
+}
+
+func capitalize(s string) string {
+	if s == "" {
+		return s
+	}
+	return strings.ToUpper(s[:1]) + s[1:]
+}
+
+func (q *ListQuery) withDefaults() ListQuery {
+	if q.Limit == 0 {
+		q.Limit = DefaultPageSize
+	}
+
+	if q.SortBy == "" {
+		q.SortBy = SortByGtin
+	}
+
+	if q.SortDirection == "" {
+		q.SortDirection = Ascending
+	}
+
+	return *q
+}
+
+func (q *ListQuery) validate() error {
+	var violations []Violation
+
+	if q.Limit < 1 || q.Limit > MaxPageSize {
+		violations = append(violations, Violation{
+			Field:   "limit",
+			Rule:    RuleRange,
+			Value:   q.Limit,
+			Message: fmt.Sprintf("limit %d is invalid, it must be between 1 and %d", q.Limit, MaxPageSize),
+		})
+	}
+
+	if !q.SortBy.valid() {
+		violations = append(violations, Violation{
+			Field:   "sort",
+			Rule:    RuleOneOf,
+			Value:   q.SortBy,
+			Message: fmt.Sprintf("sort %q is invalid, it must be one of %s", q.SortBy, strings.Join(sortFieldNames(), ", ")),
+		})
+	}
+
+	if q.SortDirection != Ascending && q.SortDirection != Descending {
+		violations = append(violations, Violation{
+			Field:   "order",
+			Rule:    RuleOneOf,
+			Value:   q.SortDirection,
+			Message: fmt.Sprintf("order %q is invalid, it must be %q or %q", q.SortDirection, Ascending, Descending),
+		})
+	}
+
+	if q.Category != "" && !q.Category.valid() {
+		violations = append(violations, Violation{
+			Field:   "category",
+			Rule:    RuleOneOf,
+			Value:   q.Category,
+			Message: fmt.Sprintf("category %q is invalid, it must be one of %s", q.Category, categoryNames()),
+		})
+	}
+
+	for _, a := range q.ExcludeAllergens {
+		if !a.valid() {
+			violations = append(violations, Violation{
+				Field:   "excludeAllergens",
+				Rule:    RuleOneOf,
+				Value:   a,
+				Message: fmt.Sprintf("allergen %q is invalid, it must be one of %s", a, allergenNames()),
+			})
+		}
+	}
+
+	for _, r := range q.NutrientRanges {
+		if !r.Nutrient.valid() {
+			violations = append(violations, Violation{
+				Field:   string(r.Nutrient),
+				Rule:    RuleOneOf,
+				Value:   r.Nutrient,
+				Message: fmt.Sprintf("nutrient %q is invalid", r.Nutrient),
+			})
+			continue
+		}
+
+		if r.Min != nil && r.Max != nil && *r.Min > *r.Max {
+			violations = append(violations, Violation{
+				Field:   string(r.Nutrient),
+				Rule:    RuleRange,
+				Value:   []float64{*r.Min, *r.Max},
+				Message: fmt.Sprintf("%s range [%f, %f] is invalid, minimum must not exceed maximum", r.Nutrient, *r.Min, *r.Max),
+			})
+		}
+	}
+
+	return newValidationError(ErrInvalidQuery, violations)
+}
+
+func (n Nutrient) valid() bool {
+	for _, other := range Nutrients {
+		if n == other {
+			return true
+		}
+	}
+	return false
+}
+
+func (f SortField) valid() bool {
+	switch f {
+	case SortByGtin, SortByName, SortByBrand, SortByFlavor:
+		return true
+	}
+	return Nutrient(f).valid()
+}
+
+func sortFieldNames() []string {
+	names := []string{string(SortByGtin), string(SortByName), string(SortByBrand), string(SortByFlavor)}
+	for _, n := range Nutrients {
+		names = append(names, string(n))
+	}
+	return names
+}
@@ -0,0 +1,103 @@
+package supplement_test
+
+import (
+	"errors"
+	"net/url"
+	"testing"
+
+	"github.com/marioromandono/supplementapp/internal/supplement"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestParseListQuery(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name    string
+		values  url.Values
+		want    supplement.ListQuery
+		wantErr error
+	}{
+		{
+			name:    "empty",
+			values:  url.Values{},
+			want:    supplement.ListQuery{},
+			wantErr: nil,
+		},
+		{
+			name: "pagination and sorting",
+			values: url.Values{
+				"limit":  {"10"},
+				"cursor": {"abc"},
+				"sort":   {"carbohydrates"},
+				"order":  {"desc"},
+			},
+			want: supplement.ListQuery{
+				Limit:         10,
+				Cursor:        "abc",
+				SortBy:        supplement.SortField(supplement.Carbohydrates),
+				SortDirection: supplement.Descending,
+			},
+			wantErr: nil,
+		},
+		{
+			name: "filters",
+			values: url.Values{
+				"brand":            {"brand"},
+				"flavor":           {"flavor"},
+				"category":         {"gel"},
+				"minCaffeine":      {"50"},
+				"maxSodium":        {"200.5"},
+				"minFructose":      {"1"},
+				"maxFructose":      {"2"},
+				"excludeAllergens": {"milk, soy"},
+				"includeDeleted":   {"true"},
+				"unrelatedParam":   {"ignored"},
+			},
+			want: supplement.ListQuery{
+				Brand:            "brand",
+				Flavor:           "flavor",
+				Category:         supplement.CategoryGel,
+				ExcludeAllergens: []supplement.Allergen{supplement.AllergenMilk, supplement.AllergenSoy},
+				IncludeDeleted:   true,
+				NutrientRanges: []supplement.NutrientRange{
+					{Nutrient: supplement.Fructose, Min: Ptr[float64](1), Max: Ptr[float64](2)},
+					{Nutrient: supplement.Caffeine, Min: Ptr[float64](50)},
+					{Nutrient: supplement.Sodium, Max: Ptr[float64](200.5)},
+				},
+			},
+			wantErr: nil,
+		},
+		{
+			name:    "invalid limit",
+			values:  url.Values{"limit": {"ten"}},
+			want:    supplement.ListQuery{},
+			wantErr: supplement.ErrInvalidQuery,
+		},
+		{
+			name:    "invalid nutrient bound",
+			values:  url.Values{"minProtein": {"a lot"}},
+			want:    supplement.ListQuery{},
+			wantErr: supplement.ErrInvalidQuery,
+		},
+		{
+			name:    "invalid includeDeleted",
+			values:  url.Values{"includeDeleted": {"maybe"}},
+			want:    supplement.ListQuery{},
+			wantErr: supplement.ErrInvalidQuery,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			got, err := supplement.ParseListQuery(tt.values)
+
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("ParseListQuery() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if diff := cmp.Diff(got, tt.want); diff != "" {
+				t.Errorf("ParseListQuery() (-got +want):\n%s", diff)
+			}
+		})
+	}
+}
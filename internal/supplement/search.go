@@ -0,0 +1,199 @@
+package supplement
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/runes"
+	"golang.org/x/text/transform"
+	"golang.org/x/text/unicode/norm"
+)
+
+// MaxSearchLength is the most characters a search can have.
+const MaxSearchLength = 200
+
+// SearchThreshold is how similar a word has to be to a search term for the
+// term to match it, as in Postgres' pg_trgm.word_similarity_threshold.
+const SearchThreshold = 0.6
+
+// SearchQuery looks up supplements by words of their name, brand and flavor,
+// such as "maurten 160".
+type SearchQuery struct {
+	Text  string
+	Limit int
+}
+
+// ParseSearchQuery builds a SearchQuery from URL query parameters such as
+// ?q=sis+beta+fuel&limit=10.
+func ParseSearchQuery(values url.Values) (SearchQuery, error) {
+	query := SearchQuery{Text: values.Get("q")}
+
+	if v := values.Get("limit"); v != "" {
+		var err error
+		if query.Limit, err = strconv.Atoi(v); err != nil {
+			return SearchQuery{}, newValidationError(ErrInvalidQuery, []Violation{{
+				Field:   "limit",
+				Rule:    RuleType,
+				Value:   v,
+				Message: fmt.Sprintf("limit %q is not an integer", v),
+			}})
+		}
+	}
+
+	return query, nil
+}
+
+func (q *SearchQuery) withDefaults() SearchQuery {
+	if q.Limit == 0 {
+		q.Limit = DefaultPageSize
+	}
+
+	return *q
+}
+
+func (q *SearchQuery) validate() error {
+	var violations []Violation
+
+	if len(SearchTerms(q.Text)) == 0 {
+		violations = append(violations, Violation{
+			Field:   "q",
+			Rule:    RuleRequired,
+			Value:   q.Text,
+			Message: fmt.Sprintf("q %q is invalid, it must have a word to search for", q.Text),
+		})
+	}
+
+	if n := len([]rune(q.Text)); n > MaxSearchLength {
+		violations = append(violations, Violation{
+			Field:   "q",
+			Rule:    RuleMax,
+			Value:   n,
+			Message: fmt.Sprintf("q is invalid, it must have at most %d characters, not %d", MaxSearchLength, n),
+		})
+	}
+
+	if q.Limit < 1 || q.Limit > MaxPageSize {
+		violations = append(violations, Violation{
+			Field:   "limit",
+			Rule:    RuleRange,
+			Value:   q.Limit,
+			Message: fmt.Sprintf("limit %d is invalid, it must be between 1 and %d", q.Limit, MaxPageSize),
+		})
+	}
+
+	return newValidationError(ErrInvalidQuery, violations)
+}
+
+// Search returns the supplements matching query, most relevant first.
+func (service *SupplementService) Search(ctx context.Context, query SearchQuery) ([]Supplement, error) {
+	query = query.withDefaults()
+
+	if err := query.validate(); err != nil {
+		return nil, err
+	}
+
+	supplements, err := service.repository.Search(ctx, query)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if supplements == nil {
+		supplements = []Supplement{}
+	}
+
+	return supplements, nil
+}
+
+// SearchText is what searches match a supplement by.
+func (s Supplement) SearchText() string {
+	return s.Name + " " + s.Brand + " " + s.Flavor
+}
+
+// fold lowercases s and strips its accents, so that "Café" reads "cafe" like
+// Postgres' lower(unaccent(...)).
+func fold(s string) string {
+	folded, _, err := transform.String(transform.Chain(norm.NFD, runes.Remove(runes.In(unicode.Mn)), norm.NFC), s)
+	if err != nil {
+		folded = s
+	}
+	return strings.ToLower(folded)
+}
+
+// SearchTerms returns the folded words of a search, without punctuation.
+func SearchTerms(text string) []string {
+	return strings.FieldsFunc(fold(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// SearchRank scores how well text matches every term, from 0 when some term
+// does not, to 1 when every term is a whole word of text. A term matches a
+// word it is a prefix of, or one at least SearchThreshold similar to it, so
+// typos are tolerated. It ranks like the Postgres repository, for storages
+// that search in Go.
+func SearchRank(text string, terms []string) float64 {
+	if len(terms) == 0 {
+		return 0
+	}
+
+	words := SearchTerms(text)
+	rank := 0.0
+	for _, term := range terms {
+		best := 0.0
+		for _, word := range words {
+			if word == term {
+				best = 1
+				break
+			}
+
+			similarity := wordSimilarity(term, word)
+			if strings.HasPrefix(word, term) || similarity >= SearchThreshold {
+				best = max(best, similarity)
+			}
+		}
+
+		if best == 0 {
+			return 0
+		}
+		rank += best
+	}
+
+	return rank / float64(len(terms))
+}
+
+// wordSimilarity is the share of the trigrams of term that word has, as
+// pg_trgm's word_similarity computes it for a single word.
+func wordSimilarity(term, word string) float64 {
+	termTrigrams := trigrams(term)
+	wordTrigrams := trigrams(word)
+
+	shared := 0
+	for _, t := range termTrigrams {
+		if slices.Contains(wordTrigrams, t) {
+			shared++
+		}
+	}
+
+	return float64(shared) / float64(len(termTrigrams))
+}
+
+// trigrams returns the distinct trigrams of word padded like pg_trgm does,
+// with two spaces before and one after.
+func trigrams(word string) []string {
+	padded := []rune("  " + word + " ")
+
+	var result []string
+	for i := range len(padded) - 2 {
+		t := string(padded[i : i+3])
+		if !slices.Contains(result, t) {
+			result = append(result, t)
+		}
+	}
+	return result
+}
@@ -0,0 +1,125 @@
+package supplement_test
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/marioromandono/supplementapp/internal/supplement"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestParseSearchQuery(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name    string
+		values  url.Values
+		want    supplement.SearchQuery
+		wantErr error
+	}{
+		{name: "text", values: url.Values{"q": {"sis beta fuel"}}, want: supplement.SearchQuery{Text: "sis beta fuel"}},
+		{name: "limit", values: url.Values{"q": {"gel"}, "limit": {"5"}}, want: supplement.SearchQuery{Text: "gel", Limit: 5}},
+		{name: "invalid limit", values: url.Values{"q": {"gel"}, "limit": {"five"}}, wantErr: supplement.ErrInvalidQuery},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			got, err := supplement.ParseSearchQuery(tt.values)
+
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("ParseSearchQuery() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("ParseSearchQuery() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSearchTerms(t *testing.T) {
+	t.Parallel()
+	got := supplement.SearchTerms("  Isóstar, Plátano-Maracuyá 160g! ")
+
+	if diff := cmp.Diff(got, []string{"isostar", "platano", "maracuya", "160g"}); diff != "" {
+		t.Errorf("SearchTerms() (-got +want):\n%s", diff)
+	}
+}
+
+func TestSearchRank(t *testing.T) {
+	t.Parallel()
+	text := "Gel 160 Maurten Café"
+	tests := []struct {
+		name   string
+		search string
+		want   func(rank float64) bool
+	}{
+		{name: "whole words", search: "maurten gel", want: func(rank float64) bool { return rank == 1 }},
+		{name: "prefix", search: "maur", want: func(rank float64) bool { return rank > 0 && rank < 1 }},
+		{name: "accents", search: "CAFÉ", want: func(rank float64) bool { return rank == 1 }},
+		{name: "typo", search: "maurtenn", want: func(rank float64) bool { return rank > 0 && rank < 1 }},
+		{name: "some term missing", search: "maurten 320", want: func(rank float64) bool { return rank == 0 }},
+		{name: "too different", search: "martin", want: func(rank float64) bool { return rank == 0 }},
+		{name: "no terms", search: "", want: func(rank float64) bool { return rank == 0 }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			got := supplement.SearchRank(text, supplement.SearchTerms(tt.search))
+
+			if !tt.want(got) {
+				t.Errorf("SearchRank(%q) = %f", tt.search, got)
+			}
+		})
+	}
+
+	if exact, prefix := supplement.SearchRank("Gel", []string{"gel"}), supplement.SearchRank("Gell", []string{"gel"}); exact <= prefix {
+		t.Errorf("SearchRank() of a whole word = %f, want more than a prefix's %f", exact, prefix)
+	}
+}
+
+func TestSupplementService_Search(t *testing.T) {
+	t.Parallel()
+	store := map[string]supplement.Supplement{
+		"01234567890128": {Gtin: "01234567890128", Name: "Gel 160", Brand: "Maurten", Flavor: "Neutral"},
+		"04006381333931": {Gtin: "04006381333931", Name: "Beta Fuel", Brand: "SiS", Flavor: "Naranja"},
+		"05901234123457": {Gtin: "05901234123457", Name: "Gel 100", Brand: "Maurten", Flavor: "Café"},
+	}
+	tests := []struct {
+		name    string
+		query   supplement.SearchQuery
+		want    []string
+		wantErr error
+	}{
+		{name: "default limit", query: supplement.SearchQuery{Text: "maurten"}, want: []string{"01234567890128", "05901234123457"}},
+		{name: "limit", query: supplement.SearchQuery{Text: "maurten", Limit: 1}, want: []string{"01234567890128"}},
+		{name: "no match", query: supplement.SearchQuery{Text: "isostar"}, want: []string{}},
+		{name: "no words", query: supplement.SearchQuery{Text: " - "}, wantErr: supplement.ErrInvalidQuery},
+		{name: "too long", query: supplement.SearchQuery{Text: strings.Repeat("a", supplement.MaxSearchLength+1)}, wantErr: supplement.ErrInvalidQuery},
+		{name: "invalid limit", query: supplement.SearchQuery{Text: "gel", Limit: supplement.MaxPageSize + 1}, wantErr: supplement.ErrInvalidQuery},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			service := supplement.NewSupplementService(&stubSupplementRepository{store: store})
+
+			got, err := service.Search(context.TODO(), tt.query)
+
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("SupplementService.Search() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			var gtins []string
+			if got != nil {
+				gtins = []string{}
+			}
+			for _, s := range got {
+				gtins = append(gtins, s.Gtin)
+			}
+			if diff := cmp.Diff(gtins, tt.want); diff != "" {
+				t.Errorf("SupplementService.Search() (-got +want):\n%s", diff)
+			}
+		})
+	}
+}
@@ -4,23 +4,79 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"time"
 )
 
 var (
 	ErrNotFound          = errors.New("supplement not found")
 	ErrAlreadyExists     = errors.New("supplement already exists")
 	ErrInvalidSupplement = errors.New("invalid supplement")
+	ErrInvalidQuery      = errors.New("invalid query")
+	ErrInvalidCursor     = errors.New("invalid cursor")
+	// ErrPreconditionFailed means the supplement changed since the version
+	// the caller based its modification on.
+	ErrPreconditionFailed = errors.New("supplement version does not match")
+	ErrInvalidPatch       = errors.New("invalid patch")
+	ErrPatchTestFailed    = errors.New("patch test failed")
 )
 
+// GtinError ties an error to the GTIN of the supplement it is about.
+type GtinError struct {
+	Gtin string
+	Err  error
+}
+
+func (e *GtinError) Error() string {
+	return e.Gtin + ": " + e.Err.Error()
+}
+
+func (e *GtinError) Unwrap() error {
+	return e.Err
+}
+
 type SupplementService struct {
 	repository SupplementRepository
+	cursors    cursorCodec
+}
+
+type Option func(*SupplementService)
+
+// WithCursorKey sets the key used to sign pagination cursors. Every instance
+// serving the same clients must share it; by default a random key is used,
+// which only suits a single process such as a test.
+func WithCursorKey(key []byte) Option {
+	return func(service *SupplementService) {
+		service.cursors.key = key
+	}
 }
 
-func NewSupplementService(repository SupplementRepository) *SupplementService {
-	return &SupplementService{repository: repository}
+func WithCursorTTL(ttl time.Duration) Option {
+	return func(service *SupplementService) {
+		service.cursors.ttl = ttl
+	}
+}
+
+func NewSupplementService(repository SupplementRepository, options ...Option) *SupplementService {
+	service := &SupplementService{repository: repository, cursors: newCursorCodec()}
+	for _, option := range options {
+		option(service)
+	}
+	return service
 }
 
+// Create stores a new supplement, checking that its GTIN is free and storing
+// it in one transaction.
 func (service *SupplementService) Create(ctx context.Context, supplement Supplement) error {
+	return service.inTransaction(ctx, func(tx *SupplementService) error {
+		return tx.create(ctx, supplement)
+	})
+}
+
+func (service *SupplementService) create(ctx context.Context, supplement Supplement) error {
+	if gtin, err := NormalizeGtin(supplement.Gtin); err == nil {
+		supplement.Gtin = gtin
+	}
+
 	existing, err := service.repository.FindByGtin(ctx, supplement.Gtin)
 
 	if err != nil {
@@ -28,65 +84,321 @@ func (service *SupplementService) Create(ctx context.Context, supplement Supplem
 	}
 
 	if existing != nil {
-		return fmt.Errorf("%s: %w", supplement.Gtin, ErrAlreadyExists)
+		return &GtinError{Gtin: supplement.Gtin, Err: ErrAlreadyExists}
 	}
 
 	if err := supplement.validate(); err != nil {
-		return fmt.Errorf("%w: %v", ErrInvalidSupplement, err)
+		return err
 	}
 
-	return service.repository.Create(ctx, supplement)
+	supplement.normalize()
+
+	return withGtin(supplement.Gtin, service.repository.Create(ctx, supplement))
 }
 
 func (service *SupplementService) FindByGtin(ctx context.Context, gtin string) (*Supplement, error) {
-	supplement, err := service.repository.FindByGtin(ctx, gtin)
+	return service.findExisting(ctx, gtin)
+}
+
+// Delete removes the supplement, leaving a tombstone that Restore can bring
+// back until it is purged. A non-zero version makes it conditional on the
+// supplement not having changed since then.
+func (service *SupplementService) Delete(ctx context.Context, gtin string, version int64) error {
+	return service.inTransaction(ctx, func(tx *SupplementService) error {
+		return tx.delete(ctx, gtin, version)
+	})
+}
+
+func (service *SupplementService) delete(ctx context.Context, gtin string, version int64) error {
+	supplement, err := service.findMatching(ctx, gtin, version)
 
 	if err != nil {
-		return nil, err
+		return err
 	}
 
-	if supplement == nil {
-		return nil, fmt.Errorf("%s: %w", gtin, ErrNotFound)
+	return withGtin(gtin, service.repository.Delete(ctx, *supplement))
+}
+
+// Update applies the non-nil fields of other. A non-zero version makes it
+// conditional on the supplement not having changed since then; either way a
+// concurrent modification between reading and writing is detected.
+func (service *SupplementService) Update(ctx context.Context, gtin string, other UpdatableSupplement, version int64) error {
+	return service.inTransaction(ctx, func(tx *SupplementService) error {
+		return tx.update(ctx, gtin, other, version)
+	})
+}
+
+func (service *SupplementService) update(ctx context.Context, gtin string, other UpdatableSupplement, version int64) error {
+	supplement, err := service.findMatching(ctx, gtin, version)
+
+	if err != nil {
+		return err
 	}
 
-	return supplement, nil
+	updated := supplement.update(other)
+
+	if err := updated.validate(); err != nil {
+		return err
+	}
+
+	updated.normalize()
+
+	return withGtin(gtin, service.repository.Update(ctx, updated))
+}
+
+// Patch applies a merge patch or JSON patch to the supplement. The GTIN cannot
+// be patched. A non-zero version makes it conditional like Update.
+func (service *SupplementService) Patch(ctx context.Context, gtin string, patch Patch, version int64) error {
+	return service.inTransaction(ctx, func(tx *SupplementService) error {
+		return tx.patch(ctx, gtin, patch, version)
+	})
 }
 
-func (service *SupplementService) Delete(ctx context.Context, gtin string) error {
-	supplement, err := service.repository.FindByGtin(ctx, gtin)
+func (service *SupplementService) patch(ctx context.Context, gtin string, patch Patch, version int64) error {
+	supplement, err := service.findMatching(ctx, gtin, version)
 
 	if err != nil {
 		return err
 	}
 
-	if supplement == nil {
-		return fmt.Errorf("%s: %w", gtin, ErrNotFound)
+	patched, err := supplement.patch(patch)
+
+	if err != nil {
+		return &GtinError{Gtin: gtin, Err: err}
+	}
+
+	if patched.Gtin != supplement.Gtin {
+		return newValidationError(ErrInvalidSupplement, []Violation{{
+			Field:   "gtin",
+			Rule:    RuleGtin,
+			Value:   patched.Gtin,
+			Message: fmt.Sprintf("gtin %q is invalid, it cannot be changed from %q", patched.Gtin, supplement.Gtin),
+		}})
+	}
+
+	if err := patched.validate(); err != nil {
+		return err
+	}
+
+	patched.normalize()
+
+	return withGtin(gtin, service.repository.Update(ctx, patched))
+}
+
+// Replace stores replacement as the whole new state of the supplement,
+// creating it if it does not exist yet. The GTIN may be left out of
+// replacement, but if present it must identify the same supplement as gtin.
+// A non-zero version makes it conditional like Update.
+func (service *SupplementService) Replace(ctx context.Context, gtin string, replacement Supplement, version int64) (created bool, err error) {
+	err = service.inTransaction(ctx, func(tx *SupplementService) error {
+		created, err = tx.replace(ctx, gtin, replacement, version)
+		return err
+	})
+	return created, err
+}
+
+func (service *SupplementService) replace(ctx context.Context, gtin string, replacement Supplement, version int64) (bool, error) {
+	if replacement.Gtin == "" {
+		replacement.Gtin = gtin
+	}
+
+	if err := replacement.validate(); err != nil {
+		return false, err
+	}
+
+	replacement.Gtin, _ = NormalizeGtin(replacement.Gtin)
+	replacement.normalize()
+
+	if normalized, err := NormalizeGtin(gtin); err != nil || normalized != replacement.Gtin {
+		return false, newValidationError(ErrInvalidSupplement, []Violation{{
+			Field:   "gtin",
+			Rule:    RuleGtin,
+			Value:   replacement.Gtin,
+			Message: fmt.Sprintf("gtin %q is invalid, it must match %q in the path", replacement.Gtin, gtin),
+		}})
+	}
+
+	existing, err := service.repository.FindByGtin(ctx, replacement.Gtin)
+
+	if err != nil {
+		return false, err
 	}
 
-	return service.repository.Delete(ctx, *supplement)
+	if existing == nil {
+		if version != 0 {
+			return false, &GtinError{Gtin: gtin, Err: ErrPreconditionFailed}
+		}
+		if err := service.repository.Create(ctx, replacement); err != nil {
+			return false, withGtin(gtin, err)
+		}
+		return true, nil
+	}
+
+	if version != 0 && existing.Version != version {
+		return false, &GtinError{Gtin: gtin, Err: ErrPreconditionFailed}
+	}
+
+	replacement.Version = existing.Version
+	return false, withGtin(gtin, service.repository.Update(ctx, replacement))
 }
 
-func (service *SupplementService) Update(ctx context.Context, gtin string, other UpdatableSupplement) error {
-	supplement, err := service.repository.FindByGtin(ctx, gtin)
+func (service *SupplementService) ListAll(ctx context.Context, query ListQuery) (Page, error) {
+	query = query.withDefaults()
+
+	if err := query.validate(); err != nil {
+		return Page{}, err
+	}
+
+	query.After = nil
+	if query.Cursor != "" {
+		after, err := service.cursors.decode(query.Cursor, query)
+		if err != nil {
+			return Page{}, err
+		}
+		query.After = after
+	}
+
+	limit := query.Limit
+	query.Limit++
+
+	supplements, err := service.repository.ListAll(ctx, query)
 
 	if err != nil {
+		return Page{}, err
+	}
+
+	page := Page{Supplements: supplements}
+	if page.Supplements == nil {
+		page.Supplements = []Supplement{}
+	}
+
+	if len(supplements) > limit {
+		page.Supplements = supplements[:limit]
+		page.Next, err = service.cursors.encode(query, page.Supplements[limit-1])
+		if err != nil {
+			return Page{}, err
+		}
+	}
+
+	return page, nil
+}
+
+// Export calls fn with every supplement that matches the filters of query,
+// in its order. Its limit and cursor are ignored.
+func (service *SupplementService) Export(ctx context.Context, query ListQuery, fn func(Supplement) error) error {
+	query = query.withDefaults()
+	query.Limit, query.Cursor = DefaultPageSize, ""
+
+	if err := query.validate(); err != nil {
 		return err
 	}
 
-	if supplement == nil {
-		return fmt.Errorf("%s: %w", gtin, ErrNotFound)
+	query.After = nil
+	return service.repository.Export(ctx, query, fn)
+}
+
+// Restore brings back a deleted supplement that has not been purged yet.
+func (service *SupplementService) Restore(ctx context.Context, gtin string) (*Supplement, error) {
+	normalized, err := NormalizeGtin(gtin)
+
+	if err != nil {
+		return nil, &GtinError{Gtin: gtin, Err: ErrNotFound}
 	}
 
-	updated := supplement.update(other)
+	if err := service.repository.Restore(ctx, normalized); err != nil {
+		return nil, withGtin(gtin, err)
+	}
 
-	if err := updated.validate(); err != nil {
-		return fmt.Errorf("%w: %v", ErrInvalidSupplement, err)
+	return service.findExisting(ctx, gtin)
+}
+
+// Purge removes for good the supplements deleted more than retention ago,
+// and returns how many there were. Their history is kept.
+func (service *SupplementService) Purge(ctx context.Context, retention time.Duration) (int, error) {
+	if retention < 0 {
+		return 0, fmt.Errorf("retention %s is invalid, it must not be negative", retention)
 	}
 
-	return service.repository.Update(ctx, updated)
+	return service.repository.Purge(ctx, time.Now().Add(-retention))
 }
 
-// TODO: Add pagination, sorting, and filtering
-func (service *SupplementService) ListAll(ctx context.Context) ([]Supplement, error) {
-	return service.repository.ListAll(ctx)
+// History lists every recorded change of the supplement, oldest first, even
+// if it has since been deleted. A supplement stored before the audit log has
+// an empty history.
+func (service *SupplementService) History(ctx context.Context, gtin string) (History, error) {
+	normalized, err := NormalizeGtin(gtin)
+
+	if err != nil {
+		return History{}, &GtinError{Gtin: gtin, Err: ErrNotFound}
+	}
+
+	entries, err := service.repository.History(ctx, normalized)
+
+	if err != nil {
+		return History{}, err
+	}
+
+	if len(entries) == 0 {
+		if _, err := service.findExisting(ctx, gtin); err != nil {
+			return History{}, err
+		}
+		return History{Entries: []AuditEntry{}}, nil
+	}
+
+	return History{Entries: entries}, nil
+}
+
+func (service *SupplementService) findMatching(ctx context.Context, gtin string, version int64) (*Supplement, error) {
+	supplement, err := service.findExisting(ctx, gtin)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if version != 0 && supplement.Version != version {
+		return nil, &GtinError{Gtin: gtin, Err: ErrPreconditionFailed}
+	}
+
+	return supplement, nil
+}
+
+// inTransaction calls fn with a copy of the service whose repository reads
+// and writes in one transaction, so that what fn checks still holds when it
+// writes.
+func (service *SupplementService) inTransaction(ctx context.Context, fn func(tx *SupplementService) error) error {
+	return service.repository.InTransaction(ctx, func(repository SupplementRepository) error {
+		tx := *service
+		tx.repository = repository
+		return fn(&tx)
+	})
+}
+
+// withGtin attaches gtin to the sentinel errors repositories return bare.
+func withGtin(gtin string, err error) error {
+	if errors.Is(err, ErrPreconditionFailed) || errors.Is(err, ErrNotFound) || errors.Is(err, ErrAlreadyExists) {
+		return &GtinError{Gtin: gtin, Err: err}
+	}
+	return err
+}
+
+// findExisting looks a supplement up by any form of its GTIN. A GTIN that
+// cannot be normalized can never be stored, so it is reported as not found.
+func (service *SupplementService) findExisting(ctx context.Context, gtin string) (*Supplement, error) {
+	normalized, err := NormalizeGtin(gtin)
+
+	if err != nil {
+		return nil, &GtinError{Gtin: gtin, Err: ErrNotFound}
+	}
+
+	supplement, err := service.repository.FindByGtin(ctx, normalized)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if supplement == nil {
+		return nil, &GtinError{Gtin: gtin, Err: ErrNotFound}
+	}
+
+	return supplement, nil
 }
@@ -3,7 +3,10 @@ package supplement_test
 import (
 	"context"
 	"errors"
+	"maps"
+	"sort"
 	"testing"
+	"time"
 
 	"github.com/marioromandono/supplementapp/internal/supplement"
 
@@ -11,8 +14,41 @@ import (
 	"github.com/google/go-cmp/cmp/cmpopts"
 )
 
+// equateOmittedNutrients lets fixtures leave out nutrients, which the service
+// stores as zero in the unit of the nutrient.
+var equateOmittedNutrients = cmp.Comparer(func(a, b supplement.Quantity) bool {
+	if a.Amount == 0 && b.Amount == 0 && (a.Unit == "" || b.Unit == "") {
+		return true
+	}
+	return a == b
+})
+
 type stubSupplementRepository struct {
-	store map[string]supplement.Supplement
+	store   map[string]supplement.Supplement
+	deleted map[string]supplement.Supplement
+	history map[string][]supplement.AuditEntry
+	// createErr is returned by Create, as for a supplement created
+	// concurrently after the service checked its GTIN was free.
+	createErr error
+}
+
+// InTransaction runs fn on a copy of the stub, whose stores replace the
+// original ones only if fn succeeds.
+func (r *stubSupplementRepository) InTransaction(ctx context.Context, fn func(repository supplement.SupplementRepository) error) error {
+	tx := *r
+	tx.store, tx.deleted = maps.Clone(r.store), maps.Clone(r.deleted)
+
+	if err := fn(&tx); err != nil {
+		return err
+	}
+
+	clear(r.store)
+	maps.Copy(r.store, tx.store)
+	if r.deleted != nil {
+		clear(r.deleted)
+		maps.Copy(r.deleted, tx.deleted)
+	}
+	return nil
 }
 
 func (r *stubSupplementRepository) FindByGtin(ctx context.Context, gtin string) (*supplement.Supplement, error) {
@@ -24,28 +60,102 @@ func (r *stubSupplementRepository) FindByGtin(ctx context.Context, gtin string)
 }
 
 func (r *stubSupplementRepository) Create(ctx context.Context, s supplement.Supplement) error {
+	if r.createErr != nil {
+		return r.createErr
+	}
 	r.store[s.Gtin] = s
 	return nil
 }
 
 func (r *stubSupplementRepository) Update(ctx context.Context, s supplement.Supplement) error {
+	if r.store[s.Gtin].Version != s.Version {
+		return supplement.ErrPreconditionFailed
+	}
+	s.Version++
 	r.store[s.Gtin] = s
 	return nil
 }
 
 func (r *stubSupplementRepository) Delete(ctx context.Context, s supplement.Supplement) error {
+	if r.store[s.Gtin].Version != s.Version {
+		return supplement.ErrPreconditionFailed
+	}
 	delete(r.store, s.Gtin)
+	if r.deleted != nil {
+		r.deleted[s.Gtin] = s
+	}
+	return nil
+}
+
+func (r *stubSupplementRepository) Restore(ctx context.Context, gtin string) error {
+	s, ok := r.deleted[gtin]
+	if !ok {
+		return supplement.ErrNotFound
+	}
+	delete(r.deleted, gtin)
+	s.Version++
+	r.store[gtin] = s
 	return nil
 }
 
-func (r *stubSupplementRepository) ListAll(ctx context.Context) ([]supplement.Supplement, error) {
+func (r *stubSupplementRepository) Purge(ctx context.Context, deletedBefore time.Time) (int, error) {
+	purged := 0
+	for gtin, s := range r.deleted {
+		if s.DeletedAt.Before(deletedBefore) {
+			delete(r.deleted, gtin)
+			purged++
+		}
+	}
+	return purged, nil
+}
+
+func (r *stubSupplementRepository) ListAll(ctx context.Context, query supplement.ListQuery) ([]supplement.Supplement, error) {
 	var supplements []supplement.Supplement
 	for _, s := range r.store {
 		supplements = append(supplements, s)
 	}
+	sort.Slice(supplements, func(i, j int) bool {
+		return supplements[i].Gtin < supplements[j].Gtin
+	})
+	if query.After != nil {
+		i := sort.Search(len(supplements), func(i int) bool {
+			return supplements[i].Gtin > query.After.Gtin
+		})
+		supplements = supplements[i:]
+	}
+	if len(supplements) > query.Limit {
+		supplements = supplements[:query.Limit]
+	}
 	return supplements, nil
 }
 
+func (r *stubSupplementRepository) Export(ctx context.Context, query supplement.ListQuery, fn func(supplement.Supplement) error) error {
+	query.Limit = len(r.store)
+	supplements, _ := r.ListAll(ctx, query)
+	for _, s := range supplements {
+		if err := fn(s); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *stubSupplementRepository) Search(ctx context.Context, query supplement.SearchQuery) ([]supplement.Supplement, error) {
+	terms := supplement.SearchTerms(query.Text)
+	supplements, _ := r.ListAll(ctx, supplement.ListQuery{Limit: len(r.store)})
+	var found []supplement.Supplement
+	for _, s := range supplements {
+		if supplement.SearchRank(s.SearchText(), terms) > 0 && len(found) < query.Limit {
+			found = append(found, s)
+		}
+	}
+	return found, nil
+}
+
+func (r *stubSupplementRepository) History(ctx context.Context, gtin string) ([]supplement.AuditEntry, error) {
+	return r.history[gtin], nil
+}
+
 func Ptr[T any](v T) *T {
 	return &v
 }
@@ -74,7 +184,7 @@ func TestSupplementService_FindByGtin(t *testing.T) {
 			},
 			args: args{
 				ctx:  context.TODO(),
-				gtin: "1234567890123",
+				gtin: "01234567890128",
 			},
 			want:      nil,
 			wantErr:   supplement.ErrNotFound,
@@ -84,18 +194,48 @@ func TestSupplementService_FindByGtin(t *testing.T) {
 			name: "found",
 			fields: fields{
 				repository: &stubSupplementRepository{store: map[string]supplement.Supplement{
-					"1234567890123": {Gtin: "1234567890123"},
+					"01234567890128": {Gtin: "01234567890128"},
+				}},
+			},
+			args: args{
+				ctx:  context.TODO(),
+				gtin: "01234567890128",
+			},
+			want:    &supplement.Supplement{Gtin: "01234567890128"},
+			wantErr: nil,
+			wantStore: map[string]supplement.Supplement{
+				"01234567890128": {Gtin: "01234567890128"},
+			},
+		},
+		{
+			name: "found by gtin-8",
+			fields: fields{
+				repository: &stubSupplementRepository{store: map[string]supplement.Supplement{
+					"00000096385074": {Gtin: "00000096385074"},
 				}},
 			},
 			args: args{
 				ctx:  context.TODO(),
-				gtin: "1234567890123",
+				gtin: "96385074",
 			},
-			want:    &supplement.Supplement{Gtin: "1234567890123"},
+			want:    &supplement.Supplement{Gtin: "00000096385074"},
 			wantErr: nil,
 			wantStore: map[string]supplement.Supplement{
-				"1234567890123": {Gtin: "1234567890123"},
+				"00000096385074": {Gtin: "00000096385074"},
+			},
+		},
+		{
+			name: "invalid gtin",
+			fields: fields{
+				repository: &stubSupplementRepository{store: map[string]supplement.Supplement{}},
+			},
+			args: args{
+				ctx:  context.TODO(),
+				gtin: "123",
 			},
+			want:      nil,
+			wantErr:   supplement.ErrNotFound,
+			wantStore: map[string]supplement.Supplement{},
 		},
 	}
 	for _, tt := range tests {
@@ -110,7 +250,7 @@ func TestSupplementService_FindByGtin(t *testing.T) {
 			if diff := cmp.Diff(got, tt.want); diff != "" {
 				t.Errorf("SupplementService.FindByGtin() = %v, want %v", got, tt.want)
 			}
-			if diff := cmp.Diff(tt.fields.repository.(*stubSupplementRepository).store, tt.wantStore); diff != "" {
+			if diff := cmp.Diff(tt.fields.repository.(*stubSupplementRepository).store, tt.wantStore, equateOmittedNutrients); diff != "" {
 				t.Errorf("SupplementService.FindByGtin() store mismatch (-got +want):\n%s", diff)
 			}
 		})
@@ -137,16 +277,16 @@ func TestSupplementService_Create(t *testing.T) {
 			name: "already exists",
 			fields: fields{
 				repository: &stubSupplementRepository{store: map[string]supplement.Supplement{
-					"1234567890123": {Gtin: "1234567890123"},
+					"01234567890128": {Gtin: "01234567890128"},
 				}},
 			},
 			args: args{
 				ctx:        context.TODO(),
-				supplement: supplement.Supplement{Gtin: "1234567890123"},
+				supplement: supplement.Supplement{Gtin: "01234567890128"},
 			},
 			wantErr: supplement.ErrAlreadyExists,
 			wantStore: map[string]supplement.Supplement{
-				"1234567890123": {Gtin: "1234567890123"},
+				"01234567890128": {Gtin: "01234567890128"},
 			},
 		},
 		{
@@ -180,7 +320,7 @@ func TestSupplementService_Create(t *testing.T) {
 			},
 			args: args{
 				ctx:        context.TODO(),
-				supplement: supplement.Supplement{Gtin: "1234567890123"},
+				supplement: supplement.Supplement{Gtin: "01234567890128"},
 			},
 			wantErr:   supplement.ErrInvalidSupplement,
 			wantStore: map[string]supplement.Supplement{},
@@ -193,7 +333,7 @@ func TestSupplementService_Create(t *testing.T) {
 			args: args{
 				ctx: context.TODO(),
 				supplement: supplement.Supplement{
-					Gtin: "1234567890123",
+					Gtin: "01234567890128",
 					Name: "name",
 				},
 			},
@@ -208,7 +348,7 @@ func TestSupplementService_Create(t *testing.T) {
 			args: args{
 				ctx: context.TODO(),
 				supplement: supplement.Supplement{
-					Gtin:  "1234567890123",
+					Gtin:  "01234567890128",
 					Name:  "name",
 					Brand: "brand",
 				},
@@ -224,11 +364,11 @@ func TestSupplementService_Create(t *testing.T) {
 			args: args{
 				ctx: context.TODO(),
 				supplement: supplement.Supplement{
-					Gtin:          "1234567890123",
+					Gtin:          "01234567890128",
 					Name:          "name",
 					Brand:         "brand",
 					Flavor:        "flavor",
-					Carbohydrates: -1.0,
+					Carbohydrates: supplement.Grams(-1.0),
 				},
 			},
 			wantErr:   supplement.ErrInvalidSupplement,
@@ -242,11 +382,11 @@ func TestSupplementService_Create(t *testing.T) {
 			args: args{
 				ctx: context.TODO(),
 				supplement: supplement.Supplement{
-					Gtin:         "1234567890123",
+					Gtin:         "01234567890128",
 					Name:         "name",
 					Brand:        "brand",
 					Flavor:       "flavor",
-					Electrolytes: -1.0,
+					Electrolytes: supplement.Milligrams(-1.0),
 				},
 			},
 			wantErr:   supplement.ErrInvalidSupplement,
@@ -260,11 +400,11 @@ func TestSupplementService_Create(t *testing.T) {
 			args: args{
 				ctx: context.TODO(),
 				supplement: supplement.Supplement{
-					Gtin:          "1234567890123",
+					Gtin:          "01234567890128",
 					Name:          "name",
 					Brand:         "brand",
 					Flavor:        "flavor",
-					Maltodextrose: -1.0,
+					Maltodextrose: supplement.Grams(-1.0),
 				},
 			},
 			wantErr:   supplement.ErrInvalidSupplement,
@@ -278,11 +418,11 @@ func TestSupplementService_Create(t *testing.T) {
 			args: args{
 				ctx: context.TODO(),
 				supplement: supplement.Supplement{
-					Gtin:     "1234567890123",
+					Gtin:     "01234567890128",
 					Name:     "name",
 					Brand:    "brand",
 					Flavor:   "flavor",
-					Fructose: -1.0,
+					Fructose: supplement.Grams(-1.0),
 				},
 			},
 			wantErr:   supplement.ErrInvalidSupplement,
@@ -296,11 +436,11 @@ func TestSupplementService_Create(t *testing.T) {
 			args: args{
 				ctx: context.TODO(),
 				supplement: supplement.Supplement{
-					Gtin:     "1234567890123",
+					Gtin:     "01234567890128",
 					Name:     "name",
 					Brand:    "brand",
 					Flavor:   "flavor",
-					Caffeine: -1.0,
+					Caffeine: supplement.Milligrams(-1.0),
 				},
 			},
 			wantErr:   supplement.ErrInvalidSupplement,
@@ -314,11 +454,11 @@ func TestSupplementService_Create(t *testing.T) {
 			args: args{
 				ctx: context.TODO(),
 				supplement: supplement.Supplement{
-					Gtin:   "1234567890123",
+					Gtin:   "01234567890128",
 					Name:   "name",
 					Brand:  "brand",
 					Flavor: "flavor",
-					Sodium: -1.0,
+					Sodium: supplement.Milligrams(-1.0),
 				},
 			},
 			wantErr:   supplement.ErrInvalidSupplement,
@@ -332,16 +472,93 @@ func TestSupplementService_Create(t *testing.T) {
 			args: args{
 				ctx: context.TODO(),
 				supplement: supplement.Supplement{
-					Gtin:    "1234567890123",
+					Gtin:    "01234567890128",
 					Name:    "name",
 					Brand:   "brand",
 					Flavor:  "flavor",
-					Protein: -1.0,
+					Protein: supplement.Grams(-1.0),
+				},
+			},
+			wantErr:   supplement.ErrInvalidSupplement,
+			wantStore: map[string]supplement.Supplement{},
+		},
+		{
+			name: "wrong check digit",
+			fields: fields{
+				repository: &stubSupplementRepository{store: map[string]supplement.Supplement{}},
+			},
+			args: args{
+				ctx: context.TODO(),
+				supplement: supplement.Supplement{
+					Gtin:   "01234567890123",
+					Name:   "name",
+					Brand:  "brand",
+					Flavor: "flavor",
 				},
 			},
 			wantErr:   supplement.ErrInvalidSupplement,
 			wantStore: map[string]supplement.Supplement{},
 		},
+		{
+			name: "normalizes gtin-12",
+			fields: fields{
+				repository: &stubSupplementRepository{store: map[string]supplement.Supplement{}},
+			},
+			args: args{
+				ctx: context.TODO(),
+				supplement: supplement.Supplement{
+					Gtin:   "012345678905",
+					Name:   "name",
+					Brand:  "brand",
+					Flavor: "flavor",
+				},
+			},
+			wantErr: nil,
+			wantStore: map[string]supplement.Supplement{
+				"00012345678905": {
+					Gtin:   "00012345678905",
+					Name:   "name",
+					Brand:  "brand",
+					Flavor: "flavor",
+				},
+			},
+		},
+		{
+			name: "already exists in another gtin form",
+			fields: fields{
+				repository: &stubSupplementRepository{store: map[string]supplement.Supplement{
+					"01234567890128": {Gtin: "01234567890128"},
+				}},
+			},
+			args: args{
+				ctx:        context.TODO(),
+				supplement: supplement.Supplement{Gtin: "1234567890128"},
+			},
+			wantErr: supplement.ErrAlreadyExists,
+			wantStore: map[string]supplement.Supplement{
+				"01234567890128": {Gtin: "01234567890128"},
+			},
+		},
+		{
+			name: "created concurrently",
+			fields: fields{
+				repository: &stubSupplementRepository{
+					store:     map[string]supplement.Supplement{},
+					createErr: supplement.ErrAlreadyExists,
+				},
+			},
+			args: args{
+				ctx: context.TODO(),
+				supplement: supplement.Supplement{
+					Gtin:   "1234567890128",
+					Name:   "name",
+					Brand:  "brand",
+					Flavor: "flavor",
+				},
+			},
+			wantErr:   supplement.ErrAlreadyExists,
+			wantStore: map[string]supplement.Supplement{},
+		},
 		{
 			name: "with every nutrient set to zero",
 			fields: fields{
@@ -350,7 +567,7 @@ func TestSupplementService_Create(t *testing.T) {
 			args: args{
 				ctx: context.TODO(),
 				supplement: supplement.Supplement{
-					Gtin:   "1234567890123",
+					Gtin:   "01234567890128",
 					Name:   "name",
 					Brand:  "brand",
 					Flavor: "flavor",
@@ -358,8 +575,8 @@ func TestSupplementService_Create(t *testing.T) {
 			},
 			wantErr: nil,
 			wantStore: map[string]supplement.Supplement{
-				"1234567890123": {
-					Gtin:   "1234567890123",
+				"01234567890128": {
+					Gtin:   "01234567890128",
 					Name:   "name",
 					Brand:  "brand",
 					Flavor: "flavor",
@@ -374,33 +591,33 @@ func TestSupplementService_Create(t *testing.T) {
 			args: args{
 				ctx: context.TODO(),
 				supplement: supplement.Supplement{
-					Gtin:          "1234567890123",
+					Gtin:          "01234567890128",
 					Name:          "name",
 					Brand:         "brand",
 					Flavor:        "flavor",
-					Carbohydrates: 1.0,
-					Electrolytes:  1.0,
-					Maltodextrose: 1.0,
-					Fructose:      1.0,
-					Caffeine:      1.0,
-					Sodium:        1.0,
-					Protein:       1.0,
+					Carbohydrates: supplement.Grams(1.0),
+					Electrolytes:  supplement.Milligrams(1.0),
+					Maltodextrose: supplement.Grams(1.0),
+					Fructose:      supplement.Grams(1.0),
+					Caffeine:      supplement.Milligrams(1.0),
+					Sodium:        supplement.Milligrams(1.0),
+					Protein:       supplement.Grams(1.0),
 				},
 			},
 			wantErr: nil,
 			wantStore: map[string]supplement.Supplement{
-				"1234567890123": {
-					Gtin:          "1234567890123",
+				"01234567890128": {
+					Gtin:          "01234567890128",
 					Name:          "name",
 					Brand:         "brand",
 					Flavor:        "flavor",
-					Carbohydrates: 1.0,
-					Electrolytes:  1.0,
-					Maltodextrose: 1.0,
-					Fructose:      1.0,
-					Caffeine:      1.0,
-					Sodium:        1.0,
-					Protein:       1.0,
+					Carbohydrates: supplement.Grams(1.0),
+					Electrolytes:  supplement.Milligrams(1.0),
+					Maltodextrose: supplement.Grams(1.0),
+					Fructose:      supplement.Grams(1.0),
+					Caffeine:      supplement.Milligrams(1.0),
+					Sodium:        supplement.Milligrams(1.0),
+					Protein:       supplement.Grams(1.0),
 				},
 			},
 		},
@@ -412,22 +629,210 @@ func TestSupplementService_Create(t *testing.T) {
 			if err := service.Create(tt.args.ctx, tt.args.supplement); !errors.Is(err, tt.wantErr) {
 				t.Errorf("SupplementService.Create() error = %v, wantErr %v", err, tt.wantErr)
 			}
-			if diff := cmp.Diff(tt.fields.repository.(*stubSupplementRepository).store, tt.wantStore); diff != "" {
+			if diff := cmp.Diff(tt.fields.repository.(*stubSupplementRepository).store, tt.wantStore, equateOmittedNutrients); diff != "" {
 				t.Errorf("SupplementService.Create() store mismatch (-got +want):\n%s", diff)
 			}
 		})
 	}
 }
 
+func TestSupplementService_Create_ValidationError(t *testing.T) {
+	t.Parallel()
+	service := supplement.NewSupplementService(&stubSupplementRepository{store: map[string]supplement.Supplement{}})
+
+	err := service.Create(context.TODO(), supplement.Supplement{
+		Gtin:         "01234567890123",
+		Name:         "name",
+		Flavor:       "flavor",
+		Serving:      &supplement.Serving{Size: supplement.Milligrams(500), ServingsPerPackage: 0},
+		Electrolytes: supplement.Millilitres(1.0),
+		Caffeine:     supplement.Milligrams(-1.0),
+		Sodium:       supplement.Grams(10_000),
+		Protein:      supplement.Grams(0.1234),
+		Micronutrients: supplement.Panel{
+			"vitamin-x":           supplement.Milligrams(1),
+			supplement.VitaminB12: supplement.Quantity{Amount: 0.0001, Unit: supplement.Microgram},
+		},
+	})
+
+	var validationErr *supplement.ValidationError
+	if !errors.As(err, &validationErr) {
+		t.Fatalf("SupplementService.Create() error = %v, want a *supplement.ValidationError", err)
+	}
+	if !errors.Is(err, supplement.ErrInvalidSupplement) {
+		t.Errorf("SupplementService.Create() error = %v, wantErr %v", err, supplement.ErrInvalidSupplement)
+	}
+
+	want := []supplement.Violation{
+		{Field: "gtin", Rule: supplement.RuleGtin, Value: "01234567890123", Message: `gtin "01234567890123" is invalid, its check digit must be 8`},
+		{Field: "brand", Rule: supplement.RuleRequired, Value: "", Message: `brand "" is invalid, it must not be empty`},
+		{Field: "electrolytes.unit", Rule: supplement.RuleOneOf, Value: supplement.Millilitre, Message: `electrolytes unit "ml" is invalid, it must be one of g, mg, mcg`},
+		{Field: "caffeine", Rule: supplement.RuleMin, Value: float64(-1.0), Message: "caffeine -1.000000 is invalid, it must be greater or equal to zero"},
+		{Field: "sodium", Rule: supplement.RuleMax, Value: float64(10_000_000), Message: "sodium 10000000.000000 is invalid, it must be less or equal to 9999999.999 mg"},
+		{Field: "protein", Rule: supplement.RuleScale, Value: 0.1234, Message: "protein 0.1234 is invalid, it must have at most 3 decimal places in g"},
+		{Field: "serving.size.unit", Rule: supplement.RuleOneOf, Value: supplement.Milligram, Message: `serving size unit "mg" is invalid, it must be "g" or "ml"`},
+		{Field: "serving.servingsPerPackage", Rule: supplement.RuleMin, Value: 0, Message: "servings per package 0 is invalid, it must be at least 1"},
+		{Field: "micronutrients.vitamin-b12", Rule: supplement.RuleScale, Value: 0.0001, Message: "micronutrients.vitamin-b12 0.0001 is invalid, it must have at most 3 decimal places in mcg"},
+		{
+			Field:   "micronutrients.vitamin-x",
+			Rule:    supplement.RuleOneOf,
+			Value:   supplement.Micronutrient("vitamin-x"),
+			Message: `micronutrient "vitamin-x" is invalid, it must be one of potassium, magnesium, calcium, chloride, iron, zinc, vitamin-b1, vitamin-b6, vitamin-b12, vitamin-c, vitamin-d, vitamin-e`,
+		},
+	}
+	if diff := cmp.Diff(validationErr.Violations, want); diff != "" {
+		t.Errorf("SupplementService.Create() violations (-got +want):\n%s", diff)
+	}
+}
+
+func TestSupplementService_Create_CategoryRules(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name           string
+		supplement     supplement.Supplement
+		wantViolations []supplement.Violation
+	}{
+		{
+			name:       "capsule without carbohydrates",
+			supplement: supplement.Supplement{Category: supplement.CategoryCapsule, Sodium: supplement.Milligrams(200)},
+		},
+		{
+			name:       "gel with carbohydrates",
+			supplement: supplement.Supplement{Category: supplement.CategoryGel, Carbohydrates: supplement.Grams(22), Fructose: supplement.Grams(8)},
+		},
+		{
+			name:       "capsule with carbohydrates",
+			supplement: supplement.Supplement{Category: supplement.CategoryCapsule, Carbohydrates: supplement.Grams(1), Fructose: supplement.Grams(0.5)},
+			wantViolations: []supplement.Violation{
+				{Field: "carbohydrates", Rule: supplement.RuleCategory, Value: float64(1), Message: "carbohydrates 1.000000 is invalid, a capsule cannot claim carbohydrates"},
+				{Field: "fructose", Rule: supplement.RuleCategory, Value: 0.5, Message: "fructose 0.500000 is invalid, a capsule cannot claim fructose"},
+			},
+		},
+		{
+			name:       "unknown category",
+			supplement: supplement.Supplement{Category: "sachet"},
+			wantViolations: []supplement.Violation{
+				{Field: "category", Rule: supplement.RuleOneOf, Value: supplement.Category("sachet"), Message: `category "sachet" is invalid, it must be one of gel, drink-mix, bar, chew, capsule, tablet, powder`},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			service := supplement.NewSupplementService(&stubSupplementRepository{store: map[string]supplement.Supplement{}})
+			s := tt.supplement
+			s.Gtin, s.Name, s.Brand, s.Flavor = "01234567890128", "name", "brand", "flavor"
+
+			err := service.Create(context.TODO(), s)
+
+			var violations []supplement.Violation
+			var validationErr *supplement.ValidationError
+			if errors.As(err, &validationErr) {
+				violations = validationErr.Violations
+			} else if err != nil {
+				t.Fatalf("SupplementService.Create() error = %v, want nil or a *supplement.ValidationError", err)
+			}
+			if diff := cmp.Diff(violations, tt.wantViolations); diff != "" {
+				t.Errorf("SupplementService.Create() violations (-got +want):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestSupplementService_Create_Composition(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name           string
+		ingredients    []string
+		allergens      supplement.AllergenDeclaration
+		want           supplement.Supplement
+		wantViolations []supplement.Violation
+	}{
+		{
+			name:        "normalized",
+			ingredients: []string{" maltodextrin", "whey protein "},
+			allergens: supplement.AllergenDeclaration{
+				Contains:   []supplement.Allergen{supplement.AllergenSoy, supplement.AllergenMilk},
+				MayContain: []supplement.Allergen{},
+			},
+			want: supplement.Supplement{
+				Ingredients: []string{"maltodextrin", "whey protein"},
+				Allergens:   supplement.AllergenDeclaration{Contains: []supplement.Allergen{supplement.AllergenMilk, supplement.AllergenSoy}},
+			},
+		},
+		{
+			name:        "empty ingredient",
+			ingredients: []string{"maltodextrin", " "},
+			wantViolations: []supplement.Violation{
+				{Field: "ingredients[1]", Rule: supplement.RuleRequired, Value: " ", Message: `ingredient 2 " " is invalid, it must not be empty`},
+			},
+		},
+		{
+			name: "invalid allergens",
+			allergens: supplement.AllergenDeclaration{
+				Contains:   []supplement.Allergen{supplement.AllergenMilk, "dairy"},
+				MayContain: []supplement.Allergen{supplement.AllergenMilk},
+			},
+			wantViolations: []supplement.Violation{
+				{
+					Field:   "allergens.contains[1]",
+					Rule:    supplement.RuleOneOf,
+					Value:   supplement.Allergen("dairy"),
+					Message: `allergen "dairy" is invalid, it must be one of gluten, wheat, crustaceans, eggs, fish, peanuts, soy, milk, tree-nuts, celery, mustard, sesame, sulphites, lupin, molluscs`,
+				},
+				{
+					Field:   "allergens.mayContain[0]",
+					Rule:    supplement.RuleUnique,
+					Value:   supplement.AllergenMilk,
+					Message: `allergen "milk" is invalid, it is declared more than once`,
+				},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			repository := &stubSupplementRepository{store: map[string]supplement.Supplement{}}
+			service := supplement.NewSupplementService(repository)
+			s := supplement.Supplement{Gtin: "01234567890128", Name: "name", Brand: "brand", Flavor: "flavor", Ingredients: tt.ingredients, Allergens: tt.allergens}
+
+			err := service.Create(context.TODO(), s)
+
+			var violations []supplement.Violation
+			var validationErr *supplement.ValidationError
+			if errors.As(err, &validationErr) {
+				violations = validationErr.Violations
+			} else if err != nil {
+				t.Fatalf("SupplementService.Create() error = %v, want nil or a *supplement.ValidationError", err)
+			}
+			if diff := cmp.Diff(violations, tt.wantViolations); diff != "" {
+				t.Errorf("SupplementService.Create() violations (-got +want):\n%s", diff)
+			}
+
+			if tt.wantViolations != nil {
+				return
+			}
+			stored := repository.store[s.Gtin]
+			if diff := cmp.Diff(stored.Ingredients, tt.want.Ingredients); diff != "" {
+				t.Errorf("stored ingredients (-got +want):\n%s", diff)
+			}
+			if diff := cmp.Diff(stored.Allergens, tt.want.Allergens); diff != "" {
+				t.Errorf("stored allergens (-got +want):\n%s", diff)
+			}
+		})
+	}
+}
+
 func TestSupplementService_Update(t *testing.T) {
 	t.Parallel()
 	type fields struct {
 		repository supplement.SupplementRepository
 	}
 	type args struct {
-		ctx   context.Context
-		gtin  string
-		other supplement.UpdatableSupplement
+		ctx     context.Context
+		gtin    string
+		other   supplement.UpdatableSupplement
+		version int64
 	}
 	tests := []struct {
 		name      string
@@ -443,18 +848,90 @@ func TestSupplementService_Update(t *testing.T) {
 			},
 			args: args{
 				ctx:   context.TODO(),
-				gtin:  "1234567890123",
+				gtin:  "01234567890128",
 				other: supplement.UpdatableSupplement{Name: Ptr("updated name")},
 			},
 			wantErr:   supplement.ErrNotFound,
 			wantStore: map[string]supplement.Supplement{},
 		},
+		{
+			name: "micronutrients partial update",
+			fields: fields{
+				repository: &stubSupplementRepository{store: map[string]supplement.Supplement{
+					"01234567890128": {
+						Gtin:   "01234567890128",
+						Name:   "name",
+						Brand:  "brand",
+						Flavor: "flavor",
+						Micronutrients: supplement.Panel{
+							supplement.Potassium: supplement.Milligrams(200),
+							supplement.Magnesium: supplement.Milligrams(50),
+							supplement.Calcium:   supplement.Milligrams(40),
+						},
+					},
+				}},
+			},
+			args: args{
+				ctx:  context.TODO(),
+				gtin: "01234567890128",
+				other: supplement.UpdatableSupplement{Micronutrients: supplement.PanelUpdate{
+					supplement.Potassium: Ptr(supplement.Quantity{Amount: 0.3, Unit: supplement.Gram}),
+					supplement.Calcium:   nil,
+					supplement.VitaminD:  Ptr(supplement.Quantity{Amount: 5}),
+				}},
+			},
+			wantErr: nil,
+			wantStore: map[string]supplement.Supplement{
+				"01234567890128": {
+					Gtin:   "01234567890128",
+					Name:   "name",
+					Brand:  "brand",
+					Flavor: "flavor",
+					Micronutrients: supplement.Panel{
+						supplement.Potassium: supplement.Milligrams(300),
+						supplement.Magnesium: supplement.Milligrams(50),
+						supplement.VitaminD:  supplement.Quantity{Amount: 5, Unit: supplement.Microgram},
+					},
+					Version: 1,
+				},
+			},
+		},
+		{
+			name: "invalid micronutrients",
+			fields: fields{
+				repository: &stubSupplementRepository{store: map[string]supplement.Supplement{
+					"01234567890128": {
+						Gtin:   "01234567890128",
+						Name:   "name",
+						Brand:  "brand",
+						Flavor: "flavor",
+					},
+				}},
+			},
+			args: args{
+				ctx:  context.TODO(),
+				gtin: "01234567890128",
+				other: supplement.UpdatableSupplement{Micronutrients: supplement.PanelUpdate{
+					"vitamin-x":          Ptr(supplement.Milligrams(1)),
+					supplement.Potassium: Ptr(supplement.Milligrams(-1)),
+				}},
+			},
+			wantErr: supplement.ErrInvalidSupplement,
+			wantStore: map[string]supplement.Supplement{
+				"01234567890128": {
+					Gtin:   "01234567890128",
+					Name:   "name",
+					Brand:  "brand",
+					Flavor: "flavor",
+				},
+			},
+		},
 		{
 			name: "invalid name",
 			fields: fields{
 				repository: &stubSupplementRepository{store: map[string]supplement.Supplement{
-					"1234567890123": {
-						Gtin:   "1234567890123",
+					"01234567890128": {
+						Gtin:   "01234567890128",
 						Name:   "name",
 						Brand:  "brand",
 						Flavor: "flavor",
@@ -463,13 +940,13 @@ func TestSupplementService_Update(t *testing.T) {
 			},
 			args: args{
 				ctx:   context.TODO(),
-				gtin:  "1234567890123",
+				gtin:  "01234567890128",
 				other: supplement.UpdatableSupplement{Name: Ptr("")},
 			},
 			wantErr: supplement.ErrInvalidSupplement,
 			wantStore: map[string]supplement.Supplement{
-				"1234567890123": {
-					Gtin:   "1234567890123",
+				"01234567890128": {
+					Gtin:   "01234567890128",
 					Name:   "name",
 					Brand:  "brand",
 					Flavor: "flavor",
@@ -480,8 +957,8 @@ func TestSupplementService_Update(t *testing.T) {
 			name: "valid name",
 			fields: fields{
 				repository: &stubSupplementRepository{store: map[string]supplement.Supplement{
-					"1234567890123": {
-						Gtin:   "1234567890123",
+					"01234567890128": {
+						Gtin:   "01234567890128",
 						Name:   "name",
 						Brand:  "brand",
 						Flavor: "flavor",
@@ -490,16 +967,17 @@ func TestSupplementService_Update(t *testing.T) {
 			},
 			args: args{
 				ctx:   context.TODO(),
-				gtin:  "1234567890123",
+				gtin:  "01234567890128",
 				other: supplement.UpdatableSupplement{Name: Ptr("updated name")},
 			},
 			wantErr: nil,
 			wantStore: map[string]supplement.Supplement{
-				"1234567890123": {
-					Gtin:   "1234567890123",
-					Name:   "updated name",
-					Brand:  "brand",
-					Flavor: "flavor",
+				"01234567890128": {
+					Gtin:    "01234567890128",
+					Name:    "updated name",
+					Brand:   "brand",
+					Flavor:  "flavor",
+					Version: 1,
 				},
 			},
 		},
@@ -507,8 +985,8 @@ func TestSupplementService_Update(t *testing.T) {
 			name: "invalid brand",
 			fields: fields{
 				repository: &stubSupplementRepository{store: map[string]supplement.Supplement{
-					"1234567890123": {
-						Gtin:   "1234567890123",
+					"01234567890128": {
+						Gtin:   "01234567890128",
 						Name:   "name",
 						Brand:  "brand",
 						Flavor: "flavor",
@@ -517,13 +995,13 @@ func TestSupplementService_Update(t *testing.T) {
 			},
 			args: args{
 				ctx:   context.TODO(),
-				gtin:  "1234567890123",
+				gtin:  "01234567890128",
 				other: supplement.UpdatableSupplement{Brand: Ptr("")},
 			},
 			wantErr: supplement.ErrInvalidSupplement,
 			wantStore: map[string]supplement.Supplement{
-				"1234567890123": {
-					Gtin:   "1234567890123",
+				"01234567890128": {
+					Gtin:   "01234567890128",
 					Name:   "name",
 					Brand:  "brand",
 					Flavor: "flavor",
@@ -534,8 +1012,8 @@ func TestSupplementService_Update(t *testing.T) {
 			name: "valid brand",
 			fields: fields{
 				repository: &stubSupplementRepository{store: map[string]supplement.Supplement{
-					"1234567890123": {
-						Gtin:   "1234567890123",
+					"01234567890128": {
+						Gtin:   "01234567890128",
 						Name:   "name",
 						Brand:  "brand",
 						Flavor: "flavor",
@@ -544,16 +1022,17 @@ func TestSupplementService_Update(t *testing.T) {
 			},
 			args: args{
 				ctx:   context.TODO(),
-				gtin:  "1234567890123",
+				gtin:  "01234567890128",
 				other: supplement.UpdatableSupplement{Brand: Ptr("updated brand")},
 			},
 			wantErr: nil,
 			wantStore: map[string]supplement.Supplement{
-				"1234567890123": {
-					Gtin:   "1234567890123",
-					Name:   "name",
-					Brand:  "updated brand",
-					Flavor: "flavor",
+				"01234567890128": {
+					Gtin:    "01234567890128",
+					Name:    "name",
+					Brand:   "updated brand",
+					Flavor:  "flavor",
+					Version: 1,
 				},
 			},
 		},
@@ -561,8 +1040,8 @@ func TestSupplementService_Update(t *testing.T) {
 			name: "invalid flavor",
 			fields: fields{
 				repository: &stubSupplementRepository{store: map[string]supplement.Supplement{
-					"1234567890123": {
-						Gtin:   "1234567890123",
+					"01234567890128": {
+						Gtin:   "01234567890128",
 						Name:   "name",
 						Brand:  "brand",
 						Flavor: "flavor",
@@ -571,13 +1050,13 @@ func TestSupplementService_Update(t *testing.T) {
 			},
 			args: args{
 				ctx:   context.TODO(),
-				gtin:  "1234567890123",
+				gtin:  "01234567890128",
 				other: supplement.UpdatableSupplement{Flavor: Ptr("")},
 			},
 			wantErr: supplement.ErrInvalidSupplement,
 			wantStore: map[string]supplement.Supplement{
-				"1234567890123": {
-					Gtin:   "1234567890123",
+				"01234567890128": {
+					Gtin:   "01234567890128",
 					Name:   "name",
 					Brand:  "brand",
 					Flavor: "flavor",
@@ -588,8 +1067,8 @@ func TestSupplementService_Update(t *testing.T) {
 			name: "valid flavor",
 			fields: fields{
 				repository: &stubSupplementRepository{store: map[string]supplement.Supplement{
-					"1234567890123": {
-						Gtin:   "1234567890123",
+					"01234567890128": {
+						Gtin:   "01234567890128",
 						Name:   "name",
 						Brand:  "brand",
 						Flavor: "flavor",
@@ -598,16 +1077,17 @@ func TestSupplementService_Update(t *testing.T) {
 			},
 			args: args{
 				ctx:   context.TODO(),
-				gtin:  "1234567890123",
+				gtin:  "01234567890128",
 				other: supplement.UpdatableSupplement{Flavor: Ptr("updated flavor")},
 			},
 			wantErr: nil,
 			wantStore: map[string]supplement.Supplement{
-				"1234567890123": {
-					Gtin:   "1234567890123",
-					Name:   "name",
-					Brand:  "brand",
-					Flavor: "updated flavor",
+				"01234567890128": {
+					Gtin:    "01234567890128",
+					Name:    "name",
+					Brand:   "brand",
+					Flavor:  "updated flavor",
+					Version: 1,
 				},
 			},
 		},
@@ -615,8 +1095,8 @@ func TestSupplementService_Update(t *testing.T) {
 			name: "invalid carbohydrates",
 			fields: fields{
 				repository: &stubSupplementRepository{store: map[string]supplement.Supplement{
-					"1234567890123": {
-						Gtin:   "1234567890123",
+					"01234567890128": {
+						Gtin:   "01234567890128",
 						Name:   "name",
 						Brand:  "brand",
 						Flavor: "flavor",
@@ -625,13 +1105,13 @@ func TestSupplementService_Update(t *testing.T) {
 			},
 			args: args{
 				ctx:   context.TODO(),
-				gtin:  "1234567890123",
-				other: supplement.UpdatableSupplement{Carbohydrates: Ptr(float32(-1.0))},
+				gtin:  "01234567890128",
+				other: supplement.UpdatableSupplement{Carbohydrates: Ptr(supplement.Grams(-1.0))},
 			},
 			wantErr: supplement.ErrInvalidSupplement,
 			wantStore: map[string]supplement.Supplement{
-				"1234567890123": {
-					Gtin:   "1234567890123",
+				"01234567890128": {
+					Gtin:   "01234567890128",
 					Name:   "name",
 					Brand:  "brand",
 					Flavor: "flavor",
@@ -642,28 +1122,29 @@ func TestSupplementService_Update(t *testing.T) {
 			name: "valid carbohydrates",
 			fields: fields{
 				repository: &stubSupplementRepository{store: map[string]supplement.Supplement{
-					"1234567890123": {
-						Gtin:          "1234567890123",
+					"01234567890128": {
+						Gtin:          "01234567890128",
 						Name:          "name",
 						Brand:         "brand",
 						Flavor:        "flavor",
-						Carbohydrates: 1.0,
+						Carbohydrates: supplement.Grams(1.0),
 					},
 				}},
 			},
 			args: args{
 				ctx:   context.TODO(),
-				gtin:  "1234567890123",
-				other: supplement.UpdatableSupplement{Carbohydrates: Ptr(float32(2.0))},
+				gtin:  "01234567890128",
+				other: supplement.UpdatableSupplement{Carbohydrates: Ptr(supplement.Grams(2.0))},
 			},
 			wantErr: nil,
 			wantStore: map[string]supplement.Supplement{
-				"1234567890123": {
-					Gtin:          "1234567890123",
+				"01234567890128": {
+					Gtin:          "01234567890128",
 					Name:          "name",
 					Brand:         "brand",
 					Flavor:        "flavor",
-					Carbohydrates: 2.0,
+					Carbohydrates: supplement.Grams(2.0),
+					Version:       1,
 				},
 			},
 		},
@@ -671,8 +1152,8 @@ func TestSupplementService_Update(t *testing.T) {
 			name: "invalid electrolytes",
 			fields: fields{
 				repository: &stubSupplementRepository{store: map[string]supplement.Supplement{
-					"1234567890123": {
-						Gtin:   "1234567890123",
+					"01234567890128": {
+						Gtin:   "01234567890128",
 						Name:   "name",
 						Brand:  "brand",
 						Flavor: "flavor",
@@ -681,13 +1162,13 @@ func TestSupplementService_Update(t *testing.T) {
 			},
 			args: args{
 				ctx:   context.TODO(),
-				gtin:  "1234567890123",
-				other: supplement.UpdatableSupplement{Electrolytes: Ptr(float32(-1.0))},
+				gtin:  "01234567890128",
+				other: supplement.UpdatableSupplement{Electrolytes: Ptr(supplement.Milligrams(-1.0))},
 			},
 			wantErr: supplement.ErrInvalidSupplement,
 			wantStore: map[string]supplement.Supplement{
-				"1234567890123": {
-					Gtin:   "1234567890123",
+				"01234567890128": {
+					Gtin:   "01234567890128",
 					Name:   "name",
 					Brand:  "brand",
 					Flavor: "flavor",
@@ -698,28 +1179,29 @@ func TestSupplementService_Update(t *testing.T) {
 			name: "valid electrolytes",
 			fields: fields{
 				repository: &stubSupplementRepository{store: map[string]supplement.Supplement{
-					"1234567890123": {
-						Gtin:         "1234567890123",
+					"01234567890128": {
+						Gtin:         "01234567890128",
 						Name:         "name",
 						Brand:        "brand",
 						Flavor:       "flavor",
-						Electrolytes: 1.0,
+						Electrolytes: supplement.Milligrams(1.0),
 					},
 				}},
 			},
 			args: args{
 				ctx:   context.TODO(),
-				gtin:  "1234567890123",
-				other: supplement.UpdatableSupplement{Electrolytes: Ptr(float32(2.0))},
+				gtin:  "01234567890128",
+				other: supplement.UpdatableSupplement{Electrolytes: Ptr(supplement.Milligrams(2.0))},
 			},
 			wantErr: nil,
 			wantStore: map[string]supplement.Supplement{
-				"1234567890123": {
-					Gtin:         "1234567890123",
+				"01234567890128": {
+					Gtin:         "01234567890128",
 					Name:         "name",
 					Brand:        "brand",
 					Flavor:       "flavor",
-					Electrolytes: 2.0,
+					Electrolytes: supplement.Milligrams(2.0),
+					Version:      1,
 				},
 			},
 		},
@@ -727,8 +1209,8 @@ func TestSupplementService_Update(t *testing.T) {
 			name: "invalid maltodextrose",
 			fields: fields{
 				repository: &stubSupplementRepository{store: map[string]supplement.Supplement{
-					"1234567890123": {
-						Gtin:   "1234567890123",
+					"01234567890128": {
+						Gtin:   "01234567890128",
 						Name:   "name",
 						Brand:  "brand",
 						Flavor: "flavor",
@@ -737,13 +1219,13 @@ func TestSupplementService_Update(t *testing.T) {
 			},
 			args: args{
 				ctx:   context.TODO(),
-				gtin:  "1234567890123",
-				other: supplement.UpdatableSupplement{Maltodextrose: Ptr(float32(-1.0))},
+				gtin:  "01234567890128",
+				other: supplement.UpdatableSupplement{Maltodextrose: Ptr(supplement.Grams(-1.0))},
 			},
 			wantErr: supplement.ErrInvalidSupplement,
 			wantStore: map[string]supplement.Supplement{
-				"1234567890123": {
-					Gtin:   "1234567890123",
+				"01234567890128": {
+					Gtin:   "01234567890128",
 					Name:   "name",
 					Brand:  "brand",
 					Flavor: "flavor",
@@ -754,28 +1236,29 @@ func TestSupplementService_Update(t *testing.T) {
 			name: "valid maltodextrose",
 			fields: fields{
 				repository: &stubSupplementRepository{store: map[string]supplement.Supplement{
-					"1234567890123": {
-						Gtin:          "1234567890123",
+					"01234567890128": {
+						Gtin:          "01234567890128",
 						Name:          "name",
 						Brand:         "brand",
 						Flavor:        "flavor",
-						Maltodextrose: 1.0,
+						Maltodextrose: supplement.Grams(1.0),
 					},
 				}},
 			},
 			args: args{
 				ctx:   context.TODO(),
-				gtin:  "1234567890123",
-				other: supplement.UpdatableSupplement{Maltodextrose: Ptr(float32(2.0))},
+				gtin:  "01234567890128",
+				other: supplement.UpdatableSupplement{Maltodextrose: Ptr(supplement.Grams(2.0))},
 			},
 			wantErr: nil,
 			wantStore: map[string]supplement.Supplement{
-				"1234567890123": {
-					Gtin:          "1234567890123",
+				"01234567890128": {
+					Gtin:          "01234567890128",
 					Name:          "name",
 					Brand:         "brand",
 					Flavor:        "flavor",
-					Maltodextrose: 2.0,
+					Maltodextrose: supplement.Grams(2.0),
+					Version:       1,
 				},
 			},
 		},
@@ -783,8 +1266,8 @@ func TestSupplementService_Update(t *testing.T) {
 			name: "invalid fructose",
 			fields: fields{
 				repository: &stubSupplementRepository{store: map[string]supplement.Supplement{
-					"1234567890123": {
-						Gtin:   "1234567890123",
+					"01234567890128": {
+						Gtin:   "01234567890128",
 						Name:   "name",
 						Brand:  "brand",
 						Flavor: "flavor",
@@ -793,13 +1276,13 @@ func TestSupplementService_Update(t *testing.T) {
 			},
 			args: args{
 				ctx:   context.TODO(),
-				gtin:  "1234567890123",
-				other: supplement.UpdatableSupplement{Fructose: Ptr(float32(-1.0))},
+				gtin:  "01234567890128",
+				other: supplement.UpdatableSupplement{Fructose: Ptr(supplement.Grams(-1.0))},
 			},
 			wantErr: supplement.ErrInvalidSupplement,
 			wantStore: map[string]supplement.Supplement{
-				"1234567890123": {
-					Gtin:   "1234567890123",
+				"01234567890128": {
+					Gtin:   "01234567890128",
 					Name:   "name",
 					Brand:  "brand",
 					Flavor: "flavor",
@@ -810,28 +1293,29 @@ func TestSupplementService_Update(t *testing.T) {
 			name: "valid fructose",
 			fields: fields{
 				repository: &stubSupplementRepository{store: map[string]supplement.Supplement{
-					"1234567890123": {
-						Gtin:     "1234567890123",
+					"01234567890128": {
+						Gtin:     "01234567890128",
 						Name:     "name",
 						Brand:    "brand",
 						Flavor:   "flavor",
-						Fructose: 1.0,
+						Fructose: supplement.Grams(1.0),
 					},
 				}},
 			},
 			args: args{
 				ctx:   context.TODO(),
-				gtin:  "1234567890123",
-				other: supplement.UpdatableSupplement{Fructose: Ptr(float32(2.0))},
+				gtin:  "01234567890128",
+				other: supplement.UpdatableSupplement{Fructose: Ptr(supplement.Grams(2.0))},
 			},
 			wantErr: nil,
 			wantStore: map[string]supplement.Supplement{
-				"1234567890123": {
-					Gtin:     "1234567890123",
+				"01234567890128": {
+					Gtin:     "01234567890128",
 					Name:     "name",
 					Brand:    "brand",
 					Flavor:   "flavor",
-					Fructose: 2.0,
+					Fructose: supplement.Grams(2.0),
+					Version:  1,
 				},
 			},
 		},
@@ -839,8 +1323,8 @@ func TestSupplementService_Update(t *testing.T) {
 			name: "invalid caffeine",
 			fields: fields{
 				repository: &stubSupplementRepository{store: map[string]supplement.Supplement{
-					"1234567890123": {
-						Gtin:   "1234567890123",
+					"01234567890128": {
+						Gtin:   "01234567890128",
 						Name:   "name",
 						Brand:  "brand",
 						Flavor: "flavor",
@@ -849,13 +1333,13 @@ func TestSupplementService_Update(t *testing.T) {
 			},
 			args: args{
 				ctx:   context.TODO(),
-				gtin:  "1234567890123",
-				other: supplement.UpdatableSupplement{Caffeine: Ptr(float32(-1.0))},
+				gtin:  "01234567890128",
+				other: supplement.UpdatableSupplement{Caffeine: Ptr(supplement.Milligrams(-1.0))},
 			},
 			wantErr: supplement.ErrInvalidSupplement,
 			wantStore: map[string]supplement.Supplement{
-				"1234567890123": {
-					Gtin:   "1234567890123",
+				"01234567890128": {
+					Gtin:   "01234567890128",
 					Name:   "name",
 					Brand:  "brand",
 					Flavor: "flavor",
@@ -866,28 +1350,29 @@ func TestSupplementService_Update(t *testing.T) {
 			name: "valid caffeine",
 			fields: fields{
 				repository: &stubSupplementRepository{store: map[string]supplement.Supplement{
-					"1234567890123": {
-						Gtin:     "1234567890123",
+					"01234567890128": {
+						Gtin:     "01234567890128",
 						Name:     "name",
 						Brand:    "brand",
 						Flavor:   "flavor",
-						Caffeine: 1.0,
+						Caffeine: supplement.Milligrams(1.0),
 					},
 				}},
 			},
 			args: args{
 				ctx:   context.TODO(),
-				gtin:  "1234567890123",
-				other: supplement.UpdatableSupplement{Caffeine: Ptr(float32(2.0))},
+				gtin:  "01234567890128",
+				other: supplement.UpdatableSupplement{Caffeine: Ptr(supplement.Milligrams(2.0))},
 			},
 			wantErr: nil,
 			wantStore: map[string]supplement.Supplement{
-				"1234567890123": {
-					Gtin:     "1234567890123",
+				"01234567890128": {
+					Gtin:     "01234567890128",
 					Name:     "name",
 					Brand:    "brand",
 					Flavor:   "flavor",
-					Caffeine: 2.0,
+					Caffeine: supplement.Milligrams(2.0),
+					Version:  1,
 				},
 			},
 		},
@@ -895,8 +1380,8 @@ func TestSupplementService_Update(t *testing.T) {
 			name: "invalid sodium",
 			fields: fields{
 				repository: &stubSupplementRepository{store: map[string]supplement.Supplement{
-					"1234567890123": {
-						Gtin:   "1234567890123",
+					"01234567890128": {
+						Gtin:   "01234567890128",
 						Name:   "name",
 						Brand:  "brand",
 						Flavor: "flavor",
@@ -905,13 +1390,13 @@ func TestSupplementService_Update(t *testing.T) {
 			},
 			args: args{
 				ctx:   context.TODO(),
-				gtin:  "1234567890123",
-				other: supplement.UpdatableSupplement{Sodium: Ptr(float32(-1.0))},
+				gtin:  "01234567890128",
+				other: supplement.UpdatableSupplement{Sodium: Ptr(supplement.Milligrams(-1.0))},
 			},
 			wantErr: supplement.ErrInvalidSupplement,
 			wantStore: map[string]supplement.Supplement{
-				"1234567890123": {
-					Gtin:   "1234567890123",
+				"01234567890128": {
+					Gtin:   "01234567890128",
 					Name:   "name",
 					Brand:  "brand",
 					Flavor: "flavor",
@@ -922,28 +1407,29 @@ func TestSupplementService_Update(t *testing.T) {
 			name: "valid sodium",
 			fields: fields{
 				repository: &stubSupplementRepository{store: map[string]supplement.Supplement{
-					"1234567890123": {
-						Gtin:   "1234567890123",
+					"01234567890128": {
+						Gtin:   "01234567890128",
 						Name:   "name",
 						Brand:  "brand",
 						Flavor: "flavor",
-						Sodium: 1.0,
+						Sodium: supplement.Milligrams(1.0),
 					},
 				}},
 			},
 			args: args{
 				ctx:   context.TODO(),
-				gtin:  "1234567890123",
-				other: supplement.UpdatableSupplement{Sodium: Ptr(float32(2.0))},
+				gtin:  "01234567890128",
+				other: supplement.UpdatableSupplement{Sodium: Ptr(supplement.Milligrams(2.0))},
 			},
 			wantErr: nil,
 			wantStore: map[string]supplement.Supplement{
-				"1234567890123": {
-					Gtin:   "1234567890123",
-					Name:   "name",
-					Brand:  "brand",
-					Flavor: "flavor",
-					Sodium: 2.0,
+				"01234567890128": {
+					Gtin:    "01234567890128",
+					Name:    "name",
+					Brand:   "brand",
+					Flavor:  "flavor",
+					Sodium:  supplement.Milligrams(2.0),
+					Version: 1,
 				},
 			},
 		},
@@ -951,8 +1437,8 @@ func TestSupplementService_Update(t *testing.T) {
 			name: "invalid protein",
 			fields: fields{
 				repository: &stubSupplementRepository{store: map[string]supplement.Supplement{
-					"1234567890123": {
-						Gtin:   "1234567890123",
+					"01234567890128": {
+						Gtin:   "01234567890128",
 						Name:   "name",
 						Brand:  "brand",
 						Flavor: "flavor",
@@ -961,13 +1447,13 @@ func TestSupplementService_Update(t *testing.T) {
 			},
 			args: args{
 				ctx:   context.TODO(),
-				gtin:  "1234567890123",
-				other: supplement.UpdatableSupplement{Protein: Ptr(float32(-1.0))},
+				gtin:  "01234567890128",
+				other: supplement.UpdatableSupplement{Protein: Ptr(supplement.Grams(-1.0))},
 			},
 			wantErr: supplement.ErrInvalidSupplement,
 			wantStore: map[string]supplement.Supplement{
-				"1234567890123": {
-					Gtin:   "1234567890123",
+				"01234567890128": {
+					Gtin:   "01234567890128",
 					Name:   "name",
 					Brand:  "brand",
 					Flavor: "flavor",
@@ -978,28 +1464,29 @@ func TestSupplementService_Update(t *testing.T) {
 			name: "valid protein",
 			fields: fields{
 				repository: &stubSupplementRepository{store: map[string]supplement.Supplement{
-					"1234567890123": {
-						Gtin:    "1234567890123",
+					"01234567890128": {
+						Gtin:    "01234567890128",
 						Name:    "name",
 						Brand:   "brand",
 						Flavor:  "flavor",
-						Protein: 1.0,
+						Protein: supplement.Grams(1.0),
 					},
 				}},
 			},
 			args: args{
 				ctx:   context.TODO(),
-				gtin:  "1234567890123",
-				other: supplement.UpdatableSupplement{Protein: Ptr(float32(2.0))},
+				gtin:  "01234567890128",
+				other: supplement.UpdatableSupplement{Protein: Ptr(supplement.Grams(2.0))},
 			},
 			wantErr: nil,
 			wantStore: map[string]supplement.Supplement{
-				"1234567890123": {
-					Gtin:    "1234567890123",
+				"01234567890128": {
+					Gtin:    "01234567890128",
 					Name:    "name",
 					Brand:   "brand",
 					Flavor:  "flavor",
-					Protein: 2.0,
+					Protein: supplement.Grams(2.0),
+					Version: 1,
 				},
 			},
 		},
@@ -1007,77 +1494,347 @@ func TestSupplementService_Update(t *testing.T) {
 			name: "valid supplement",
 			fields: fields{
 				repository: &stubSupplementRepository{store: map[string]supplement.Supplement{
-					"1234567890123": {
-						Gtin:          "1234567890123",
+					"01234567890128": {
+						Gtin:          "01234567890128",
 						Name:          "name",
 						Brand:         "brand",
 						Flavor:        "flavor",
-						Carbohydrates: 1.0,
-						Electrolytes:  1.0,
-						Maltodextrose: 1.0,
-						Fructose:      1.0,
-						Caffeine:      1.0,
-						Sodium:        1.0,
-						Protein:       1.0,
+						Carbohydrates: supplement.Grams(1.0),
+						Electrolytes:  supplement.Milligrams(1.0),
+						Maltodextrose: supplement.Grams(1.0),
+						Fructose:      supplement.Grams(1.0),
+						Caffeine:      supplement.Milligrams(1.0),
+						Sodium:        supplement.Milligrams(1.0),
+						Protein:       supplement.Grams(1.0),
 					},
 				}},
 			},
 			args: args{
 				ctx:  context.TODO(),
-				gtin: "1234567890123",
+				gtin: "01234567890128",
 				other: supplement.UpdatableSupplement{
 					Name:          Ptr("updated name"),
 					Brand:         Ptr("updated brand"),
 					Flavor:        Ptr("updated flavor"),
-					Carbohydrates: Ptr(float32(2.0)),
-					Electrolytes:  Ptr(float32(2.0)),
-					Maltodextrose: Ptr(float32(2.0)),
-					Fructose:      Ptr(float32(2.0)),
-					Caffeine:      Ptr(float32(2.0)),
-					Sodium:        Ptr(float32(2.0)),
-					Protein:       Ptr(float32(2.0)),
+					Carbohydrates: Ptr(supplement.Grams(2.0)),
+					Electrolytes:  Ptr(supplement.Milligrams(2.0)),
+					Maltodextrose: Ptr(supplement.Grams(2.0)),
+					Fructose:      Ptr(supplement.Grams(2.0)),
+					Caffeine:      Ptr(supplement.Milligrams(2.0)),
+					Sodium:        Ptr(supplement.Milligrams(2.0)),
+					Protein:       Ptr(supplement.Grams(2.0)),
 				},
 			},
 			wantErr: nil,
 			wantStore: map[string]supplement.Supplement{
-				"1234567890123": {
-					Gtin:          "1234567890123",
+				"01234567890128": {
+					Gtin:          "01234567890128",
 					Name:          "updated name",
 					Brand:         "updated brand",
 					Flavor:        "updated flavor",
-					Carbohydrates: 2.0,
-					Electrolytes:  2.0,
-					Maltodextrose: 2.0,
-					Fructose:      2.0,
-					Caffeine:      2.0,
-					Sodium:        2.0,
-					Protein:       2.0,
+					Carbohydrates: supplement.Grams(2.0),
+					Electrolytes:  supplement.Milligrams(2.0),
+					Maltodextrose: supplement.Grams(2.0),
+					Fructose:      supplement.Grams(2.0),
+					Caffeine:      supplement.Milligrams(2.0),
+					Sodium:        supplement.Milligrams(2.0),
+					Protein:       supplement.Grams(2.0),
+					Version:       1,
 				},
 			},
 		},
-	}
-	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			t.Parallel()
-			service := supplement.NewSupplementService(tt.fields.repository)
-			if err := service.Update(tt.args.ctx, tt.args.gtin, tt.args.other); !errors.Is(err, tt.wantErr) {
-				t.Errorf("SupplementService.Update() error = %v, wantErr %v", err, tt.wantErr)
+		{
+			name: "matching version",
+			fields: fields{
+				repository: &stubSupplementRepository{store: map[string]supplement.Supplement{
+					"01234567890128": {Gtin: "01234567890128", Name: "name", Brand: "brand", Flavor: "flavor", Version: 3},
+				}},
+			},
+			args: args{
+				ctx:     context.TODO(),
+				gtin:    "01234567890128",
+				other:   supplement.UpdatableSupplement{Name: Ptr("updated name")},
+				version: 3,
+			},
+			wantErr: nil,
+			wantStore: map[string]supplement.Supplement{
+				"01234567890128": {Gtin: "01234567890128", Name: "updated name", Brand: "brand", Flavor: "flavor", Version: 4},
+			},
+		},
+		{
+			name: "stale version",
+			fields: fields{
+				repository: &stubSupplementRepository{store: map[string]supplement.Supplement{
+					"01234567890128": {Gtin: "01234567890128", Name: "name", Brand: "brand", Flavor: "flavor", Version: 3},
+				}},
+			},
+			args: args{
+				ctx:     context.TODO(),
+				gtin:    "01234567890128",
+				other:   supplement.UpdatableSupplement{Name: Ptr("updated name")},
+				version: 2,
+			},
+			wantErr: supplement.ErrPreconditionFailed,
+			wantStore: map[string]supplement.Supplement{
+				"01234567890128": {Gtin: "01234567890128", Name: "name", Brand: "brand", Flavor: "flavor", Version: 3},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			service := supplement.NewSupplementService(tt.fields.repository)
+			if err := service.Update(tt.args.ctx, tt.args.gtin, tt.args.other, tt.args.version); !errors.Is(err, tt.wantErr) {
+				t.Errorf("SupplementService.Update() error = %v, wantErr %v", err, tt.wantErr)
 			}
-			if diff := cmp.Diff(tt.fields.repository.(*stubSupplementRepository).store, tt.wantStore); diff != "" {
+			if diff := cmp.Diff(tt.fields.repository.(*stubSupplementRepository).store, tt.wantStore, equateOmittedNutrients); diff != "" {
 				t.Errorf("SupplementService.Update() store mismatch (-got +want):\n%s", diff)
 			}
 		})
 	}
 }
 
+func TestSupplementService_Patch(t *testing.T) {
+	t.Parallel()
+	stored := supplement.Supplement{Gtin: "01234567890128", Name: "name", Brand: "brand", Flavor: "flavor", Caffeine: supplement.Milligrams(1.0), Sodium: supplement.Milligrams(1.0)}
+	mergePatch := func(patch string) supplement.Patch {
+		p, err := supplement.NewMergePatch([]byte(patch))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return p
+	}
+	jsonPatch := func(patch string) supplement.Patch {
+		p, err := supplement.NewJSONPatch([]byte(patch))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return p
+	}
+	tests := []struct {
+		name      string
+		patch     supplement.Patch
+		wantErr   error
+		wantStore supplement.Supplement
+	}{
+		{
+			name:      "merge patch",
+			patch:     mergePatch(`{"name": "updated name", "caffeine": null}`),
+			wantStore: supplement.Supplement{Gtin: "01234567890128", Name: "updated name", Brand: "brand", Flavor: "flavor", Sodium: supplement.Milligrams(1.0), Version: 1},
+		},
+		{
+			name:      "merge patch converting units",
+			patch:     mergePatch(`{"sodium": {"amount": 0.5, "unit": "g"}}`),
+			wantStore: supplement.Supplement{Gtin: "01234567890128", Name: "name", Brand: "brand", Flavor: "flavor", Caffeine: supplement.Milligrams(1.0), Sodium: supplement.Milligrams(500), Version: 1},
+		},
+		{
+			name:      "merge patch with unknown member",
+			patch:     mergePatch(`{"colour": "red"}`),
+			wantErr:   supplement.ErrInvalidPatch,
+			wantStore: stored,
+		},
+		{
+			name:      "merge patch changing gtin",
+			patch:     mergePatch(`{"gtin": "04006381333931"}`),
+			wantErr:   supplement.ErrInvalidSupplement,
+			wantStore: stored,
+		},
+		{
+			name:      "merge patch making supplement invalid",
+			patch:     mergePatch(`{"name": null}`),
+			wantErr:   supplement.ErrInvalidSupplement,
+			wantStore: stored,
+		},
+		{
+			name:      "json patch",
+			patch:     jsonPatch(`[{"op": "test", "path": "/caffeine/amount", "value": 1}, {"op": "replace", "path": "/caffeine", "value": 2}]`),
+			wantStore: supplement.Supplement{Gtin: "01234567890128", Name: "name", Brand: "brand", Flavor: "flavor", Caffeine: supplement.Milligrams(2.0), Sodium: supplement.Milligrams(1.0), Version: 1},
+		},
+		{
+			name:      "json patch with failing test",
+			patch:     jsonPatch(`[{"op": "test", "path": "/caffeine/amount", "value": 5}, {"op": "replace", "path": "/caffeine", "value": 2}]`),
+			wantErr:   supplement.ErrPatchTestFailed,
+			wantStore: stored,
+		},
+		{
+			name:      "json patch on missing path",
+			patch:     jsonPatch(`[{"op": "replace", "path": "/colour", "value": "red"}]`),
+			wantErr:   supplement.ErrInvalidPatch,
+			wantStore: stored,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			repository := &stubSupplementRepository{store: map[string]supplement.Supplement{stored.Gtin: stored}}
+			service := supplement.NewSupplementService(repository)
+			if err := service.Patch(context.TODO(), stored.Gtin, tt.patch, 0); !errors.Is(err, tt.wantErr) {
+				t.Errorf("SupplementService.Patch() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if diff := cmp.Diff(repository.store[stored.Gtin], tt.wantStore, equateOmittedNutrients); diff != "" {
+				t.Errorf("SupplementService.Patch() store mismatch (-got +want):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestSupplementService_Replace(t *testing.T) {
+	t.Parallel()
+	type fields struct {
+		repository supplement.SupplementRepository
+	}
+	type args struct {
+		ctx         context.Context
+		gtin        string
+		replacement supplement.Supplement
+		version     int64
+	}
+	tests := []struct {
+		name        string
+		fields      fields
+		args        args
+		wantCreated bool
+		wantErr     error
+		wantStore   map[string]supplement.Supplement
+	}{
+		{
+			name: "created",
+			fields: fields{
+				repository: &stubSupplementRepository{store: map[string]supplement.Supplement{}},
+			},
+			args: args{
+				ctx:         context.TODO(),
+				gtin:        "4006381333931",
+				replacement: supplement.Supplement{Name: "name", Brand: "brand", Flavor: "flavor", Caffeine: supplement.Milligrams(1.0)},
+			},
+			wantCreated: true,
+			wantErr:     nil,
+			wantStore: map[string]supplement.Supplement{
+				"04006381333931": {Gtin: "04006381333931", Name: "name", Brand: "brand", Flavor: "flavor", Caffeine: supplement.Milligrams(1.0)},
+			},
+		},
+		{
+			name: "replaced",
+			fields: fields{
+				repository: &stubSupplementRepository{store: map[string]supplement.Supplement{
+					"01234567890128": {Gtin: "01234567890128", Name: "name", Brand: "brand", Flavor: "flavor", Caffeine: supplement.Milligrams(1.0), Sodium: supplement.Milligrams(1.0), Version: 1},
+				}},
+			},
+			args: args{
+				ctx:         context.TODO(),
+				gtin:        "01234567890128",
+				replacement: supplement.Supplement{Gtin: "01234567890128", Name: "updated name", Brand: "brand", Flavor: "flavor", Sodium: supplement.Milligrams(2.0)},
+			},
+			wantCreated: false,
+			wantErr:     nil,
+			wantStore: map[string]supplement.Supplement{
+				"01234567890128": {Gtin: "01234567890128", Name: "updated name", Brand: "brand", Flavor: "flavor", Sodium: supplement.Milligrams(2.0), Version: 2},
+			},
+		},
+		{
+			name: "gtin mismatch",
+			fields: fields{
+				repository: &stubSupplementRepository{store: map[string]supplement.Supplement{}},
+			},
+			args: args{
+				ctx:         context.TODO(),
+				gtin:        "01234567890128",
+				replacement: supplement.Supplement{Gtin: "04006381333931", Name: "name", Brand: "brand", Flavor: "flavor"},
+			},
+			wantErr:   supplement.ErrInvalidSupplement,
+			wantStore: map[string]supplement.Supplement{},
+		},
+		{
+			name: "invalid supplement",
+			fields: fields{
+				repository: &stubSupplementRepository{store: map[string]supplement.Supplement{
+					"01234567890128": {Gtin: "01234567890128", Name: "name", Brand: "brand", Flavor: "flavor"},
+				}},
+			},
+			args: args{
+				ctx:         context.TODO(),
+				gtin:        "01234567890128",
+				replacement: supplement.Supplement{Name: "name", Brand: "brand"},
+			},
+			wantErr: supplement.ErrInvalidSupplement,
+			wantStore: map[string]supplement.Supplement{
+				"01234567890128": {Gtin: "01234567890128", Name: "name", Brand: "brand", Flavor: "flavor"},
+			},
+		},
+		{
+			name: "stale version",
+			fields: fields{
+				repository: &stubSupplementRepository{store: map[string]supplement.Supplement{
+					"01234567890128": {Gtin: "01234567890128", Name: "name", Brand: "brand", Flavor: "flavor", Version: 3},
+				}},
+			},
+			args: args{
+				ctx:         context.TODO(),
+				gtin:        "01234567890128",
+				replacement: supplement.Supplement{Name: "updated name", Brand: "brand", Flavor: "flavor"},
+				version:     2,
+			},
+			wantErr: supplement.ErrPreconditionFailed,
+			wantStore: map[string]supplement.Supplement{
+				"01234567890128": {Gtin: "01234567890128", Name: "name", Brand: "brand", Flavor: "flavor", Version: 3},
+			},
+		},
+		{
+			// The stub finds no tombstones, but its GTIN cannot be created.
+			name: "deleted supplement",
+			fields: fields{
+				repository: &stubSupplementRepository{store: map[string]supplement.Supplement{}, createErr: supplement.ErrAlreadyExists},
+			},
+			args: args{
+				ctx:         context.TODO(),
+				gtin:        "01234567890128",
+				replacement: supplement.Supplement{Name: "name", Brand: "brand", Flavor: "flavor"},
+			},
+			wantErr:   supplement.ErrAlreadyExists,
+			wantStore: map[string]supplement.Supplement{},
+		},
+		{
+			name: "version of missing supplement",
+			fields: fields{
+				repository: &stubSupplementRepository{store: map[string]supplement.Supplement{}},
+			},
+			args: args{
+				ctx:         context.TODO(),
+				gtin:        "01234567890128",
+				replacement: supplement.Supplement{Name: "name", Brand: "brand", Flavor: "flavor"},
+				version:     1,
+			},
+			wantErr:   supplement.ErrPreconditionFailed,
+			wantStore: map[string]supplement.Supplement{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			service := supplement.NewSupplementService(tt.fields.repository)
+			created, err := service.Replace(tt.args.ctx, tt.args.gtin, tt.args.replacement, tt.args.version)
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("SupplementService.Replace() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if created != tt.wantCreated {
+				t.Errorf("SupplementService.Replace() created = %v, want %v", created, tt.wantCreated)
+			}
+			if diff := cmp.Diff(tt.fields.repository.(*stubSupplementRepository).store, tt.wantStore, equateOmittedNutrients); diff != "" {
+				t.Errorf("SupplementService.Replace() store mismatch (-got +want):\n%s", diff)
+			}
+		})
+	}
+}
+
 func TestSupplementService_Delete(t *testing.T) {
 	t.Parallel()
 	type fields struct {
 		repository supplement.SupplementRepository
 	}
 	type args struct {
-		ctx  context.Context
-		gtin string
+		ctx     context.Context
+		gtin    string
+		version int64
 	}
 	tests := []struct {
 		name      string
@@ -1093,7 +1850,7 @@ func TestSupplementService_Delete(t *testing.T) {
 			},
 			args: args{
 				ctx:  context.TODO(),
-				gtin: "1234567890123",
+				gtin: "01234567890128",
 			},
 			wantErr:   supplement.ErrNotFound,
 			wantStore: map[string]supplement.Supplement{},
@@ -1102,25 +1859,42 @@ func TestSupplementService_Delete(t *testing.T) {
 			name: "success",
 			fields: fields{
 				repository: &stubSupplementRepository{store: map[string]supplement.Supplement{
-					"1234567890123": {Gtin: "1234567890123"},
+					"01234567890128": {Gtin: "01234567890128"},
 				}},
 			},
 			args: args{
 				ctx:  context.TODO(),
-				gtin: "1234567890123",
+				gtin: "01234567890128",
 			},
 			wantErr:   nil,
 			wantStore: map[string]supplement.Supplement{},
 		},
+		{
+			name: "stale version",
+			fields: fields{
+				repository: &stubSupplementRepository{store: map[string]supplement.Supplement{
+					"01234567890128": {Gtin: "01234567890128", Version: 2},
+				}},
+			},
+			args: args{
+				ctx:     context.TODO(),
+				gtin:    "01234567890128",
+				version: 1,
+			},
+			wantErr: supplement.ErrPreconditionFailed,
+			wantStore: map[string]supplement.Supplement{
+				"01234567890128": {Gtin: "01234567890128", Version: 2},
+			},
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			t.Parallel()
 			service := supplement.NewSupplementService(tt.fields.repository)
-			if err := service.Delete(tt.args.ctx, tt.args.gtin); !errors.Is(err, tt.wantErr) {
+			if err := service.Delete(tt.args.ctx, tt.args.gtin, tt.args.version); !errors.Is(err, tt.wantErr) {
 				t.Errorf("SupplementService.Delete() error = %v, wantErr %v", err, tt.wantErr)
 			}
-			if diff := cmp.Diff(tt.fields.repository.(*stubSupplementRepository).store, tt.wantStore); diff != "" {
+			if diff := cmp.Diff(tt.fields.repository.(*stubSupplementRepository).store, tt.wantStore, equateOmittedNutrients); diff != "" {
 				t.Errorf("SupplementService.Delete() store mismatch (-got +want):\n%s", diff)
 			}
 		})
@@ -1133,7 +1907,8 @@ func TestSupplementService_ListAll(t *testing.T) {
 		repository supplement.SupplementRepository
 	}
 	type args struct {
-		ctx context.Context
+		ctx   context.Context
+		query supplement.ListQuery
 	}
 	tests := []struct {
 		name   string
@@ -1159,29 +1934,146 @@ func TestSupplementService_ListAll(t *testing.T) {
 			name: "non-empty store",
 			fields: fields{
 				repository: &stubSupplementRepository{store: map[string]supplement.Supplement{
-					"1234567890123": {Gtin: "1234567890123"},
-					"1234567890124": {Gtin: "1234567890124"},
+					"01234567890128": {Gtin: "01234567890128"},
+					"04006381333931": {Gtin: "04006381333931"},
 				}},
 			},
 			args: args{
 				ctx: context.TODO(),
 			},
 			want: []supplement.Supplement{
-				{Gtin: "1234567890123"},
-				{Gtin: "1234567890124"},
+				{Gtin: "01234567890128"},
+				{Gtin: "04006381333931"},
 			},
 			wantErr: nil,
 			wantStore: map[string]supplement.Supplement{
-				"1234567890123": {Gtin: "1234567890123"},
-				"1234567890124": {Gtin: "1234567890124"},
+				"01234567890128": {Gtin: "01234567890128"},
+				"04006381333931": {Gtin: "04006381333931"},
 			},
 		},
+		{
+			name: "first page",
+			fields: fields{
+				repository: &stubSupplementRepository{store: map[string]supplement.Supplement{
+					"01234567890128": {Gtin: "01234567890128"},
+					"04006381333931": {Gtin: "04006381333931"},
+					"05901234123457": {Gtin: "05901234123457"},
+				}},
+			},
+			args: args{
+				ctx:   context.TODO(),
+				query: supplement.ListQuery{Limit: 2},
+			},
+			want: []supplement.Supplement{
+				{Gtin: "01234567890128"},
+				{Gtin: "04006381333931"},
+			},
+			wantErr: nil,
+			wantStore: map[string]supplement.Supplement{
+				"01234567890128": {Gtin: "01234567890128"},
+				"04006381333931": {Gtin: "04006381333931"},
+				"05901234123457": {Gtin: "05901234123457"},
+			},
+		},
+		{
+			name: "limit too big",
+			fields: fields{
+				repository: &stubSupplementRepository{store: map[string]supplement.Supplement{}},
+			},
+			args: args{
+				ctx:   context.TODO(),
+				query: supplement.ListQuery{Limit: supplement.MaxPageSize + 1},
+			},
+			want:      nil,
+			wantErr:   supplement.ErrInvalidQuery,
+			wantStore: map[string]supplement.Supplement{},
+		},
+		{
+			name: "tampered cursor",
+			fields: fields{
+				repository: &stubSupplementRepository{store: map[string]supplement.Supplement{}},
+			},
+			args: args{
+				ctx:   context.TODO(),
+				query: supplement.ListQuery{Cursor: "eyJnIjoiMTIzNDU2Nzg5MDEyMyJ9.c2lnbmF0dXJl"},
+			},
+			want:      nil,
+			wantErr:   supplement.ErrInvalidCursor,
+			wantStore: map[string]supplement.Supplement{},
+		},
+		{
+			name: "unknown sort field",
+			fields: fields{
+				repository: &stubSupplementRepository{store: map[string]supplement.Supplement{}},
+			},
+			args: args{
+				ctx:   context.TODO(),
+				query: supplement.ListQuery{SortBy: "price"},
+			},
+			want:      nil,
+			wantErr:   supplement.ErrInvalidQuery,
+			wantStore: map[string]supplement.Supplement{},
+		},
+		{
+			name: "unknown sort direction",
+			fields: fields{
+				repository: &stubSupplementRepository{store: map[string]supplement.Supplement{}},
+			},
+			args: args{
+				ctx:   context.TODO(),
+				query: supplement.ListQuery{SortDirection: "up"},
+			},
+			want:      nil,
+			wantErr:   supplement.ErrInvalidQuery,
+			wantStore: map[string]supplement.Supplement{},
+		},
+		{
+			name: "unknown category",
+			fields: fields{
+				repository: &stubSupplementRepository{store: map[string]supplement.Supplement{}},
+			},
+			args: args{
+				ctx:   context.TODO(),
+				query: supplement.ListQuery{Category: "sachet"},
+			},
+			want:      nil,
+			wantErr:   supplement.ErrInvalidQuery,
+			wantStore: map[string]supplement.Supplement{},
+		},
+		{
+			name: "unknown excluded allergen",
+			fields: fields{
+				repository: &stubSupplementRepository{store: map[string]supplement.Supplement{}},
+			},
+			args: args{
+				ctx:   context.TODO(),
+				query: supplement.ListQuery{ExcludeAllergens: []supplement.Allergen{supplement.AllergenMilk, "dairy"}},
+			},
+			want:      nil,
+			wantErr:   supplement.ErrInvalidQuery,
+			wantStore: map[string]supplement.Supplement{},
+		},
+		{
+			name: "inverted nutrient range",
+			fields: fields{
+				repository: &stubSupplementRepository{store: map[string]supplement.Supplement{}},
+			},
+			args: args{
+				ctx: context.TODO(),
+				query: supplement.ListQuery{NutrientRanges: []supplement.NutrientRange{
+					{Nutrient: supplement.Caffeine, Min: Ptr[float64](100), Max: Ptr[float64](50)},
+				}},
+			},
+			want:      nil,
+			wantErr:   supplement.ErrInvalidQuery,
+			wantStore: map[string]supplement.Supplement{},
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			t.Parallel()
 			service := supplement.NewSupplementService(tt.fields.repository)
-			got, err := service.ListAll(tt.args.ctx)
+			got, err := service.ListAll(tt.args.ctx, tt.args.query)
 			less := func(a, b supplement.Supplement) bool {
 				return a.Gtin < b.Gtin
 			}
@@ -1189,12 +2081,211 @@ func TestSupplementService_ListAll(t *testing.T) {
 			if !errors.Is(err, tt.wantErr) {
 				t.Errorf("SupplementService.ListAll() error = %v, wantErr %v", err, tt.wantErr)
 			}
-			if diff := cmp.Diff(got, tt.want, cmpopts.EquateEmpty(), cmpopts.SortSlices(less)); diff != "" {
+			if diff := cmp.Diff(got.Supplements, tt.want, cmpopts.EquateEmpty(), cmpopts.SortSlices(less)); diff != "" {
 				t.Errorf("SupplementService.ListAll() (-got +want):\n%s", diff)
 			}
-			if diff := cmp.Diff(tt.fields.repository.(*stubSupplementRepository).store, tt.wantStore); diff != "" {
+			if diff := cmp.Diff(tt.fields.repository.(*stubSupplementRepository).store, tt.wantStore, equateOmittedNutrients); diff != "" {
 				t.Errorf("SupplementService.ListAll() store mismatch (-got +want):\n%s", diff)
 			}
 		})
 	}
 }
+
+func TestSupplementService_ListAll_Cursor(t *testing.T) {
+	t.Parallel()
+	store := map[string]supplement.Supplement{
+		"01234567890128": {Gtin: "01234567890128"},
+		"04006381333931": {Gtin: "04006381333931"},
+		"05901234123457": {Gtin: "05901234123457"},
+	}
+
+	t.Run("follows next cursors until the last page", func(t *testing.T) {
+		t.Parallel()
+		service := supplement.NewSupplementService(&stubSupplementRepository{store: store})
+		var got []supplement.Supplement
+		query := supplement.ListQuery{Limit: 2}
+		pages := 0
+
+		for {
+			page, err := service.ListAll(context.TODO(), query)
+			if err != nil {
+				t.Fatalf("SupplementService.ListAll() error = %v, want nil", err)
+			}
+			got = append(got, page.Supplements...)
+			pages++
+			if page.Next == "" {
+				break
+			}
+			query.Cursor = page.Next
+		}
+
+		want := []supplement.Supplement{
+			{Gtin: "01234567890128"},
+			{Gtin: "04006381333931"},
+			{Gtin: "05901234123457"},
+		}
+		if diff := cmp.Diff(got, want); diff != "" {
+			t.Errorf("SupplementService.ListAll() (-got +want):\n%s", diff)
+		}
+		if pages != 2 {
+			t.Errorf("SupplementService.ListAll() pages = %d, want 2", pages)
+		}
+	})
+
+	t.Run("cursor signed with another key", func(t *testing.T) {
+		t.Parallel()
+		issuer := supplement.NewSupplementService(&stubSupplementRepository{store: store}, supplement.WithCursorKey([]byte("one")))
+		service := supplement.NewSupplementService(&stubSupplementRepository{store: store}, supplement.WithCursorKey([]byte("two")))
+
+		page, err := issuer.ListAll(context.TODO(), supplement.ListQuery{Limit: 1})
+		if err != nil {
+			t.Fatalf("SupplementService.ListAll() error = %v, want nil", err)
+		}
+
+		_, err = service.ListAll(context.TODO(), supplement.ListQuery{Limit: 1, Cursor: page.Next})
+		if !errors.Is(err, supplement.ErrInvalidCursor) {
+			t.Errorf("SupplementService.ListAll() error = %v, wantErr %v", err, supplement.ErrInvalidCursor)
+		}
+	})
+
+	t.Run("cursor issued for another sort", func(t *testing.T) {
+		t.Parallel()
+		service := supplement.NewSupplementService(&stubSupplementRepository{store: store})
+
+		page, err := service.ListAll(context.TODO(), supplement.ListQuery{Limit: 1})
+		if err != nil {
+			t.Fatalf("SupplementService.ListAll() error = %v, want nil", err)
+		}
+
+		_, err = service.ListAll(context.TODO(), supplement.ListQuery{Limit: 1, Cursor: page.Next, SortDirection: supplement.Descending})
+		if !errors.Is(err, supplement.ErrInvalidCursor) {
+			t.Errorf("SupplementService.ListAll() error = %v, wantErr %v", err, supplement.ErrInvalidCursor)
+		}
+	})
+
+	t.Run("expired cursor", func(t *testing.T) {
+		t.Parallel()
+		service := supplement.NewSupplementService(&stubSupplementRepository{store: store}, supplement.WithCursorTTL(time.Millisecond))
+
+		page, err := service.ListAll(context.TODO(), supplement.ListQuery{Limit: 1})
+		if err != nil {
+			t.Fatalf("SupplementService.ListAll() error = %v, want nil", err)
+		}
+
+		time.Sleep(5 * time.Millisecond)
+
+		_, err = service.ListAll(context.TODO(), supplement.ListQuery{Limit: 1, Cursor: page.Next})
+		if !errors.Is(err, supplement.ErrInvalidCursor) {
+			t.Errorf("SupplementService.ListAll() error = %v, wantErr %v", err, supplement.ErrInvalidCursor)
+		}
+	})
+}
+
+func TestSupplementService_History(t *testing.T) {
+	t.Parallel()
+	entries := []supplement.AuditEntry{
+		{Gtin: "04006381333931", Version: 1, Operation: supplement.OperationCreate, Actor: "qa"},
+		{Gtin: "04006381333931", Version: 1, Operation: supplement.OperationDelete, Actor: "qa"},
+	}
+	repository := &stubSupplementRepository{
+		store:   map[string]supplement.Supplement{"05901234123457": {Gtin: "05901234123457", Name: "Bar", Brand: "Brand", Flavor: "Cocoa", Version: 1}},
+		history: map[string][]supplement.AuditEntry{"04006381333931": entries},
+	}
+	tests := []struct {
+		name    string
+		gtin    string
+		want    supplement.History
+		wantErr error
+	}{
+		{name: "deleted supplement", gtin: "4006381333931", want: supplement.History{Entries: entries}},
+		{name: "stored before the audit log", gtin: "5901234123457", want: supplement.History{Entries: []supplement.AuditEntry{}}},
+		{name: "never stored", gtin: "01234567890128", wantErr: supplement.ErrNotFound},
+		{name: "invalid gtin", gtin: "123", wantErr: supplement.ErrNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			service := supplement.NewSupplementService(repository)
+
+			got, err := service.History(context.TODO(), tt.gtin)
+
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("SupplementService.History() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if diff := cmp.Diff(got, tt.want); diff != "" {
+				t.Errorf("SupplementService.History() (-got +want):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestSupplementService_Restore(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name    string
+		gtin    string
+		want    *supplement.Supplement
+		wantErr error
+	}{
+		{name: "deleted supplement", gtin: "4006381333931", want: &supplement.Supplement{Gtin: "04006381333931", Name: "Gel", Version: 3}},
+		{name: "not deleted", gtin: "01234567890128", wantErr: supplement.ErrNotFound},
+		{name: "invalid gtin", gtin: "123", wantErr: supplement.ErrNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			repository := &stubSupplementRepository{
+				store: map[string]supplement.Supplement{"01234567890128": {Gtin: "01234567890128", Version: 1}},
+				deleted: map[string]supplement.Supplement{
+					"04006381333931": {Gtin: "04006381333931", Name: "Gel", Version: 2},
+				},
+			}
+			service := supplement.NewSupplementService(repository)
+
+			got, err := service.Restore(context.TODO(), tt.gtin)
+
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("SupplementService.Restore() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if diff := cmp.Diff(got, tt.want); diff != "" {
+				t.Errorf("SupplementService.Restore() (-got +want):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestSupplementService_Purge(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name      string
+		retention time.Duration
+		want      int
+		wantErr   bool
+	}{
+		{name: "past retention", retention: 24 * time.Hour, want: 1},
+		{name: "no retention", retention: 0, want: 2},
+		{name: "negative retention", retention: -time.Hour, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			repository := &stubSupplementRepository{
+				store: map[string]supplement.Supplement{},
+				deleted: map[string]supplement.Supplement{
+					"04006381333931": {Gtin: "04006381333931", DeletedAt: Ptr(time.Now().Add(-48 * time.Hour))},
+					"01234567890128": {Gtin: "01234567890128", DeletedAt: Ptr(time.Now().Add(-time.Hour))},
+				},
+			}
+			service := supplement.NewSupplementService(repository)
+
+			got, err := service.Purge(context.TODO(), tt.retention)
+
+			if (err != nil) != tt.wantErr {
+				t.Errorf("SupplementService.Purge() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("SupplementService.Purge() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,132 @@
+package supplement
+
+import (
+	"fmt"
+	"net/url"
+)
+
+// Serving is what nutrient amounts refer to: a serving of Size, in grams or
+// millilitres, of which a package holds ServingsPerPackage.
+type Serving struct {
+	Size               Quantity `json:"size"`
+	ServingsPerPackage int      `json:"servingsPerPackage"`
+}
+
+// Basis is what the nutrient amounts of a View refer to.
+type Basis string
+
+const (
+	PerServing Basis = "serving"
+	Per100g    Basis = "100g"
+	Per100ml   Basis = "100ml"
+)
+
+// View is a supplement with its nutrients expressed per Basis.
+type View struct {
+	Supplement
+	Basis Basis `json:"basis"`
+}
+
+// Per returns s with its nutrients per basis. A supplement without a serving
+// size in the unit of basis cannot be converted and stays per serving.
+func (s Supplement) Per(basis Basis) View {
+	var unit Unit
+	switch basis {
+	case Per100g:
+		unit = Gram
+	case Per100ml:
+		unit = Millilitre
+	default:
+		return View{Supplement: s, Basis: PerServing}
+	}
+
+	if s.Serving == nil || s.Serving.Size.Unit != unit || s.Serving.Size.Amount <= 0 {
+		return View{Supplement: s, Basis: PerServing}
+	}
+
+	factor := 100 / s.Serving.Size.Amount
+	for _, n := range Nutrients {
+		q := s.nutrient(n)
+		q.Amount = round(q.Amount*factor, NutrientScale)
+	}
+
+	if s.Micronutrients != nil {
+		panel := make(Panel, len(s.Micronutrients))
+		for m, q := range s.Micronutrients {
+			q.Amount = round(q.Amount*factor, NutrientScale)
+			panel[m] = q
+		}
+		s.Micronutrients = panel
+	}
+
+	return View{Supplement: s, Basis: basis}
+}
+
+// ViewPage is a Page with its supplements expressed per a basis.
+type ViewPage struct {
+	Supplements []View `json:"supplements"`
+	Next        string `json:"next,omitempty"`
+}
+
+func (p Page) Per(basis Basis) ViewPage {
+	views := make([]View, len(p.Supplements))
+	for i, s := range p.Supplements {
+		views[i] = s.Per(basis)
+	}
+	return ViewPage{Supplements: views, Next: p.Next}
+}
+
+// ParseBasis reads the basis URL query parameter, PerServing by default.
+func ParseBasis(values url.Values) (Basis, error) {
+	basis := Basis(values.Get("basis"))
+
+	switch basis {
+	case "":
+		return PerServing, nil
+	case PerServing, Per100g, Per100ml:
+		return basis, nil
+	default:
+		return "", newValidationError(ErrInvalidQuery, []Violation{{
+			Field:   "basis",
+			Rule:    RuleOneOf,
+			Value:   basis,
+			Message: fmt.Sprintf("basis %q is invalid, it must be one of %s, %s or %s", basis, PerServing, Per100g, Per100ml),
+		}})
+	}
+}
+
+func appendIfInvalidServing(violations []Violation, serving *Serving) []Violation {
+	if serving == nil {
+		return violations
+	}
+
+	size := serving.Size
+	if size.Unit != Gram && size.Unit != Millilitre {
+		violations = append(violations, Violation{
+			Field:   "serving.size.unit",
+			Rule:    RuleOneOf,
+			Value:   size.Unit,
+			Message: fmt.Sprintf("serving size unit %q is invalid, it must be %q or %q", size.Unit, Gram, Millilitre),
+		})
+	}
+
+	if size.Amount <= 0 || size.Amount > MaxNutrientAmount || !hasScale(size.Amount, NutrientScale) {
+		violations = append(violations, Violation{
+			Field:   "serving.size.amount",
+			Rule:    RuleRange,
+			Value:   size.Amount,
+			Message: fmt.Sprintf("serving size %g is invalid, it must be greater than zero and at most %.3f, with at most %d decimal places", size.Amount, MaxNutrientAmount, NutrientScale),
+		})
+	}
+
+	if serving.ServingsPerPackage < 1 {
+		violations = append(violations, Violation{
+			Field:   "serving.servingsPerPackage",
+			Rule:    RuleMin,
+			Value:   serving.ServingsPerPackage,
+			Message: fmt.Sprintf("servings per package %d is invalid, it must be at least 1", serving.ServingsPerPackage),
+		})
+	}
+
+	return violations
+}
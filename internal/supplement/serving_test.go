@@ -0,0 +1,106 @@
+package supplement_test
+
+import (
+	"errors"
+	"net/url"
+	"testing"
+
+	"github.com/marioromandono/supplementapp/internal/supplement"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestSupplement_Per(t *testing.T) {
+	t.Parallel()
+	gel := supplement.Supplement{
+		Gtin:           "01234567890128",
+		Serving:        &supplement.Serving{Size: supplement.Grams(40), ServingsPerPackage: 1},
+		Carbohydrates:  supplement.Grams(22),
+		Sodium:         supplement.Milligrams(50),
+		Micronutrients: supplement.Panel{supplement.Potassium: supplement.Milligrams(20)},
+	}
+	drink := supplement.Supplement{
+		Gtin:          "04006381333931",
+		Serving:       &supplement.Serving{Size: supplement.Millilitres(500), ServingsPerPackage: 1},
+		Carbohydrates: supplement.Grams(30),
+	}
+	unknown := supplement.Supplement{Gtin: "05901234123457", Carbohydrates: supplement.Grams(30)}
+
+	tests := []struct {
+		name  string
+		s     supplement.Supplement
+		basis supplement.Basis
+		want  supplement.View
+	}{
+		{
+			name:  "per serving",
+			s:     gel,
+			basis: supplement.PerServing,
+			want:  supplement.View{Supplement: gel, Basis: supplement.PerServing},
+		},
+		{
+			name:  "per 100 g",
+			s:     gel,
+			basis: supplement.Per100g,
+			want: supplement.View{
+				Supplement: supplement.Supplement{
+					Gtin:           gel.Gtin,
+					Serving:        gel.Serving,
+					Carbohydrates:  supplement.Grams(55),
+					Sodium:         supplement.Milligrams(125),
+					Micronutrients: supplement.Panel{supplement.Potassium: supplement.Milligrams(50)},
+				},
+				Basis: supplement.Per100g,
+			},
+		},
+		{
+			name:  "per 100 ml",
+			s:     drink,
+			basis: supplement.Per100ml,
+			want: supplement.View{
+				Supplement: supplement.Supplement{Gtin: drink.Gtin, Serving: drink.Serving, Carbohydrates: supplement.Grams(6)},
+				Basis:      supplement.Per100ml,
+			},
+		},
+		{
+			name:  "per 100 g of a drink",
+			s:     drink,
+			basis: supplement.Per100g,
+			want:  supplement.View{Supplement: drink, Basis: supplement.PerServing},
+		},
+		{
+			name:  "unknown serving",
+			s:     unknown,
+			basis: supplement.Per100g,
+			want:  supplement.View{Supplement: unknown, Basis: supplement.PerServing},
+		},
+	}
+	for _, tt := range tests {
+		if diff := cmp.Diff(tt.s.Per(tt.basis), tt.want); diff != "" {
+			t.Errorf("%s: Supplement.Per() mismatch (-got +want):\n%s", tt.name, diff)
+		}
+	}
+}
+
+func TestParseBasis(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name    string
+		values  url.Values
+		want    supplement.Basis
+		wantErr error
+	}{
+		{name: "default", values: url.Values{}, want: supplement.PerServing},
+		{name: "per 100 g", values: url.Values{"basis": {"100g"}}, want: supplement.Per100g},
+		{name: "invalid", values: url.Values{"basis": {"100oz"}}, wantErr: supplement.ErrInvalidQuery},
+	}
+	for _, tt := range tests {
+		got, err := supplement.ParseBasis(tt.values)
+		if !errors.Is(err, tt.wantErr) {
+			t.Errorf("%s: ParseBasis() error = %v, wantErr %v", tt.name, err, tt.wantErr)
+		}
+		if got != tt.want {
+			t.Errorf("%s: ParseBasis() = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,145 @@
+package supplement
+
+import (
+	"bytes"
+	"encoding/json"
+	"math"
+	"slices"
+	"strings"
+)
+
+type Unit string
+
+const (
+	Gram       Unit = "g"
+	Milligram  Unit = "mg"
+	Microgram  Unit = "mcg"
+	Millilitre Unit = "ml"
+)
+
+// MassUnits are the units nutrient amounts can be given in.
+var MassUnits = []Unit{Gram, Milligram, Microgram}
+
+// massExponents holds the power of ten of a gram each mass unit is.
+var massExponents = map[Unit]int{Gram: 0, Milligram: -3, Microgram: -6}
+
+// Quantity is an amount in a unit, {"amount": 300, "unit": "mg"} in JSON. A
+// bare number is also accepted; like a quantity without unit, it is taken to
+// be in the unit of the nutrient it describes.
+type Quantity struct {
+	Amount float64 `json:"amount"`
+	Unit   Unit    `json:"unit"`
+}
+
+func Grams(amount float64) Quantity {
+	return Quantity{Amount: amount, Unit: Gram}
+}
+
+func Milligrams(amount float64) Quantity {
+	return Quantity{Amount: amount, Unit: Milligram}
+}
+
+func Millilitres(amount float64) Quantity {
+	return Quantity{Amount: amount, Unit: Millilitre}
+}
+
+func (q *Quantity) UnmarshalJSON(data []byte) error {
+	var amount float64
+	if err := json.Unmarshal(data, &amount); err == nil {
+		*q = Quantity{Amount: amount}
+		return nil
+	}
+
+	type quantity Quantity
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	return decoder.Decode((*quantity)(q))
+}
+
+// In converts q to unit. Only mass units convert into each other.
+func (q Quantity) In(unit Unit) (Quantity, bool) {
+	if q.Unit == unit {
+		return q, true
+	}
+
+	from, ok := massExponents[q.Unit]
+	if !ok {
+		return Quantity{}, false
+	}
+	to, ok := massExponents[unit]
+	if !ok {
+		return Quantity{}, false
+	}
+
+	return Quantity{Amount: q.Amount * math.Pow10(from-to), Unit: unit}, true
+}
+
+// Unit is the unit amounts of n are stored, filtered and sorted in.
+func (n Nutrient) Unit() Unit {
+	switch n {
+	case Electrolytes, Caffeine, Sodium:
+		return Milligram
+	default:
+		return Gram
+	}
+}
+
+// Quantity returns amount in the unit of n.
+func (n Nutrient) Quantity(amount float64) Quantity {
+	return Quantity{Amount: amount, Unit: n.Unit()}
+}
+
+// nutrient returns the field of s holding n.
+func (s *Supplement) nutrient(n Nutrient) *Quantity {
+	switch n {
+	case Carbohydrates:
+		return &s.Carbohydrates
+	case Electrolytes:
+		return &s.Electrolytes
+	case Maltodextrose:
+		return &s.Maltodextrose
+	case Fructose:
+		return &s.Fructose
+	case Caffeine:
+		return &s.Caffeine
+	case Sodium:
+		return &s.Sodium
+	case Protein:
+		return &s.Protein
+	default:
+		return nil
+	}
+}
+
+// normalizeUnits converts every nutrient of a valid supplement to the unit it
+// is stored in.
+func (s *Supplement) normalizeUnits() {
+	for _, n := range Nutrients {
+		q := s.nutrient(n)
+		if q.Unit == "" {
+			q.Unit = n.Unit()
+		}
+		*q, _ = q.In(n.Unit())
+		q.Amount = round(q.Amount, NutrientScale)
+	}
+
+	if s.Serving != nil {
+		s.Serving.Size.Amount = round(s.Serving.Size.Amount, NutrientScale)
+	}
+}
+
+func round(value float64, scale int) float64 {
+	return math.Round(value*math.Pow10(scale)) / math.Pow10(scale)
+}
+
+func isMassUnit(unit Unit) bool {
+	return slices.Contains(MassUnits, unit)
+}
+
+func joinUnits(units []Unit) string {
+	names := make([]string, len(units))
+	for i, u := range units {
+		names[i] = string(u)
+	}
+	return strings.Join(names, ", ")
+}
@@ -0,0 +1,56 @@
+package supplement_test
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/marioromandono/supplementapp/internal/supplement"
+)
+
+func TestQuantity_UnmarshalJSON(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name    string
+		data    string
+		want    supplement.Quantity
+		wantErr bool
+	}{
+		{name: "quantity", data: `{"amount": 0.5, "unit": "g"}`, want: supplement.Grams(0.5)},
+		{name: "bare number", data: `300`, want: supplement.Quantity{Amount: 300}},
+		{name: "without unit", data: `{"amount": 300}`, want: supplement.Quantity{Amount: 300}},
+		{name: "unknown member", data: `{"amount": 300, "per": "serving"}`, wantErr: true},
+		{name: "string", data: `"300 mg"`, wantErr: true},
+	}
+	for _, tt := range tests {
+		var got supplement.Quantity
+		err := json.Unmarshal([]byte(tt.data), &got)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: json.Unmarshal() error = %v, wantErr %v", tt.name, err, tt.wantErr)
+		}
+		if err == nil && got != tt.want {
+			t.Errorf("%s: json.Unmarshal() = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestQuantity_In(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name   string
+		q      supplement.Quantity
+		unit   supplement.Unit
+		want   supplement.Quantity
+		wantOk bool
+	}{
+		{name: "same unit", q: supplement.Millilitres(500), unit: supplement.Millilitre, want: supplement.Millilitres(500), wantOk: true},
+		{name: "grams to milligrams", q: supplement.Grams(0.5), unit: supplement.Milligram, want: supplement.Milligrams(500), wantOk: true},
+		{name: "micrograms to milligrams", q: supplement.Quantity{Amount: 2000, Unit: supplement.Microgram}, unit: supplement.Milligram, want: supplement.Milligrams(2), wantOk: true},
+		{name: "volume to mass", q: supplement.Millilitres(500), unit: supplement.Gram, wantOk: false},
+	}
+	for _, tt := range tests {
+		got, ok := tt.q.In(tt.unit)
+		if ok != tt.wantOk || got != tt.want {
+			t.Errorf("%s: Quantity.In() = %v, %t, want %v, %t", tt.name, got, ok, tt.want, tt.wantOk)
+		}
+	}
+}
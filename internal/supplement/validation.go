@@ -0,0 +1,50 @@
+package supplement
+
+import "strings"
+
+const (
+	RuleGtin     = "gtin"
+	RuleRequired = "required"
+	RuleMin      = "min"
+	RuleMax      = "max"
+	RuleScale    = "scale"
+	RuleCategory = "category"
+	RuleRange    = "range"
+	RuleOneOf    = "oneOf"
+	RuleType     = "type"
+	RuleUnique   = "unique"
+)
+
+type Violation struct {
+	Field   string `json:"field"`
+	Rule    string `json:"rule"`
+	Value   any    `json:"value"`
+	Message string `json:"message"`
+}
+
+// ValidationError lists every rule a supplement, query or import file
+// breaks. It unwraps to ErrInvalidSupplement, ErrInvalidQuery or
+// ErrInvalidImport, so errors.Is keeps working.
+type ValidationError struct {
+	Err        error
+	Violations []Violation
+}
+
+func (e *ValidationError) Error() string {
+	messages := make([]string, len(e.Violations))
+	for i, v := range e.Violations {
+		messages[i] = v.Message
+	}
+	return e.Err.Error() + ": " + strings.Join(messages, "; ")
+}
+
+func (e *ValidationError) Unwrap() error {
+	return e.Err
+}
+
+func newValidationError(err error, violations []Violation) error {
+	if len(violations) == 0 {
+		return nil
+	}
+	return &ValidationError{Err: err, Violations: violations}
+}
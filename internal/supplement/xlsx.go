@@ -0,0 +1,114 @@
+package supplement
+
+import (
+	"archive/zip"
+	"bufio"
+	"encoding/xml"
+	"io"
+	"strconv"
+)
+
+// xlsxParts are the parts of a workbook with a single sheet, other than the
+// sheet itself.
+var xlsxParts = []struct{ name, content string }{
+	{"[Content_Types].xml", xml.Header + `<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">` +
+		`<Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/>` +
+		`<Default Extension="xml" ContentType="application/xml"/>` +
+		`<Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/>` +
+		`<Override PartName="/xl/worksheets/sheet1.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/>` +
+		`</Types>`},
+	{"_rels/.rels", xml.Header + `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+		`<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/>` +
+		`</Relationships>`},
+	{"xl/workbook.xml", xml.Header + `<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships">` +
+		`<sheets><sheet name="Supplements" sheetId="1" r:id="rId1"/></sheets>` +
+		`</workbook>`},
+	{"xl/_rels/workbook.xml.rels", xml.Header + `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+		`<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet1.xml"/>` +
+		`</Relationships>`},
+}
+
+// xlsxWriter writes the sheet row by row, so that only the compressor's
+// window is held in memory. Amounts of nutrients and micronutrients are
+// number cells, in the unit they are stored in, and the rest text cells.
+type xlsxWriter struct {
+	archive *zip.Writer
+	sheet   *bufio.Writer
+}
+
+func newXLSXWriter(w io.Writer) *xlsxWriter {
+	return &xlsxWriter{archive: zip.NewWriter(w)}
+}
+
+func (w *xlsxWriter) start() error {
+	if w.sheet != nil {
+		return nil
+	}
+
+	for _, part := range xlsxParts {
+		f, err := w.archive.Create(part.name)
+		if err != nil {
+			return err
+		}
+		if _, err := io.WriteString(f, part.content); err != nil {
+			return err
+		}
+	}
+
+	f, err := w.archive.Create("xl/worksheets/sheet1.xml")
+	if err != nil {
+		return err
+	}
+	w.sheet = bufio.NewWriter(f)
+	w.sheet.WriteString(xml.Header + `<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData>`)
+
+	header := make([]any, len(CSVColumns))
+	for i, column := range CSVColumns {
+		header[i] = column
+	}
+	return w.writeRow(header)
+}
+
+func (w *xlsxWriter) writeRow(cells []any) error {
+	w.sheet.WriteString("<row>")
+	for _, cell := range cells {
+		switch cell := cell.(type) {
+		case Quantity:
+			w.sheet.WriteString("<c><v>" + strconv.FormatFloat(cell.Amount, 'f', -1, 64) + "</v></c>")
+		case int:
+			w.sheet.WriteString("<c><v>" + strconv.Itoa(cell) + "</v></c>")
+		case string:
+			if cell == "" {
+				// Cells carry no reference, so empty ones keep the next in
+				// their column.
+				w.sheet.WriteString("<c/>")
+				continue
+			}
+			w.sheet.WriteString(`<c t="inlineStr"><is><t xml:space="preserve">`)
+			if err := xml.EscapeText(w.sheet, []byte(cell)); err != nil {
+				return err
+			}
+			w.sheet.WriteString("</t></is></c>")
+		}
+	}
+	_, err := w.sheet.WriteString("</row>")
+	return err
+}
+
+func (w *xlsxWriter) Write(s Supplement) error {
+	if err := w.start(); err != nil {
+		return err
+	}
+	return w.writeRow(csvCells(s))
+}
+
+func (w *xlsxWriter) Close() error {
+	if err := w.start(); err != nil {
+		return err
+	}
+	w.sheet.WriteString("</sheetData></worksheet>")
+	if err := w.sheet.Flush(); err != nil {
+		return err
+	}
+	return w.archive.Close()
+}
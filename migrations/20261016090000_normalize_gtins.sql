@@ -0,0 +1,33 @@
+-- +goose Up
+-- A GTIN with an invalid check digit would be padded into a key the service
+-- rejects, leaving its row listed but impossible to find, update or delete,
+-- so such rows have to be fixed or removed first.
+-- +goose StatementBegin
+DO $$
+DECLARE
+    invalid TEXT;
+BEGIN
+    SELECT string_agg(s.gtin, ', ' ORDER BY s.gtin) INTO invalid
+    FROM Supplements s, LATERAL (SELECT lpad(s.gtin, 14, '0') AS gtin) padded
+    WHERE s.gtin ~ '^(\d{8}|\d{12}|\d{13})$'
+        AND (10 - (
+            SELECT sum(substr(padded.gtin, i, 1)::INT * CASE WHEN i % 2 = 1 THEN 3 ELSE 1 END)
+            FROM generate_series(1, 13) AS i
+        ) % 10) % 10 <> substr(padded.gtin, 14, 1)::INT;
+
+    IF invalid IS NOT NULL THEN
+        RAISE EXCEPTION 'supplements have GTINs with an invalid check digit: %', invalid
+            USING HINT = 'Fix or delete these rows, then migrate again.';
+    END IF;
+END
+$$;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+UPDATE Supplements SET gtin = lpad(gtin, 14, '0') WHERE gtin ~ '^(\d{8}|\d{12}|\d{13})$';
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+UPDATE Supplements SET gtin = substr(gtin, 2) WHERE gtin ~ '^0\d{13}$';
+-- +goose StatementEnd
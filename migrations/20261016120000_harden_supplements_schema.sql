@@ -0,0 +1,79 @@
+-- +goose Up
+-- +goose StatementBegin
+UPDATE Supplements SET
+    carbohydrates = coalesce(carbohydrates, 0),
+    electrolytes = coalesce(electrolytes, 0),
+    maltodextrose = coalesce(maltodextrose, 0),
+    fructose = coalesce(fructose, 0),
+    caffeine = coalesce(caffeine, 0),
+    sodium = coalesce(sodium, 0),
+    protein = coalesce(protein, 0)
+WHERE carbohydrates IS NULL OR electrolytes IS NULL OR maltodextrose IS NULL OR fructose IS NULL OR caffeine IS NULL OR sodium IS NULL OR protein IS NULL;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+ALTER TABLE Supplements
+    ALTER COLUMN gtin SET NOT NULL,
+    ALTER COLUMN name SET NOT NULL,
+    ALTER COLUMN brand SET NOT NULL,
+    ALTER COLUMN flavor SET NOT NULL,
+    ALTER COLUMN carbohydrates TYPE NUMERIC(10, 3) USING round(carbohydrates::numeric, 3),
+    ALTER COLUMN electrolytes TYPE NUMERIC(10, 3) USING round(electrolytes::numeric, 3),
+    ALTER COLUMN maltodextrose TYPE NUMERIC(10, 3) USING round(maltodextrose::numeric, 3),
+    ALTER COLUMN fructose TYPE NUMERIC(10, 3) USING round(fructose::numeric, 3),
+    ALTER COLUMN caffeine TYPE NUMERIC(10, 3) USING round(caffeine::numeric, 3),
+    ALTER COLUMN sodium TYPE NUMERIC(10, 3) USING round(sodium::numeric, 3),
+    ALTER COLUMN protein TYPE NUMERIC(10, 3) USING round(protein::numeric, 3),
+    ALTER COLUMN carbohydrates SET NOT NULL,
+    ALTER COLUMN electrolytes SET NOT NULL,
+    ALTER COLUMN maltodextrose SET NOT NULL,
+    ALTER COLUMN fructose SET NOT NULL,
+    ALTER COLUMN caffeine SET NOT NULL,
+    ALTER COLUMN sodium SET NOT NULL,
+    ALTER COLUMN protein SET NOT NULL,
+    ADD CONSTRAINT supplements_gtin_check CHECK (char_length(gtin) = 14 AND gtin ~ '^[0-9]+$'),
+    ADD CONSTRAINT supplements_name_check CHECK (name <> ''),
+    ADD CONSTRAINT supplements_brand_check CHECK (brand <> ''),
+    ADD CONSTRAINT supplements_flavor_check CHECK (flavor <> ''),
+    ADD CONSTRAINT supplements_carbohydrates_check CHECK (carbohydrates >= 0),
+    ADD CONSTRAINT supplements_electrolytes_check CHECK (electrolytes >= 0),
+    ADD CONSTRAINT supplements_maltodextrose_check CHECK (maltodextrose >= 0),
+    ADD CONSTRAINT supplements_fructose_check CHECK (fructose >= 0),
+    ADD CONSTRAINT supplements_caffeine_check CHECK (caffeine >= 0),
+    ADD CONSTRAINT supplements_sodium_check CHECK (sodium >= 0),
+    ADD CONSTRAINT supplements_protein_check CHECK (protein >= 0);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE Supplements
+    DROP CONSTRAINT supplements_gtin_check,
+    DROP CONSTRAINT supplements_name_check,
+    DROP CONSTRAINT supplements_brand_check,
+    DROP CONSTRAINT supplements_flavor_check,
+    DROP CONSTRAINT supplements_carbohydrates_check,
+    DROP CONSTRAINT supplements_electrolytes_check,
+    DROP CONSTRAINT supplements_maltodextrose_check,
+    DROP CONSTRAINT supplements_fructose_check,
+    DROP CONSTRAINT supplements_caffeine_check,
+    DROP CONSTRAINT supplements_sodium_check,
+    DROP CONSTRAINT supplements_protein_check,
+    ALTER COLUMN carbohydrates DROP NOT NULL,
+    ALTER COLUMN electrolytes DROP NOT NULL,
+    ALTER COLUMN maltodextrose DROP NOT NULL,
+    ALTER COLUMN fructose DROP NOT NULL,
+    ALTER COLUMN caffeine DROP NOT NULL,
+    ALTER COLUMN sodium DROP NOT NULL,
+    ALTER COLUMN protein DROP NOT NULL,
+    ALTER COLUMN carbohydrates TYPE REAL,
+    ALTER COLUMN electrolytes TYPE REAL,
+    ALTER COLUMN maltodextrose TYPE REAL,
+    ALTER COLUMN fructose TYPE REAL,
+    ALTER COLUMN caffeine TYPE REAL,
+    ALTER COLUMN sodium TYPE REAL,
+    ALTER COLUMN protein TYPE REAL,
+    ALTER COLUMN gtin DROP NOT NULL,
+    ALTER COLUMN name DROP NOT NULL,
+    ALTER COLUMN brand DROP NOT NULL,
+    ALTER COLUMN flavor DROP NOT NULL;
+-- +goose StatementEnd
@@ -0,0 +1,27 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE Supplements
+    ADD COLUMN serving_size NUMERIC(10, 3) CHECK (serving_size > 0),
+    ADD COLUMN serving_unit VARCHAR CHECK (serving_unit IN ('g', 'ml')),
+    ADD COLUMN servings_per_package INTEGER CHECK (servings_per_package >= 1),
+    ADD CONSTRAINT supplements_serving_check CHECK (num_nulls(serving_size, serving_unit, servings_per_package) IN (0, 3));
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+COMMENT ON COLUMN Supplements.carbohydrates IS 'grams per serving';
+COMMENT ON COLUMN Supplements.electrolytes IS 'milligrams per serving';
+COMMENT ON COLUMN Supplements.maltodextrose IS 'grams per serving';
+COMMENT ON COLUMN Supplements.fructose IS 'grams per serving';
+COMMENT ON COLUMN Supplements.caffeine IS 'milligrams per serving';
+COMMENT ON COLUMN Supplements.sodium IS 'milligrams per serving';
+COMMENT ON COLUMN Supplements.protein IS 'grams per serving';
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE Supplements
+    DROP CONSTRAINT supplements_serving_check,
+    DROP COLUMN serving_size,
+    DROP COLUMN serving_unit,
+    DROP COLUMN servings_per_package;
+-- +goose StatementEnd
@@ -0,0 +1,34 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE supplement_ingredients (
+    supplement_id INT NOT NULL REFERENCES Supplements (id) ON DELETE CASCADE,
+    position INT NOT NULL CHECK (position >= 0),
+    name VARCHAR NOT NULL CHECK (name <> ''),
+    PRIMARY KEY (supplement_id, position)
+);
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+CREATE TABLE supplement_allergens (
+    supplement_id INT NOT NULL REFERENCES Supplements (id) ON DELETE CASCADE,
+    allergen VARCHAR NOT NULL CHECK (allergen IN (
+        'gluten', 'wheat', 'crustaceans', 'eggs', 'fish', 'peanuts', 'soy', 'milk',
+        'tree-nuts', 'celery', 'mustard', 'sesame', 'sulphites', 'lupin', 'molluscs'
+    )),
+    presence VARCHAR NOT NULL CHECK (presence IN ('contains', 'may-contain')),
+    PRIMARY KEY (supplement_id, allergen)
+);
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+CREATE INDEX supplement_allergens_allergen_idx ON supplement_allergens (allergen);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE supplement_allergens;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+DROP TABLE supplement_ingredients;
+-- +goose StatementEnd
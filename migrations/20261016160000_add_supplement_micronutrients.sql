@@ -0,0 +1,45 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE micronutrients (
+    code VARCHAR PRIMARY KEY,
+    unit VARCHAR NOT NULL CHECK (unit IN ('g', 'mg', 'mcg'))
+);
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+INSERT INTO micronutrients (code, unit) VALUES
+    ('potassium', 'mg'),
+    ('magnesium', 'mg'),
+    ('calcium', 'mg'),
+    ('chloride', 'mg'),
+    ('iron', 'mg'),
+    ('zinc', 'mg'),
+    ('vitamin-b1', 'mg'),
+    ('vitamin-b6', 'mg'),
+    ('vitamin-b12', 'mcg'),
+    ('vitamin-c', 'mg'),
+    ('vitamin-d', 'mcg'),
+    ('vitamin-e', 'mg');
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+CREATE TABLE supplement_micronutrients (
+    supplement_id INT NOT NULL REFERENCES Supplements (id) ON DELETE CASCADE,
+    code VARCHAR NOT NULL REFERENCES micronutrients (code),
+    amount NUMERIC(10, 3) NOT NULL CHECK (amount >= 0),
+    PRIMARY KEY (supplement_id, code)
+);
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+COMMENT ON COLUMN supplement_micronutrients.amount IS 'per serving, in the unit of the micronutrient';
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE supplement_micronutrients;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+DROP TABLE micronutrients;
+-- +goose StatementEnd
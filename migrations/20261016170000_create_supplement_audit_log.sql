@@ -0,0 +1,39 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE supplement_audit_log (
+    id BIGINT GENERATED ALWAYS AS IDENTITY PRIMARY KEY,
+    gtin VARCHAR NOT NULL,
+    version BIGINT NOT NULL,
+    operation VARCHAR NOT NULL CHECK (operation IN ('create', 'update', 'delete')),
+    actor VARCHAR NOT NULL CHECK (actor <> ''),
+    at TIMESTAMPTZ NOT NULL,
+    changes JSONB NOT NULL
+);
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+CREATE INDEX supplement_audit_log_gtin_idx ON supplement_audit_log (gtin, id);
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+CREATE FUNCTION supplement_audit_log_append_only() RETURNS trigger AS $$
+BEGIN
+    RAISE EXCEPTION 'supplement_audit_log is append-only';
+END;
+$$ LANGUAGE plpgsql;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+CREATE TRIGGER supplement_audit_log_append_only
+    BEFORE UPDATE OR DELETE ON supplement_audit_log
+    FOR EACH STATEMENT EXECUTE FUNCTION supplement_audit_log_append_only();
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE supplement_audit_log;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+DROP FUNCTION supplement_audit_log_append_only;
+-- +goose StatementEnd
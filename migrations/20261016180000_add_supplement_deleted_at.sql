@@ -0,0 +1,28 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE Supplements ADD COLUMN deleted_at TIMESTAMPTZ;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+CREATE INDEX supplements_deleted_at_idx ON Supplements (deleted_at) WHERE deleted_at IS NOT NULL;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+ALTER TABLE supplement_audit_log DROP CONSTRAINT supplement_audit_log_operation_check;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+ALTER TABLE supplement_audit_log ADD CONSTRAINT supplement_audit_log_operation_check
+    CHECK (operation IN ('create', 'update', 'delete', 'restore', 'purge'));
+-- +goose StatementEnd
+
+-- +goose Down
+-- The audit log is append-only, so its restore and purge entries, and the
+-- check allowing them, stay. Tombstones are deleted as they were before.
+-- +goose StatementBegin
+DELETE FROM Supplements WHERE deleted_at IS NOT NULL;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+ALTER TABLE Supplements DROP COLUMN deleted_at;
+-- +goose StatementEnd
@@ -0,0 +1,49 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE EXTENSION IF NOT EXISTS unaccent;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+CREATE EXTENSION IF NOT EXISTS pg_trgm;
+-- +goose StatementEnd
+
+-- unaccent() is only stable, as its dictionary could change, so generated
+-- columns and indexes go through this immutable wrapper naming the
+-- dictionary.
+-- +goose StatementBegin
+CREATE FUNCTION supplement_search_text(name TEXT, brand TEXT, flavor TEXT) RETURNS TEXT
+    LANGUAGE sql IMMUTABLE PARALLEL SAFE STRICT
+    AS $$ SELECT lower(public.unaccent('public.unaccent'::regdictionary, name || ' ' || brand || ' ' || flavor)) $$;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+ALTER TABLE Supplements ADD COLUMN search_text TEXT
+    GENERATED ALWAYS AS (supplement_search_text(name, brand, flavor)) STORED;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+ALTER TABLE Supplements ADD COLUMN search_document TSVECTOR
+    GENERATED ALWAYS AS (to_tsvector('simple', supplement_search_text(name, brand, flavor))) STORED;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+CREATE INDEX supplements_search_document_idx ON Supplements USING GIN (search_document);
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+CREATE INDEX supplements_search_text_idx ON Supplements USING GIN (search_text gin_trgm_ops);
+-- +goose StatementEnd
+
+-- +goose Down
+-- The extensions stay, as other objects of the database may use them.
+-- +goose StatementBegin
+ALTER TABLE Supplements DROP COLUMN search_document;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+ALTER TABLE Supplements DROP COLUMN search_text;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+DROP FUNCTION supplement_search_text(TEXT, TEXT, TEXT);
+-- +goose StatementEnd
@@ -0,0 +1,74 @@
+// Package migrations embeds the goose SQL migrations so the binaries can
+// inspect and apply them without the files being shipped next to them.
+// Postgres migrations live at the top level, SQLite ones under sqlite/.
+package migrations
+
+import (
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"strconv"
+	"strings"
+)
+
+//go:embed *.sql
+var Postgres embed.FS
+
+//go:embed sqlite/*.sql
+var sqlite embed.FS
+
+// SQLite holds the SQLite migrations at its root, as goose expects.
+var SQLite = mustSub(sqlite, "sqlite")
+
+var (
+	ErrSchemaAhead  = errors.New("database schema is newer than this binary")
+	ErrSchemaBehind = errors.New("database schema has pending migrations")
+)
+
+// Latest returns the version of the newest migration in migrations, i.e. the
+// schema version this build of the application expects to find.
+func Latest(migrations fs.FS) (int64, error) {
+	files, err := fs.Glob(migrations, "*.sql")
+	if err != nil {
+		return 0, err
+	}
+
+	var latest int64
+	for _, file := range files {
+		prefix, _, _ := strings.Cut(file, "_")
+		version, err := strconv.ParseInt(prefix, 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("migration %q has no numeric version prefix", file)
+		}
+		latest = max(latest, version)
+	}
+
+	return latest, nil
+}
+
+// Compare checks the version applied to a database against the newest
+// migration in migrations, returning ErrSchemaAhead or ErrSchemaBehind when
+// they differ.
+func Compare(current int64, migrations fs.FS) error {
+	latest, err := Latest(migrations)
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case current > latest:
+		return fmt.Errorf("%w: it is at version %d, the newest migration is %d", ErrSchemaAhead, current, latest)
+	case current < latest:
+		return fmt.Errorf("%w: it is at version %d, the newest migration is %d", ErrSchemaBehind, current, latest)
+	}
+	return nil
+}
+
+func mustSub(fsys fs.FS, dir string) fs.FS {
+	sub, err := fs.Sub(fsys, dir)
+	if err != nil {
+		panic(err)
+	}
+	return sub
+}
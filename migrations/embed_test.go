@@ -0,0 +1,80 @@
+package migrations_test
+
+import (
+	"errors"
+	"io/fs"
+	"testing"
+	"testing/fstest"
+
+	"github.com/marioromandono/supplementapp/migrations"
+)
+
+var testMigrations = fstest.MapFS{
+	"20240410125348_create_supplements_table.sql": {},
+	"20261016090000_normalize_gtins.sql":          {},
+	"20261016100000_add_supplement_version.sql":   {},
+	"sqlite/20261016110000_create_table.sql":      {},
+}
+
+func TestLatest(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name       string
+		migrations fstest.MapFS
+		want       int64
+		wantErr    bool
+	}{
+		{name: "newest", migrations: testMigrations, want: 20261016100000},
+		{name: "none", migrations: fstest.MapFS{}, want: 0},
+		{name: "no version", migrations: fstest.MapFS{"create_table.sql": {}}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			got, err := migrations.Latest(tt.migrations)
+
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Latest() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("Latest() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCompare(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name    string
+		current int64
+		wantErr error
+	}{
+		{name: "equal", current: 20261016100000, wantErr: nil},
+		{name: "behind", current: 20261016090000, wantErr: migrations.ErrSchemaBehind},
+		{name: "never migrated", current: 0, wantErr: migrations.ErrSchemaBehind},
+		{name: "ahead", current: 20261016110000, wantErr: migrations.ErrSchemaAhead},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			err := migrations.Compare(tt.current, testMigrations)
+
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("Compare(%d) error = %v, wantErr %v", tt.current, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// TestEmbedded checks that every embedded migration has a version, so that
+// Latest, and with it the schema check at startup, works on them.
+func TestEmbedded(t *testing.T) {
+	t.Parallel()
+	for name, fsys := range map[string]fs.FS{"postgres": migrations.Postgres, "sqlite": migrations.SQLite} {
+		latest, err := migrations.Latest(fsys)
+		if err != nil || latest == 0 {
+			t.Errorf("Latest(%s) = %d, %v, want a version", name, latest, err)
+		}
+	}
+}
@@ -0,0 +1,23 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE Supplements (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    gtin TEXT UNIQUE,
+    name TEXT,
+    brand TEXT,
+    flavor TEXT,
+    carbohydrates REAL,
+    electrolytes REAL,
+    maltodextrose REAL,
+    fructose REAL,
+    caffeine REAL,
+    sodium REAL,
+    protein REAL,
+    version INTEGER NOT NULL DEFAULT 1
+);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE Supplements;
+-- +goose StatementEnd
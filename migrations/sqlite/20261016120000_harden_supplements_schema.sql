@@ -0,0 +1,71 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE Supplements_hardened (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    gtin TEXT NOT NULL UNIQUE CHECK (length(gtin) = 14 AND gtin NOT GLOB '*[^0-9]*'),
+    name TEXT NOT NULL CHECK (name <> ''),
+    brand TEXT NOT NULL CHECK (brand <> ''),
+    flavor TEXT NOT NULL CHECK (flavor <> ''),
+    carbohydrates REAL NOT NULL CHECK (carbohydrates >= 0),
+    electrolytes REAL NOT NULL CHECK (electrolytes >= 0),
+    maltodextrose REAL NOT NULL CHECK (maltodextrose >= 0),
+    fructose REAL NOT NULL CHECK (fructose >= 0),
+    caffeine REAL NOT NULL CHECK (caffeine >= 0),
+    sodium REAL NOT NULL CHECK (sodium >= 0),
+    protein REAL NOT NULL CHECK (protein >= 0),
+    version INTEGER NOT NULL DEFAULT 1
+);
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+INSERT INTO Supplements_hardened
+SELECT id, gtin, name, brand, flavor,
+    round(coalesce(carbohydrates, 0), 3),
+    round(coalesce(electrolytes, 0), 3),
+    round(coalesce(maltodextrose, 0), 3),
+    round(coalesce(fructose, 0), 3),
+    round(coalesce(caffeine, 0), 3),
+    round(coalesce(sodium, 0), 3),
+    round(coalesce(protein, 0), 3),
+    version
+FROM Supplements;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+DROP TABLE Supplements;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+ALTER TABLE Supplements_hardened RENAME TO Supplements;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+CREATE TABLE Supplements_unhardened (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    gtin TEXT UNIQUE,
+    name TEXT,
+    brand TEXT,
+    flavor TEXT,
+    carbohydrates REAL,
+    electrolytes REAL,
+    maltodextrose REAL,
+    fructose REAL,
+    caffeine REAL,
+    sodium REAL,
+    protein REAL,
+    version INTEGER NOT NULL DEFAULT 1
+);
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+INSERT INTO Supplements_unhardened SELECT * FROM Supplements;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+DROP TABLE Supplements;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+ALTER TABLE Supplements_unhardened RENAME TO Supplements;
+-- +goose StatementEnd
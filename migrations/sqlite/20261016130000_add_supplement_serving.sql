@@ -0,0 +1,30 @@
+-- +goose Up
+-- Nutrient amounts are per serving: carbohydrates, maltodextrose, fructose and
+-- protein in grams, electrolytes, caffeine and sodium in milligrams.
+-- +goose StatementBegin
+ALTER TABLE Supplements ADD COLUMN serving_size REAL CHECK (serving_size > 0);
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+ALTER TABLE Supplements ADD COLUMN serving_unit TEXT CHECK (serving_unit IN ('g', 'ml'));
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+ALTER TABLE Supplements ADD COLUMN servings_per_package INTEGER CHECK (
+    (serving_size IS NULL AND serving_unit IS NULL AND servings_per_package IS NULL)
+    OR (serving_size IS NOT NULL AND serving_unit IS NOT NULL AND servings_per_package >= 1)
+);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE Supplements DROP COLUMN servings_per_package;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+ALTER TABLE Supplements DROP COLUMN serving_unit;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+ALTER TABLE Supplements DROP COLUMN serving_size;
+-- +goose StatementEnd
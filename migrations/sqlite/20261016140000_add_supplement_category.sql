@@ -0,0 +1,18 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE Supplements ADD COLUMN category TEXT
+    CHECK (category IN ('gel', 'drink-mix', 'bar', 'chew', 'capsule', 'tablet', 'powder'));
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+CREATE INDEX supplements_category_idx ON Supplements (category);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX supplements_category_idx;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+ALTER TABLE Supplements DROP COLUMN category;
+-- +goose StatementEnd
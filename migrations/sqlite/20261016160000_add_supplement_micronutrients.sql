@@ -0,0 +1,41 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE micronutrients (
+    code TEXT PRIMARY KEY,
+    unit TEXT NOT NULL CHECK (unit IN ('g', 'mg', 'mcg'))
+);
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+INSERT INTO micronutrients (code, unit) VALUES
+    ('potassium', 'mg'),
+    ('magnesium', 'mg'),
+    ('calcium', 'mg'),
+    ('chloride', 'mg'),
+    ('iron', 'mg'),
+    ('zinc', 'mg'),
+    ('vitamin-b1', 'mg'),
+    ('vitamin-b6', 'mg'),
+    ('vitamin-b12', 'mcg'),
+    ('vitamin-c', 'mg'),
+    ('vitamin-d', 'mcg'),
+    ('vitamin-e', 'mg');
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+CREATE TABLE supplement_micronutrients (
+    supplement_id INTEGER NOT NULL REFERENCES Supplements (id) ON DELETE CASCADE,
+    code TEXT NOT NULL REFERENCES micronutrients (code),
+    amount REAL NOT NULL CHECK (amount >= 0),
+    PRIMARY KEY (supplement_id, code)
+);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE supplement_micronutrients;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+DROP TABLE micronutrients;
+-- +goose StatementEnd
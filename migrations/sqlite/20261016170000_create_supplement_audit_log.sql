@@ -0,0 +1,35 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE supplement_audit_log (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    gtin TEXT NOT NULL,
+    version INTEGER NOT NULL,
+    operation TEXT NOT NULL CHECK (operation IN ('create', 'update', 'delete')),
+    actor TEXT NOT NULL CHECK (actor <> ''),
+    at TEXT NOT NULL,
+    changes TEXT NOT NULL CHECK (json_valid(changes))
+);
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+CREATE INDEX supplement_audit_log_gtin_idx ON supplement_audit_log (gtin, id);
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+CREATE TRIGGER supplement_audit_log_no_update BEFORE UPDATE ON supplement_audit_log
+BEGIN
+    SELECT RAISE(ABORT, 'supplement_audit_log is append-only');
+END;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+CREATE TRIGGER supplement_audit_log_no_delete BEFORE DELETE ON supplement_audit_log
+BEGIN
+    SELECT RAISE(ABORT, 'supplement_audit_log is append-only');
+END;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE supplement_audit_log;
+-- +goose StatementEnd
@@ -0,0 +1,75 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE Supplements ADD COLUMN deleted_at TEXT;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+CREATE INDEX supplements_deleted_at_idx ON Supplements (deleted_at) WHERE deleted_at IS NOT NULL;
+-- +goose StatementEnd
+
+-- SQLite cannot alter a check constraint, so the audit log is rebuilt with
+-- the new operations, its append-only triggers set aside while it is copied.
+-- +goose StatementBegin
+DROP TRIGGER supplement_audit_log_no_update;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+DROP TRIGGER supplement_audit_log_no_delete;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+CREATE TABLE supplement_audit_log_rebuilt (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    gtin TEXT NOT NULL,
+    version INTEGER NOT NULL,
+    operation TEXT NOT NULL CHECK (operation IN ('create', 'update', 'delete', 'restore', 'purge')),
+    actor TEXT NOT NULL CHECK (actor <> ''),
+    at TEXT NOT NULL,
+    changes TEXT NOT NULL CHECK (json_valid(changes))
+);
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+INSERT INTO supplement_audit_log_rebuilt SELECT * FROM supplement_audit_log;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+DROP TABLE supplement_audit_log;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+ALTER TABLE supplement_audit_log_rebuilt RENAME TO supplement_audit_log;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+CREATE INDEX supplement_audit_log_gtin_idx ON supplement_audit_log (gtin, id);
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+CREATE TRIGGER supplement_audit_log_no_update BEFORE UPDATE ON supplement_audit_log
+BEGIN
+    SELECT RAISE(ABORT, 'supplement_audit_log is append-only');
+END;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+CREATE TRIGGER supplement_audit_log_no_delete BEFORE DELETE ON supplement_audit_log
+BEGIN
+    SELECT RAISE(ABORT, 'supplement_audit_log is append-only');
+END;
+-- +goose StatementEnd
+
+-- +goose Down
+-- The audit log is append-only, so its restore and purge entries, and the
+-- check allowing them, stay. Tombstones are deleted as they were before.
+-- +goose StatementBegin
+DELETE FROM Supplements WHERE deleted_at IS NOT NULL;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+DROP INDEX supplements_deleted_at_idx;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+ALTER TABLE Supplements DROP COLUMN deleted_at;
+-- +goose StatementEnd